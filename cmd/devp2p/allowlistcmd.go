@@ -0,0 +1,77 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of go-themis.
+//
+// go-themis is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-themis is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-themis. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/themis-network/go-themis/cmd/utils"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/p2p/permission"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	allowlistCommand = cli.Command{
+		Name:  "allowlist",
+		Usage: "Node allowlist commands",
+		Subcommands: []cli.Command{
+			allowlistSignCommand,
+		},
+	}
+	allowlistSignCommand = cli.Command{
+		Name:      "sign",
+		Usage:     "sign a node allowlist file",
+		ArgsUsage: "<allowlist-file> <key-file>",
+		Description: `
+Sign the allowlist file of permissioned mode with the hex-encoded private key in
+key-file. The sequence number of the list is incremented before signing, nodes
+reject lists with a lower sequence number than the last one they loaded. The
+signature is stored in the file, and the signing account is printed. Nodes
+started with --permissioned.signer set to that account accept the file.`,
+		Action: allowlistSign,
+	}
+)
+
+func allowlistSign(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("need allowlist file and key file as arguments")
+	}
+	file, keyfile := ctx.Args().Get(0), ctx.Args().Get(1)
+
+	var list permission.Allowlist
+	if err := loadJSON(file, &list); err != nil {
+		utils.Fatalf("Failed to load allowlist: %v", err)
+	}
+	for _, n := range list.Nodes {
+		if err := permission.ValidateRoles(n.Roles); err != nil {
+			utils.Fatalf("Invalid node %x: %v", n.ID[:8], err)
+		}
+	}
+	key, err := crypto.LoadECDSA(keyfile)
+	if err != nil {
+		utils.Fatalf("Failed to load key: %v", err)
+	}
+	list.Seq++
+	if err := list.Sign(key); err != nil {
+		utils.Fatalf("Can't sign allowlist: %v", err)
+	}
+	writeJSON(file, &list)
+	fmt.Println("Signer:", crypto.PubkeyToAddress(key.PublicKey).Hex())
+	fmt.Println("Sequence:", list.Seq)
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of go-themis.
+//
+// go-themis is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-themis is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-themis. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/p2p/permission"
+)
+
+func TestAllowlistSign(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "devp2p-test")
+	if err != nil {
+		t.Fatal("Can't create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	key, _ := crypto.GenerateKey()
+	keyfile := filepath.Join(tmpdir, "the-keyfile")
+	if err := crypto.SaveECDSA(keyfile, key); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(tmpdir, "permissioned-nodes.json")
+	writeJSON(file, &permission.Allowlist{Nodes: []permission.AllowlistNode{
+		{ID: discover.NodeID{1}, Roles: []string{permission.RoleSigner}},
+	}})
+
+	sign := runDevp2p(t, "allowlist", "sign", file, keyfile)
+	sign.Expect("Signer: " + crypto.PubkeyToAddress(key.PublicKey).Hex() + "\nSequence: 1\n")
+	sign.ExpectExit()
+
+	src := permission.NewFileSource(file, crypto.PubkeyToAddress(key.PublicKey))
+	if entries, err := src.Entries(); err != nil || len(entries) != 1 {
+		t.Fatalf("signed allowlist not accepted: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of go-themis.
+//
+// go-themis is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-themis is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-themis. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/themis-network/go-themis/cmd/utils"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/p2p/dnsdisc"
+	"github.com/themis-network/go-themis/p2p/enr"
+	"gopkg.in/urfave/cli.v1"
+)
+
+const (
+	treeInfoFile  = "enrtree-info.json"
+	treeNodesFile = "nodes.json"
+)
+
+var (
+	dnsCommand = cli.Command{
+		Name:  "dns",
+		Usage: "DNS discovery commands",
+		Subcommands: []cli.Command{
+			dnsSignCommand,
+			dnsToTXTCommand,
+		},
+	}
+	dnsSignCommand = cli.Command{
+		Name:      "sign",
+		Usage:     "sign a DNS discovery tree",
+		ArgsUsage: "<tree-directory> <key-file> <domain>",
+		Description: `
+Sign the node list in the tree directory with the hex-encoded private key in
+key-file. The sequence number, signature and enrtree:// URL of the tree are
+stored in the ` + treeInfoFile + ` file of the directory.`,
+		Flags: []cli.Flag{
+			cli.UintFlag{
+				Name:  "seq",
+				Usage: "sequence number of the tree (default: previous sequence number + 1)",
+			},
+		},
+		Action: dnsSign,
+	}
+	dnsToTXTCommand = cli.Command{
+		Name:      "to-txt",
+		Usage:     "create DNS TXT records for a discovery tree",
+		ArgsUsage: "<tree-directory> [output-file]",
+		Description: `
+Print the TXT records of a signed tree as a JSON object mapping names to
+record content. If output-file is given, the JSON is written to that file.`,
+		Action: dnsToTXT,
+	}
+)
+
+// treeInfo is the content of the tree info file.
+type treeInfo struct {
+	URL   string   `json:"url,omitempty"`
+	Seq   uint     `json:"seq"`
+	Sig   string   `json:"sig,omitempty"`
+	Links []string `json:"links,omitempty"`
+}
+
+// dnsSign signs a tree and updates its info file.
+func dnsSign(ctx *cli.Context) error {
+	if ctx.NArg() != 3 {
+		return fmt.Errorf("need tree directory, key file and domain as arguments")
+	}
+	var (
+		dir     = ctx.Args().Get(0)
+		keyfile = ctx.Args().Get(1)
+		domain  = ctx.Args().Get(2)
+	)
+	info, nodes := loadTreeDefinition(dir)
+	key, err := crypto.LoadECDSA(keyfile)
+	if err != nil {
+		utils.Fatalf("Failed to load key: %v", err)
+	}
+	if ctx.IsSet("seq") {
+		info.Seq = ctx.Uint("seq")
+	} else {
+		info.Seq++
+	}
+	tree, err := dnsdisc.MakeTree(info.Seq, nodes, info.Links)
+	if err != nil {
+		utils.Fatalf("Invalid tree: %v", err)
+	}
+	url, err := tree.Sign(key, domain)
+	if err != nil {
+		utils.Fatalf("Can't sign tree: %v", err)
+	}
+	info.URL, info.Sig = url, tree.Signature()
+	writeJSON(filepath.Join(dir, treeInfoFile), info)
+	fmt.Println(url)
+	return nil
+}
+
+// dnsToTXT outputs the TXT records of a signed tree.
+func dnsToTXT(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree definition directory as argument")
+	}
+	info, nodes := loadTreeDefinition(ctx.Args().Get(0))
+	if info.URL == "" || info.Sig == "" {
+		utils.Fatalf("Tree is not signed, run 'dns sign' first")
+	}
+	domain, pubkey, err := dnsdisc.ParseURL(info.URL)
+	if err != nil {
+		utils.Fatalf("Invalid tree URL: %v", err)
+	}
+	tree, err := dnsdisc.MakeTree(info.Seq, nodes, info.Links)
+	if err != nil {
+		utils.Fatalf("Invalid tree: %v", err)
+	}
+	if err := tree.SetSignature(pubkey, info.Sig); err != nil {
+		utils.Fatalf("Tree signature doesn't match its content, run 'dns sign' again: %v", err)
+	}
+	records := tree.ToTXT(domain)
+	if output := ctx.Args().Get(1); output != "" {
+		writeJSON(output, records)
+	} else {
+		enc, _ := json.MarshalIndent(records, "", "  ")
+		fmt.Println(string(enc))
+	}
+	return nil
+}
+
+// loadTreeDefinition loads the info file and node list of a tree directory.
+// A missing info file is treated as an empty, unsigned tree.
+func loadTreeDefinition(dir string) (*treeInfo, []*enr.Record) {
+	info := new(treeInfo)
+	if err := loadJSON(filepath.Join(dir, treeInfoFile), info); err != nil && !os.IsNotExist(err) {
+		utils.Fatalf("Failed to load tree info: %v", err)
+	}
+	var texts []string
+	if err := loadJSON(filepath.Join(dir, treeNodesFile), &texts); err != nil {
+		utils.Fatalf("Failed to load node list: %v", err)
+	}
+	nodes := make([]*enr.Record, len(texts))
+	for i, text := range texts {
+		r, err := dnsdisc.ParseRecord(text)
+		if err != nil {
+			utils.Fatalf("Invalid node %d in %s: %v", i, treeNodesFile, err)
+		}
+		nodes[i] = r
+	}
+	return info, nodes
+}
+
+func loadJSON(file string, val interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, val); err != nil {
+		return fmt.Errorf("can't decode %s: %v", file, err)
+	}
+	return nil
+}
+
+func writeJSON(file string, val interface{}) {
+	enc, err := json.MarshalIndent(val, "", "  ")
+	if err != nil {
+		utils.Fatalf("Can't encode %s: %v", file, err)
+	}
+	if err := ioutil.WriteFile(file, append(enc, '\n'), 0644); err != nil {
+		utils.Fatalf("Can't write %s: %v", file, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of go-themis.
+//
+// go-themis is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-themis is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-themis. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/p2p/dnsdisc"
+	"github.com/themis-network/go-themis/p2p/enr"
+)
+
+func TestDNSSignToTXT(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "devp2p-test")
+	if err != nil {
+		t.Fatal("Can't create temporary directory:", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Create the signing key and the node list.
+	key, _ := crypto.GenerateKey()
+	keyfile := filepath.Join(tmpdir, "the-keyfile")
+	if err := crypto.SaveECDSA(keyfile, key); err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for i := 0; i < 3; i++ {
+		nodekey, _ := crypto.GenerateKey()
+		var r enr.Record
+		r.Set(enr.IP(net.IP{127, 0, 0, 1}))
+		r.Set(enr.TCP(30303 + i))
+		if err := enr.SignV4(&r, nodekey); err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, dnsdisc.RecordText(&r))
+	}
+	writeJSON(filepath.Join(tmpdir, treeNodesFile), texts)
+
+	// Sign the tree and create its records.
+	sign := runDevp2p(t, "dns", "sign", tmpdir, keyfile, "nodes.example.org")
+	sign.ExpectRegexp(`enrtree://[A-Z2-7]+@nodes\.example\.org\n`)
+	sign.ExpectExit()
+
+	output := filepath.Join(tmpdir, "txt.json")
+	runDevp2p(t, "dns", "to-txt", tmpdir, output).ExpectExit()
+
+	var records map[string]string
+	if err := loadJSON(output, &records); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := records["nodes.example.org"]; !ok {
+		t.Fatal("root record missing")
+	}
+	// root, ENR branch, three nodes and the empty link branch
+	if len(records) != 6 {
+		t.Errorf("wrong number of records %d, want 6", len(records))
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of go-themis.
+//
+// go-themis is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-themis is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-themis. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/consensus"
+	"github.com/themis-network/go-themis/consensus/clique"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/params"
+	"github.com/themis-network/go-themis/rlp"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var WitnessFlag = cli.StringFlag{
+	Name:  "witness",
+	Usage: "JSON file with the block witness (as returned by debug_getBlockWitness)",
+}
+
+var verifyBlockCommand = cli.Command{
+	Action:    verifyBlockCmd,
+	Name:      "verify-block",
+	Usage:     "statelessly re-executes a block from its witness and checks the post state",
+	ArgsUsage: "<block-rlp-file>",
+	Description: `
+The verify-block command re-executes a block on top of the parent header and the
+trie nodes contained in its witness, without access to a state database, and
+checks the resulting gas usage, receipts and post state root against the block.
+
+The block file must contain the hex encoded RLP of the block. The chain config
+is taken from the --prestate genesis file, defaulting to the Themis test network.`,
+	Flags: []cli.Flag{
+		WitnessFlag,
+	},
+}
+
+func verifyBlockCmd(ctx *cli.Context) error {
+	if len(ctx.Args().First()) == 0 {
+		return errors.New("path-to-block argument required")
+	}
+	if !ctx.IsSet(WitnessFlag.Name) {
+		return errors.New("--witness flag required")
+	}
+	// Load the block and its witness
+	hexblock, err := ioutil.ReadFile(ctx.Args().First())
+	if err != nil {
+		return fmt.Errorf("could not read block: %v", err)
+	}
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(common.FromHex(strings.TrimSpace(string(hexblock))), block); err != nil {
+		return fmt.Errorf("could not decode block: %v", err)
+	}
+	blob, err := ioutil.ReadFile(ctx.String(WitnessFlag.Name))
+	if err != nil {
+		return fmt.Errorf("could not read witness: %v", err)
+	}
+	witness := new(core.BlockWitness)
+	if err := json.Unmarshal(blob, witness); err != nil {
+		return fmt.Errorf("could not decode witness: %v", err)
+	}
+	// Assemble the chain rules the block is verified against
+	config := params.ThemisTestChainConfig
+	if ctx.GlobalString(GenesisFlag.Name) != "" {
+		config = readGenesis(ctx.GlobalString(GenesisFlag.Name)).Config
+	}
+	var engine consensus.Engine
+	if config.Clique != nil {
+		engine = clique.New(config.Clique, ethdb.NewMemDatabase())
+	} else {
+		engine = ethash.NewFaker()
+	}
+	if err := core.VerifyBlockWitness(config, engine, block, witness); err != nil {
+		return fmt.Errorf("block #%d [%x…] verification failed: %v", block.NumberU64(), block.Hash().Bytes()[:4], err)
+	}
+	fmt.Printf("block #%d [%x…] verified, state root %x\n", block.NumberU64(), block.Hash().Bytes()[:4], block.Root())
+	return nil
+}
@@ -21,7 +21,7 @@ var(
 	}
 	nodesFlag = cli.StringFlag{
 		Name:  "nodes",
-		Usage: "full node ws endpoint, ip:port, eg. 192.168.1.102:8090",
+		Usage: "comma separated full node ws endpoints to fail over between, ip:port, eg. 192.168.1.102:8090,192.168.1.103:8090",
 	}
 )
 
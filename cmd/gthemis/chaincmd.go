@@ -95,6 +95,24 @@ Requires a first argument of the file to write to.
 Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing.`,
+	}
+	exportStateDiffsCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportStateDiffs),
+		Name:      "export-statediffs",
+		Usage:     "Export the state changes of a range of blocks into a file",
+		ArgsUsage: "<blockNumFirst> <blockNumLast> <filename>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The export-statediffs command streams the state changes of every block in the
+given range as JSON, one block per line: the balance, nonce, code and storage
+values before and after the block of every account it modified. The changes are
+computed by diffing the state tries of each block and its parent, so both need
+to be available (i.e. an archive node is required for historical blocks). The
+output is gzipped if the file name ends in .gz.`,
 	}
 	importPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(importPreimages),
@@ -346,6 +364,29 @@ func importPreimages(ctx *cli.Context) error {
 	return nil
 }
 
+// exportStateDiffs dumps the state changes of a range of blocks to the specified
+// file in a streaming way.
+func exportStateDiffs(ctx *cli.Context) error {
+	if len(ctx.Args()) < 3 {
+		utils.Fatalf("This command requires three arguments.")
+	}
+	first, ferr := strconv.ParseUint(ctx.Args().Get(0), 10, 64)
+	last, lerr := strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+	if ferr != nil || lerr != nil {
+		utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+	}
+	stack := makeFullNode(ctx)
+	chain, _ := utils.MakeChain(ctx, stack)
+	defer chain.Stop()
+
+	start := time.Now()
+	if err := utils.ExportStateDiffs(chain, ctx.Args().Get(2), first, last); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
 // exportPreimages dumps the preimage data to specified json file in streaming way.
 func exportPreimages(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
@@ -32,6 +32,7 @@ import (
 	"github.com/themis-network/go-themis/eth"
 	"github.com/themis-network/go-themis/node"
 	"github.com/themis-network/go-themis/params"
+	"github.com/themis-network/go-themis/sink"
 	whisper "github.com/themis-network/go-themis/whisper/whisperv6"
 	"github.com/naoina/toml"
 )
@@ -80,6 +81,7 @@ type gethConfig struct {
 	Node      node.Config
 	Ethstats  ethstatsConfig
 	Dashboard dashboard.Config
+	Sink      sink.Config
 }
 
 func loadConfig(file string, cfg *gethConfig) error {
@@ -114,6 +116,7 @@ func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 		Shh:       whisper.DefaultConfig,
 		Node:      defaultNodeConfig(),
 		Dashboard: dashboard.DefaultConfig,
+		Sink:      sink.DefaultConfig,
 	}
 
 	// Load config file.
@@ -175,6 +178,17 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 	if cfg.Ethstats.URL != "" {
 		utils.RegisterEthStatsService(stack, cfg.Ethstats.URL)
 	}
+	// Add the GraphQL service if requested.
+	if ctx.GlobalBool(utils.GraphQLEnabledFlag.Name) {
+		if cfg.Node.HTTPHost == "" {
+			utils.Fatalf("GraphQL requires the HTTP-RPC server (--rpc) to be enabled")
+		}
+		utils.RegisterGraphQLService(stack, &cfg.Eth.Logs, cfg.Node.RPCLimits)
+	}
+	// Add the event sink if any destination was configured.
+	if cfg.Sink.Enabled() {
+		utils.RegisterSinkService(stack, &cfg.Sink)
+	}
 	return stack
 }
 
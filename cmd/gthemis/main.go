@@ -93,6 +93,8 @@ var (
 		utils.CacheDatabaseFlag,
 		utils.CacheGCFlag,
 		utils.TrieCacheGenFlag,
+		utils.SnapshotFlag,
+		utils.ParallelExecFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
@@ -104,7 +106,11 @@ var (
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
+		utils.DNSDiscoveryFlag,
 		utils.NetrestrictFlag,
+		utils.PermissionedFlag,
+		utils.PermissionSignerFlag,
+		utils.PermissionRegistryFlag,
 		utils.NodeKeyFileFlag,
 		utils.NodeKeyHexFlag,
 		utils.DeveloperFlag,
@@ -114,6 +120,14 @@ var (
 		utils.NetworkIdFlag,
 		utils.RPCCORSDomainFlag,
 		utils.RPCVirtualHostsFlag,
+		utils.RPCTLSCertFlag,
+		utils.RPCTLSKeyFlag,
+		utils.RPCTLSClientCAFlag,
+		utils.GraphQLEnabledFlag,
+		utils.LogsMaxBlockRangeFlag,
+		utils.LogsMaxResultsFlag,
+		utils.RPCGlobalGasCapFlag,
+		utils.RPCGlobalEVMTimeoutFlag,
 		utils.EthStatsURLFlag,
 		utils.MetricsEnabledFlag,
 		utils.FakePoWFlag,
@@ -164,6 +178,7 @@ func init() {
 		initCommand,
 		importCommand,
 		exportCommand,
+		exportStateDiffsCommand,
 		importPreimagesCommand,
 		exportPreimagesCommand,
 		copydbCommand,
@@ -131,6 +131,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.CacheDatabaseFlag,
 			utils.CacheGCFlag,
 			utils.TrieCacheGenFlag,
+			utils.SnapshotFlag,
+			utils.ParallelExecFlag,
 		},
 	},
 	{
@@ -156,6 +158,14 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.IPCPathFlag,
 			utils.RPCCORSDomainFlag,
 			utils.RPCVirtualHostsFlag,
+			utils.RPCTLSCertFlag,
+			utils.RPCTLSKeyFlag,
+			utils.RPCTLSClientCAFlag,
+			utils.GraphQLEnabledFlag,
+			utils.LogsMaxBlockRangeFlag,
+			utils.LogsMaxResultsFlag,
+			utils.RPCGlobalGasCapFlag,
+			utils.RPCGlobalEVMTimeoutFlag,
 			utils.JSpathFlag,
 			utils.ExecFlag,
 			utils.PreloadJSFlag,
@@ -173,7 +183,11 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.NATFlag,
 			utils.NoDiscoverFlag,
 			utils.DiscoveryV5Flag,
+			utils.DNSDiscoveryFlag,
 			utils.NetrestrictFlag,
+			utils.PermissionedFlag,
+			utils.PermissionSignerFlag,
+			utils.PermissionRegistryFlag,
 			utils.NodeKeyFileFlag,
 			utils.NodeKeyHexFlag,
 		},
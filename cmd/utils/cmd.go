@@ -19,6 +19,7 @@ package utils
 
 import (
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -26,6 +27,7 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/core"
@@ -237,6 +239,56 @@ func ExportAppendChain(blockchain *core.BlockChain, fn string, first uint64, las
 	return nil
 }
 
+// ExportStateDiffs exports the state changes of a range of blocks into the
+// specified file as a stream of JSON objects, one block per line.
+func ExportStateDiffs(blockchain *core.BlockChain, fn string, first uint64, last uint64) error {
+	log.Info("Exporting state diffs", "file", fn, "first", first, "last", last)
+
+	if first == 0 {
+		return fmt.Errorf("genesis has no parent state")
+	}
+	if first > last {
+		return fmt.Errorf("export failed: first (%d) is greater than last (%d)", first, last)
+	}
+	// Open the file handle and potentially wrap with a gzip stream
+	fh, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	var writer io.Writer = fh
+	if strings.HasSuffix(fn, ".gz") {
+		writer = gzip.NewWriter(writer)
+		defer writer.(*gzip.Writer).Close()
+	}
+	// Iterate over the blocks and export their diffs as they are computed
+	var (
+		enc    = json.NewEncoder(writer)
+		start  = time.Now()
+		report = time.Now()
+	)
+	for nr := first; nr <= last; nr++ {
+		block := blockchain.GetBlockByNumber(nr)
+		if block == nil {
+			return fmt.Errorf("export failed on #%d: not found", nr)
+		}
+		diff, err := blockchain.StateDiff(block)
+		if err != nil {
+			return fmt.Errorf("export failed on #%d: %v", nr, err)
+		}
+		if err := enc.Encode(diff); err != nil {
+			return err
+		}
+		if time.Since(report) > 8*time.Second {
+			log.Info("Exporting state diffs", "exported", nr-first+1, "elapsed", common.PrettyDuration(time.Since(start)))
+			report = time.Now()
+		}
+	}
+	log.Info("Exported state diffs", "file", fn)
+	return nil
+}
+
 // ImportPreimages imports a batch of exported hash preimages into the database.
 func ImportPreimages(db *ethdb.LDBDatabase, fn string) error {
 	log.Info("Importing preimages", "file", fn)
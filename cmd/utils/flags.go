@@ -19,6 +19,7 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -43,9 +44,11 @@ import (
 	"github.com/themis-network/go-themis/dashboard"
 	"github.com/themis-network/go-themis/eth"
 	"github.com/themis-network/go-themis/eth/downloader"
+	"github.com/themis-network/go-themis/eth/filters"
 	"github.com/themis-network/go-themis/eth/gasprice"
 	"github.com/themis-network/go-themis/ethdb"
 	"github.com/themis-network/go-themis/ethstats"
+	"github.com/themis-network/go-themis/graphql"
 	"github.com/themis-network/go-themis/les"
 	"github.com/themis-network/go-themis/log"
 	"github.com/themis-network/go-themis/metrics"
@@ -53,10 +56,13 @@ import (
 	"github.com/themis-network/go-themis/node"
 	"github.com/themis-network/go-themis/p2p"
 	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/p2p/dnsdisc"
 	"github.com/themis-network/go-themis/p2p/discv5"
 	"github.com/themis-network/go-themis/p2p/nat"
 	"github.com/themis-network/go-themis/p2p/netutil"
 	"github.com/themis-network/go-themis/params"
+	"github.com/themis-network/go-themis/rpc"
+	"github.com/themis-network/go-themis/sink"
 	whisper "github.com/themis-network/go-themis/whisper/whisperv6"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -165,7 +171,7 @@ var (
 	defaultSyncMode = eth.DefaultConfig.SyncMode
 	SyncModeFlag    = TextMarshalerFlag{
 		Name:  "syncmode",
-		Usage: `Blockchain sync mode ("fast", "full", or "light")`,
+		Usage: `Blockchain sync mode ("fast", "full", "snap", or "light")`,
 		Value: &defaultSyncMode,
 	}
 	GCModeFlag = cli.StringFlag{
@@ -308,6 +314,14 @@ var (
 		Usage: "Number of trie node generations to keep in memory",
 		Value: int(state.MaxTrieCacheGen),
 	}
+	SnapshotFlag = cli.BoolFlag{
+		Name:  "snapshot",
+		Usage: "Maintain a flat snapshot of the state for faster state reads",
+	}
+	ParallelExecFlag = cli.BoolFlag{
+		Name:  "parallelexec",
+		Usage: "Execute the transactions of imported blocks optimistically in parallel",
+	}
 	// Miner settings
 	MiningEnabledFlag = cli.BoolFlag{
 		Name:  "mine",
@@ -391,6 +405,42 @@ var (
 		Usage: "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
 		Value: strings.Join(node.DefaultConfig.HTTPVirtualHosts, ","),
 	}
+	RPCTLSCertFlag = cli.StringFlag{
+		Name:  "rpc.tlscert",
+		Usage: "PEM certificate chain to serve the HTTP-RPC and WS-RPC servers over TLS with (reloaded on SIGHUP)",
+	}
+	RPCTLSKeyFlag = cli.StringFlag{
+		Name:  "rpc.tlskey",
+		Usage: "PEM private key of the HTTP-RPC and WS-RPC TLS certificate (reloaded on SIGHUP)",
+	}
+	RPCTLSClientCAFlag = cli.StringFlag{
+		Name:  "rpc.tlsclientca",
+		Usage: "PEM certificate authorities to require and verify HTTP-RPC and WS-RPC client certificates against",
+	}
+	GraphQLEnabledFlag = cli.BoolFlag{
+		Name:  "graphql",
+		Usage: "Enable GraphQL and the GraphiQL page on the HTTP-RPC server (requires --rpc)",
+	}
+	LogsMaxBlockRangeFlag = cli.Uint64Flag{
+		Name:  "logs.maxrange",
+		Usage: "Maximum number of blocks a log query searches at once (0 = unlimited)",
+		Value: eth.DefaultConfig.Logs.MaxBlockRange,
+	}
+	LogsMaxResultsFlag = cli.IntFlag{
+		Name:  "logs.maxresults",
+		Usage: "Maximum number of logs a log query returns at once (0 = unlimited)",
+		Value: eth.DefaultConfig.Logs.MaxResults,
+	}
+	RPCGlobalGasCapFlag = cli.Uint64Flag{
+		Name:  "rpc.gascap",
+		Usage: "Gas allowance of a single eth_callBundle call (0 = unlimited)",
+		Value: eth.DefaultConfig.RPCGasCap,
+	}
+	RPCGlobalEVMTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.evmtimeout",
+		Usage: "Execution time allowance of eth_callBundle (0 = unlimited)",
+		Value: eth.DefaultConfig.RPCEVMTimeout,
+	}
 	RPCApiFlag = cli.StringFlag{
 		Name:  "rpcapi",
 		Usage: "API's offered over the HTTP-RPC interface",
@@ -489,10 +539,26 @@ var (
 		Name:  "v5disc",
 		Usage: "Enables the experimental RLPx V5 (Topic Discovery) mechanism",
 	}
+	DNSDiscoveryFlag = cli.StringFlag{
+		Name:  "discovery.dns",
+		Usage: "Comma separated list of enrtree:// URLs to use as DNS node lists",
+	}
 	NetrestrictFlag = cli.StringFlag{
 		Name:  "netrestrict",
 		Usage: "Restricts network communication to the given IP networks (CIDR masks)",
 	}
+	PermissionedFlag = cli.BoolFlag{
+		Name:  "permissioned",
+		Usage: "Only peer with the nodes in the allowlist (permissioned-nodes.json in the data directory)",
+	}
+	PermissionSignerFlag = cli.StringFlag{
+		Name:  "permissioned.signer",
+		Usage: "Account that must sign the node allowlist file (required with --permissioned)",
+	}
+	PermissionRegistryFlag = cli.StringFlag{
+		Name:  "permissioned.registry",
+		Usage: "Address of the node registry contract adding nodes to the allowlist",
+	}
 
 	// ATM the url is left to the user and deployment to
 	JSpathFlag = cli.StringFlag{
@@ -721,6 +787,20 @@ func setHTTP(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(RPCVirtualHostsFlag.Name) {
 		cfg.HTTPVirtualHosts = splitAndTrim(ctx.GlobalString(RPCVirtualHostsFlag.Name))
 	}
+	if ctx.GlobalIsSet(RPCTLSCertFlag.Name) || ctx.GlobalIsSet(RPCTLSKeyFlag.Name) || ctx.GlobalIsSet(RPCTLSClientCAFlag.Name) {
+		if cfg.RPCTLS == nil {
+			cfg.RPCTLS = new(rpc.TLSConfig)
+		}
+		if ctx.GlobalIsSet(RPCTLSCertFlag.Name) {
+			cfg.RPCTLS.CertFile = ctx.GlobalString(RPCTLSCertFlag.Name)
+		}
+		if ctx.GlobalIsSet(RPCTLSKeyFlag.Name) {
+			cfg.RPCTLS.KeyFile = ctx.GlobalString(RPCTLSKeyFlag.Name)
+		}
+		if ctx.GlobalIsSet(RPCTLSClientCAFlag.Name) {
+			cfg.RPCTLS.ClientCAFile = ctx.GlobalString(RPCTLSClientCAFlag.Name)
+		}
+	}
 }
 
 // setWS creates the WebSocket RPC listener interface string from the set
@@ -903,6 +983,7 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setHTTP(ctx, cfg)
 	setWS(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
+	setPermissions(ctx, cfg)
 
 	switch {
 	case ctx.GlobalIsSet(DataDirFlag.Name):
@@ -924,6 +1005,19 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setPermissions configures permissioned mode from the command line flags.
+func setPermissions(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(PermissionedFlag.Name) {
+		cfg.Permissioned = ctx.GlobalBool(PermissionedFlag.Name)
+	}
+	if signer := ctx.GlobalString(PermissionSignerFlag.Name); signer != "" {
+		if !common.IsHexAddress(signer) {
+			Fatalf("Option %q: invalid address %q", PermissionSignerFlag.Name, signer)
+		}
+		cfg.PermissionSigner = common.HexToAddress(signer)
+	}
+}
+
 func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	if ctx.GlobalIsSet(GpoBlocksFlag.Name) {
 		cfg.Blocks = ctx.GlobalInt(GpoBlocksFlag.Name)
@@ -933,6 +1027,24 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	}
 }
 
+func setLogs(ctx *cli.Context, cfg *filters.Config) {
+	if ctx.GlobalIsSet(LogsMaxBlockRangeFlag.Name) {
+		cfg.MaxBlockRange = ctx.GlobalUint64(LogsMaxBlockRangeFlag.Name)
+	}
+	if ctx.GlobalIsSet(LogsMaxResultsFlag.Name) {
+		cfg.MaxResults = ctx.GlobalInt(LogsMaxResultsFlag.Name)
+	}
+}
+
+func setRPCLimits(ctx *cli.Context, cfg *eth.Config) {
+	if ctx.GlobalIsSet(RPCGlobalGasCapFlag.Name) {
+		cfg.RPCGasCap = ctx.GlobalUint64(RPCGlobalGasCapFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCGlobalEVMTimeoutFlag.Name) {
+		cfg.RPCEVMTimeout = ctx.GlobalDuration(RPCGlobalEVMTimeoutFlag.Name)
+	}
+}
+
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolNoLocalsFlag.Name) {
 		cfg.NoLocals = ctx.GlobalBool(TxPoolNoLocalsFlag.Name)
@@ -1046,7 +1158,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 	setEtherbase(ctx, ks, cfg)
 	setGPO(ctx, &cfg.GPO)
+	setLogs(ctx, &cfg.Logs)
 	setTxPool(ctx, &cfg.TxPool)
+	setRPCLimits(ctx, cfg)
 	setEthash(ctx, cfg)
 
 	switch {
@@ -1080,6 +1194,26 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cfg.TrieCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
 	}
+	if registry := ctx.GlobalString(PermissionRegistryFlag.Name); registry != "" {
+		if !common.IsHexAddress(registry) {
+			Fatalf("Option %q: invalid address %q", PermissionRegistryFlag.Name, registry)
+		}
+		cfg.PermissionRegistry = common.HexToAddress(registry)
+	}
+	if ctx.GlobalIsSet(DNSDiscoveryFlag.Name) {
+		for _, url := range splitAndTrim(ctx.GlobalString(DNSDiscoveryFlag.Name)) {
+			if _, _, err := dnsdisc.ParseURL(url); err != nil {
+				Fatalf("Invalid --%s URL %q: %v", DNSDiscoveryFlag.Name, url, err)
+			}
+			cfg.DiscoveryURLs = append(cfg.DiscoveryURLs, url)
+		}
+	}
+	if ctx.GlobalIsSet(SnapshotFlag.Name) {
+		cfg.Snapshot = ctx.GlobalBool(SnapshotFlag.Name)
+	}
+	if ctx.GlobalIsSet(ParallelExecFlag.Name) {
+		cfg.ParallelExec = ctx.GlobalBool(ParallelExecFlag.Name)
+	}
 	if ctx.GlobalIsSet(MinerThreadsFlag.Name) {
 		cfg.MinerThreads = ctx.GlobalInt(MinerThreadsFlag.Name)
 	}
@@ -1199,6 +1333,45 @@ func RegisterEthStatsService(stack *node.Node, url string) {
 	}
 }
 
+// RegisterGraphQLService adds the GraphQL service, served on the HTTP-RPC
+// endpoint, to the stack. Its log queries and execution times are bounded like
+// the equivalent RPC methods.
+func RegisterGraphQLService(stack *node.Node, logs *filters.Config, limits *rpc.Limits) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		// Resolve the queries against the full node, or the light one lacking it
+		var ethServ *eth.Ethereum
+		if err := ctx.Service(&ethServ); err == nil {
+			return graphql.New(ethServ.APIBackend, logs, limits)
+		}
+		var lesServ *les.LightEthereum
+		if err := ctx.Service(&lesServ); err == nil {
+			return graphql.New(lesServ.ApiBackend, logs, limits)
+		}
+		return nil, errors.New("no Ethereum service to serve GraphQL from")
+	}); err != nil {
+		Fatalf("Failed to register the GraphQL service: %v", err)
+	}
+}
+
+// RegisterSinkService adds the event sink, publishing chain events to webhooks
+// and files, to the stack.
+func RegisterSinkService(stack *node.Node, cfg *sink.Config) {
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		// Publish the events of the full node, or the light one lacking it
+		var ethServ *eth.Ethereum
+		if err := ctx.Service(&ethServ); err == nil {
+			return sink.New(cfg, ethServ.APIBackend, false)
+		}
+		var lesServ *les.LightEthereum
+		if err := ctx.Service(&lesServ); err == nil {
+			return sink.New(cfg, lesServ.ApiBackend, true)
+		}
+		return nil, errors.New("no Ethereum service to publish events of")
+	}); err != nil {
+		Fatalf("Failed to register the event sink service: %v", err)
+	}
+}
+
 // SetupNetwork configures the system for either the main net or some test network.
 func SetupNetwork(ctx *cli.Context) {
 	// TODO(fjl): move target gas limit into config
@@ -1286,6 +1459,7 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		Disabled:      ctx.GlobalString(GCModeFlag.Name) == "archive",
 		TrieNodeLimit: eth.DefaultConfig.TrieCache,
 		TrieTimeLimit: eth.DefaultConfig.TrieTimeout,
+		Snapshot:      ctx.GlobalBool(SnapshotFlag.Name),
 	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheGCFlag.Name) {
 		cache.TrieNodeLimit = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheGCFlag.Name) / 100
@@ -1295,6 +1469,9 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	if err != nil {
 		Fatalf("Can't create BlockChain: %v", err)
 	}
+	if ctx.GlobalBool(ParallelExecFlag.Name) {
+		chain.SetProcessor(core.NewParallelStateProcessor(config, chain, engine))
+	}
 	return chain, chainDb
 }
 
@@ -70,6 +70,7 @@ type CacheConfig struct {
 	Disabled      bool          // Whether to disable trie write caching (archive node)
 	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
 	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+	Snapshot      bool          // Whether to maintain a flat state snapshot for fast state reads
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -177,6 +178,17 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
 	}
+	// Load (or start generating) the state snapshot now that the head state is
+	// final. Nothing is cached in the plain state database yet, so it's safe to
+	// swap it out.
+	if cacheConfig.Snapshot {
+		stateCache, err := state.NewDatabaseWithSnapshots(db, bc.CurrentBlock().Root())
+		if err != nil {
+			log.Warn("State snapshot unavailable", "err", err)
+		} else {
+			bc.stateCache = stateCache
+		}
+	}
 	// Check the current state of the block hashes and make sure that we do not have any of the bad blocks in our chain
 	for hash := range BadHashes {
 		if header := bc.GetHeaderByHash(hash); header != nil {
@@ -381,6 +393,11 @@ func (bc *BlockChain) State() (*state.StateDB, error) {
 	return bc.StateAt(bc.CurrentBlock().Root())
 }
 
+// StateCache returns the caching database underpinning the blockchain instance.
+func (bc *BlockChain) StateCache() state.Database {
+	return bc.stateCache
+}
+
 // StateAt returns a new mutable state based on a particular point in time.
 func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache)
@@ -678,6 +695,13 @@ func (bc *BlockChain) Stop() {
 			log.Error("Dangling trie nodes after full cleanup")
 		}
 	}
+	// Flatten the state snapshot into the disk so it matches the persisted head
+	if snaps := bc.stateCache.Snapshots(); snaps != nil {
+		if err := snaps.Cap(bc.CurrentBlock().Root(), 0); err != nil {
+			log.Error("Failed to flatten state snapshot", "err", err)
+		}
+		snaps.Stop()
+	}
 	log.Info("Blockchain manager stopped")
 }
 
@@ -984,11 +1008,30 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 	// Set new head.
 	if status == CanonStatTy {
 		bc.insert(block)
+		bc.capSnapshot(root)
 	}
 	bc.futureBlocks.Remove(block.Hash())
 	return status, nil
 }
 
+// capSnapshot keeps the state snapshot in line with a new canonical head state,
+// flattening the diff layers the tries aren't kept in memory for anymore. If the
+// head has no snapshot (e.g. after a reorg deeper than the persisted layer), the
+// snapshot is regenerated.
+func (bc *BlockChain) capSnapshot(root common.Hash) {
+	snaps := bc.stateCache.Snapshots()
+	if snaps == nil {
+		return
+	}
+	if snaps.Snapshot(root) == nil {
+		snaps.Rebuild(root)
+		return
+	}
+	if err := snaps.Cap(root, triesInMemory-1); err != nil {
+		log.Warn("Failed to cap state snapshot", "root", root, "err", err)
+	}
+}
+
 // InsertChain attempts to insert the given batch of blocks in to the canonical
 // chain or, otherwise, create a fork. If an error is returned it will return
 // the index number of the failing block as well an error describing what went
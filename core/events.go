@@ -24,6 +24,41 @@ import (
 // NewTxsEvent is posted when a batch of transactions enter the transaction pool.
 type NewTxsEvent struct{ Txs []*types.Transaction }
 
+// TxPoolEventType is the kind of transaction state change reported by a
+// TxPoolEvent.
+type TxPoolEventType int
+
+const (
+	TxPoolAdded    TxPoolEventType = iota // Transaction entered the pool
+	TxPoolPromoted                        // Transaction became executable
+	TxPoolDropped                         // Transaction was removed without being included
+	TxPoolIncluded                        // Transaction was removed as it got included in a block
+)
+
+// String implements fmt.Stringer.
+func (t TxPoolEventType) String() string {
+	switch t {
+	case TxPoolAdded:
+		return "added"
+	case TxPoolPromoted:
+		return "promoted"
+	case TxPoolDropped:
+		return "dropped"
+	case TxPoolIncluded:
+		return "included"
+	default:
+		return "unknown"
+	}
+}
+
+// TxPoolEvent is posted when a transaction enters, gets promoted within, is
+// dropped from or gets included out of the transaction pool.
+type TxPoolEvent struct {
+	Tx     *types.Transaction
+	Type   TxPoolEventType
+	Reason string // Reason of a drop, empty for other events
+}
+
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
 type PendingLogsEvent struct {
 	Logs []*types.Log
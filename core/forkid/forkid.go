@@ -0,0 +1,166 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package forkid implements the fork identifier of EIP-2124, a compact summary
+// of the chain a node is on and of the forks it has passed and expects.
+package forkid
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/params"
+)
+
+var (
+	// ErrRemoteStale is returned by the filter if a remote fork identifier is a
+	// subset of the local one, but the remote node didn't announce the next fork
+	// the local node already passed.
+	ErrRemoteStale = errors.New("remote needs update")
+
+	// ErrLocalIncompatibleOrStale is returned by the filter if a remote fork
+	// identifier is incompatible with the local one, or if the local node passed
+	// the next fork announced by the remote node without switching to it.
+	ErrLocalIncompatibleOrStale = errors.New("local incompatible or needs update")
+)
+
+// ID is a fork identifier as defined by EIP-2124.
+type ID struct {
+	Hash [4]byte // CRC32 checksum of the genesis block and passed fork block numbers
+	Next uint64  // Block number of the next upcoming fork, or 0 if no forks are known
+}
+
+// Filter is a fork identifier validator, returning an error if a remote node's
+// fork identifier is incompatible with the local chain.
+type Filter func(id ID) error
+
+// NewID calculates the fork identifier of a chain at the given head block.
+func NewID(config *params.ChainConfig, genesis common.Hash, head uint64) ID {
+	hash := crc32.ChecksumIEEE(genesis[:])
+
+	var next uint64
+	for _, fork := range gatherForks(config) {
+		if fork > head {
+			next = fork
+			break
+		}
+		hash = checksumUpdate(hash, fork)
+	}
+	return ID{Hash: checksumToBytes(hash), Next: next}
+}
+
+// NewFilter creates a filter validating remote fork identifiers against a chain
+// whose head block is reported by the given function.
+func NewFilter(config *params.ChainConfig, genesis common.Hash, head func() uint64) Filter {
+	var (
+		forks = gatherForks(config)
+		sums  = make([][4]byte, len(forks)+1) // Checksums after each fork, including genesis
+	)
+	hash := crc32.ChecksumIEEE(genesis[:])
+	sums[0] = checksumToBytes(hash)
+	for i, fork := range forks {
+		hash = checksumUpdate(hash, fork)
+		sums[i+1] = checksumToBytes(hash)
+	}
+	// Add a sentinel beyond any block number, simplifying the checks below
+	forks = append(forks, math.MaxUint64)
+
+	return func(id ID) error {
+		head := head()
+		for i, fork := range forks {
+			// Find the fork range the local head is in
+			if head >= fork {
+				continue
+			}
+			// If the checksums match, the remote node must not announce a fork
+			// the local head already passed
+			if sums[i] == id.Hash {
+				if id.Next > 0 && head >= id.Next {
+					return ErrLocalIncompatibleOrStale
+				}
+				return nil
+			}
+			// If the remote checksum is one of a past local fork, the remote node
+			// is syncing and must announce the subsequent local fork
+			for j := 0; j < i; j++ {
+				if sums[j] == id.Hash {
+					if forks[j] != id.Next {
+						return ErrRemoteStale
+					}
+					return nil
+				}
+			}
+			// If the remote checksum is one of a future local fork, the local node
+			// is syncing and the remote one is ahead
+			for j := i + 1; j < len(sums); j++ {
+				if sums[j] == id.Hash {
+					return nil
+				}
+			}
+			return ErrLocalIncompatibleOrStale
+		}
+		return ErrLocalIncompatibleOrStale
+	}
+}
+
+// checksumUpdate extends a fork checksum with the block number of a fork.
+func checksumUpdate(hash uint32, fork uint64) uint32 {
+	var blob [8]byte
+	binary.BigEndian.PutUint64(blob[:], fork)
+	return crc32.Update(hash, crc32.IEEETable, blob[:])
+}
+
+// checksumToBytes converts a fork checksum into its big endian representation.
+func checksumToBytes(hash uint32) [4]byte {
+	var blob [4]byte
+	binary.BigEndian.PutUint32(blob[:], hash)
+	return blob
+}
+
+// gatherForks collects the ordered and deduplicated block numbers of the forks
+// of a chain configuration, skipping the ones active since genesis.
+func gatherForks(config *params.ChainConfig) []uint64 {
+	var (
+		kind  = reflect.TypeOf(params.ChainConfig{})
+		conf  = reflect.ValueOf(config).Elem()
+		forks []uint64
+	)
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+		if !strings.HasSuffix(field.Name, "Block") || field.Type != reflect.TypeOf(new(big.Int)) {
+			continue
+		}
+		if block := conf.Field(i).Interface().(*big.Int); block != nil && block.Sign() > 0 {
+			forks = append(forks, block.Uint64())
+		}
+	}
+	sort.Slice(forks, func(i, j int) bool { return forks[i] < forks[j] })
+
+	unique := forks[:0]
+	for _, fork := range forks {
+		if len(unique) == 0 || fork != unique[len(unique)-1] {
+			unique = append(unique, fork)
+		}
+	}
+	return unique
+}
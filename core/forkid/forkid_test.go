@@ -0,0 +1,103 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package forkid
+
+import (
+	"testing"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/params"
+)
+
+// Tests that fork identifiers are calculated correctly, using the EIP-2124
+// test vectors of the main network.
+func TestCreation(t *testing.T) {
+	tests := []struct {
+		head uint64
+		want ID
+	}{
+		{0, ID{Hash: [4]byte{0xfc, 0x64, 0xec, 0x04}, Next: 1150000}},       // Unsynced
+		{1149999, ID{Hash: [4]byte{0xfc, 0x64, 0xec, 0x04}, Next: 1150000}}, // Last Frontier block
+		{1150000, ID{Hash: [4]byte{0x97, 0xc2, 0xc3, 0x4c}, Next: 1920000}}, // First Homestead block
+		{1919999, ID{Hash: [4]byte{0x97, 0xc2, 0xc3, 0x4c}, Next: 1920000}}, // Last Homestead block
+		{1920000, ID{Hash: [4]byte{0x91, 0xd1, 0xf9, 0x48}, Next: 2463000}}, // First DAO block
+		{2463000, ID{Hash: [4]byte{0x7a, 0x64, 0xda, 0x13}, Next: 2675000}}, // First Tangerine block
+		{2675000, ID{Hash: [4]byte{0x3e, 0xdd, 0x5b, 0x10}, Next: 4370000}}, // First Spurious block
+		{4369999, ID{Hash: [4]byte{0x3e, 0xdd, 0x5b, 0x10}, Next: 4370000}}, // Last Spurious block
+		{4370000, ID{Hash: [4]byte{0xa0, 0x0b, 0xc3, 0x24}, Next: 0}},       // First Byzantium block
+		{7987396, ID{Hash: [4]byte{0xa0, 0x0b, 0xc3, 0x24}, Next: 0}},       // Future Byzantium block
+	}
+	for i, tt := range tests {
+		if have := NewID(params.MainnetChainConfig, params.MainnetGenesisHash, tt.head); have != tt.want {
+			t.Errorf("test %d: fork ID mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that remote fork identifiers are validated according to EIP-2124.
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		head uint64
+		id   ID
+		err  error
+	}{
+		// Local and remote are on the same fork, without future forks
+		{7987396, ID{Hash: [4]byte{0xa0, 0x0b, 0xc3, 0x24}, Next: 0}, nil},
+
+		// Remote announces a fork the local node doesn't know about yet
+		{7279999, ID{Hash: [4]byte{0xa0, 0x0b, 0xc3, 0x24}, Next: 7280000}, nil},
+
+		// Remote announces a fork the local node passed without switching to it
+		{7987396, ID{Hash: [4]byte{0xa0, 0x0b, 0xc3, 0x24}, Next: 7280000}, ErrLocalIncompatibleOrStale},
+
+		// Remote is syncing and announces the next local fork
+		{7987396, ID{Hash: [4]byte{0x3e, 0xdd, 0x5b, 0x10}, Next: 4370000}, nil},
+
+		// Remote is syncing, but doesn't know about the next local fork
+		{7987396, ID{Hash: [4]byte{0x3e, 0xdd, 0x5b, 0x10}, Next: 0}, ErrRemoteStale},
+
+		// Local is syncing, remote is on a future fork
+		{0, ID{Hash: [4]byte{0xa0, 0x0b, 0xc3, 0x24}, Next: 0}, nil},
+
+		// Remote is on another chain
+		{7987396, ID{Hash: [4]byte{0xaf, 0xec, 0x6b, 0x27}, Next: 0}, ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		head := tt.head
+		filter := NewFilter(params.MainnetChainConfig, params.MainnetGenesisHash, func() uint64 { return head })
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that nodes of different chains are told apart even if they share the
+// same fork blocks.
+func TestChainSeparation(t *testing.T) {
+	genesis := common.HexToHash("0x01")
+	filter := NewFilter(params.ThemisTestChainConfig, genesis, func() uint64 { return 10 })
+
+	if err := filter(NewID(params.ThemisTestChainConfig, genesis, 10)); err != nil {
+		t.Errorf("same chain rejected: %v", err)
+	}
+	if err := filter(NewID(params.MainnetChainConfig, params.MainnetGenesisHash, 10)); err != ErrLocalIncompatibleOrStale {
+		t.Errorf("main network error mismatch: have %v, want %v", err, ErrLocalIncompatibleOrStale)
+	}
+	if err := filter(NewID(params.ThemisTestChainConfig, common.HexToHash("0x02"), 10)); err != ErrLocalIncompatibleOrStale {
+		t.Errorf("other genesis error mismatch: have %v, want %v", err, ErrLocalIncompatibleOrStale)
+	}
+}
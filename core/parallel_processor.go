@@ -0,0 +1,442 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"runtime"
+	"sync"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/consensus"
+	"github.com/themis-network/go-themis/consensus/misc"
+	"github.com/themis-network/go-themis/core/state"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/core/vm"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/params"
+)
+
+// ParallelStateProcessor is a Processor executing the transactions of a block
+// optimistically in parallel. Every transaction is first run speculatively on
+// its own copy of the block's pre-state, tracking the parts of the state it
+// reads and writes. The results are then committed in block order: if none of
+// the state read by a transaction was modified by the ones preceding it, its
+// writes are replayed onto the real state, otherwise it's re-executed on top of
+// it. The produced state, receipts and logs are identical to StateProcessor's.
+//
+// ParallelStateProcessor implements Processor.
+type ParallelStateProcessor struct {
+	config  *params.ChainConfig // Chain configuration options
+	bc      *BlockChain         // Canonical block chain
+	engine  consensus.Engine    // Consensus engine used for block rewards
+	workers int                 // Number of concurrent speculative executors
+}
+
+// NewParallelStateProcessor initialises a new ParallelStateProcessor.
+func NewParallelStateProcessor(config *params.ChainConfig, bc *BlockChain, engine consensus.Engine) *ParallelStateProcessor {
+	return &ParallelStateProcessor{
+		config:  config,
+		bc:      bc,
+		engine:  engine,
+		workers: runtime.NumCPU(),
+	}
+}
+
+// speculation is the result of speculatively executing a transaction on top of
+// the pre-state of its block.
+type speculation struct {
+	msg    types.Message
+	gas    uint64
+	failed bool
+	err    error
+	view   *trackedState // State accesses done during execution
+}
+
+// Process processes the state changes according to the Ethereum rules by running
+// the transaction messages using the statedb and applying any rewards to both
+// the processor (coinbase) and any included uncles.
+//
+// Process returns the receipts and logs accumulated during the process and
+// returns the amount of gas that was used in the process. If any of the
+// transactions failed to execute due to insufficient gas it will return an error.
+func (p *ParallelStateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
+	// Tracing requires the transactions to be executed in order, and there's
+	// nothing to gain from speculation for trivial blocks
+	txs := block.Transactions()
+	if cfg.Debug || len(txs) < 2 || p.workers < 2 {
+		return applyBlock(p.config, p.bc, p.engine, block, statedb, cfg)
+	}
+	var (
+		receipts types.Receipts
+		usedGas  = new(uint64)
+		header   = block.Header()
+		allLogs  []*types.Log
+		gp       = new(GasPool).AddGas(block.GasLimit())
+	)
+	// Mutate the the block and state according to any hard-fork specs
+	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	// Start speculatively executing all transactions on copies of the pre-state.
+	// The copies are made upfront as the pre-state gets modified while committing.
+	var (
+		results = make([]chan *speculation, len(txs))
+		tasks   = make(chan int, len(txs))
+		abort   = make(chan struct{})
+		pending sync.WaitGroup
+	)
+	for i := range txs {
+		results[i] = make(chan *speculation, 1)
+		tasks <- i
+	}
+	close(tasks)
+
+	copies := make([]*state.StateDB, len(txs))
+	for i := range txs {
+		copies[i] = statedb.Copy()
+	}
+	workers := p.workers
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+	for n := 0; n < workers; n++ {
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			for i := range tasks {
+				select {
+				case <-abort:
+					return
+				default:
+				}
+				results[i] <- p.speculate(block, i, copies[i], cfg)
+				copies[i] = nil
+			}
+		}()
+	}
+	defer pending.Wait()
+	defer close(abort)
+
+	// Commit the transactions in order, re-executing the conflicting ones
+	var (
+		written   = make(accessSet)
+		conflicts int
+	)
+	for i, tx := range txs {
+		res := <-results[i]
+
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		if res.err == nil && !res.view.serial && !written.conflicts(res.view.reads) && gp.Gas() >= res.msg.Gas() {
+			// Speculation is valid, make sure the gas pool is charged exactly as
+			// during sequential execution
+			gp.SubGas(res.msg.Gas())
+			gp.AddGas(res.msg.Gas() - res.gas)
+
+			res.view.replay(statedb)
+			written.merge(res.view.writes())
+			receipt := finaliseTransaction(p.config, statedb, header, tx, res.msg, res.gas, res.failed, usedGas)
+
+			receipts = append(receipts, receipt)
+			allLogs = append(allLogs, receipt.Logs...)
+			continue
+		}
+		// Speculation was invalidated, execute the transaction on the real state,
+		// still tracking its writes to detect later conflicts
+		conflicts++
+
+		view := newTrackedState(statedb)
+		receipt, _, err := applyTransaction(p.config, p.bc, nil, gp, statedb, view, header, tx, usedGas, cfg)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		written.merge(view.writes())
+
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, receipt.Logs...)
+	}
+	log.Trace("Executed block transactions in parallel", "number", block.Number(), "txs", len(txs), "conflicts", conflicts)
+
+	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
+	p.engine.Finalize(p.bc, header, statedb, txs, block.Uncles(), receipts)
+
+	return receipts, allLogs, *usedGas, nil
+}
+
+// speculate executes a single transaction of a block on a private copy of the
+// block's pre-state, tracking every state access made.
+func (p *ParallelStateProcessor) speculate(block *types.Block, index int, statedb *state.StateDB, cfg vm.Config) *speculation {
+	var (
+		tx     = block.Transactions()[index]
+		header = block.Header()
+		res    = &speculation{view: newTrackedState(statedb)}
+	)
+	statedb.Prepare(tx.Hash(), block.Hash(), index)
+
+	res.msg, res.err = tx.AsMessage(types.MakeSigner(p.config, header.Number))
+	if res.err != nil {
+		return res
+	}
+	// Execute the transaction with a dedicated gas pool, the block's one is only
+	// charged when committing
+	vmenv := vm.NewEVM(NewEVMContext(res.msg, header, p.bc, nil), res.view, p.config, cfg)
+	_, res.gas, res.failed, res.err = ApplyMessage(vmenv, res.msg, new(GasPool).AddGas(block.GasLimit()))
+	return res
+}
+
+// accessKind enumerates the parts of an account a state access can refer to.
+type accessKind uint8
+
+const (
+	accessExist    accessKind = iota // Existence and emptiness of the account
+	accessBalance                    // Balance of the account
+	accessNonce                      // Nonce of the account
+	accessCode                       // Code of the account
+	accessStorage                    // A single storage slot of the account
+	accessDestruct                   // Removal of the account along with its storage
+)
+
+// accessKey identifies a part of the state accessed by a transaction.
+type accessKey struct {
+	addr common.Address
+	kind accessKind
+	slot common.Hash // Only set for storage accesses
+}
+
+// accessSet is a set of state parts accessed by one or more transactions.
+type accessSet map[accessKey]struct{}
+
+// add inserts a state part into the access set.
+func (s accessSet) add(addr common.Address, kind accessKind) {
+	s[accessKey{addr: addr, kind: kind}] = struct{}{}
+}
+
+// merge inserts all the state parts of another access set into this one.
+func (s accessSet) merge(other accessSet) {
+	for key := range other {
+		s[key] = struct{}{}
+	}
+}
+
+// conflicts returns whether any of the given reads refers to a part of the state
+// that was written according to this access set.
+func (s accessSet) conflicts(reads accessSet) bool {
+	for key := range reads {
+		if _, ok := s[key]; ok {
+			return true
+		}
+		if _, ok := s[accessKey{addr: key.addr, kind: accessDestruct}]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stateOp is a state modification done by a transaction, which can be replayed
+// onto another state database.
+type stateOp struct {
+	apply  func(*state.StateDB)
+	addr   common.Address
+	kinds  []accessKind
+	slot   common.Hash
+	create bool // Whether the account was empty (or missing) before the change
+}
+
+// trackedState is a vm.StateDB wrapping a state database, recording the parts of
+// the state read by the EVM and the modifications it makes.
+type trackedState struct {
+	*state.StateDB
+
+	reads     accessSet
+	ops       []stateOp
+	revisions map[int]int // Length of the op log at each state snapshot
+	serial    bool        // Whether the accesses couldn't be tracked accurately
+}
+
+// newTrackedState creates a state access tracker on top of a state database.
+func newTrackedState(statedb *state.StateDB) *trackedState {
+	return &trackedState{
+		StateDB:   statedb,
+		reads:     make(accessSet),
+		revisions: make(map[int]int),
+	}
+}
+
+// read records a state access of the EVM.
+func (s *trackedState) read(addr common.Address, kinds ...accessKind) {
+	for _, kind := range kinds {
+		s.reads.add(addr, kind)
+	}
+}
+
+// write records a state modification of the EVM, applying it to the wrapped
+// state database too.
+func (s *trackedState) write(addr common.Address, apply func(*state.StateDB), kinds ...accessKind) {
+	// Touches of the RIPEMD precompile survive reverts (see the journal), which
+	// can't be reproduced by replaying the surviving operations
+	if addr == ripemd {
+		s.serial = true
+	}
+	s.ops = append(s.ops, stateOp{apply: apply, addr: addr, kinds: kinds, create: s.StateDB.Empty(addr)})
+	apply(s.StateDB)
+}
+
+// replay applies the state modifications recorded by the tracker onto another
+// state database.
+func (s *trackedState) replay(statedb *state.StateDB) {
+	for _, op := range s.ops {
+		op.apply(statedb)
+	}
+}
+
+// writes returns the parts of the state modified by the recorded operations.
+// Any change to an account that is or was empty may alter its existence too.
+func (s *trackedState) writes() accessSet {
+	writes := make(accessSet)
+	for _, op := range s.ops {
+		for _, kind := range op.kinds {
+			if kind == accessStorage {
+				writes[accessKey{addr: op.addr, kind: kind, slot: op.slot}] = struct{}{}
+				continue
+			}
+			writes.add(op.addr, kind)
+		}
+		if len(op.kinds) > 0 && (op.create || s.StateDB.Empty(op.addr)) {
+			writes.add(op.addr, accessExist)
+		}
+	}
+	return writes
+}
+
+// ripemd is the address of the RIPEMD precompile, see trackedState.write.
+var ripemd = common.BytesToAddress([]byte{3})
+
+func (s *trackedState) CreateAccount(addr common.Address) {
+	// The balance of an overwritten account is carried over, its data dropped
+	s.read(addr, accessExist, accessBalance)
+	s.write(addr, func(db *state.StateDB) { db.CreateAccount(addr) }, accessExist, accessBalance, accessNonce, accessCode, accessDestruct)
+}
+
+func (s *trackedState) SubBalance(addr common.Address, amount *big.Int) {
+	amount = new(big.Int).Set(amount)
+	s.read(addr, accessBalance)
+	s.write(addr, func(db *state.StateDB) { db.SubBalance(addr, amount) }, accessBalance)
+}
+
+func (s *trackedState) AddBalance(addr common.Address, amount *big.Int) {
+	// Credits are commutative, only a touch of an empty account alters the state
+	// without changing the balance
+	amount = new(big.Int).Set(amount)
+	if amount.Sign() == 0 && !s.StateDB.Empty(addr) {
+		s.write(addr, func(db *state.StateDB) { db.AddBalance(addr, amount) })
+		return
+	}
+	s.write(addr, func(db *state.StateDB) { db.AddBalance(addr, amount) }, accessBalance)
+}
+
+func (s *trackedState) GetBalance(addr common.Address) *big.Int {
+	s.read(addr, accessBalance)
+	return s.StateDB.GetBalance(addr)
+}
+
+func (s *trackedState) GetNonce(addr common.Address) uint64 {
+	s.read(addr, accessNonce)
+	return s.StateDB.GetNonce(addr)
+}
+
+func (s *trackedState) SetNonce(addr common.Address, nonce uint64) {
+	s.write(addr, func(db *state.StateDB) { db.SetNonce(addr, nonce) }, accessNonce)
+}
+
+func (s *trackedState) GetCodeHash(addr common.Address) common.Hash {
+	s.read(addr, accessCode)
+	return s.StateDB.GetCodeHash(addr)
+}
+
+func (s *trackedState) GetCode(addr common.Address) []byte {
+	s.read(addr, accessCode)
+	return s.StateDB.GetCode(addr)
+}
+
+func (s *trackedState) SetCode(addr common.Address, code []byte) {
+	s.write(addr, func(db *state.StateDB) { db.SetCode(addr, code) }, accessCode)
+}
+
+func (s *trackedState) GetCodeSize(addr common.Address) int {
+	s.read(addr, accessCode)
+	return s.StateDB.GetCodeSize(addr)
+}
+
+func (s *trackedState) GetState(addr common.Address, key common.Hash) common.Hash {
+	s.reads[accessKey{addr: addr, kind: accessStorage, slot: key}] = struct{}{}
+	return s.StateDB.GetState(addr, key)
+}
+
+func (s *trackedState) SetState(addr common.Address, key, value common.Hash) {
+	s.write(addr, func(db *state.StateDB) { db.SetState(addr, key, value) }, accessStorage)
+	s.ops[len(s.ops)-1].slot = key
+}
+
+func (s *trackedState) Suicide(addr common.Address) bool {
+	s.read(addr, accessExist, accessBalance)
+	if !s.StateDB.Exist(addr) {
+		return false
+	}
+	s.write(addr, func(db *state.StateDB) { db.Suicide(addr) }, accessExist, accessBalance, accessDestruct)
+	return true
+}
+
+func (s *trackedState) HasSuicided(addr common.Address) bool {
+	s.read(addr, accessExist)
+	return s.StateDB.HasSuicided(addr)
+}
+
+func (s *trackedState) Exist(addr common.Address) bool {
+	s.read(addr, accessExist)
+	return s.StateDB.Exist(addr)
+}
+
+func (s *trackedState) Empty(addr common.Address) bool {
+	s.read(addr, accessExist, accessBalance, accessNonce, accessCode)
+	return s.StateDB.Empty(addr)
+}
+
+func (s *trackedState) Snapshot() int {
+	id := s.StateDB.Snapshot()
+	s.revisions[id] = len(s.ops)
+	return id
+}
+
+func (s *trackedState) RevertToSnapshot(id int) {
+	s.StateDB.RevertToSnapshot(id)
+	s.ops = s.ops[:s.revisions[id]]
+}
+
+func (s *trackedState) AddLog(log *types.Log) {
+	s.ops = append(s.ops, stateOp{apply: func(db *state.StateDB) { db.AddLog(log) }})
+	s.StateDB.AddLog(log)
+}
+
+func (s *trackedState) AddPreimage(hash common.Hash, preimage []byte) {
+	s.ops = append(s.ops, stateOp{apply: func(db *state.StateDB) { db.AddPreimage(hash, preimage) }})
+	s.StateDB.AddPreimage(hash, preimage)
+}
+
+func (s *trackedState) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) {
+	s.serial = true
+	s.StateDB.ForEachStorage(addr, cb)
+}
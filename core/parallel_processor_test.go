@@ -0,0 +1,149 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core/state"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/core/vm"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/params"
+	"github.com/themis-network/go-themis/rlp"
+)
+
+// Tests that the parallel state processor produces exactly the same receipts,
+// logs and state as the sequential one, both for independent and conflicting
+// transactions.
+func TestParallelProcessorByzantium(t *testing.T) { testParallelProcessor(t, params.TestChainConfig) }
+func TestParallelProcessorFrontier(t *testing.T) {
+	testParallelProcessor(t, &params.ChainConfig{ChainID: big.NewInt(1), Ethash: new(params.EthashConfig)})
+}
+
+func testParallelProcessor(t *testing.T, config *params.ChainConfig) {
+	var (
+		book     = common.HexToAddress("0xb00c") // slot[caller] = calldata; log1(caller)
+		counter  = common.HexToAddress("0xc0c0") // slot[0]++
+		reverter = common.HexToAddress("0xdead") // revert(0, 0)
+		killer   = common.HexToAddress("0x4111") // selfdestruct(caller)
+
+		keys  = make([]*ecdsa.PrivateKey, 16)
+		alloc = GenesisAlloc{
+			book:     {Code: common.FromHex("0x60003533553360006000a100"), Balance: big.NewInt(0)},
+			counter:  {Code: common.FromHex("0x60005460010160005500"), Balance: big.NewInt(0)},
+			reverter: {Code: common.FromHex("0x60006000fd"), Balance: big.NewInt(0)},
+			killer:   {Code: common.FromHex("0x33ff"), Balance: big.NewInt(1000)},
+		}
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = GenesisAccount{Balance: big.NewInt(1000000000000000)}
+	}
+	var (
+		gspec  = &Genesis{Config: config, Alloc: alloc}
+		engine = ethash.NewFaker()
+		db     = ethdb.NewMemDatabase()
+		signer = types.MakeSigner(config, big.NewInt(0))
+	)
+	genesis := gspec.MustCommit(db)
+
+	blocks, _ := GenerateChain(config, genesis, engine, db, 4, func(n int, b *BlockGen) {
+		send := func(key *ecdsa.PrivateKey, to *common.Address, value int64, data []byte) {
+			from := crypto.PubkeyToAddress(key.PublicKey)
+
+			var tx *types.Transaction
+			if to == nil {
+				tx = types.NewContractCreation(b.TxNonce(from), big.NewInt(value), 200000, big.NewInt(1), data)
+			} else {
+				tx = types.NewTransaction(b.TxNonce(from), *to, big.NewInt(value), 200000, big.NewInt(1), data)
+			}
+			tx, _ = types.SignTx(tx, signer, key)
+			b.AddTx(tx)
+		}
+		// Independent trade orders
+		for i, key := range keys[:8] {
+			send(key, &book, 0, common.LeftPadBytes([]byte{byte(n), byte(i)}, 32))
+		}
+		// Conflicting counter increments, nonce chains and value transfers
+		send(keys[8], &counter, 0, nil)
+		send(keys[9], &counter, 0, nil)
+		send(keys[0], &book, 0, []byte{byte(n)})
+		send(keys[10], &common.Address{byte(n), 0x01}, 1000, nil)
+		send(keys[11], &common.Address{byte(n), 0x01}, 1000, nil)
+		send(keys[12], &common.Address{byte(n), 0x02}, 0, nil)
+
+		// Failing calls, contract creations and self-destructs
+		send(keys[13], &reverter, 1, nil)
+		send(keys[14], nil, 0, common.FromHex("0x6001600055"))
+		send(keys[15], &killer, 0, nil)
+		send(keys[1], &killer, 5, nil)
+	})
+	// Insert the chain with the parallel processor to ensure it validates
+	pardb := ethdb.NewMemDatabase()
+	gspec.MustCommit(pardb)
+
+	chain, _ := NewBlockChain(pardb, nil, config, engine, vm.Config{})
+	defer chain.Stop()
+
+	processor := NewParallelStateProcessor(config, chain, engine)
+	processor.workers = 4
+	chain.SetProcessor(processor)
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain with parallel processor: %v", err)
+	}
+	// Process every block with both processors and compare the results exactly
+	sequential := NewStateProcessor(config, chain, engine)
+	for i, block := range blocks {
+		parent := chain.GetBlockByHash(block.ParentHash())
+
+		seqState, _ := state.New(parent.Root(), chain.stateCache)
+		seqReceipts, seqLogs, seqGas, err := sequential.Process(block, seqState, vm.Config{})
+		if err != nil {
+			t.Fatalf("block %d: sequential processing failed: %v", i, err)
+		}
+		parState, _ := state.New(parent.Root(), chain.stateCache)
+		parReceipts, parLogs, parGas, err := processor.Process(block, parState, vm.Config{})
+		if err != nil {
+			t.Fatalf("block %d: parallel processing failed: %v", i, err)
+		}
+		if seqGas != parGas {
+			t.Errorf("block %d: gas mismatch: have %d, want %d", i, parGas, seqGas)
+		}
+		seqBlob, _ := rlp.EncodeToBytes(seqReceipts)
+		parBlob, _ := rlp.EncodeToBytes(parReceipts)
+		if !bytes.Equal(seqBlob, parBlob) {
+			t.Errorf("block %d: receipt mismatch:\nhave %x\nwant %x", i, parBlob, seqBlob)
+		}
+		seqJSON, _ := json.Marshal(seqLogs)
+		parJSON, _ := json.Marshal(parLogs)
+		if !bytes.Equal(seqJSON, parJSON) {
+			t.Errorf("block %d: log mismatch:\nhave %s\nwant %s", i, parJSON, seqJSON)
+		}
+		if have, want := parState.IntermediateRoot(true), seqState.IntermediateRoot(true); have != want {
+			t.Errorf("block %d: state root mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
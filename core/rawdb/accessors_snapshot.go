@@ -0,0 +1,138 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/log"
+)
+
+// ReadSnapshotRoot retrieves the root of the block whose state is contained in
+// the persisted snapshot.
+func ReadSnapshotRoot(db DatabaseReader) common.Hash {
+	data, _ := db.Get(snapshotRootKey)
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteSnapshotRoot stores the root of the block whose state is contained in
+// the persisted snapshot.
+func WriteSnapshotRoot(db DatabaseWriter, root common.Hash) {
+	if err := db.Put(snapshotRootKey, root[:]); err != nil {
+		log.Crit("Failed to store snapshot root", "err", err)
+	}
+}
+
+// DeleteSnapshotRoot deletes the root of the persisted snapshot, marking it as
+// unusable until it is fully regenerated.
+func DeleteSnapshotRoot(db DatabaseDeleter) {
+	if err := db.Delete(snapshotRootKey); err != nil {
+		log.Crit("Failed to remove snapshot root", "err", err)
+	}
+}
+
+// ReadSnapshotGenerator retrieves the progress marker of the snapshot generator,
+// or nil if the persisted snapshot is complete.
+func ReadSnapshotGenerator(db DatabaseReader) []byte {
+	data, _ := db.Get(snapshotGeneratorKey)
+	if len(data) == 0 {
+		return nil
+	}
+	return data[1:]
+}
+
+// WriteSnapshotGenerator stores the progress marker of the snapshot generator.
+// Note, an empty but non-nil marker denotes a generation that hasn't processed
+// any entries yet.
+func WriteSnapshotGenerator(db DatabaseWriter, marker []byte) {
+	// Empty values can't be told apart from missing ones, prefix with a version byte
+	if err := db.Put(snapshotGeneratorKey, append([]byte{0}, marker...)); err != nil {
+		log.Crit("Failed to store snapshot generator marker", "err", err)
+	}
+}
+
+// DeleteSnapshotGenerator deletes the snapshot generator marker, denoting a
+// completely generated snapshot.
+func DeleteSnapshotGenerator(db DatabaseDeleter) {
+	if err := db.Delete(snapshotGeneratorKey); err != nil {
+		log.Crit("Failed to remove snapshot generator marker", "err", err)
+	}
+}
+
+// ReadSnapSyncStatus retrieves the serialized progress of snap sync, or nil if
+// no sync is in progress.
+func ReadSnapSyncStatus(db DatabaseReader) []byte {
+	data, _ := db.Get(snapSyncStatusKey)
+	return data
+}
+
+// WriteSnapSyncStatus stores the serialized progress of snap sync.
+func WriteSnapSyncStatus(db DatabaseWriter, status []byte) {
+	if err := db.Put(snapSyncStatusKey, status); err != nil {
+		log.Crit("Failed to store snap sync status", "err", err)
+	}
+}
+
+// DeleteSnapSyncStatus deletes the progress of snap sync, denoting that the next
+// snap sync starts from scratch.
+func DeleteSnapSyncStatus(db DatabaseDeleter) {
+	if err := db.Delete(snapSyncStatusKey); err != nil {
+		log.Crit("Failed to remove snap sync status", "err", err)
+	}
+}
+
+// ReadAccountSnapshot retrieves the snapshot entry of an account trie leaf.
+func ReadAccountSnapshot(db DatabaseReader, hash common.Hash) []byte {
+	data, _ := db.Get(snapshotAccountKey(hash))
+	return data
+}
+
+// WriteAccountSnapshot stores the snapshot entry of an account trie leaf.
+func WriteAccountSnapshot(db DatabaseWriter, hash common.Hash, entry []byte) {
+	if err := db.Put(snapshotAccountKey(hash), entry); err != nil {
+		log.Crit("Failed to store account snapshot", "err", err)
+	}
+}
+
+// DeleteAccountSnapshot removes the snapshot entry of an account trie leaf.
+func DeleteAccountSnapshot(db DatabaseDeleter, hash common.Hash) {
+	if err := db.Delete(snapshotAccountKey(hash)); err != nil {
+		log.Crit("Failed to delete account snapshot", "err", err)
+	}
+}
+
+// ReadStorageSnapshot retrieves the snapshot entry of a storage trie leaf.
+func ReadStorageSnapshot(db DatabaseReader, accountHash, storageHash common.Hash) []byte {
+	data, _ := db.Get(snapshotStorageKey(accountHash, storageHash))
+	return data
+}
+
+// WriteStorageSnapshot stores the snapshot entry of a storage trie leaf.
+func WriteStorageSnapshot(db DatabaseWriter, accountHash, storageHash common.Hash, entry []byte) {
+	if err := db.Put(snapshotStorageKey(accountHash, storageHash), entry); err != nil {
+		log.Crit("Failed to store storage snapshot", "err", err)
+	}
+}
+
+// DeleteStorageSnapshot removes the snapshot entry of a storage trie leaf.
+func DeleteStorageSnapshot(db DatabaseDeleter, accountHash, storageHash common.Hash) {
+	if err := db.Delete(snapshotStorageKey(accountHash, storageHash)); err != nil {
+		log.Crit("Failed to delete storage snapshot", "err", err)
+	}
+}
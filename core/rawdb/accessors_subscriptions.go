@@ -0,0 +1,44 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import "github.com/themis-network/go-themis/log"
+
+// ReadDurableSubscription retrieves the encoded state of a named durable log
+// subscription, or nil if no such subscription exists.
+func ReadDurableSubscription(db DatabaseReader, name string) []byte {
+	data, _ := db.Get(durableSubscriptionKey(name))
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
+
+// WriteDurableSubscription stores the encoded state of a named durable log
+// subscription.
+func WriteDurableSubscription(db DatabaseWriter, name string, blob []byte) {
+	if err := db.Put(durableSubscriptionKey(name), blob); err != nil {
+		log.Crit("Failed to store durable subscription", "err", err)
+	}
+}
+
+// DeleteDurableSubscription deletes a named durable log subscription.
+func DeleteDurableSubscription(db DatabaseDeleter, name string) {
+	if err := db.Delete(durableSubscriptionKey(name)); err != nil {
+		log.Crit("Failed to delete durable subscription", "name", name, "err", err)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"sync"
 
 	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/state/snapshot"
 	"github.com/themis-network/go-themis/ethdb"
 	"github.com/themis-network/go-themis/trie"
 	lru "github.com/hashicorp/golang-lru"
@@ -57,6 +58,10 @@ type Database interface {
 
 	// TrieDB retrieves the low level trie database used for data storage.
 	TrieDB() *trie.Database
+
+	// Snapshots retrieves the flat state snapshot tree consulted before the tries,
+	// or nil if state reads are served from the tries only.
+	Snapshots() *snapshot.Tree
 }
 
 // Trie is a Ethereum Merkle Trie.
@@ -83,8 +88,28 @@ func NewDatabase(db ethdb.Database) Database {
 	}
 }
 
+// NewDatabaseWithSnapshots creates a backing store for state like NewDatabase,
+// which additionally maintains a flat snapshot of the state in db, consulted for
+// account and storage reads before falling back to the tries. The snapshot must
+// match the state of the given root, otherwise it's regenerated in the background.
+func NewDatabaseWithSnapshots(db ethdb.Database, root common.Hash) (Database, error) {
+	csc, _ := lru.New(codeSizeCacheSize)
+	triedb := trie.NewDatabase(db)
+
+	snaps, err := snapshot.New(db, triedb, root)
+	if err != nil {
+		return nil, err
+	}
+	return &cachingDB{
+		db:            triedb,
+		snaps:         snaps,
+		codeSizeCache: csc,
+	}, nil
+}
+
 type cachingDB struct {
 	db            *trie.Database
+	snaps         *snapshot.Tree
 	mu            sync.Mutex
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
@@ -159,6 +184,11 @@ func (db *cachingDB) TrieDB() *trie.Database {
 	return db.db
 }
 
+// Snapshots retrieves the flat state snapshot tree, if enabled.
+func (db *cachingDB) Snapshots() *snapshot.Tree {
+	return db.snaps
+}
+
 // cachedTrie inserts its trie into a cachingDB on commit.
 type cachedTrie struct {
 	*trie.SecureTrie
@@ -0,0 +1,251 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/trie"
+)
+
+// diskCacheItems is the number of flat state entries to keep cached in memory
+// on top of the persistent snapshot.
+const diskCacheItems = 256 * 1024
+
+// diskLayer is a low level persistent snapshot built on top of a key-value store.
+type diskLayer struct {
+	diskdb ethdb.Database // Key-value store containing the base snapshot
+	triedb *trie.Database // Trie node cache for reconstruction purposes
+	cache  *lru.Cache     // Cache to avoid hitting the disk for direct access
+
+	root  common.Hash // Root hash of the base snapshot
+	stale bool        // Signals that the layer became stale (state progressed)
+
+	genMarker []byte             // Marker for the state that's indexed during initial layer generation (nil when done)
+	genAbort  chan chan struct{} // Notification channel to abort generating the snapshot in this layer
+	genDone   chan struct{}      // Closed when the generator of this layer terminates
+
+	lock sync.RWMutex
+}
+
+// newDiskLayer creates a disk layer for the given root, with an optional marker
+// of the generation progress if the layer is not yet complete.
+func newDiskLayer(diskdb ethdb.Database, triedb *trie.Database, root common.Hash, genMarker []byte) *diskLayer {
+	cache, _ := lru.New(diskCacheItems)
+	return &diskLayer{
+		diskdb:    diskdb,
+		triedb:    triedb,
+		cache:     cache,
+		root:      root,
+		genMarker: genMarker,
+	}
+}
+
+// Root returns root hash for which this snapshot was made.
+func (dl *diskLayer) Root() common.Hash {
+	return dl.root
+}
+
+// Parent always returns nil as there's no layer below the disk.
+func (dl *diskLayer) Parent() snapshot {
+	return nil
+}
+
+// Stale return whether this layer has become stale (was flattened across) or if
+// it's still live.
+func (dl *diskLayer) Stale() bool {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	return dl.stale
+}
+
+// markStale flags the layer as stale, failing all subsequent accesses.
+func (dl *diskLayer) markStale() {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	dl.stale = true
+}
+
+// Account directly retrieves the account trie value associated with a particular
+// hash.
+func (dl *diskLayer) Account(hash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.accountCovered(hash) {
+		return nil, ErrNotCoveredYet
+	}
+	key := string(hash[:])
+	if blob, ok := dl.cache.Get(key); ok {
+		return blob.([]byte), nil
+	}
+	blob := rawdb.ReadAccountSnapshot(dl.diskdb, hash)
+	dl.cache.Add(key, blob)
+	return blob, nil
+}
+
+// Storage directly retrieves the storage trie value associated with a particular
+// slot hash within a particular account.
+func (dl *diskLayer) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
+	dl.lock.RLock()
+	defer dl.lock.RUnlock()
+
+	if dl.stale {
+		return nil, ErrSnapshotStale
+	}
+	if !dl.storageCovered(accountHash, storageHash) {
+		return nil, ErrNotCoveredYet
+	}
+	key := string(append(accountHash[:], storageHash[:]...))
+	if blob, ok := dl.cache.Get(key); ok {
+		return blob.([]byte), nil
+	}
+	blob := rawdb.ReadStorageSnapshot(dl.diskdb, accountHash, storageHash)
+	dl.cache.Add(key, blob)
+	return blob, nil
+}
+
+// Update creates a new layer on top of the existing snapshot diff tree with
+// the specified data items. Note, the maps are retained by the method to avoid
+// copying everything.
+func (dl *diskLayer) Update(blockRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) *diffLayer {
+	return newDiffLayer(dl, blockRoot, destructs, accounts, storage)
+}
+
+// accountCovered returns whether the generator already indexed the given
+// account. The method assumes the layer lock is held.
+func (dl *diskLayer) accountCovered(hash common.Hash) bool {
+	if dl.genMarker == nil {
+		return true
+	}
+	marker := dl.genMarker
+	if len(marker) > common.HashLength {
+		marker = marker[:common.HashLength]
+	}
+	return bytes.Compare(hash[:], marker) <= 0
+}
+
+// storageCovered returns whether the generator already indexed the given
+// storage slot. The method assumes the layer lock is held.
+func (dl *diskLayer) storageCovered(accountHash, storageHash common.Hash) bool {
+	if dl.genMarker == nil {
+		return true
+	}
+	return bytes.Compare(append(accountHash[:], storageHash[:]...), dl.genMarker) <= 0
+}
+
+// flatten merges the given diff layer (which must be a direct child of this
+// one) into the persistent database, returning the new disk layer and marking
+// both the old disk layer and the diff stale. The generator of the layer must
+// not be running while flattening.
+//
+// Items not yet covered by an interrupted generation are skipped, those will be
+// picked up from the new state trie once generation is resumed.
+func (dl *diskLayer) flatten(diff *diffLayer) *diskLayer {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	diff.lock.Lock()
+	defer diff.lock.Unlock()
+
+	batch := dl.diskdb.NewBatch()
+	flush := func() {
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				log.Crit("Failed to write state snapshot", "err", err)
+			}
+			batch.Reset()
+		}
+	}
+	// Wipe out the accounts (and their storage) that were destructed first
+	for hash := range diff.destructSet {
+		if dl.accountCovered(hash) {
+			rawdb.DeleteAccountSnapshot(batch, hash)
+			dl.cache.Remove(string(hash[:]))
+		}
+		prefix := append(append([]byte{}, rawdb.SnapshotStoragePrefix...), hash[:]...)
+		it := dl.diskdb.(iteratee).NewIteratorWithPrefix(prefix)
+		for it.Next() {
+			key := it.Key()
+			if len(key) != len(rawdb.SnapshotStoragePrefix)+2*common.HashLength {
+				continue
+			}
+			batch.Delete(key)
+			dl.cache.Remove(string(key[len(rawdb.SnapshotStoragePrefix):]))
+			flush()
+		}
+		it.Release()
+		flush()
+	}
+	// Push all updated accounts into the database
+	for hash, data := range diff.accountData {
+		if !dl.accountCovered(hash) {
+			continue
+		}
+		if len(data) > 0 {
+			rawdb.WriteAccountSnapshot(batch, hash, data)
+		} else {
+			rawdb.DeleteAccountSnapshot(batch, hash)
+		}
+		dl.cache.Add(string(hash[:]), data)
+		flush()
+	}
+	// Push all the storage slots into the database
+	for accountHash, storage := range diff.storageData {
+		for storageHash, data := range storage {
+			if !dl.storageCovered(accountHash, storageHash) {
+				continue
+			}
+			if len(data) > 0 {
+				rawdb.WriteStorageSnapshot(batch, accountHash, storageHash, data)
+			} else {
+				rawdb.DeleteStorageSnapshot(batch, accountHash, storageHash)
+			}
+			dl.cache.Add(string(append(accountHash[:], storageHash[:]...)), data)
+			flush()
+		}
+	}
+	// Update the snapshot block marker and write any remainder data
+	rawdb.WriteSnapshotRoot(batch, diff.root)
+	if dl.genMarker != nil {
+		rawdb.WriteSnapshotGenerator(batch, dl.genMarker)
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write state snapshot", "err", err)
+	}
+	dl.stale, diff.stale = true, true
+
+	log.Debug("Flattened snapshot diff layer", "root", diff.root, "accounts", len(diff.accountData), "destructs", len(diff.destructSet))
+	return &diskLayer{
+		diskdb:    dl.diskdb,
+		triedb:    dl.triedb,
+		cache:     dl.cache,
+		root:      diff.root,
+		genMarker: dl.genMarker,
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/rlp"
+	"github.com/themis-network/go-themis/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// storageDone is the storage part of a generator marker denoting that all
+	// the slots of an account have been indexed.
+	storageDone = bytes.Repeat([]byte{0xff}, common.HashLength)
+)
+
+// account is the consensus representation of accounts, as stored in the leaves
+// of the account trie. It mirrors state.Account to avoid an import cycle.
+type account struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash
+	CodeHash []byte
+}
+
+// generatorStats is a collection of statistics gathered by the snapshot generator
+// for logging purposes.
+type generatorStats struct {
+	start    time.Time // Timestamp when generation started
+	accounts uint64    // Number of accounts indexed
+	slots    uint64    // Number of storage slots indexed
+	logged   time.Time // Timestamp of the last progress report
+}
+
+// log prints the current generation progress if enough time passed since the
+// last report, or unconditionally if forced.
+func (gs *generatorStats) log(msg string, root common.Hash, marker []byte, force bool) {
+	if !force && time.Since(gs.logged) < 8*time.Second {
+		return
+	}
+	ctx := []interface{}{"root", root, "accounts", gs.accounts, "slots", gs.slots, "elapsed", common.PrettyDuration(time.Since(gs.start))}
+	if marker != nil {
+		ctx = append(ctx, "at", common.ToHex(marker))
+	}
+	log.Info(msg, ctx...)
+	gs.logged = time.Now()
+}
+
+// generateSnapshot regenerates a brand new snapshot based on an existing state
+// database and head block asynchronously. The snapshot is returned immediately
+// and generation is continued in the background until done.
+func generateSnapshot(diskdb ethdb.Database, triedb *trie.Database, root common.Hash) *diskLayer {
+	// Invalidate any previous snapshot until the old entries are wiped
+	rawdb.DeleteSnapshotRoot(diskdb)
+
+	base := newDiskLayer(diskdb, triedb, root, []byte{})
+	base.startGeneration(true)
+
+	log.Info("Started state snapshot generation", "root", root)
+	return base
+}
+
+// startGeneration launches the background generator of the layer, optionally
+// wiping all previous snapshot entries from the database first.
+func (dl *diskLayer) startGeneration(wipe bool) {
+	dl.genAbort = make(chan chan struct{})
+	dl.genDone = make(chan struct{})
+	go dl.generate(wipe)
+}
+
+// stopGeneration aborts the background generator of the layer if it's running,
+// waiting until its progress is persisted.
+func (dl *diskLayer) stopGeneration() {
+	if dl.genAbort == nil {
+		return
+	}
+	abort := make(chan struct{})
+	select {
+	case dl.genAbort <- abort:
+		<-abort
+	case <-dl.genDone:
+	}
+}
+
+// wipeSnapshot deletes all the snapshot entries from the database.
+func wipeSnapshot(diskdb ethdb.Database) {
+	batch := diskdb.NewBatch()
+	for _, wipe := range []struct {
+		prefix []byte
+		keylen int
+	}{
+		{rawdb.SnapshotAccountPrefix, len(rawdb.SnapshotAccountPrefix) + common.HashLength},
+		{rawdb.SnapshotStoragePrefix, len(rawdb.SnapshotStoragePrefix) + 2*common.HashLength},
+	} {
+		it := diskdb.(iteratee).NewIteratorWithPrefix(wipe.prefix)
+		for it.Next() {
+			// Other data (e.g. trie nodes) may share the prefix, filter by length
+			if len(it.Key()) != wipe.keylen {
+				continue
+			}
+			batch.Delete(it.Key())
+			if batch.ValueSize() >= ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					log.Crit("Failed to wipe state snapshot", "err", err)
+				}
+				batch.Reset()
+			}
+		}
+		it.Release()
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to wipe state snapshot", "err", err)
+	}
+}
+
+// generate is a background thread that iterates over the state and storage tries
+// of the layer's root and constructs a state snapshot, starting from the layer's
+// generation marker. Progress is persisted along the way, and the method is often
+// restarted as the chain progresses and diff layers are flattened into the disk.
+//
+// If the tries can't be iterated (e.g. the nodes of the root were garbage
+// collected already), the generator stops and waits to be restarted on a newer
+// root, resuming from its last marker.
+func (dl *diskLayer) generate(wipe bool) {
+	defer close(dl.genDone)
+
+	if wipe {
+		wipeSnapshot(dl.diskdb)
+	}
+	dl.lock.RLock()
+	stats := &generatorStats{start: time.Now(), logged: time.Now()}
+	accMarker, storeMarker := dl.genMarker, []byte(nil)
+	if len(accMarker) > common.HashLength {
+		accMarker, storeMarker = accMarker[:common.HashLength], accMarker[common.HashLength:]
+	}
+	dl.lock.RUnlock()
+
+	batch := dl.diskdb.NewBatch()
+	rawdb.WriteSnapshotRoot(batch, dl.root)
+
+	// commit writes the accumulated batch and advances the in-memory marker,
+	// making the newly indexed entries available to readers.
+	commit := func(marker []byte) {
+		if marker != nil {
+			rawdb.WriteSnapshotGenerator(batch, marker)
+		} else {
+			rawdb.DeleteSnapshotGenerator(batch)
+		}
+		if err := batch.Write(); err != nil {
+			log.Crit("Failed to write state snapshot", "err", err)
+		}
+		batch.Reset()
+
+		dl.lock.Lock()
+		dl.genMarker = marker
+		dl.lock.Unlock()
+	}
+	// checkAbort persists the progress and returns true if an abort was requested.
+	checkAbort := func(marker []byte) bool {
+		if batch.ValueSize() < ethdb.IdealBatchSize {
+			select {
+			case abort := <-dl.genAbort:
+				commit(marker)
+				stats.log("Aborting state snapshot generation", dl.root, marker, true)
+				close(abort)
+				return true
+			default:
+				return false
+			}
+		}
+		commit(marker)
+		stats.log("Generating state snapshot", dl.root, marker, false)
+		return false
+	}
+	// Persist the root along with the initial marker before indexing anything
+	commit(dl.genMarker)
+
+	accTrie, err := trie.New(dl.root, dl.triedb)
+	if err != nil {
+		log.Warn("Failed to open account trie for snapshot generation", "root", dl.root, "err", err)
+		return
+	}
+	accIt := trie.NewIterator(accTrie.NodeIterator(accMarker))
+	for accIt.Next() {
+		accountHash := common.BytesToHash(accIt.Key)
+
+		var acc account
+		if err := rlp.DecodeBytes(accIt.Value, &acc); err != nil {
+			log.Crit("Invalid account encountered during snapshot creation", "err", err)
+		}
+		rawdb.WriteAccountSnapshot(batch, accountHash, accIt.Value)
+		stats.accounts++
+
+		marker := accountHash[:]
+		if checkAbort(marker) {
+			return
+		}
+		// If the account has storage, index all of its slots too
+		if acc.Root != emptyRoot {
+			// Only resume mid-storage for the account the marker points into
+			var start []byte
+			if storeMarker != nil && bytes.Equal(accountHash[:], accMarker) {
+				start = storeMarker
+			}
+			storeTrie, err := trie.New(acc.Root, dl.triedb)
+			if err != nil {
+				log.Warn("Failed to open storage trie for snapshot generation", "root", acc.Root, "err", err)
+				return
+			}
+			storeIt := trie.NewIterator(storeTrie.NodeIterator(start))
+			for storeIt.Next() {
+				rawdb.WriteStorageSnapshot(batch, accountHash, common.BytesToHash(storeIt.Key), storeIt.Value)
+				stats.slots++
+
+				if checkAbort(append(accountHash[:], storeIt.Key...)) {
+					return
+				}
+			}
+			if storeIt.Err != nil {
+				log.Warn("Failed to iterate storage trie for snapshot generation", "root", acc.Root, "err", storeIt.Err)
+				return
+			}
+		}
+		if checkAbort(append(accountHash[:], storageDone...)) {
+			return
+		}
+	}
+	if accIt.Err != nil {
+		log.Warn("Failed to iterate account trie for snapshot generation", "root", dl.root, "err", accIt.Err)
+		return
+	}
+	// Snapshot fully generated, mark it complete and report
+	commit(nil)
+	stats.log("Generated state snapshot", dl.root, nil, true)
+}
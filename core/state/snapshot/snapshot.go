@@ -0,0 +1,289 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snapshot implements a flat, hash keyed view of the account and storage
+// tries, allowing O(1) state reads instead of trie traversals.
+//
+// The snapshot is organised as a tree of layers: a single persistent disk layer
+// holding the flattened state of some older block, with in-memory diff layers
+// stacked on top of it, one per recently processed block.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/trie"
+)
+
+var (
+	// ErrSnapshotStale is returned from data accessors if the underlying snapshot
+	// layer had been invalidated due to the chain progressing forward far enough
+	// to not maintain the layer's original state.
+	ErrSnapshotStale = errors.New("snapshot stale")
+
+	// ErrNotCoveredYet is returned from data accessors if the underlying snapshot
+	// is being generated currently and the requested data item is not yet in the
+	// range of accounts covered.
+	ErrNotCoveredYet = errors.New("not covered yet")
+
+	// errSnapshotCycle is returned if a snapshot is attempted to be inserted
+	// that forms a cycle in the snapshot tree.
+	errSnapshotCycle = errors.New("snapshot cycle")
+
+	// errUnsupportedDatabase is returned if the backing database can't iterate
+	// over its content, which is needed to wipe stale snapshot entries.
+	errUnsupportedDatabase = errors.New("database doesn't support iteration")
+)
+
+// Snapshot represents the functionality supported by a snapshot storage layer.
+// The returned values are the raw leaf values of the account and storage tries,
+// or nil if the requested item doesn't exist.
+type Snapshot interface {
+	// Root returns the root hash for which this snapshot was made.
+	Root() common.Hash
+
+	// Account directly retrieves the account trie value associated with a
+	// particular account hash.
+	Account(hash common.Hash) ([]byte, error)
+
+	// Storage directly retrieves the storage trie value associated with a
+	// particular slot hash within a particular account.
+	Storage(accountHash, storageHash common.Hash) ([]byte, error)
+}
+
+// snapshot is the internal version of the snapshot data layer that supports some
+// additional methods compared to the public API.
+type snapshot interface {
+	Snapshot
+
+	// Parent returns the subsequent layer of a snapshot, or nil if the base was
+	// reached.
+	Parent() snapshot
+
+	// Update creates a new layer on top of the existing snapshot diff tree with
+	// the specified data items.
+	Update(blockRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) *diffLayer
+
+	// Stale return whether this layer has become stale (was flattened across) or
+	// if it's still live.
+	Stale() bool
+}
+
+// iteratee is implemented by databases able to iterate over a subset of their
+// content, which the snapshot needs to wipe the entries of deleted accounts.
+type iteratee interface {
+	NewIteratorWithPrefix(prefix []byte) iterator.Iterator
+}
+
+// Tree is a state snapshot tree. It consists of one persistent base layer backed
+// by a key-value store, on top of which arbitrarily many in-memory diff layers
+// are topped. The memory diffs can form a tree with branching, but the disk layer
+// is singleton and common to all. If a reorg goes deeper than the disk layer,
+// the whole snapshot needs to be regenerated.
+type Tree struct {
+	diskdb ethdb.Database           // Persistent database to store the snapshot
+	triedb *trie.Database           // In-memory cache to access the trie through
+	layers map[common.Hash]snapshot // Collection of all known layers
+	lock   sync.RWMutex
+}
+
+// New attempts to load an already existing snapshot from a persistent key-value
+// store, ensuring that the head of the snapshot matches the expected one.
+//
+// If the snapshot is missing, only partially generated or doesn't match the
+// requested root, it is (re)generated in the background. Until the generator
+// covers a particular account, reads of it fail with ErrNotCoveredYet.
+func New(diskdb ethdb.Database, triedb *trie.Database, root common.Hash) (*Tree, error) {
+	if _, ok := diskdb.(iteratee); !ok {
+		return nil, errUnsupportedDatabase
+	}
+	base := loadSnapshot(diskdb, triedb)
+	if base != nil && base.root != root {
+		log.Warn("Snapshot doesn't match head state, rebuilding", "snapshot", base.root, "head", root)
+		base.stopGeneration()
+		base = nil
+	}
+	if base == nil {
+		base = generateSnapshot(diskdb, triedb, root)
+	}
+	return &Tree{
+		diskdb: diskdb,
+		triedb: triedb,
+		layers: map[common.Hash]snapshot{base.root: base},
+	}, nil
+}
+
+// Snapshot retrieves a snapshot belonging to the given block root, or nil if no
+// snapshot is maintained for that block.
+func (t *Tree) Snapshot(blockRoot common.Hash) Snapshot {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if layer, ok := t.layers[blockRoot]; ok {
+		return layer
+	}
+	return nil
+}
+
+// Update adds a new snapshot into the tree, if that can be linked to an existing
+// old parent. It is disallowed to insert a disk layer (the origin of all).
+//
+// The map arguments are taken over by the snapshot and must not be modified by
+// the caller afterwards.
+func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+	// Reject noop updates to avoid self-loops in the snapshot tree. This is a
+	// special case that can only happen for Clique networks where empty blocks
+	// don't modify the state (0 block subsidy).
+	if blockRoot == parentRoot {
+		return errSnapshotCycle
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Re-committing an already known state (e.g. during tracing) is a noop
+	if _, ok := t.layers[blockRoot]; ok {
+		return nil
+	}
+	parent, ok := t.layers[parentRoot]
+	if !ok {
+		return fmt.Errorf("parent [%#x] snapshot missing", parentRoot)
+	}
+	t.layers[blockRoot] = parent.Update(blockRoot, destructs, accounts, storage)
+	return nil
+}
+
+// Cap traverses downwards the snapshot tree from a head block hash until the
+// number of allowed diff layers are crossed. All layers beyond the permitted
+// number are flattened downwards into the disk layer, and every fork that does
+// not descend from the new disk layer anymore is dropped.
+//
+// Note, the final diff layer count in general will be one more than the amount
+// requested. This happens because the bottom-most diff layer is the accumulator
+// which may or may not overflow and cascade to disk.
+func (t *Tree) Cap(root common.Hash, layers int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	snap, ok := t.layers[root]
+	if !ok {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	diff, ok := snap.(*diffLayer)
+	if !ok {
+		return nil // Head is the disk layer, nothing to flatten
+	}
+	// Walk down the requested number of layers to find the new bottom layer
+	for ; layers > 0; layers-- {
+		parent, ok := diff.Parent().(*diffLayer)
+		if !ok {
+			return nil // Not enough diff layers to flatten anything
+		}
+		diff = parent
+	}
+	// Collect all the layers below (and including) the new bottom one and merge
+	// them into the disk layer, oldest first
+	var chain []*diffLayer
+	for layer := snapshot(diff); ; layer = layer.Parent() {
+		dl, ok := layer.(*diffLayer)
+		if !ok {
+			break
+		}
+		chain = append(chain, dl)
+	}
+	base := chain[len(chain)-1].Parent().(*diskLayer)
+	base.stopGeneration()
+	for i := len(chain) - 1; i >= 0; i-- {
+		base = base.flatten(chain[i])
+	}
+	if base.genMarker != nil {
+		base.startGeneration(false)
+	}
+	// Relink the children of the flattened layer to the new disk layer and drop
+	// all the layers that got disconnected from it
+	for _, layer := range t.layers {
+		if dl, ok := layer.(*diffLayer); ok && dl.Parent() == snapshot(diff) {
+			dl.setParent(base)
+		}
+	}
+	layerSet := map[common.Hash]snapshot{base.root: base}
+	for hash, layer := range t.layers {
+		for current := layer; current != nil; current = current.Parent() {
+			if current == snapshot(base) {
+				layerSet[hash] = layer
+				break
+			}
+		}
+	}
+	t.layers = layerSet
+	return nil
+}
+
+// Rebuild wipes all available snapshot data from the persistent database and
+// discards all caches and diff layers. Afterwards, it starts a new snapshot
+// generator with the given root hash.
+func (t *Tree) Rebuild(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	log.Warn("Rebuilding state snapshot", "root", root)
+	for _, layer := range t.layers {
+		switch layer := layer.(type) {
+		case *diskLayer:
+			layer.stopGeneration()
+			layer.markStale()
+		case *diffLayer:
+			layer.markStale()
+		}
+	}
+	base := generateSnapshot(t.diskdb, t.triedb, root)
+	t.layers = map[common.Hash]snapshot{base.root: base}
+}
+
+// Stop terminates any running background generation, persisting its progress
+// so it can be resumed on the next startup.
+func (t *Tree) Stop() {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	for _, layer := range t.layers {
+		if dl, ok := layer.(*diskLayer); ok {
+			dl.stopGeneration()
+		}
+	}
+}
+
+// loadSnapshot loads a pre-existing state snapshot backed by a key-value store,
+// resuming its generation if it was interrupted. Nil is returned if there is no
+// persisted snapshot.
+func loadSnapshot(diskdb ethdb.Database, triedb *trie.Database) *diskLayer {
+	root := rawdb.ReadSnapshotRoot(diskdb)
+	if root == (common.Hash{}) {
+		return nil
+	}
+	base := newDiskLayer(diskdb, triedb, root, rawdb.ReadSnapshotGenerator(diskdb))
+	if base.genMarker != nil {
+		log.Info("Resuming state snapshot generation", "root", root, "at", common.ToHex(base.genMarker))
+		base.startGeneration(false)
+	}
+	return base
+}
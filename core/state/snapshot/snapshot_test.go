@@ -0,0 +1,175 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/rlp"
+	"github.com/themis-network/go-themis/trie"
+)
+
+// makeAccount creates an RLP encoded account with the given balance and storage
+// root.
+func makeAccount(balance int64, root common.Hash) []byte {
+	blob, _ := rlp.EncodeToBytes(&account{Balance: big.NewInt(balance), Root: root, CodeHash: crypto.Keccak256(nil)})
+	return blob
+}
+
+// waitGeneration blocks until the background generator of the tree's disk layer
+// terminates.
+func waitGeneration(t *testing.T, tree *Tree) *diskLayer {
+	tree.lock.RLock()
+	var base *diskLayer
+	for _, layer := range tree.layers {
+		if dl, ok := layer.(*diskLayer); ok {
+			base = dl
+		}
+	}
+	tree.lock.RUnlock()
+
+	select {
+	case <-base.genDone:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("snapshot generation timed out")
+	}
+	return base
+}
+
+// Tests that a snapshot generated from a state trie contains all of its accounts
+// and storage slots, and that the result is persisted.
+func TestGeneration(t *testing.T) {
+	diskdb := ethdb.NewMemDatabase()
+	triedb := trie.NewDatabase(diskdb)
+
+	storage, _ := trie.New(common.Hash{}, triedb)
+	storage.Update(common.HexToHash("0x01").Bytes(), []byte("val-1"))
+	storage.Update(common.HexToHash("0x02").Bytes(), []byte("val-2"))
+	storageRoot, _ := storage.Commit(nil)
+
+	accounts, _ := trie.New(common.Hash{}, triedb)
+	accounts.Update(common.HexToHash("0xa1").Bytes(), makeAccount(1, emptyRoot))
+	accounts.Update(common.HexToHash("0xa2").Bytes(), makeAccount(2, storageRoot))
+	accounts.Update(common.HexToHash("0xa3").Bytes(), makeAccount(3, emptyRoot))
+	root, _ := accounts.Commit(nil)
+	triedb.Commit(root, false)
+
+	tree, err := New(diskdb, triedb, root)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	if base := waitGeneration(t, tree); base.genMarker != nil {
+		t.Fatalf("generation marker mismatch: have %x, want nil", base.genMarker)
+	}
+	snap := tree.Snapshot(root)
+	for i, hash := range []string{"0xa1", "0xa2", "0xa3"} {
+		blob, err := snap.Account(common.HexToHash(hash))
+		if err != nil {
+			t.Fatalf("account %s: failed to retrieve: %v", hash, err)
+		}
+		want := makeAccount(int64(i+1), emptyRoot)
+		if i == 1 {
+			want = makeAccount(2, storageRoot)
+		}
+		if !bytes.Equal(blob, want) {
+			t.Errorf("account %s: value mismatch: have %x, want %x", hash, blob, want)
+		}
+	}
+	if blob, _ := snap.Storage(common.HexToHash("0xa2"), common.HexToHash("0x02")); !bytes.Equal(blob, []byte("val-2")) {
+		t.Errorf("storage value mismatch: have %x, want %x", blob, []byte("val-2"))
+	}
+	if blob, _ := snap.Account(common.HexToHash("0xff")); blob != nil {
+		t.Errorf("missing account retrieved: %x", blob)
+	}
+	// Reopening the tree should load the snapshot without regenerating it
+	if have := rawdb.ReadSnapshotRoot(diskdb); have != root {
+		t.Fatalf("persisted root mismatch: have %x, want %x", have, root)
+	}
+	if base := loadSnapshot(diskdb, triedb); base == nil || base.genMarker != nil {
+		t.Fatalf("failed to load completed snapshot")
+	}
+}
+
+// Tests that diff layers shadow their parents, that destructed accounts hide the
+// storage of older layers and that capping flattens the diffs into the disk.
+func TestDiffLayersAndCap(t *testing.T) {
+	diskdb := ethdb.NewMemDatabase()
+	triedb := trie.NewDatabase(diskdb)
+
+	var (
+		base = common.HexToHash("0x01")
+		acc1 = common.HexToHash("0xa1")
+		acc2 = common.HexToHash("0xa2")
+		slot = common.HexToHash("0x11")
+	)
+	rawdb.WriteSnapshotRoot(diskdb, base)
+	rawdb.WriteAccountSnapshot(diskdb, acc1, []byte("acc1-disk"))
+	rawdb.WriteAccountSnapshot(diskdb, acc2, []byte("acc2-disk"))
+	rawdb.WriteStorageSnapshot(diskdb, acc2, slot, []byte("slot-disk"))
+
+	tree, err := New(diskdb, triedb, base)
+	if err != nil {
+		t.Fatalf("failed to create snapshot tree: %v", err)
+	}
+	// Layer 2 modifies an account, layer 3 destructs another one
+	tree.Update(common.HexToHash("0x02"), base, nil, map[common.Hash][]byte{acc1: []byte("acc1-diff")}, nil)
+	tree.Update(common.HexToHash("0x03"), common.HexToHash("0x02"), map[common.Hash]struct{}{acc2: {}}, nil, nil)
+
+	snap := tree.Snapshot(common.HexToHash("0x03"))
+	if blob, _ := snap.Account(acc1); !bytes.Equal(blob, []byte("acc1-diff")) {
+		t.Errorf("account value mismatch: have %s, want %s", blob, "acc1-diff")
+	}
+	if blob, _ := snap.Account(acc2); blob != nil {
+		t.Errorf("destructed account retrieved: %s", blob)
+	}
+	if blob, _ := snap.Storage(acc2, slot); blob != nil {
+		t.Errorf("destructed storage retrieved: %s", blob)
+	}
+	if blob, _ := tree.Snapshot(common.HexToHash("0x02")).Storage(acc2, slot); !bytes.Equal(blob, []byte("slot-disk")) {
+		t.Errorf("storage value mismatch: have %s, want %s", blob, "slot-disk")
+	}
+	// Flatten everything into the disk and check the old layers became unusable
+	old := tree.Snapshot(common.HexToHash("0x02"))
+	if err := tree.Cap(common.HexToHash("0x03"), 0); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if len(tree.layers) != 1 {
+		t.Fatalf("layer count mismatch: have %d, want 1", len(tree.layers))
+	}
+	if _, err := old.Account(acc1); err != ErrSnapshotStale {
+		t.Errorf("stale layer error mismatch: have %v, want %v", err, ErrSnapshotStale)
+	}
+	if have := rawdb.ReadSnapshotRoot(diskdb); have != common.HexToHash("0x03") {
+		t.Errorf("persisted root mismatch: have %x, want %x", have, common.HexToHash("0x03"))
+	}
+	if blob := rawdb.ReadAccountSnapshot(diskdb, acc1); !bytes.Equal(blob, []byte("acc1-diff")) {
+		t.Errorf("persisted account mismatch: have %s, want %s", blob, "acc1-diff")
+	}
+	if blob := rawdb.ReadAccountSnapshot(diskdb, acc2); len(blob) != 0 {
+		t.Errorf("destructed account persisted: %s", blob)
+	}
+	if blob := rawdb.ReadStorageSnapshot(diskdb, acc2, slot); len(blob) != 0 {
+		t.Errorf("destructed storage persisted: %s", blob)
+	}
+}
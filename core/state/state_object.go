@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"sort"
 
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/crypto"
@@ -125,11 +126,16 @@ func (c *stateObject) EncodeRLP(w io.Writer) error {
 	return rlp.Encode(w, c.data)
 }
 
-// setError remembers the first non-nil error it is called with.
+// setError remembers the first non-nil error it is called with. On witness
+// databases the error is reported to the owning state database too, as missing
+// storage nodes there mean an incomplete witness.
 func (self *stateObject) setError(err error) {
 	if self.dbErr == nil {
 		self.dbErr = err
 	}
+	if self.db.ordered {
+		self.db.setError(err)
+	}
 }
 
 func (self *stateObject) markSuicided() {
@@ -165,11 +171,24 @@ func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
 	if exists {
 		return value
 	}
-	// Load from DB in case it is missing.
-	enc, err := self.getTrie(db).TryGet(key[:])
-	if err != nil {
-		self.setError(err)
-		return common.Hash{}
+	// Load from the snapshot if it covers the slot, from the trie otherwise. If
+	// the account was destructed, the snapshot's view of the storage is stale.
+	var (
+		enc []byte
+		err error
+	)
+	if self.db.snap != nil {
+		if _, destructed := self.db.snapDestructs[self.addrHash]; destructed {
+			self.cachedStorage[key] = common.Hash{}
+			return common.Hash{}
+		}
+		enc, err = self.db.snap.Storage(self.addrHash, crypto.Keccak256Hash(key[:]))
+	}
+	if self.db.snap == nil || err != nil {
+		if enc, err = self.getTrie(db).TryGet(key[:]); err != nil {
+			self.setError(err)
+			return common.Hash{}
+		}
 	}
 	if len(enc) > 0 {
 		_, content, _, err := rlp.Split(enc)
@@ -200,17 +219,51 @@ func (self *stateObject) setState(key, value common.Hash) {
 // updateTrie writes cached storage modifications into the object's storage trie.
 func (self *stateObject) updateTrie(db Database) Trie {
 	tr := self.getTrie(db)
-	for key, value := range self.dirtyStorage {
-		delete(self.dirtyStorage, key)
-		if (value == common.Hash{}) {
-			self.setError(tr.TryDelete(key[:]))
-			continue
+
+	// Track the storage changes for the snapshot too
+	var storage map[common.Hash][]byte
+	if self.db.snap != nil && len(self.dirtyStorage) > 0 {
+		if storage = self.db.snapStorage[self.addrHash]; storage == nil {
+			storage = make(map[common.Hash][]byte)
+			self.db.snapStorage[self.addrHash] = storage
 		}
+	}
+	if self.db.ordered {
+		// Apply the changes in a deterministic order, so that the trie nodes resolved
+		// along the way (e.g. siblings of deleted nodes) don't vary between runs
+		keys := make([]common.Hash, 0, len(self.dirtyStorage))
+		for key := range self.dirtyStorage {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+
+		for _, key := range keys {
+			self.updateSlot(tr, storage, key, self.dirtyStorage[key])
+		}
+	} else {
+		for key, value := range self.dirtyStorage {
+			self.updateSlot(tr, storage, key, value)
+		}
+	}
+	return tr
+}
+
+// updateSlot writes a dirty storage slot into the storage trie, and into the
+// snapshot changes if they are tracked.
+func (self *stateObject) updateSlot(tr Trie, storage map[common.Hash][]byte, key, value common.Hash) {
+	delete(self.dirtyStorage, key)
+
+	var v []byte
+	if (value == common.Hash{}) {
+		self.setError(tr.TryDelete(key[:]))
+	} else {
 		// Encoding []byte cannot fail, ok to ignore the error.
-		v, _ := rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
+		v, _ = rlp.EncodeToBytes(bytes.TrimLeft(value[:], "\x00"))
 		self.setError(tr.TryUpdate(key[:], v))
 	}
-	return tr
+	if storage != nil {
+		storage[crypto.Keccak256Hash(key[:])] = v // v will be nil if value is 0x00
+	}
 }
 
 // UpdateRoot sets the trie root to the current root hash of
@@ -19,6 +19,7 @@ package state
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
@@ -435,3 +436,45 @@ func TestCopyOfCopy(t *testing.T) {
 		t.Fatalf("2nd copy fail, expected 42, got %v", got)
 	}
 }
+
+// Tests that trie updates are only ordered on top of databases recording or
+// replaying witnesses, and that copies retain the ordering.
+func TestOrderedUpdates(t *testing.T) {
+	db := NewDatabase(ethdb.NewMemDatabase())
+	tests := []struct {
+		db      Database
+		ordered bool
+	}{
+		{db, false},
+		{NewRecordingDatabase(db), true},
+		{NewWitnessDatabase(nil), true},
+	}
+	for i, tt := range tests {
+		sdb, err := New(common.Hash{}, tt.db)
+		if err != nil {
+			t.Fatalf("test %d: failed to create state: %v", i, err)
+		}
+		if sdb.ordered != tt.ordered || sdb.Copy().ordered != tt.ordered {
+			t.Errorf("test %d: ordering mismatch: have %t/%t, want %t", i, sdb.ordered, sdb.Copy().ordered, tt.ordered)
+		}
+	}
+}
+
+// Tests that storage errors of state objects are only reported to the state on
+// witness databases.
+func TestStorageErrorScope(t *testing.T) {
+	var (
+		addr = common.HexToAddress("0x01")
+		fail = errors.New("missing storage node")
+	)
+	state, _ := New(common.Hash{}, NewDatabase(ethdb.NewMemDatabase()))
+	state.GetOrNewStateObject(addr).setError(fail)
+	if err := state.Error(); err != nil {
+		t.Errorf("storage error reported to the state: %v", err)
+	}
+	state, _ = New(common.Hash{}, NewWitnessDatabase(nil))
+	state.GetOrNewStateObject(addr).setError(fail)
+	if err := state.Error(); err != fail {
+		t.Errorf("witness storage error mismatch: have %v, want %v", err, fail)
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/rlp"
+	"github.com/themis-network/go-themis/trie"
+)
+
+// AccountDiff is the change of a single account between two states.
+type AccountDiff struct {
+	Address common.Address               `json:"address"`
+	Before  *AccountValues               `json:"before"` // Nil if the account didn't exist
+	After   *AccountValues               `json:"after"`  // Nil if the account was deleted
+	Storage map[common.Hash]*StorageDiff `json:"storage,omitempty"`
+}
+
+// AccountValues are the fields of an account at one side of a diff. The code is
+// only included if it changed.
+type AccountValues struct {
+	Balance  *hexutil.Big   `json:"balance"`
+	Nonce    hexutil.Uint64 `json:"nonce"`
+	CodeHash common.Hash    `json:"codeHash"`
+	Code     hexutil.Bytes  `json:"code,omitempty"`
+}
+
+// StorageDiff is the change of a single storage slot between two states. Missing
+// slots are reported as zero.
+type StorageDiff struct {
+	Before common.Hash `json:"before"`
+	After  common.Hash `json:"after"`
+}
+
+// DiffStates computes the changes of every account, and of every storage slot
+// in them, between two state roots. Only the trie paths that differ are walked,
+// so the cost is proportional to the size of the change, not of the state. The
+// accounts are sorted by address.
+func DiffStates(db Database, from, to common.Hash) ([]*AccountDiff, error) {
+	before, err := db.OpenTrie(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := db.OpenTrie(to)
+	if err != nil {
+		return nil, err
+	}
+	olds, news, err := diffTries(before, after)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[common.Hash]struct{}, len(news))
+	for hash := range olds {
+		hashes[hash] = struct{}{}
+	}
+	for hash := range news {
+		hashes[hash] = struct{}{}
+	}
+	diffs := make([]*AccountDiff, 0, len(hashes))
+	for hash := range hashes {
+		key := after.GetKey(hash[:])
+		if key == nil {
+			return nil, fmt.Errorf("no preimage found for hash %x", hash)
+		}
+		diff, err := diffAccount(db, common.BytesToAddress(key), olds[hash], news[hash])
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, diff)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return bytes.Compare(diffs[i].Address[:], diffs[j].Address[:]) < 0
+	})
+	return diffs, nil
+}
+
+// diffAccount computes the change of a single account from its RLP encoded
+// values before and after.
+func diffAccount(db Database, addr common.Address, before, after []byte) (*AccountDiff, error) {
+	var (
+		addrHash   = crypto.Keccak256Hash(addr[:])
+		diff       = &AccountDiff{Address: addr}
+		prev, post Account
+	)
+	if before != nil {
+		if err := rlp.DecodeBytes(before, &prev); err != nil {
+			return nil, fmt.Errorf("invalid account %x: %v", addr, err)
+		}
+		diff.Before = &AccountValues{
+			Balance:  (*hexutil.Big)(prev.Balance),
+			Nonce:    hexutil.Uint64(prev.Nonce),
+			CodeHash: common.BytesToHash(prev.CodeHash),
+		}
+	}
+	if after != nil {
+		if err := rlp.DecodeBytes(after, &post); err != nil {
+			return nil, fmt.Errorf("invalid account %x: %v", addr, err)
+		}
+		diff.After = &AccountValues{
+			Balance:  (*hexutil.Big)(post.Balance),
+			Nonce:    hexutil.Uint64(post.Nonce),
+			CodeHash: common.BytesToHash(post.CodeHash),
+		}
+	}
+	// Attach the codes if they changed
+	if !bytes.Equal(prev.CodeHash, post.CodeHash) {
+		for _, values := range []*AccountValues{diff.Before, diff.After} {
+			if values == nil || values.CodeHash == common.BytesToHash(emptyCodeHash) {
+				continue
+			}
+			code, err := db.ContractCode(addrHash, values.CodeHash)
+			if err != nil {
+				return nil, err
+			}
+			values.Code = code
+		}
+	}
+	// Diff the storage tries if they changed
+	if prev.Root == post.Root {
+		return diff, nil
+	}
+	oldTrie, err := db.OpenStorageTrie(addrHash, prev.Root)
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := db.OpenStorageTrie(addrHash, post.Root)
+	if err != nil {
+		return nil, err
+	}
+	olds, news, err := diffTries(oldTrie, newTrie)
+	if err != nil {
+		return nil, err
+	}
+	diff.Storage = make(map[common.Hash]*StorageDiff)
+	for _, values := range []map[common.Hash][]byte{olds, news} {
+		for hash := range values {
+			key := newTrie.GetKey(hash[:])
+			if key == nil {
+				return nil, fmt.Errorf("no preimage found for storage hash %x of %x", hash, addr)
+			}
+			slot := common.BytesToHash(key)
+			if _, ok := diff.Storage[slot]; ok {
+				continue
+			}
+			before, err := decodeStorage(olds[hash])
+			if err != nil {
+				return nil, err
+			}
+			after, err := decodeStorage(news[hash])
+			if err != nil {
+				return nil, err
+			}
+			diff.Storage[slot] = &StorageDiff{Before: before, After: after}
+		}
+	}
+	return diff, nil
+}
+
+// diffTries returns the values of the leaves that differ between two tries, keyed
+// by their (hashed) trie key: the values in the first trie, and the ones in the
+// second. Leaves missing from one of the tries are absent from its map.
+func diffTries(a, b Trie) (map[common.Hash][]byte, map[common.Hash][]byte, error) {
+	collect := func(from, to Trie) (map[common.Hash][]byte, error) {
+		diff, _ := trie.NewDifferenceIterator(from.NodeIterator(nil), to.NodeIterator(nil))
+		it := trie.NewIterator(diff)
+
+		values := make(map[common.Hash][]byte)
+		for it.Next() {
+			values[common.BytesToHash(it.Key)] = common.CopyBytes(it.Value)
+		}
+		return values, it.Err
+	}
+	olds, err := collect(b, a)
+	if err != nil {
+		return nil, nil, err
+	}
+	news, err := collect(a, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return olds, news, nil
+}
+
+// decodeStorage decodes a storage trie value, returning zero for missing slots.
+func decodeStorage(enc []byte) (common.Hash, error) {
+	if enc == nil {
+		return common.Hash{}, nil
+	}
+	_, content, _, err := rlp.Split(enc)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(content), nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/ethdb"
+)
+
+// Tests that state diffs report the before and after values of every changed
+// account field and storage slot, and nothing else.
+func TestDiffStates(t *testing.T) {
+	var (
+		db       = NewDatabase(ethdb.NewMemDatabase())
+		state, _ = New(common.Hash{}, db)
+
+		untouched = common.HexToAddress("0x01")
+		payer     = common.HexToAddress("0x02")
+		contract  = common.HexToAddress("0x03")
+		destroyed = common.HexToAddress("0x04")
+		created   = common.HexToAddress("0x05")
+	)
+	state.SetBalance(untouched, big.NewInt(1))
+	state.SetBalance(payer, big.NewInt(100))
+	state.SetCode(contract, []byte{0x01})
+	state.SetState(contract, common.HexToHash("0x01"), common.HexToHash("0xaa"))
+	state.SetState(contract, common.HexToHash("0x02"), common.HexToHash("0xbb"))
+	state.SetBalance(destroyed, big.NewInt(7))
+	state.SetCode(destroyed, []byte{0x02})
+
+	before, _ := state.Commit(true)
+
+	state.SubBalance(payer, big.NewInt(10))
+	state.SetNonce(payer, 1)
+	state.SetState(contract, common.HexToHash("0x01"), common.Hash{})
+	state.SetState(contract, common.HexToHash("0x02"), common.HexToHash("0xcc"))
+	state.SetState(contract, common.HexToHash("0x03"), common.HexToHash("0xdd"))
+	state.Suicide(destroyed)
+	state.SetBalance(created, big.NewInt(10))
+	state.SetCode(created, []byte{0x03})
+
+	after, _ := state.Commit(true)
+
+	diffs, err := DiffStates(db, before, after)
+	if err != nil {
+		t.Fatalf("failed to diff states: %v", err)
+	}
+	if len(diffs) != 4 {
+		t.Fatalf("diff count mismatch: have %d, want 4", len(diffs))
+	}
+	// Check the balance and nonce change of the payer
+	if diff := diffs[0]; diff.Address != payer || diff.Before.Balance.ToInt().Int64() != 100 || diff.After.Balance.ToInt().Int64() != 90 ||
+		diff.Before.Nonce != 0 || diff.After.Nonce != 1 || diff.Before.Code != nil || len(diff.Storage) != 0 {
+		t.Errorf("payer diff mismatch: %+v", diff)
+	}
+	// Check the storage changes of the contract
+	diff := diffs[1]
+	if diff.Address != contract || diff.Before.Code != nil || diff.After.Code != nil {
+		t.Errorf("contract diff mismatch: %+v", diff)
+	}
+	want := map[common.Hash]*StorageDiff{
+		common.HexToHash("0x01"): {Before: common.HexToHash("0xaa")},
+		common.HexToHash("0x02"): {Before: common.HexToHash("0xbb"), After: common.HexToHash("0xcc")},
+		common.HexToHash("0x03"): {After: common.HexToHash("0xdd")},
+	}
+	if len(diff.Storage) != len(want) {
+		t.Errorf("storage diff count mismatch: have %d, want %d", len(diff.Storage), len(want))
+	}
+	for slot, change := range want {
+		if have := diff.Storage[slot]; have == nil || *have != *change {
+			t.Errorf("slot %x: diff mismatch: have %+v, want %+v", slot, have, change)
+		}
+	}
+	// Check the removal and creation of accounts, along with their codes
+	if diff := diffs[2]; diff.Address != destroyed || diff.After != nil || !bytes.Equal(diff.Before.Code, []byte{0x02}) {
+		t.Errorf("destroyed account diff mismatch: %+v", diff)
+	}
+	if diff := diffs[3]; diff.Address != created || diff.Before != nil || !bytes.Equal(diff.After.Code, []byte{0x03}) {
+		t.Errorf("created account diff mismatch: %+v", diff)
+	}
+}
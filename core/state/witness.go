@@ -0,0 +1,149 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/trie"
+)
+
+// errWitnessNotFound is returned if a non trie node item is requested from a
+// recording reader and it's missing from the local writes.
+var errWitnessNotFound = errors.New("not found")
+
+// RecordingDatabase is a state database which records every trie node and
+// contract code retrieved through it, allowing the operations executed on top
+// of it to be replayed later without access to the full state.
+//
+// Reads are served from a source database, but none of the source's caches
+// are shared, so every node touched is guaranteed to be recorded. Writes are
+// kept in memory and never reach the source.
+type RecordingDatabase struct {
+	Database
+	reader *recordingReader
+}
+
+// orderedDatabase is implemented by state databases recording or replaying the
+// trie nodes resolved while updating tries. These sets only match if the state
+// applies its trie updates in a deterministic order.
+type orderedDatabase interface {
+	ordered()
+}
+
+// requiresOrder returns whether trie updates on top of the given database need
+// to be applied in a deterministic order.
+func requiresOrder(db Database) bool {
+	_, ok := db.(orderedDatabase)
+	return ok
+}
+
+// NewRecordingDatabase creates a state database reading through the given one,
+// recording all the trie nodes and contract codes accessed.
+func NewRecordingDatabase(source Database) *RecordingDatabase {
+	reader := &recordingReader{
+		MemDatabase: ethdb.NewMemDatabase(),
+		source:      source.TrieDB(),
+		touched:     make(map[common.Hash][]byte),
+	}
+	return &RecordingDatabase{
+		Database: NewDatabase(reader),
+		reader:   reader,
+	}
+}
+
+func (db *RecordingDatabase) ordered() {}
+
+// Witness returns all the trie nodes and contract codes recorded so far, sorted
+// by their hash.
+func (db *RecordingDatabase) Witness() [][]byte {
+	db.reader.lock.Lock()
+	defer db.reader.lock.Unlock()
+
+	hashes := make([]common.Hash, 0, len(db.reader.touched))
+	for hash := range db.reader.touched {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+
+	blobs := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		blobs[i] = db.reader.touched[hash]
+	}
+	return blobs
+}
+
+// recordingReader is a key-value store feeding the trie database of a recording
+// state database, serving node reads from the source and remembering them.
+type recordingReader struct {
+	*ethdb.MemDatabase
+
+	source  *trie.Database
+	touched map[common.Hash][]byte
+	lock    sync.Mutex
+}
+
+// Get retrieves a trie node or contract code from the local writes if available,
+// or from the source trie database otherwise, recording it.
+func (r *recordingReader) Get(key []byte) ([]byte, error) {
+	if blob, err := r.MemDatabase.Get(key); err == nil {
+		return blob, nil
+	}
+	if len(key) != common.HashLength {
+		return nil, errWitnessNotFound
+	}
+	hash := common.BytesToHash(key)
+	blob, err := r.source.Node(hash)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	r.touched[hash] = common.CopyBytes(blob)
+	r.lock.Unlock()
+
+	return blob, nil
+}
+
+// Has retrieves whether a trie node or contract code is available.
+func (r *recordingReader) Has(key []byte) (bool, error) {
+	_, err := r.Get(key)
+	return err == nil, nil
+}
+
+// NewWitnessDatabase creates a state database containing only the trie nodes
+// and contract codes of a witness. Executing the operations the witness was
+// recorded for on top of it doesn't require any further state.
+func NewWitnessDatabase(witness [][]byte) Database {
+	db := ethdb.NewMemDatabase()
+	for _, blob := range witness {
+		db.Put(crypto.Keccak256(blob), blob)
+	}
+	return witnessDatabase{NewDatabase(db)}
+}
+
+// witnessDatabase is a state database serving the contents of a witness.
+type witnessDatabase struct {
+	Database
+}
+
+func (witnessDatabase) ordered() {}
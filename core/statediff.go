@@ -0,0 +1,59 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/consensus"
+	"github.com/themis-network/go-themis/core/state"
+	"github.com/themis-network/go-themis/core/types"
+)
+
+// BlockStateDiff is the change of the state caused by a block, with the before
+// and after values of every modified account and storage slot.
+type BlockStateDiff struct {
+	Number     hexutil.Uint64       `json:"number"`
+	Hash       common.Hash          `json:"hash"`
+	ParentHash common.Hash          `json:"parentHash"`
+	Accounts   []*state.AccountDiff `json:"accounts"`
+}
+
+// StateDiff computes the state changes of a block by diffing the state tries of
+// its parent and of itself. Both states need to be available, so for anything
+// but recent blocks this requires an archive node.
+func (bc *BlockChain) StateDiff(block *types.Block) (*BlockStateDiff, error) {
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis has no parent state")
+	}
+	parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	accounts, err := state.DiffStates(bc.stateCache, parent.Root, block.Root())
+	if err != nil {
+		return nil, err
+	}
+	return &BlockStateDiff{
+		Number:     hexutil.Uint64(block.NumberU64()),
+		Hash:       block.Hash(),
+		ParentHash: block.ParentHash(),
+		Accounts:   accounts,
+	}, nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/types"
+)
+
+var (
+	// ErrSenderDenied is returned if the sender of a transaction is not permitted
+	// to submit transactions by the admission policy of the pool.
+	ErrSenderDenied = errors.New("sender not permitted")
+
+	// ErrDestinationDenied is returned if a transaction calls a contract that the
+	// sender is not permitted to interact with by the admission policy.
+	ErrDestinationDenied = errors.New("destination contract not permitted")
+
+	// ErrSenderRateLimited is returned if the sender of a transaction already
+	// submitted the maximum number of transactions allowed within the current
+	// rate limiting window.
+	ErrSenderRateLimited = errors.New("sender rate limit exceeded")
+)
+
+// policyRateWindow is the time window over which the per-sender admission rate
+// of the transaction pool is measured.
+const policyRateWindow = time.Minute
+
+// TxPolicy is the admission policy of the transaction pool, restricting who may
+// submit transactions and which contracts they may call. The zero value permits
+// everything.
+type TxPolicy struct {
+	AllowSenders []common.Address `toml:",omitempty" json:"allowSenders"` // Senders permitted to submit transactions (empty allows all)
+	DenySenders  []common.Address `toml:",omitempty" json:"denySenders"`  // Senders rejected regardless of the allowlist
+
+	RestrictContracts bool           `toml:",omitempty" json:"restrictContracts"` // Whether contract calls are limited to contracts with a rule
+	Contracts         []ContractRule `toml:",omitempty" json:"contracts"`         // Per-contract admission rules
+
+	Trustees   []common.Address `toml:",omitempty" json:"trustees"`   // Escrow trustees exempt from the pool's price floor
+	SenderRate uint64           `toml:",omitempty" json:"senderRate"` // Maximum transactions admitted per sender per minute (0 = unlimited)
+}
+
+// ContractRule is the admission rule of transactions calling a single contract.
+type ContractRule struct {
+	Address common.Address   `json:"address"`                   // Address of the contract the rule applies to
+	Deny    bool             `toml:",omitempty" json:"deny"`    // Whether all calls to the contract are rejected
+	Senders []common.Address `toml:",omitempty" json:"senders"` // Senders permitted to call the contract (empty allows all)
+}
+
+// senderRate tracks the number of transactions admitted from a single sender
+// within the current rate limiting window.
+type senderRate struct {
+	start time.Time // Start of the current window
+	count uint64    // Transactions admitted within the window
+}
+
+// txPolicy is the compiled form of a TxPolicy, indexed for fast lookups while
+// validating transactions. It is not safe for concurrent use, the pool lock
+// protects it.
+type txPolicy struct {
+	config TxPolicy
+
+	allow     map[common.Address]struct{}
+	deny      map[common.Address]struct{}
+	trustees  map[common.Address]struct{}
+	contracts map[common.Address]*contractRule
+
+	rates     map[common.Address]*senderRate
+	lastPrune time.Time
+}
+
+// contractRule is the compiled form of a ContractRule.
+type contractRule struct {
+	deny    bool
+	senders map[common.Address]struct{}
+}
+
+// newTxPolicy compiles an admission policy. Nil is returned for a policy that
+// doesn't restrict anything, allowing the pool to skip the checks altogether.
+func newTxPolicy(config *TxPolicy) *txPolicy {
+	if config == nil {
+		return nil
+	}
+	if len(config.AllowSenders) == 0 && len(config.DenySenders) == 0 && !config.RestrictContracts &&
+		len(config.Contracts) == 0 && len(config.Trustees) == 0 && config.SenderRate == 0 {
+		return nil
+	}
+	policy := &txPolicy{
+		config:    *config,
+		allow:     addressSet(config.AllowSenders),
+		deny:      addressSet(config.DenySenders),
+		trustees:  addressSet(config.Trustees),
+		contracts: make(map[common.Address]*contractRule),
+		rates:     make(map[common.Address]*senderRate),
+		lastPrune: time.Now(),
+	}
+	for _, rule := range config.Contracts {
+		policy.contracts[rule.Address] = &contractRule{
+			deny:    rule.Deny,
+			senders: addressSet(rule.Senders),
+		}
+	}
+	return policy
+}
+
+// addressSet converts a list of addresses into a set for fast membership tests.
+func addressSet(addrs []common.Address) map[common.Address]struct{} {
+	set := make(map[common.Address]struct{}, len(addrs))
+	for _, addr := range addrs {
+		set[addr] = struct{}{}
+	}
+	return set
+}
+
+// check verifies that the sender is permitted to submit the transaction. Rules
+// of the destination apply whether or not it holds code. If contracts are
+// restricted, contract creations and calls to destinations without a rule are
+// rejected, leaving only plain value transfers to accounts without code.
+func (p *txPolicy) check(from common.Address, tx *types.Transaction, contract bool) error {
+	if _, ok := p.deny[from]; ok {
+		return ErrSenderDenied
+	}
+	if len(p.allow) > 0 {
+		if _, ok := p.allow[from]; !ok {
+			return ErrSenderDenied
+		}
+	}
+	to := tx.To()
+	if to == nil {
+		if p.config.RestrictContracts {
+			return ErrDestinationDenied
+		}
+		return nil
+	}
+	rule, ok := p.contracts[*to]
+	if !ok {
+		if p.config.RestrictContracts && (contract || len(tx.Data()) > 0) {
+			return ErrDestinationDenied
+		}
+		return nil
+	}
+	if rule.deny {
+		return ErrDestinationDenied
+	}
+	if len(rule.senders) > 0 {
+		if _, ok := rule.senders[from]; !ok {
+			return ErrDestinationDenied
+		}
+	}
+	return nil
+}
+
+// exempt returns whether the sender is a trustee that may bypass the minimum
+// gas price of the pool.
+func (p *txPolicy) exempt(from common.Address) bool {
+	_, ok := p.trustees[from]
+	return ok
+}
+
+// limited returns whether the sender exhausted its rate allowance within the
+// current window.
+func (p *txPolicy) limited(from common.Address, now time.Time) bool {
+	if p.config.SenderRate == 0 {
+		return false
+	}
+	rate := p.rates[from]
+	return rate != nil && now.Sub(rate.start) <= policyRateWindow && rate.count >= p.config.SenderRate
+}
+
+// charge counts an admitted transaction against the rate allowance of its sender.
+func (p *txPolicy) charge(from common.Address, now time.Time) {
+	if p.config.SenderRate == 0 {
+		return
+	}
+	// Drop the counters of idle senders every once in a while
+	if now.Sub(p.lastPrune) > policyRateWindow {
+		for addr, rate := range p.rates {
+			if now.Sub(rate.start) > policyRateWindow {
+				delete(p.rates, addr)
+			}
+		}
+		p.lastPrune = now
+	}
+	rate := p.rates[from]
+	if rate == nil || now.Sub(rate.start) > policyRateWindow {
+		rate = &senderRate{start: now}
+		p.rates[from] = rate
+	}
+	rate.count++
+}
@@ -0,0 +1,195 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/crypto"
+)
+
+// signedTx creates a signed value transfer to the given destination.
+func signedTx(nonce uint64, to common.Address, key *ecdsa.PrivateKey) *types.Transaction {
+	tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(1), 100000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+	return tx
+}
+
+// contractCall creates a signed transaction carrying call data to the given
+// destination.
+func contractCall(nonce uint64, to common.Address, key *ecdsa.PrivateKey) *types.Transaction {
+	tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(1), 100000, big.NewInt(1), []byte{0x01}), types.HomesteadSigner{}, key)
+	return tx
+}
+
+// contractCreation creates a signed contract creation transaction.
+func contractCreation(nonce uint64, key *ecdsa.PrivateKey) *types.Transaction {
+	tx, _ := types.SignTx(types.NewContractCreation(nonce, big.NewInt(1), 100000, big.NewInt(1), []byte{0x00}), types.HomesteadSigner{}, key)
+	return tx
+}
+
+// Tests that the sender allow and deny lists of the admission policy are enforced.
+func TestTxPolicySenders(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	other, _ := crypto.GenerateKey()
+	from, stranger := crypto.PubkeyToAddress(key.PublicKey), crypto.PubkeyToAddress(other.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000))
+	pool.currentState.AddBalance(stranger, big.NewInt(1000000))
+
+	pool.SetPolicy(TxPolicy{AllowSenders: []common.Address{from}})
+	if err := pool.AddRemote(transaction(0, 100000, other)); err != ErrSenderDenied {
+		t.Errorf("unlisted sender error mismatch: have %v, want %v", err, ErrSenderDenied)
+	}
+	if err := pool.AddRemote(transaction(0, 100000, key)); err != nil {
+		t.Errorf("allowed sender rejected: %v", err)
+	}
+	// Denying a sender with pooled transactions should drop them
+	pool.SetPolicy(TxPolicy{DenySenders: []common.Address{from}})
+	if pending, queued := pool.Stats(); pending+queued != 0 {
+		t.Errorf("denied transactions retained: %d pending, %d queued", pending, queued)
+	}
+	if err := pool.AddRemote(transaction(1, 100000, key)); err != ErrSenderDenied {
+		t.Errorf("denied sender error mismatch: have %v, want %v", err, ErrSenderDenied)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that per-contract admission rules only apply to contract destinations.
+func TestTxPolicyContracts(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	other, _ := crypto.GenerateKey()
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000))
+	pool.currentState.AddBalance(crypto.PubkeyToAddress(other.PublicKey), big.NewInt(1000000))
+
+	var (
+		escrow   = common.HexToAddress("0x01")
+		unlisted = common.HexToAddress("0x02")
+		account  = common.HexToAddress("0x03")
+	)
+	pool.currentState.SetCode(escrow, []byte{0x00})
+	pool.currentState.SetCode(unlisted, []byte{0x00})
+
+	pool.SetPolicy(TxPolicy{
+		RestrictContracts: true,
+		Contracts:         []ContractRule{{Address: escrow, Senders: []common.Address{from}}},
+	})
+	tests := []struct {
+		tx  *types.Transaction
+		err error
+	}{
+		{signedTx(0, escrow, key), nil},
+		{signedTx(1, unlisted, key), ErrDestinationDenied},
+		{signedTx(1, account, key), nil},
+		{signedTx(0, escrow, other), ErrDestinationDenied},
+		{contractCall(2, account, key), ErrDestinationDenied},
+		{contractCreation(2, key), ErrDestinationDenied},
+	}
+	for i, tt := range tests {
+		if err := pool.AddRemote(tt.tx); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that trustees bypass the price floor and that sender rates are capped.
+func TestTxPolicyTrusteesAndRate(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000))
+	pool.SetGasPrice(big.NewInt(10))
+
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(1), key)); err != ErrUnderpriced {
+		t.Fatalf("underpriced error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	pool.SetPolicy(TxPolicy{Trustees: []common.Address{from}, SenderRate: 2})
+	for i := uint64(0); i < 2; i++ {
+		if err := pool.AddRemote(pricedTransaction(i, 100000, big.NewInt(1), key)); err != nil {
+			t.Fatalf("trustee transaction %d rejected: %v", i, err)
+		}
+	}
+	if err := pool.AddRemote(pricedTransaction(2, 100000, big.NewInt(1), key)); err != ErrSenderRateLimited {
+		t.Fatalf("rate limit error mismatch: have %v, want %v", err, ErrSenderRateLimited)
+	}
+	// Once the window passes, the sender should be admitted again
+	pool.mu.Lock()
+	limited := pool.policy.limited(from, time.Now().Add(2*policyRateWindow))
+	pool.mu.Unlock()
+	if limited {
+		t.Fatalf("sender rate not reset after window")
+	}
+}
+
+// Tests that only successful additions of remote transactions are charged
+// against the sender rate, and that reinjected transactions bypass it.
+func TestTxPolicyRateCharging(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	pool.currentState.AddBalance(from, big.NewInt(1000000))
+	pool.SetPolicy(TxPolicy{SenderRate: 2})
+
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(2), key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	// Failed additions must not consume the allowance
+	for i := 0; i < 3; i++ {
+		if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(2), key)); err == nil {
+			t.Fatalf("duplicate transaction accepted")
+		}
+		if err := pool.AddRemote(pricedTransaction(0, 100001, big.NewInt(2), key)); err != ErrReplaceUnderpriced {
+			t.Fatalf("underpriced replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+		}
+	}
+	if err := pool.AddRemote(pricedTransaction(1, 100000, big.NewInt(2), key)); err != nil {
+		t.Fatalf("transaction within allowance rejected: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(2, 100000, big.NewInt(2), key)); err != ErrSenderRateLimited {
+		t.Fatalf("rate limit error mismatch: have %v, want %v", err, ErrSenderRateLimited)
+	}
+	// Reinjected and local transactions are not limited
+	pool.mu.Lock()
+	errs := pool.addTxsLocked([]*types.Transaction{pricedTransaction(2, 100000, big.NewInt(2), key)}, false, false)
+	pool.mu.Unlock()
+	if errs[0] != nil {
+		t.Fatalf("reinjected transaction rejected: %v", errs[0])
+	}
+	if err := pool.AddLocal(pricedTransaction(3, 100000, big.NewInt(2), key)); err != nil {
+		t.Fatalf("local transaction rejected: %v", err)
+	}
+}
@@ -38,6 +38,10 @@ import (
 const (
 	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
 	chainHeadChanSize = 10
+
+	// maxQueuedEvents is the maximum number of pool events waiting for delivery
+	// to subscribers. Events beyond it are dropped.
+	maxQueuedEvents = 4096
 )
 
 var (
@@ -78,6 +82,20 @@ var (
 	ErrOversizedData = errors.New("oversized data")
 )
 
+// Reasons reported by a TxPoolEvent when a transaction is dropped from the pool.
+const (
+	dropReplaced     = "replaced"
+	dropOutbid       = "replacement underpriced"
+	dropUnderpriced  = "underpriced"
+	dropStaleNonce   = "nonce too low"
+	dropUnpayable    = "insufficient funds or gas"
+	dropAccountLimit = "account limit exceeded"
+	dropGlobalLimit  = "pool limit exceeded"
+	dropExpired      = "expired"
+	dropPolicy       = "rejected by policy"
+	dropRemoved      = "removed"
+)
+
 var (
 	evictionInterval    = time.Minute     // Time interval to check for evictable transactions
 	statsReportInterval = 8 * time.Second // Time interval to report transaction pool stats
@@ -99,6 +117,9 @@ var (
 	// General tx metrics
 	invalidTxCounter     = metrics.NewRegisteredCounter("txpool/invalid", nil)
 	underpricedTxCounter = metrics.NewRegisteredCounter("txpool/underpriced", nil)
+
+	// Pool event metrics
+	droppedEventCounter = metrics.NewRegisteredCounter("txpool/events/dropped", nil) // Not delivered due to a full event queue
 )
 
 // TxStatus is the current status of a transaction as seen by the pool.
@@ -136,6 +157,8 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	Policy *TxPolicy `toml:",omitempty"` // Admission policy restricting senders and contract destinations
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -188,9 +211,12 @@ type TxPool struct {
 	gasPrice     *big.Int
 	txFeed       event.Feed
 	scope        event.SubscriptionScope
+	eventFeed    event.Feed
+	eventScope   event.SubscriptionScope
 	chainHeadCh  chan ChainHeadEvent
 	chainHeadSub event.Subscription
 	signer       types.Signer
+	policy       *txPolicy // Admission policy, nil if everything is permitted
 	mu           sync.RWMutex
 
 	currentState  *state.StateDB      // Current state in the blockchain head
@@ -206,6 +232,13 @@ type TxPool struct {
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
 
+	included map[common.Hash]struct{} // Transactions included by the blocks of the last reset, nil if unknown
+
+	eventQueue []TxPoolEvent // Pool events waiting to be delivered to subscribers
+	eventLock  sync.Mutex    // Lock protecting the event queue
+	eventWake  chan struct{} // Notification channel for newly queued events
+	eventQuit  chan struct{} // Termination channel for the event delivery loop
+
 	wg sync.WaitGroup // for shutdown sync
 
 	homestead bool
@@ -229,6 +262,9 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		all:         newTxLookup(),
 		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
 		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
+		policy:      newTxPolicy(config.Policy),
+		eventWake:   make(chan struct{}, 1),
+		eventQuit:   make(chan struct{}),
 	}
 	pool.locals = newAccountSet(pool.signer)
 	pool.priced = newTxPricedList(pool.all)
@@ -248,9 +284,10 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
 
-	// Start the event loop and return
-	pool.wg.Add(1)
+	// Start the event loops and return
+	pool.wg.Add(2)
 	go pool.loop()
+	go pool.eventLoop()
 
 	return pool
 }
@@ -319,6 +356,7 @@ func (pool *TxPool) loop() {
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					for _, tx := range pool.queue[addr].Flatten() {
 						pool.removeTx(tx.Hash(), true)
+						pool.emit(tx, TxPoolDropped, dropExpired)
 					}
 				}
 			}
@@ -337,6 +375,64 @@ func (pool *TxPool) loop() {
 	}
 }
 
+// eventLoop delivers the queued pool events to subscribers in order, without
+// holding the pool lock while waiting for slow consumers.
+func (pool *TxPool) eventLoop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case <-pool.eventWake:
+			pool.eventLock.Lock()
+			events := pool.eventQueue
+			pool.eventQueue = nil
+			pool.eventLock.Unlock()
+
+			for _, ev := range events {
+				pool.eventFeed.Send(ev)
+			}
+		case <-pool.eventQuit:
+			return
+		}
+	}
+}
+
+// emit queues a pool event for delivery to subscribers. It's a noop if nobody
+// is subscribed to pool events.
+func (pool *TxPool) emit(tx *types.Transaction, typ TxPoolEventType, reason string) {
+	if pool.eventScope.Count() == 0 {
+		return
+	}
+	pool.eventLock.Lock()
+	if len(pool.eventQueue) >= maxQueuedEvents {
+		pool.eventLock.Unlock()
+		droppedEventCounter.Inc(1)
+		return
+	}
+	pool.eventQueue = append(pool.eventQueue, TxPoolEvent{Tx: tx, Type: typ, Reason: reason})
+	pool.eventLock.Unlock()
+
+	select {
+	case pool.eventWake <- struct{}{}:
+	default:
+	}
+}
+
+// emitStale reports a transaction removed because its nonce was used on chain.
+// Transactions included by the blocks of the last reset are reported as such,
+// the others as dropped since another transaction took their nonce. Nothing is
+// reported if the included transactions are unknown.
+func (pool *TxPool) emitStale(tx *types.Transaction) {
+	if pool.included == nil {
+		return
+	}
+	if _, ok := pool.included[tx.Hash()]; ok {
+		pool.emit(tx, TxPoolIncluded, "")
+		return
+	}
+	pool.emit(tx, TxPoolDropped, dropStaleNonce)
+}
+
 // lockedReset is a wrapper around reset to allow calling it in a thread safe
 // manner. This method is only ever used in the tester!
 func (pool *TxPool) lockedReset(oldHead, newHead *types.Header) {
@@ -352,6 +448,15 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// If we're reorging an old state, reinject all dropped transactions
 	var reinject types.Transactions
 
+	// Track the transactions included by the new blocks for pool event
+	// subscribers, left nil if they are unknown
+	pool.included = nil
+
+	if oldHead != nil && oldHead.Hash() == newHead.ParentHash && pool.eventScope.Count() > 0 {
+		if block := pool.chain.GetBlock(newHead.Hash(), newHead.Number.Uint64()); block != nil {
+			pool.included = txHashSet(block.Transactions())
+		}
+	}
 	if oldHead != nil && oldHead.Hash() != newHead.ParentHash {
 		// If the reorg is too deep, avoid doing it (will happen during fast sync)
 		oldNum := oldHead.Number.Uint64()
@@ -394,6 +499,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 				}
 			}
 			reinject = types.TxDifference(discarded, included)
+			pool.included = txHashSet(included)
 		}
 	}
 	// Initialize the internal state to the current head
@@ -412,7 +518,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
 	senderCacher.recover(pool.signer, reinject)
-	pool.addTxsLocked(reinject, false)
+	pool.addTxsLocked(reinject, false, false)
 
 	// validate the pool of pending transactions, this will remove
 	// any transactions that have been included in the block or
@@ -434,9 +540,11 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 func (pool *TxPool) Stop() {
 	// Unsubscribe all subscriptions registered from txpool
 	pool.scope.Close()
+	pool.eventScope.Close()
 
 	// Unsubscribe subscriptions registered from blockchain
 	pool.chainHeadSub.Unsubscribe()
+	close(pool.eventQuit)
 	pool.wg.Wait()
 
 	if pool.journal != nil {
@@ -451,6 +559,12 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeTxPoolEvent registers a subscription of TxPoolEvent, reporting every
+// transaction added to, promoted within or dropped from the pool.
+func (pool *TxPool) SubscribeTxPoolEvent(ch chan<- TxPoolEvent) event.Subscription {
+	return pool.eventScope.Track(pool.eventFeed.Subscribe(ch))
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -468,10 +582,64 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 	pool.gasPrice = price
 	for _, tx := range pool.priced.Cap(price, pool.locals) {
 		pool.removeTx(tx.Hash(), false)
+		pool.emit(tx, TxPoolDropped, dropUnderpriced)
 	}
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
 
+// Policy returns the admission policy currently enforced by the transaction pool.
+func (pool *TxPool) Policy() TxPolicy {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if pool.policy == nil {
+		return TxPolicy{}
+	}
+	return pool.policy.config
+}
+
+// SetPolicy replaces the admission policy of the transaction pool, and drops all
+// pooled transactions that the new policy doesn't permit anymore.
+func (pool *TxPool) SetPolicy(policy TxPolicy) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.policy = newTxPolicy(&policy)
+	if pool.policy == nil {
+		log.Info("Transaction pool admission policy cleared")
+		return
+	}
+	var drop []*types.Transaction
+	pool.all.Range(func(hash common.Hash, tx *types.Transaction) bool {
+		from, _ := types.Sender(pool.signer, tx) // already validated
+		if pool.policy.check(from, tx, pool.isContract(tx.To())) != nil {
+			drop = append(drop, tx)
+		}
+		return true
+	})
+	for _, tx := range drop {
+		pool.removeTx(tx.Hash(), true)
+		pool.emit(tx, TxPoolDropped, dropPolicy)
+	}
+	log.Info("Transaction pool admission policy updated", "allowed", len(policy.AllowSenders), "denied", len(policy.DenySenders),
+		"contracts", len(policy.Contracts), "trustees", len(policy.Trustees), "rate", policy.SenderRate, "dropped", len(drop))
+}
+
+// isContract returns whether the given transaction destination holds code in
+// the current head state.
+func (pool *TxPool) isContract(to *common.Address) bool {
+	return to != nil && pool.currentState.GetCodeSize(*to) > 0
+}
+
+// txHashSet converts a list of transactions into a set of their hashes.
+func txHashSet(txs types.Transactions) map[common.Hash]struct{} {
+	set := make(map[common.Hash]struct{}, len(txs))
+	for _, tx := range txs {
+		set[tx.Hash()] = struct{}{}
+	}
+	return set
+}
+
 // State returns the virtual managed state of the transaction pool.
 func (pool *TxPool) State() *state.ManagedState {
 	pool.mu.RLock()
@@ -571,9 +739,17 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if err != nil {
 		return ErrInvalidSender
 	}
-	// Drop non-local transactions under our own minimal accepted gas price
+	// Ensure the sender and destination are permitted by the admission policy
+	if pool.policy != nil {
+		if err := pool.policy.check(from, tx, pool.isContract(tx.To())); err != nil {
+			return err
+		}
+	}
+	// Drop non-local transactions under our own minimal accepted gas price,
+	// unless they originate from a trustee exempt from it
 	local = local || pool.locals.contains(from) // account may be local even if the transaction arrived from the network
-	if !local && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
+	exempt := pool.policy != nil && pool.policy.exempt(from)
+	if !local && !exempt && pool.gasPrice.Cmp(tx.GasPrice()) > 0 {
 		return ErrUnderpriced
 	}
 	// Ensure the transaction adheres to nonce ordering
@@ -630,6 +806,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
 			underpricedTxCounter.Inc(1)
 			pool.removeTx(tx.Hash(), false)
+			pool.emit(tx, TxPoolDropped, dropUnderpriced)
 		}
 	}
 	// If the transaction is replacing an already pending one, do directly
@@ -646,10 +823,12 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed()
 			pendingReplaceCounter.Inc(1)
+			pool.emit(old, TxPoolDropped, dropReplaced)
 		}
 		pool.all.Add(tx)
 		pool.priced.Put(tx)
 		pool.journalTx(from, tx)
+		pool.emit(tx, TxPoolAdded, "")
 
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
 
@@ -668,11 +847,39 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		pool.locals.add(from)
 	}
 	pool.journalTx(from, tx)
+	pool.emit(tx, TxPoolAdded, "")
 
 	log.Trace("Pooled new future transaction", "hash", hash, "from", from, "to", tx.To())
 	return replace, nil
 }
 
+// addLimited validates and inserts a transaction like add, additionally enforcing
+// the sender rate limit of the admission policy on remote transactions if limit
+// is set. The allowance is only charged once the transaction made it into the
+// pool, so failed additions, local transactions and reorg reinjections don't
+// consume it.
+func (pool *TxPool) addLimited(tx *types.Transaction, local, limit bool) (bool, error) {
+	if !limit || local || pool.policy == nil {
+		return pool.add(tx, local)
+	}
+	from, err := types.Sender(pool.signer, tx)
+	if err != nil {
+		return false, ErrInvalidSender
+	}
+	if pool.locals.contains(from) {
+		return pool.add(tx, local)
+	}
+	now := time.Now()
+	if pool.policy.limited(from, now) {
+		return false, ErrSenderRateLimited
+	}
+	replace, err := pool.add(tx, local)
+	if err == nil {
+		pool.policy.charge(from, now)
+	}
+	return replace, err
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -693,6 +900,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed()
 		queuedReplaceCounter.Inc(1)
+		pool.emit(old, TxPoolDropped, dropReplaced)
 	}
 	if pool.all.Get(hash) == nil {
 		pool.all.Add(tx)
@@ -731,6 +939,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed()
 
 		pendingDiscardCounter.Inc(1)
+		pool.emit(tx, TxPoolDropped, dropOutbid)
 		return false
 	}
 	// Otherwise discard any previous transaction and mark this
@@ -739,6 +948,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed()
 
 		pendingReplaceCounter.Inc(1)
+		pool.emit(old, TxPoolDropped, dropReplaced)
 	}
 	// Failsafe to work around direct pending inserts (tests)
 	if pool.all.Get(hash) == nil {
@@ -786,7 +996,7 @@ func (pool *TxPool) addTx(tx *types.Transaction, local bool) error {
 	defer pool.mu.Unlock()
 
 	// Try to inject the transaction and update any state
-	replace, err := pool.add(tx, local)
+	replace, err := pool.addLimited(tx, local, true)
 	if err != nil {
 		return err
 	}
@@ -803,19 +1013,20 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local bool) []error {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
-	return pool.addTxsLocked(txs, local)
+	return pool.addTxsLocked(txs, local, true)
 }
 
 // addTxsLocked attempts to queue a batch of transactions if they are valid,
-// whilst assuming the transaction pool lock is already held.
-func (pool *TxPool) addTxsLocked(txs []*types.Transaction, local bool) []error {
+// whilst assuming the transaction pool lock is already held. If limit is set,
+// remote transactions are subject to the sender rate limit of the policy.
+func (pool *TxPool) addTxsLocked(txs []*types.Transaction, local, limit bool) []error {
 	// Add the batch of transaction, tracking the accepted ones
 	dirty := make(map[common.Address]struct{})
 	errs := make([]error, len(txs))
 
 	for i, tx := range txs {
 		var replace bool
-		if replace, errs[i] = pool.add(tx, local); errs[i] == nil && !replace {
+		if replace, errs[i] = pool.addLimited(tx, local, limit); errs[i] == nil && !replace {
 			from, _ := types.Sender(pool.signer, tx) // already validated
 			dirty[from] = struct{}{}
 		}
@@ -857,6 +1068,78 @@ func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
 	return pool.all.Get(hash)
 }
 
+// ContentFrom retrieves the pending and queued transactions of a single account,
+// sorted by nonce.
+func (pool *TxPool) ContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var pending, queued types.Transactions
+	if list := pool.pending[addr]; list != nil {
+		pending = list.Flatten()
+	}
+	if list := pool.queue[addr]; list != nil {
+		queued = list.Flatten()
+	}
+	return pending, queued
+}
+
+// RemoveTransaction evicts a single transaction from the pool, moving all the
+// subsequent transactions of the account back to the future queue. It returns
+// whether the transaction was found.
+func (pool *TxPool) RemoveTransaction(hash common.Hash) bool {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	tx := pool.all.Get(hash)
+	if tx == nil {
+		return false
+	}
+	pool.removeTx(hash, true)
+	pool.emit(tx, TxPoolDropped, dropRemoved)
+
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	pool.rejournal(from)
+	return true
+}
+
+// RemoveAccount evicts all the pending and queued transactions of an account from
+// the pool, returning the number of transactions removed.
+func (pool *TxPool) RemoveAccount(addr common.Address) int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var txs types.Transactions
+	if list := pool.pending[addr]; list != nil {
+		txs = append(txs, list.Flatten()...)
+	}
+	if list := pool.queue[addr]; list != nil {
+		txs = append(txs, list.Flatten()...)
+	}
+	// Remove in reverse nonce order to avoid needlessly demoting the remainder
+	for i := len(txs) - 1; i >= 0; i-- {
+		pool.removeTx(txs[i].Hash(), true)
+		pool.emit(txs[i], TxPoolDropped, dropRemoved)
+	}
+	if len(txs) > 0 {
+		pool.rejournal(addr)
+	}
+	return len(txs)
+}
+
+// rejournal regenerates the local transaction journal if the given account is a
+// local one, ensuring explicitly removed transactions don't resurrect on restart.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) rejournal(addr common.Address) {
+	if pool.journal == nil || !pool.locals.contains(addr) {
+		return
+	}
+	if err := pool.journal.rotate(pool.local()); err != nil {
+		log.Warn("Failed to rotate local tx journal", "err", err)
+	}
+}
+
 // removeTx removes a single transaction from the queue, moving all subsequent
 // transactions back to the future queue.
 func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
@@ -926,6 +1209,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			log.Trace("Removed old queued transaction", "hash", hash)
 			pool.all.Remove(hash)
 			pool.priced.Removed()
+			pool.emitStale(tx)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas)
 		drops, _ := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
@@ -935,6 +1219,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			pool.all.Remove(hash)
 			pool.priced.Removed()
 			queuedNofundsCounter.Inc(1)
+			pool.emit(tx, TxPoolDropped, dropUnpayable)
 		}
 		// Gather all executable transactions and promote them
 		for _, tx := range list.Ready(pool.pendingState.GetNonce(addr)) {
@@ -942,6 +1227,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			if pool.promoteTx(addr, hash, tx) {
 				log.Trace("Promoting queued transaction", "hash", hash)
 				promoted = append(promoted, tx)
+				pool.emit(tx, TxPoolPromoted, "")
 			}
 		}
 		// Drop all transactions over the allowed limit
@@ -951,6 +1237,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 				pool.all.Remove(hash)
 				pool.priced.Removed()
 				queuedRateLimitCounter.Inc(1)
+				pool.emit(tx, TxPoolDropped, dropAccountLimit)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 		}
@@ -1004,6 +1291,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 							if nonce := tx.Nonce(); pool.pendingState.GetNonce(offenders[i]) > nonce {
 								pool.pendingState.SetNonce(offenders[i], nonce)
 							}
+							pool.emit(tx, TxPoolDropped, dropGlobalLimit)
 							log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
 						}
 						pending--
@@ -1026,6 +1314,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 						if nonce := tx.Nonce(); pool.pendingState.GetNonce(addr) > nonce {
 							pool.pendingState.SetNonce(addr, nonce)
 						}
+						pool.emit(tx, TxPoolDropped, dropGlobalLimit)
 						log.Trace("Removed fairness-exceeding pending transaction", "hash", hash)
 					}
 					pending--
@@ -1060,6 +1349,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			if size := uint64(list.Len()); size <= drop {
 				for _, tx := range list.Flatten() {
 					pool.removeTx(tx.Hash(), true)
+					pool.emit(tx, TxPoolDropped, dropGlobalLimit)
 				}
 				drop -= size
 				queuedRateLimitCounter.Inc(int64(size))
@@ -1069,6 +1359,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			txs := list.Flatten()
 			for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
 				pool.removeTx(txs[i].Hash(), true)
+				pool.emit(txs[i], TxPoolDropped, dropGlobalLimit)
 				drop--
 				queuedRateLimitCounter.Inc(1)
 			}
@@ -1090,6 +1381,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			log.Trace("Removed old pending transaction", "hash", hash)
 			pool.all.Remove(hash)
 			pool.priced.Removed()
+			pool.emitStale(tx)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
 		drops, invalids := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
@@ -1099,6 +1391,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			pool.all.Remove(hash)
 			pool.priced.Removed()
 			pendingNofundsCounter.Inc(1)
+			pool.emit(tx, TxPoolDropped, dropUnpayable)
 		}
 		for _, tx := range invalids {
 			hash := tx.Hash()
@@ -1736,6 +1736,157 @@ func TestTransactionStatusCheck(t *testing.T) {
 	}
 }
 
+// Tests that transactions can be explicitly removed from the pool and that the
+// pool events report every state change along with the drop reasons.
+func TestTransactionRemovalAndEvents(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	account, _ := deriveSender(transaction(0, 0, key))
+	pool.currentState.AddBalance(account, big.NewInt(1000000))
+
+	events := make(chan TxPoolEvent, 32)
+	sub := pool.SubscribeTxPoolEvent(events)
+	defer sub.Unsubscribe()
+
+	txs := []*types.Transaction{transaction(0, 100000, key), transaction(1, 100000, key), transaction(3, 100000, key)}
+	for i, tx := range txs {
+		if err := pool.AddRemote(tx); err != nil {
+			t.Fatalf("tx %d: failed to add transaction: %v", i, err)
+		}
+	}
+	if pending, queued := pool.ContentFrom(account); len(pending) != 2 || len(queued) != 1 {
+		t.Fatalf("account content mismatch: have %d/%d pending/queued, want %d/%d", len(pending), len(queued), 2, 1)
+	}
+	// Removing the first transaction should demote the remaining pending one
+	if !pool.RemoveTransaction(txs[0].Hash()) {
+		t.Fatalf("failed to remove pooled transaction")
+	}
+	if pool.RemoveTransaction(txs[0].Hash()) {
+		t.Fatalf("removed already dropped transaction")
+	}
+	if pending, queued := pool.ContentFrom(account); len(pending) != 0 || len(queued) != 2 {
+		t.Fatalf("account content mismatch: have %d/%d pending/queued, want %d/%d", len(pending), len(queued), 0, 2)
+	}
+	if removed := pool.RemoveAccount(account); removed != 2 {
+		t.Fatalf("removed transaction count mismatch: have %d, want %d", removed, 2)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Verify the reported event sequence
+	want := []TxPoolEvent{
+		{Tx: txs[0], Type: TxPoolAdded}, {Tx: txs[0], Type: TxPoolPromoted},
+		{Tx: txs[1], Type: TxPoolAdded}, {Tx: txs[1], Type: TxPoolPromoted},
+		{Tx: txs[2], Type: TxPoolAdded},
+		{Tx: txs[0], Type: TxPoolDropped, Reason: dropRemoved},
+		{Tx: txs[2], Type: TxPoolDropped, Reason: dropRemoved},
+		{Tx: txs[1], Type: TxPoolDropped, Reason: dropRemoved},
+	}
+	for i, exp := range want {
+		select {
+		case ev := <-events:
+			if ev.Tx.Hash() != exp.Tx.Hash() || ev.Type != exp.Type || ev.Reason != exp.Reason {
+				t.Errorf("event %d: mismatch: have %v %x (%s), want %v %x (%s)", i, ev.Type, ev.Tx.Hash(), ev.Reason, exp.Type, exp.Tx.Hash(), exp.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: timeout waiting for pool event", i)
+		}
+	}
+}
+
+// blockTestChain is a test blockchain serving the blocks of a fixed set.
+type blockTestChain struct {
+	*testBlockChain
+	blocks map[common.Hash]*types.Block
+}
+
+func (bc *blockTestChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return bc.blocks[hash]
+}
+
+// Tests that transactions leaving the pool because they got included in a block
+// are reported as such, while others losing their nonce are reported as dropped.
+func TestTransactionIncludedEvents(t *testing.T) {
+	t.Parallel()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(ethdb.NewMemDatabase()))
+	chain := &blockTestChain{&testBlockChain{statedb, 1000000, new(event.Feed)}, make(map[common.Hash]*types.Block)}
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, chain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	account, _ := deriveSender(transaction(0, 0, key))
+	pool.currentState.AddBalance(account, big.NewInt(1000000))
+
+	events := make(chan TxPoolEvent, 32)
+	sub := pool.SubscribeTxPoolEvent(events)
+	defer sub.Unsubscribe()
+
+	txs := []*types.Transaction{transaction(0, 100000, key), transaction(1, 100000, key)}
+	for i, tx := range txs {
+		if err := pool.AddRemote(tx); err != nil {
+			t.Fatalf("tx %d: failed to add transaction: %v", i, err)
+		}
+	}
+	// Include the first transaction and a different one with the second nonce
+	var (
+		parent = &types.Header{Number: big.NewInt(0), GasLimit: 1000000}
+		header = &types.Header{Number: big.NewInt(1), ParentHash: parent.Hash(), GasLimit: 1000000}
+		block  = types.NewBlock(header, types.Transactions{txs[0], pricedTransaction(1, 100000, big.NewInt(2), key)}, nil, nil)
+	)
+	chain.blocks[block.Hash()] = block
+	statedb.SetNonce(account, 2)
+	pool.lockedReset(parent, block.Header())
+
+	if pending, queued := pool.Stats(); pending+queued != 0 {
+		t.Fatalf("stale transactions retained: %d pending, %d queued", pending, queued)
+	}
+	want := []TxPoolEvent{
+		{Tx: txs[0], Type: TxPoolAdded}, {Tx: txs[0], Type: TxPoolPromoted},
+		{Tx: txs[1], Type: TxPoolAdded}, {Tx: txs[1], Type: TxPoolPromoted},
+		{Tx: txs[0], Type: TxPoolIncluded},
+		{Tx: txs[1], Type: TxPoolDropped, Reason: dropStaleNonce},
+	}
+	for i, exp := range want {
+		select {
+		case ev := <-events:
+			if ev.Tx.Hash() != exp.Tx.Hash() || ev.Type != exp.Type || ev.Reason != exp.Reason {
+				t.Errorf("event %d: mismatch: have %v %x (%s), want %v %x (%s)", i, ev.Type, ev.Tx.Hash(), ev.Reason, exp.Type, exp.Tx.Hash(), exp.Reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d: timeout waiting for pool event", i)
+		}
+	}
+}
+
+// Tests that the queue of undelivered pool events is bounded.
+func TestTransactionEventQueueLimit(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	// Subscribe without draining, stall delivery on the first event
+	events := make(chan TxPoolEvent)
+	sub := pool.SubscribeTxPoolEvent(events)
+	defer sub.Unsubscribe()
+
+	tx := transaction(0, 100000, key)
+	for i := 0; i < 2*maxQueuedEvents; i++ {
+		pool.emit(tx, TxPoolAdded, "")
+	}
+	pool.eventLock.Lock()
+	queued := len(pool.eventQueue)
+	pool.eventLock.Unlock()
+
+	if queued > maxQueuedEvents {
+		t.Fatalf("event queue exceeds limit: have %d, want at most %d", queued, maxQueuedEvents)
+	}
+}
+
 // Benchmarks the speed of validating the contents of the pending queue of the
 // transaction pool.
 func BenchmarkPendingDemotion100(b *testing.B)   { benchmarkPendingDemotion(b, 100) }
@@ -17,8 +17,12 @@
 package vm
 
 import (
+	"bytes"
+	"encoding/json"
 	"math/big"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/params"
@@ -68,3 +72,44 @@ func TestStoreCapture(t *testing.T) {
 		t.Errorf("expected %x, got %x", exp, logger.changedValues[contract.Address()][index])
 	}
 }
+
+// Tests that the JSON logger emits a JSON object per step and a summary at the
+// end, omitting the disabled fields.
+func TestJSONLogger(t *testing.T) {
+	var (
+		env      = NewEVM(Context{}, nil, params.TestChainConfig, Config{})
+		out      = new(bytes.Buffer)
+		logger   = NewJSONLogger(&LogConfig{DisableMemory: true}, out)
+		mem      = NewMemory()
+		stack    = newstack()
+		contract = NewContract(&dummyContractRef{}, &dummyContractRef{}, new(big.Int), 0)
+	)
+	mem.Resize(32)
+	stack.push(big.NewInt(1))
+
+	logger.CaptureState(env, 0, PUSH1, 100, 3, mem, stack, contract, 1, nil)
+	logger.CaptureState(env, 2, STOP, 97, 0, mem, stack, contract, 1, nil)
+	logger.CaptureEnd([]byte{0x01}, 3, time.Millisecond, nil)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("line count mismatch: have %d, want 3", len(lines))
+	}
+	var step map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &step); err != nil {
+		t.Fatalf("failed to decode step: %v", err)
+	}
+	if step["opName"] != "PUSH1" || step["gas"] != "0x64" || step["memSize"] != float64(32) || step["memory"] != "0x" {
+		t.Errorf("step mismatch: %s", lines[0])
+	}
+	if stack, ok := step["stack"].([]interface{}); !ok || len(stack) != 1 || stack[0] != "0x1" {
+		t.Errorf("stack mismatch: %s", lines[0])
+	}
+	var summary map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[2]), &summary); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+	if summary["output"] != "01" || summary["gasUsed"] != "0x3" {
+		t.Errorf("summary mismatch: %s", lines[2])
+	}
+}
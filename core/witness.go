@@ -0,0 +1,190 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/consensus"
+	"github.com/themis-network/go-themis/core/state"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/core/vm"
+	"github.com/themis-network/go-themis/params"
+)
+
+// errWitnessMissingParent is returned if a block witness doesn't contain the
+// header of the block's parent.
+var errWitnessMissingParent = errors.New("witness missing parent header")
+
+// BlockWitness is the data needed to re-execute a block without a state database:
+// every trie node and contract code touched while executing it on top of its
+// parent, and the ancestor headers accessed. The first header is always the
+// parent of the block.
+type BlockWitness struct {
+	Headers []*types.Header `json:"headers"`
+	State   []hexutil.Bytes `json:"state"`
+}
+
+// BlockWitness re-executes a block on top of its parent state, recording every
+// trie node, contract code and ancestor header accessed into a witness.
+func (bc *BlockChain) BlockWitness(block *types.Block) (*BlockWitness, error) {
+	parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	db := state.NewRecordingDatabase(bc.stateCache)
+	statedb, err := state.New(parent.Root, db)
+	if err != nil {
+		return nil, err
+	}
+	chain := &recordingChain{BlockChain: bc, seen: map[common.Hash]bool{parent.Hash(): true}}
+	receipts, _, usedGas, err := applyBlock(bc.chainConfig, chain, bc.engine, block, statedb, bc.vmConfig)
+	if err != nil {
+		return nil, err
+	}
+	// Validating the state derives the post root, pulling in any trie nodes that
+	// are only needed for hashing (e.g. siblings of deleted nodes)
+	if err := bc.Validator().ValidateState(block, nil, statedb, receipts, usedGas); err != nil {
+		return nil, err
+	}
+	witness := &BlockWitness{Headers: append([]*types.Header{parent}, chain.headers...)}
+	for _, blob := range db.Witness() {
+		witness.State = append(witness.State, blob)
+	}
+	return witness, nil
+}
+
+// VerifyBlockWitness statelessly re-executes a block on top of the state and
+// ancestor headers contained in its witness, and checks that the results (gas,
+// receipts, bloom and post state root) match the ones committed to in the block.
+func VerifyBlockWitness(config *params.ChainConfig, engine consensus.Engine, block *types.Block, witness *BlockWitness) error {
+	if len(witness.Headers) == 0 || witness.Headers[0].Hash() != block.ParentHash() {
+		return errWitnessMissingParent
+	}
+	parent := witness.Headers[0]
+
+	nodes := make([][]byte, len(witness.State))
+	for i, blob := range witness.State {
+		nodes[i] = blob
+	}
+	statedb, err := state.New(parent.Root, state.NewWitnessDatabase(nodes))
+	if err != nil {
+		return fmt.Errorf("incomplete witness: %v", err)
+	}
+	chain := newWitnessChain(config, engine, witness.Headers)
+	receipts, _, usedGas, err := applyBlock(config, chain, engine, block, statedb, vm.Config{})
+	if err != nil {
+		return err
+	}
+	err = NewBlockValidator(config, nil, engine).ValidateState(block, nil, statedb, receipts, usedGas)
+	if dberr := statedb.Error(); dberr != nil {
+		return fmt.Errorf("incomplete witness: %v", dberr)
+	}
+	return err
+}
+
+// recordingChain is a block context on top of a local chain, recording all the
+// headers retrieved through it.
+type recordingChain struct {
+	*BlockChain
+
+	headers []*types.Header
+	seen    map[common.Hash]bool
+	lock    sync.Mutex
+}
+
+// GetHeader retrieves a block header from the local chain, recording it.
+func (c *recordingChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	header := c.BlockChain.GetHeader(hash, number)
+	if header == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.seen[hash] {
+		c.seen[hash] = true
+		c.headers = append(c.headers, header)
+	}
+	return header
+}
+
+// witnessChain is a block context serving the ancestor headers contained in a
+// block witness.
+type witnessChain struct {
+	config  *params.ChainConfig
+	engine  consensus.Engine
+	headers map[common.Hash]*types.Header
+	parent  *types.Header
+}
+
+// newWitnessChain creates a block context from the headers of a witness. The
+// headers are indexed by their own hash, so tampered ones can't be served.
+func newWitnessChain(config *params.ChainConfig, engine consensus.Engine, headers []*types.Header) *witnessChain {
+	chain := &witnessChain{
+		config:  config,
+		engine:  engine,
+		headers: make(map[common.Hash]*types.Header),
+		parent:  headers[0],
+	}
+	for _, header := range headers {
+		chain.headers[header.Hash()] = header
+	}
+	return chain
+}
+
+// Config retrieves the chain configuration.
+func (c *witnessChain) Config() *params.ChainConfig { return c.config }
+
+// Engine retrieves the consensus engine.
+func (c *witnessChain) Engine() consensus.Engine { return c.engine }
+
+// CurrentHeader retrieves the parent of the block being verified.
+func (c *witnessChain) CurrentHeader() *types.Header { return c.parent }
+
+// GetHeader retrieves a header of the witness by hash and number.
+func (c *witnessChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.headers[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+// GetHeaderByHash retrieves a header of the witness by hash.
+func (c *witnessChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	return c.headers[hash]
+}
+
+// GetHeaderByNumber retrieves a header of the witness by number, following the
+// parent links from the parent of the block being verified.
+func (c *witnessChain) GetHeaderByNumber(number uint64) *types.Header {
+	for header := c.parent; header != nil; header = c.headers[header.ParentHash] {
+		if header.Number.Uint64() == number {
+			return header
+		}
+	}
+	return nil
+}
+
+// GetBlock always returns nil as witnesses don't contain block bodies.
+func (c *witnessChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return nil
+}
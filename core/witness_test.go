@@ -0,0 +1,96 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/core/vm"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/params"
+)
+
+// Tests that block witnesses allow re-executing blocks statelessly, and that
+// incomplete witnesses are detected.
+func TestBlockWitness(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		// slot[number] = blockhash(number-3); slot[number-2] = 0
+		code     = common.FromHex("0x600343034043556000600243035500")
+		contract = common.HexToAddress("0xc0de")
+		gspec    = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address:  {Balance: big.NewInt(1000000000000000)},
+				contract: {Code: code, Balance: big.NewInt(0)},
+			},
+		}
+		engine = ethash.NewFaker()
+		db     = ethdb.NewMemDatabase()
+		signer = types.HomesteadSigner{}
+	)
+	gspec.MustCommit(db)
+	chain, _ := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{})
+	defer chain.Stop()
+
+	// Generate the blocks one by one, as BLOCKHASH needs the preceding ones
+	var blocks []*types.Block
+	for i := 0; i < 8; i++ {
+		block, _ := GenerateChain(gspec.Config, chain.CurrentBlock(), engine, db, 1, func(_ int, b *BlockGen) {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), contract, big.NewInt(0), 100000, big.NewInt(1), nil), signer, key)
+			b.AddTxWithChain(chain, tx)
+			tx, _ = types.SignTx(types.NewTransaction(b.TxNonce(address), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+			b.AddTxWithChain(chain, tx)
+		})
+		if _, err := chain.InsertChain(block); err != nil {
+			t.Fatalf("block %d: failed to insert: %v", i, err)
+		}
+		blocks = append(blocks, block...)
+	}
+	for i, block := range blocks {
+		witness, err := chain.BlockWitness(block)
+		if err != nil {
+			t.Fatalf("block %d: failed to create witness: %v", i, err)
+		}
+		if err := VerifyBlockWitness(gspec.Config, engine, block, witness); err != nil {
+			t.Fatalf("block %d: failed to verify witness: %v", i, err)
+		}
+		// Ensure BLOCKHASH lookups beyond the parent are captured
+		if i > 1 && len(witness.Headers) < 2 {
+			t.Errorf("block %d: ancestor headers missing from witness", i)
+		}
+	}
+	// Ensure any missing trie node or header is detected
+	witness, _ := chain.BlockWitness(blocks[len(blocks)-1])
+	for i := range witness.State {
+		partial := &BlockWitness{Headers: witness.Headers, State: append(append([]hexutil.Bytes{}, witness.State[:i]...), witness.State[i+1:]...)}
+		if err := VerifyBlockWitness(gspec.Config, engine, blocks[len(blocks)-1], partial); err == nil {
+			t.Errorf("state item %d: incomplete witness verified", i)
+		}
+	}
+	partial := &BlockWitness{Headers: witness.Headers[1:], State: witness.State}
+	if err := VerifyBlockWitness(gspec.Config, engine, blocks[len(blocks)-1], partial); err != errWitnessMissingParent {
+		t.Errorf("missing parent error mismatch: have %v, want %v", err, errWitnessMissingParent)
+	}
+}
@@ -5,7 +5,8 @@ import (
 	"fmt"
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis"
-	"github.com/themis-network/go-themis/ethclient"
+	"github.com/themis-network/go-themis/ethclient/failover"
+	"strings"
 	"context"
 	"github.com/themis-network/go-themis/core/types"
 	"github.com/themis-network/go-themis/cmd/stub"
@@ -29,17 +30,21 @@ type Monitor struct{
 }
 
 type ContractClient struct{
-	rawClient *ethclient.Client
+	rawClient *failover.Client
 	ctx context.Context
 	traderCaller *stub.TradeCaller
 	traderTransactor *stub.Trade
 }
 
 
-func getClient(nodeEndpoint string) (*ethclient.Client, error){
-	nodeWsUrl := nodeProtocol + nodeEndpoint
-	client, _ := ethclient.Dial(nodeWsUrl)
-	return client, nil
+// getClient connects to the comma separated node endpoints, failing over
+// between them.
+func getClient(nodeEndpoints string) (*failover.Client, error){
+	var urls []string
+	for _, endpoint := range strings.Split(nodeEndpoints, ",") {
+		urls = append(urls, nodeProtocol + strings.TrimSpace(endpoint))
+	}
+	return failover.Dial(urls...)
 }
 
 func GetContractData(){
@@ -197,8 +202,7 @@ func getContractClient(nodeEndpoint string) (*ContractClient, error){
 
 	logger.Println("Connecting to themis rpc service, nodeEndpoint:", nodeEndpoint)
 
-	nodeWsUrl := nodeProtocol + nodeEndpoint
-	rawClient, err := ethclient.Dial(nodeWsUrl)
+	rawClient, err := getClient(nodeEndpoint)
 	if err != nil {
 		return nil, err
 	}
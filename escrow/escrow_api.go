@@ -36,7 +36,7 @@ func (t *EscrowNode) startApiServer(){
 		},
 	}
 
-	rpc.StartHTTPEndpoint(t.config.Endpoint, apis, modules, cors, vhosts)
+	rpc.StartHTTPEndpoint(t.config.Endpoint, apis, modules, cors, vhosts, nil, nil, nil, nil, nil)
 }
 
 // NewPublicWeb3API creates a new Web3Service instance
@@ -26,6 +26,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/themis-network/go-themis/accounts"
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/common/hexutil"
 	"github.com/themis-network/go-themis/core"
@@ -201,6 +202,130 @@ func (api *PrivateMinerAPI) GetHashrate() uint64 {
 	return uint64(api.e.miner.HashRate())
 }
 
+// PrivateTxPoolAPI provides private RPC methods to control the admission policy
+// of the transaction pool.
+type PrivateTxPoolAPI struct {
+	e *Ethereum
+}
+
+// NewPrivateTxPoolAPI creates a new RPC service which controls the transaction
+// pool of this node.
+func NewPrivateTxPoolAPI(e *Ethereum) *PrivateTxPoolAPI {
+	return &PrivateTxPoolAPI{e: e}
+}
+
+// Policy returns the admission policy currently enforced by the transaction pool.
+func (api *PrivateTxPoolAPI) Policy() core.TxPolicy {
+	return api.e.txPool.Policy()
+}
+
+// SetPolicy replaces the admission policy of the transaction pool, dropping all
+// pooled transactions no longer permitted.
+func (api *PrivateTxPoolAPI) SetPolicy(policy core.TxPolicy) bool {
+	api.e.txPool.SetPolicy(policy)
+	return true
+}
+
+// Remove evicts a single transaction from the pool. Any subsequent transactions
+// of the same account are moved back into the future queue.
+func (api *PrivateTxPoolAPI) Remove(hash common.Hash) bool {
+	return api.e.txPool.RemoveTransaction(hash)
+}
+
+// RemoveAccount evicts all the transactions of an account from the pool and
+// returns the number of transactions removed.
+func (api *PrivateTxPoolAPI) RemoveAccount(addr common.Address) hexutil.Uint {
+	return hexutil.Uint(api.e.txPool.RemoveAccount(addr))
+}
+
+// BumpFee replaces a pooled transaction signed by an account of this node with
+// an identical one paying the given gas price, returning the new hash. The new
+// price needs to satisfy the price bump required by the pool.
+func (api *PrivateTxPoolAPI) BumpFee(hash common.Hash, gasPrice hexutil.Big) (common.Hash, error) {
+	tx := api.e.txPool.Get(hash)
+	if tx == nil {
+		return common.Hash{}, fmt.Errorf("transaction %#x not found", hash)
+	}
+	var signer types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	account := accounts.Account{Address: from}
+	wallet, err := api.e.AccountManager().Find(account)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("transaction %#x not signed by a local account", hash)
+	}
+	var replacement *types.Transaction
+	if to := tx.To(); to != nil {
+		replacement = types.NewTransaction(tx.Nonce(), *to, tx.Value(), tx.Gas(), (*big.Int)(&gasPrice), tx.Data())
+	} else {
+		replacement = types.NewContractCreation(tx.Nonce(), tx.Value(), tx.Gas(), (*big.Int)(&gasPrice), tx.Data())
+	}
+	var chainID *big.Int
+	if config := api.e.chainConfig; config.IsEIP155(api.e.blockchain.CurrentBlock().Number()) {
+		chainID = config.ChainID
+	}
+	signed, err := wallet.SignTx(account, replacement, chainID)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := api.e.txPool.AddLocal(signed); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Bumped transaction fee", "old", hash, "new", signed.Hash(), "price", signed.GasPrice())
+	return signed.Hash(), nil
+}
+
+// txPoolEvent is the RPC representation of a transaction pool event.
+type txPoolEvent struct {
+	Type   string         `json:"type"`
+	Hash   common.Hash    `json:"hash"`
+	From   common.Address `json:"from"`
+	Nonce  hexutil.Uint64 `json:"nonce"`
+	Reason string         `json:"reason,omitempty"`
+}
+
+// Events creates a subscription that is notified every time a transaction is
+// added to, promoted within, dropped from or included out of the transaction
+// pool.
+func (api *PrivateTxPoolAPI) Events(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		events := make(chan core.TxPoolEvent, 128)
+		sub := api.e.txPool.SubscribeTxPoolEvent(events)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-events:
+				signer := types.MakeSigner(api.e.chainConfig, api.e.blockchain.CurrentBlock().Number())
+				from, _ := types.Sender(signer, ev.Tx) // already validated by the pool
+				notifier.Notify(rpcSub.ID, &txPoolEvent{
+					Type:   ev.Type.String(),
+					Hash:   ev.Tx.Hash(),
+					From:   from,
+					Nonce:  hexutil.Uint64(ev.Tx.Nonce()),
+					Reason: ev.Reason,
+				})
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
 // PrivateAdminAPI is the collection of Ethereum full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -382,6 +507,29 @@ func (api *PrivateDebugAPI) GetBadBlocks(ctx context.Context) ([]*BadBlockArgs,
 	return results, nil
 }
 
+// GetBlockWitness re-executes the given block on top of its parent state and
+// returns the witness needed to verify it without access to the full state: the
+// trie nodes, contract codes and ancestor headers accessed during execution.
+func (api *PrivateDebugAPI) GetBlockWitness(ctx context.Context, number rpc.BlockNumber) (*core.BlockWitness, error) {
+	var block *types.Block
+
+	switch number {
+	case rpc.PendingBlockNumber:
+		return nil, errors.New("witness of pending block not supported")
+	case rpc.LatestBlockNumber:
+		block = api.eth.blockchain.CurrentBlock()
+	default:
+		block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not executable")
+	}
+	return api.eth.blockchain.BlockWitness(block)
+}
+
 // StorageRangeResult is the result of a debug_storageRangeAt API call.
 type StorageRangeResult struct {
 	Storage storageMap   `json:"storage"`
@@ -431,6 +579,25 @@ func storageRangeAt(st state.Trie, start []byte, maxResult int) (StorageRangeRes
 	return result, nil
 }
 
+// StateDiff returns the state changes of the given block: the balance, nonce,
+// code and storage values before and after the block of every account modified.
+func (api *PrivateDebugAPI) StateDiff(ctx context.Context, number rpc.BlockNumber) (*core.BlockStateDiff, error) {
+	var block *types.Block
+
+	switch number {
+	case rpc.PendingBlockNumber:
+		return nil, errors.New("state diff of pending block not supported")
+	case rpc.LatestBlockNumber:
+		block = api.eth.blockchain.CurrentBlock()
+	default:
+		block = api.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	return api.eth.blockchain.StateDiff(block)
+}
+
 // GetModifiedAccountsByNumber returns all accounts that have changed between the
 // two blocks specified. A change is defined as a difference in nonce, balance,
 // code hash, or storage hash.
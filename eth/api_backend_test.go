@@ -0,0 +1,202 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/consensus"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/core/vm"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/internal/ethapi"
+	"github.com/themis-network/go-themis/params"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+var (
+	bundleKey, _  = crypto.GenerateKey()
+	bundleFrom    = crypto.PubkeyToAddress(bundleKey.PublicKey)
+	bundleCounter = common.HexToAddress("0xc0de") // increments slot 0, logs and returns the new value
+	bundleAuthor  = common.HexToAddress("0xc01b") // returns the coinbase
+	bundleLoop    = common.HexToAddress("0x1009") // loops forever
+)
+
+// sealedEngine mimics an engine recovering the author from the header seal, like
+// clique does, so the author of a modified header is not the one of the original.
+type sealedEngine struct {
+	consensus.Engine
+}
+
+func (sealedEngine) Author(header *types.Header) (common.Address, error) {
+	return common.BytesToAddress(header.Hash().Bytes()), nil
+}
+
+// newBundleTester creates a blockchain API on top of a chain with a few contracts
+// exercising the call bundles, limited by the given call caps.
+func newBundleTester(t *testing.T, gasCap uint64, timeout time.Duration) (*ethapi.PublicBlockChainAPI, *types.Block) {
+	var (
+		db    = ethdb.NewMemDatabase()
+		gspec = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				bundleFrom: {Balance: big.NewInt(1e18)},
+				bundleCounter: {Balance: big.NewInt(0), Code: []byte{
+					0x60, 0x00, 0x54, 0x60, 0x01, 0x01, 0x80, 0x60, 0x00, 0x55, // PUSH1 0 SLOAD PUSH1 1 ADD DUP1 PUSH1 0 SSTORE
+					0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xa0, // PUSH1 0 MSTORE PUSH1 32 PUSH1 0 LOG0
+					0x60, 0x20, 0x60, 0x00, 0xf3, // PUSH1 32 PUSH1 0 RETURN
+				}},
+				bundleAuthor: {Balance: big.NewInt(0), Code: []byte{
+					0x41, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3, // COINBASE PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+				}},
+				bundleLoop: {Balance: big.NewInt(0), Code: []byte{0x5b, 0x60, 0x00, 0x56}}, // JUMPDEST PUSH1 0 JUMP
+			},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = sealedEngine{ethash.NewFaker()}
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, engine, db, 1, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(common.HexToAddress("0xbeef"))
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import blocks: %v", err)
+	}
+	eth := &Ethereum{
+		config:      &Config{RPCGasCap: gasCap, RPCEVMTimeout: timeout},
+		chainConfig: gspec.Config,
+		blockchain:  chain,
+		chainDb:     db,
+		engine:      engine,
+	}
+	return ethapi.NewPublicBlockChainAPI(&EthAPIBackend{eth: eth}), blocks[0]
+}
+
+// Tests that the calls of a bundle see the state changes of the ones before them
+// and that their logs are attributed to the right call of the right block.
+func TestCallBundleSequence(t *testing.T) {
+	api, block := newBundleTester(t, 0, 5*time.Second)
+
+	calls := []ethapi.CallArgs{
+		{From: bundleFrom, To: &bundleCounter},
+		{From: bundleFrom, To: &bundleCounter},
+		{From: bundleFrom, To: &bundleCounter},
+	}
+	blockOverrides := &ethapi.BlockOverrides{Number: (*hexutil.Big)(big.NewInt(100))}
+
+	results, err := api.CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil, blockOverrides)
+	if err != nil {
+		t.Fatalf("failed to execute bundle: %v", err)
+	}
+	if len(results) != len(calls) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(calls))
+	}
+	seen := make(map[common.Hash]bool)
+	for i, res := range results {
+		want := common.BigToHash(big.NewInt(int64(i + 1)))
+		if res.Failed {
+			t.Fatalf("call %d: execution failed", i)
+		}
+		if common.BytesToHash(res.ReturnValue) != want {
+			t.Errorf("call %d: return value mismatch: have %x, want %x", i, res.ReturnValue, want)
+		}
+		if len(res.Logs) != 1 {
+			t.Fatalf("call %d: log count mismatch: have %d, want 1", i, len(res.Logs))
+		}
+		log := res.Logs[0]
+		if common.BytesToHash(log.Data) != want {
+			t.Errorf("call %d: log data mismatch: have %x, want %x", i, log.Data, want)
+		}
+		if log.BlockHash != block.Hash() {
+			t.Errorf("call %d: log block hash mismatch: have %x, want %x", i, log.BlockHash, block.Hash())
+		}
+		if log.TxIndex != uint(i) {
+			t.Errorf("call %d: log index mismatch: have %d, want %d", i, log.TxIndex, i)
+		}
+		if log.TxHash == (common.Hash{}) || seen[log.TxHash] {
+			t.Errorf("call %d: log hash %x not unique", i, log.TxHash)
+		}
+		seen[log.TxHash] = true
+	}
+}
+
+// Tests that overriding the block context keeps the author of the original block
+// unless the coinbase is overridden too.
+func TestCallBundleCoinbase(t *testing.T) {
+	api, block := newBundleTester(t, 0, 5*time.Second)
+
+	var (
+		calls    = []ethapi.CallArgs{{From: bundleFrom, To: &bundleAuthor}}
+		coinbase = common.HexToAddress("0xc0ffee")
+	)
+	tests := []struct {
+		overrides *ethapi.BlockOverrides
+		want      common.Address
+	}{
+		{nil, common.BytesToAddress(block.Hash().Bytes())},
+		{&ethapi.BlockOverrides{Number: (*hexutil.Big)(big.NewInt(100))}, common.BytesToAddress(block.Hash().Bytes())},
+		{&ethapi.BlockOverrides{Time: (*hexutil.Big)(big.NewInt(100))}, common.BytesToAddress(block.Hash().Bytes())},
+		{&ethapi.BlockOverrides{Number: (*hexutil.Big)(big.NewInt(100)), Coinbase: &coinbase}, coinbase},
+	}
+	for i, tt := range tests {
+		results, err := api.CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil, tt.overrides)
+		if err != nil {
+			t.Fatalf("test %d: failed to execute bundle: %v", i, err)
+		}
+		if have := common.BytesToAddress(results[0].ReturnValue); have != tt.want {
+			t.Errorf("test %d: coinbase mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that the calls of a bundle are limited by the configured gas cap and
+// execution timeout.
+func TestCallBundleLimits(t *testing.T) {
+	calls := []ethapi.CallArgs{{From: bundleFrom, To: &bundleLoop, Gas: hexutil.Uint64(1 << 40)}}
+
+	// A capped call runs out of gas at the cap
+	api, _ := newBundleTester(t, 50000, 0)
+	results, err := api.CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to execute capped bundle: %v", err)
+	}
+	if !results[0].Failed || results[0].GasUsed != 50000 {
+		t.Errorf("capped call mismatch: have failed %v gas %d, want failed true gas 50000", results[0].Failed, results[0].GasUsed)
+	}
+	// An uncapped call is aborted at the timeout
+	api, _ = newBundleTester(t, 0, 100*time.Millisecond)
+
+	start := time.Now()
+	if _, err := api.CallBundle(context.Background(), calls, rpc.LatestBlockNumber, nil, nil); err == nil || !strings.Contains(err.Error(), "execution aborted") {
+		t.Errorf("error mismatch: have %v, want execution aborted", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("bundle not aborted in time: took %v", elapsed)
+	}
+}
@@ -17,15 +17,21 @@
 package eth
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/themis-network/go-themis/apitypes"
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/common/hexutil"
 	"github.com/themis-network/go-themis/core"
@@ -33,8 +39,8 @@ import (
 	"github.com/themis-network/go-themis/core/state"
 	"github.com/themis-network/go-themis/core/types"
 	"github.com/themis-network/go-themis/core/vm"
+	"github.com/themis-network/go-themis/crypto"
 	"github.com/themis-network/go-themis/eth/tracers"
-	"github.com/themis-network/go-themis/internal/ethapi"
 	"github.com/themis-network/go-themis/log"
 	"github.com/themis-network/go-themis/rlp"
 	"github.com/themis-network/go-themis/rpc"
@@ -53,11 +59,14 @@ const (
 )
 
 // TraceConfig holds extra parameters to trace functions.
-type TraceConfig struct {
+type TraceConfig = apitypes.TraceConfig
+
+// StdTraceConfig holds extra parameters to the standard-json trace functions.
+type StdTraceConfig struct {
 	*vm.LogConfig
-	Tracer  *string
-	Timeout *string
-	Reexec  *uint64
+	Reexec *uint64
+	TxHash common.Hash // Only trace this transaction if set
+	Dir    string      // Folder to write the traces into, relative to the node's trace folder
 }
 
 // txTraceResult is the result of a single transaction trace.
@@ -467,6 +476,262 @@ func (api *PrivateDebugAPI) traceBlock(ctx context.Context, block *types.Block,
 	return results, nil
 }
 
+// StandardTraceBlockToFile dumps the structured logs created during the execution
+// of EVM to the local file system, one JSON object per line and one file per
+// transaction, and returns the list of files to the caller. Traces already on
+// disk from an earlier, interrupted call are not regenerated.
+func (api *PrivateDebugAPI) StandardTraceBlockToFile(ctx context.Context, hash common.Hash, config *StdTraceConfig) ([]string, error) {
+	block := api.eth.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("block #%x not found", hash)
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+	parent := api.eth.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %x not found", block.ParentHash())
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	statedb, err := api.computeStateDB(parent, reexec)
+	if err != nil {
+		return nil, err
+	}
+	files, found, err := api.standardTraceBlockToFiles(ctx, block, statedb, config)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil && config.TxHash != (common.Hash{}) && !found {
+		return nil, fmt.Errorf("transaction %x not found in block %x", config.TxHash, hash)
+	}
+	return files, nil
+}
+
+// TraceRangeToFiles dumps the structured logs created during the execution of
+// EVM for all the blocks between start and end (both inclusive) to the local
+// file system, and returns the list of files to the caller. Unlike TraceChain,
+// nothing is held in memory apart from the state being traced, and since traces
+// already on disk are not regenerated, an interrupted call can be resumed by
+// simply repeating it.
+func (api *PrivateDebugAPI) TraceRangeToFiles(ctx context.Context, start, end rpc.BlockNumber, config *StdTraceConfig) ([]string, error) {
+	// Fetch the block interval that we want to trace
+	from, to := api.blockByNumber(start), api.blockByNumber(end)
+	if from == nil {
+		return nil, fmt.Errorf("starting block #%d not found", start)
+	}
+	if to == nil {
+		return nil, fmt.Errorf("end block #%d not found", end)
+	}
+	if from.NumberU64() == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+	if from.NumberU64() > to.NumberU64() {
+		return nil, fmt.Errorf("invalid range #%d-#%d", from.NumberU64(), to.NumberU64())
+	}
+	parent := api.eth.blockchain.GetBlock(from.ParentHash(), from.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %x not found", from.ParentHash())
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	statedb, err := api.computeStateDB(parent, reexec)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		database = statedb.Database()
+		files    []string
+		begin    = time.Now()
+		logged   time.Time
+		proot    common.Hash
+	)
+	// Release the last state we've referenced on any exit path
+	defer func() {
+		if proot != (common.Hash{}) {
+			database.TrieDB().Dereference(proot)
+		}
+	}()
+	for number := from.NumberU64(); number <= to.NumberU64(); number++ {
+		// Print progress logs if long enough time elapsed
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Tracing chain segment to files", "start", from.NumberU64(), "end", to.NumberU64(), "current", number, "files", len(files), "elapsed", time.Since(begin))
+			logged = time.Now()
+		}
+		// Retrieve the next block and trace it on a copy of the state
+		block := api.eth.blockchain.GetBlockByNumber(number)
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		traces, _, err := api.standardTraceBlockToFiles(ctx, block, statedb.Copy(), config)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, traces...)
+		if number == to.NumberU64() {
+			break
+		}
+		// Generate the next state snapshot fast without tracing
+		if _, _, _, err := api.eth.blockchain.Processor().Process(block, statedb, vm.Config{}); err != nil {
+			return nil, err
+		}
+		root, err := statedb.Commit(api.config.IsEIP158(block.Number()))
+		if err != nil {
+			return nil, err
+		}
+		if err := statedb.Reset(root); err != nil {
+			return nil, err
+		}
+		// Hold on to the new state and release the previous one
+		database.TrieDB().Reference(root, common.Hash{})
+		if proot != (common.Hash{}) {
+			database.TrieDB().Dereference(proot)
+		}
+		proot = root
+	}
+	log.Info("Chain segment traced to files", "start", from.NumberU64(), "end", to.NumberU64(), "files", len(files), "elapsed", time.Since(begin))
+	return files, nil
+}
+
+// traceDir resolves the folder to write trace files into. Requested folders are
+// interpreted relative to the trace folder of the node, and folders outside of
+// it are rejected, so RPC callers can't write files to arbitrary locations.
+func (api *PrivateDebugAPI) traceDir(dir string) (string, error) {
+	base := api.eth.traceDir
+	if base == "" {
+		base = filepath.Join(os.TempDir(), "gthemis-traces") // ephemeral node without a data directory
+	}
+	if dir == "" {
+		return base, nil
+	}
+	path := dir
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	path = filepath.Clean(path)
+	if rel, err := filepath.Rel(base, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("trace folder %s outside of %s", dir, base)
+	}
+	return path, nil
+}
+
+// standardTraceBlockToFiles executes all the transactions of a block on top of
+// its parent state, dumping the structured logs of the requested ones into a file
+// each. Transactions with an existing trace file are only executed, so a partial
+// run can be resumed. File names contain a digest of the logger configuration,
+// so traces of a different configuration are never reused. Traces are written
+// into temporary files first and renamed only once complete. Besides the list
+// of files, it returns whether the filtered transaction was found.
+func (api *PrivateDebugAPI) standardTraceBlockToFiles(ctx context.Context, block *types.Block, statedb *state.StateDB, config *StdTraceConfig) ([]string, bool, error) {
+	var (
+		logConfig vm.LogConfig
+		txHash    common.Hash
+		reqDir    string
+	)
+	if config != nil {
+		if config.LogConfig != nil {
+			logConfig = *config.LogConfig
+		}
+		reqDir = config.Dir
+		txHash = config.TxHash
+	}
+	dir, err := api.traceDir(reqDir)
+	if err != nil {
+		return nil, false, err
+	}
+	blob, err := json.Marshal(logConfig)
+	if err != nil {
+		return nil, false, err
+	}
+	configTag := crypto.Keccak256(blob)[:4]
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, false, err
+	}
+	var (
+		signer = types.MakeSigner(api.config, block.Number())
+		files  []string
+		found  bool
+	)
+	for i, tx := range block.Transactions() {
+		// Stop tracing if interruption was requested
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		// Trace the transaction into a file unless it's filtered out or done already
+		var (
+			traced = txHash == (common.Hash{}) || txHash == tx.Hash()
+			path   = filepath.Join(dir, fmt.Sprintf("block_%d-0x%x-%d-0x%x-0x%x.jsonl", block.NumberU64(), block.Hash().Bytes()[:4], i, tx.Hash().Bytes()[:4], configTag))
+			vmConf vm.Config
+			dump   *os.File
+			writer *bufio.Writer
+		)
+		if traced {
+			files = append(files, path)
+			if _, err := os.Stat(path); err == nil {
+				traced = false
+			}
+		}
+		if traced {
+			var err error
+			if dump, err = os.Create(path + ".tmp"); err != nil {
+				return nil, false, err
+			}
+			writer = bufio.NewWriter(dump)
+			vmConf = vm.Config{Debug: true, Tracer: vm.NewJSONLogger(&logConfig, writer)}
+		}
+		// Execute the transaction and finalize the trace file
+		msg, _ := tx.AsMessage(signer)
+		vmctx := core.NewEVMContext(msg, block.Header(), api.eth.blockchain, nil)
+
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
+		vmenv := vm.NewEVM(vmctx, statedb, api.config, vmConf)
+		_, _, _, err := core.ApplyMessage(vmenv, msg, new(core.GasPool).AddGas(msg.Gas()))
+		if traced {
+			if err == nil {
+				err = writer.Flush()
+			}
+			if cerr := dump.Close(); err == nil {
+				err = cerr
+			}
+			if err == nil {
+				err = os.Rename(path+".tmp", path)
+			} else {
+				os.Remove(path + ".tmp")
+			}
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("tracing transaction %x failed: %v", tx.Hash(), err)
+		}
+		// Finalize the state so any modifications are written to the trie
+		statedb.Finalise(true)
+
+		// If only a single transaction was requested, the rest is irrelevant
+		if tx.Hash() == txHash {
+			found = true
+			break
+		}
+	}
+	return files, found, nil
+}
+
+// blockByNumber retrieves a block by number, resolving the pending and latest
+// special block numbers.
+func (api *PrivateDebugAPI) blockByNumber(number rpc.BlockNumber) *types.Block {
+	switch number {
+	case rpc.PendingBlockNumber:
+		return api.eth.miner.PendingBlock()
+	case rpc.LatestBlockNumber:
+		return api.eth.blockchain.CurrentBlock()
+	default:
+		return api.eth.blockchain.GetBlockByNumber(uint64(number))
+	}
+}
+
 // computeStateDB retrieves the state database associated with a certain block.
 // If no state is locally available for the given block, a number of blocks are
 // attempted to be reexecuted to generate the desired state.
@@ -558,7 +823,7 @@ func (api *PrivateDebugAPI) TraceTransaction(ctx context.Context, hash common.Ha
 // executes the given message in the provided environment. The return value will
 // be tracer dependent.
 func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, vmctx vm.Context, statedb *state.StateDB, config *TraceConfig) (interface{}, error) {
-	// Assemble the structured logger or the JavaScript tracer
+	// Assemble the structured logger or the requested tracer
 	var (
 		tracer vm.Tracer
 		err    error
@@ -572,15 +837,15 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 				return nil, err
 			}
 		}
-		// Constuct the JavaScript tracer to execute with
-		if tracer, err = tracers.New(*config.Tracer); err != nil {
+		// Constuct the native or JavaScript tracer to execute with
+		if tracer, err = tracers.NewTracer(*config.Tracer); err != nil {
 			return nil, err
 		}
 		// Handle timeouts and RPC cancellations
 		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
 		go func() {
 			<-deadlineCtx.Done()
-			tracer.(*tracers.Tracer).Stop(errors.New("execution timeout"))
+			tracer.(tracers.ResultTracer).Stop(errors.New("execution timeout"))
 		}()
 		defer cancel()
 
@@ -600,14 +865,14 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 	// Depending on the tracer type, format and return the output
 	switch tracer := tracer.(type) {
 	case *vm.StructLogger:
-		return &ethapi.ExecutionResult{
+		return &apitypes.ExecutionResult{
 			Gas:         gas,
 			Failed:      failed,
 			ReturnValue: fmt.Sprintf("%x", ret),
-			StructLogs:  ethapi.FormatLogs(tracer.StructLogs()),
+			StructLogs:  apitypes.FormatLogs(tracer.StructLogs()),
 		}, nil
 
-	case *tracers.Tracer:
+	case tracers.ResultTracer:
 		return tracer.GetResult()
 
 	default:
@@ -0,0 +1,206 @@
+// Copyright 2017 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/core/vm"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/params"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// newTraceTester creates a debug API on top of a chain of a few blocks, each
+// calling a contract twice, writing its traces into a temporary folder.
+func newTraceTester(t *testing.T) (*PrivateDebugAPI, []*types.Block, string) {
+	var (
+		key, _   = crypto.GenerateKey()
+		from     = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		db       = ethdb.NewMemDatabase()
+		gspec    = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				from:     {Balance: big.NewInt(1e18)},
+				contract: {Balance: big.NewInt(0), Code: []byte{0x60, 0x01, 0x60, 0x00, 0x55}}, // PUSH1 1 PUSH1 0 SSTORE
+			},
+		}
+		genesis = gspec.MustCommit(db)
+		signer  = types.NewEIP155Signer(gspec.Config.ChainID)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 3, func(i int, b *core.BlockGen) {
+		for j := 0; j < 2; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(from), contract, big.NewInt(1), 100000, big.NewInt(1), nil), signer, key)
+			b.AddTx(tx)
+		}
+	})
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import blocks: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "trace-test")
+	if err != nil {
+		t.Fatalf("failed to create trace folder: %v", err)
+	}
+	eth := &Ethereum{blockchain: chain, chainDb: db, traceDir: dir}
+	return NewPrivateDebugAPI(gspec.Config, eth), blocks, dir
+}
+
+// checkTraceFiles verifies that the trace files are within the given folder and
+// consist of JSON objects, returning whether any of them contains stack items.
+func checkTraceFiles(t *testing.T, files []string, dir string) (stack bool) {
+	t.Helper()
+
+	for _, file := range files {
+		if filepath.Dir(file) != dir {
+			t.Errorf("trace file %s outside of %s", file, dir)
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatalf("failed to open trace file: %v", err)
+		}
+		lines := 0
+		for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+			var entry map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Errorf("trace file %s: invalid line %q: %v", file, scanner.Text(), err)
+			}
+			if items, ok := entry["stack"].([]interface{}); ok && len(items) > 0 {
+				stack = true
+			}
+		}
+		f.Close()
+		if lines == 0 {
+			t.Errorf("trace file %s is empty", file)
+		}
+	}
+	return stack
+}
+
+func TestStandardTraceBlockToFile(t *testing.T) {
+	api, blocks, dir := newTraceTester(t)
+	defer os.RemoveAll(dir)
+
+	// Trace all transactions of a block into the default folder
+	files, err := api.StandardTraceBlockToFile(context.Background(), blocks[1].Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("trace file count mismatch: have %d, want 2", len(files))
+	}
+	if !checkTraceFiles(t, files, dir) {
+		t.Errorf("stack missing from traces")
+	}
+	// Tracing again reuses the existing files
+	for _, file := range files {
+		if err := ioutil.WriteFile(file, []byte("{}\n"), 0644); err != nil {
+			t.Fatalf("failed to overwrite trace file: %v", err)
+		}
+	}
+	again, err := api.StandardTraceBlockToFile(context.Background(), blocks[1].Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to trace block again: %v", err)
+	}
+	for i, file := range again {
+		if file != files[i] {
+			t.Fatalf("trace file %d mismatch: have %s, want %s", i, file, files[i])
+		}
+		if blob, _ := ioutil.ReadFile(file); string(blob) != "{}\n" {
+			t.Errorf("existing trace file %s regenerated", file)
+		}
+	}
+	// A different logger configuration produces new traces in a sub folder
+	config := &StdTraceConfig{
+		LogConfig: &vm.LogConfig{DisableStack: true},
+		TxHash:    blocks[1].Transactions()[1].Hash(),
+		Dir:       "sub",
+	}
+	files, err = api.StandardTraceBlockToFile(context.Background(), blocks[1].Hash(), config)
+	if err != nil {
+		t.Fatalf("failed to trace transaction: %v", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("trace file count mismatch: have %d, want 1", len(files))
+	}
+	if checkTraceFiles(t, files, filepath.Join(dir, "sub")) {
+		t.Errorf("stack traced despite being disabled")
+	}
+	// Unknown transactions are reported
+	config.TxHash = common.Hash{1}
+	if _, err := api.StandardTraceBlockToFile(context.Background(), blocks[1].Hash(), config); err == nil {
+		t.Errorf("unknown transaction traced")
+	}
+}
+
+func TestTraceRangeToFiles(t *testing.T) {
+	api, blocks, dir := newTraceTester(t)
+	defer os.RemoveAll(dir)
+
+	files, err := api.TraceRangeToFiles(context.Background(), rpc.BlockNumber(1), rpc.BlockNumber(3), nil)
+	if err != nil {
+		t.Fatalf("failed to trace range: %v", err)
+	}
+	if len(files) != 6 {
+		t.Fatalf("trace file count mismatch: have %d, want 6", len(files))
+	}
+	checkTraceFiles(t, files, dir)
+	for i, block := range blocks {
+		for j := 0; j < 2; j++ {
+			if file := filepath.Base(files[2*i+j]); !strings.HasPrefix(file, "block_"+block.Number().String()+"-") {
+				t.Errorf("trace file %d of block %d misnamed: %s", j, block.NumberU64(), file)
+			}
+		}
+	}
+	if _, err := api.TraceRangeToFiles(context.Background(), rpc.BlockNumber(3), rpc.BlockNumber(1), nil); err == nil {
+		t.Errorf("inverted range traced")
+	}
+}
+
+// Tests that trace files can't be written outside of the trace folder.
+func TestTraceDirConfinement(t *testing.T) {
+	api, blocks, dir := newTraceTester(t)
+	defer os.RemoveAll(dir)
+
+	for _, folder := range []string{"..", "../escape", "sub/../../escape", "/tmp", filepath.Dir(dir)} {
+		if _, err := api.StandardTraceBlockToFile(context.Background(), blocks[0].Hash(), &StdTraceConfig{Dir: folder}); err == nil {
+			t.Errorf("trace folder %s accepted", folder)
+		}
+	}
+	for _, folder := range []string{"sub", "sub/../other", filepath.Join(dir, "abs")} {
+		if _, err := api.StandardTraceBlockToFile(context.Background(), blocks[0].Hash(), &StdTraceConfig{Dir: folder}); err != nil {
+			t.Errorf("trace folder %s rejected: %v", folder, err)
+		}
+	}
+}
@@ -46,6 +46,7 @@ import (
 	"github.com/themis-network/go-themis/miner"
 	"github.com/themis-network/go-themis/node"
 	"github.com/themis-network/go-themis/p2p"
+	"github.com/themis-network/go-themis/p2p/dnsdisc"
 	"github.com/themis-network/go-themis/params"
 	"github.com/themis-network/go-themis/rlp"
 	"github.com/themis-network/go-themis/rpc"
@@ -71,6 +72,7 @@ type Ethereum struct {
 	blockchain      *core.BlockChain
 	protocolManager *ProtocolManager
 	lesServer       LesServer
+	dialCandidates  *dnsdisc.RandomNodes // DNS node lists used for dialing, nil if none
 
 	// DB interfaces
 	chainDb ethdb.Database // Block chain database
@@ -91,6 +93,8 @@ type Ethereum struct {
 	networkID     uint64
 	netRPCService *ethapi.PublicNetAPI
 
+	traceDir string // Folder the debug API writes trace files into
+
 	lock sync.RWMutex // Protects the variadic fields (e.g. gas price and etherbase)
 }
 
@@ -131,6 +135,7 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 		etherbase:      config.Etherbase,
 		bloomRequests:  make(chan chan *bloombits.Retrieval),
 		bloomIndexer:   NewBloomIndexer(chainDb, params.BloomBitsBlocks),
+		traceDir:       ctx.ResolvePath("traces"),
 	}
 
 	log.Info("Initialising Ethereum protocol", "versions", ProtocolVersions, "network", config.NetworkId)
@@ -144,12 +149,15 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	}
 	var (
 		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout, Snapshot: config.Snapshot}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, eth.chainConfig, eth.engine, vmConfig)
 	if err != nil {
 		return nil, err
 	}
+	if config.ParallelExec {
+		eth.blockchain.SetProcessor(core.NewParallelStateProcessor(eth.chainConfig, eth.blockchain, eth.engine))
+	}
 	// Rewind the chain in case of an incompatible config upgrade.
 	if compat, ok := genesisErr.(*params.ConfigCompatError); ok {
 		log.Warn("Rewinding chain to upgrade configuration", "err", compat)
@@ -166,6 +174,15 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	if eth.protocolManager, err = NewProtocolManager(eth.chainConfig, config.SyncMode, config.NetworkId, eth.eventMux, eth.txPool, eth.engine, eth.blockchain, chainDb); err != nil {
 		return nil, err
 	}
+	if len(config.DiscoveryURLs) > 0 {
+		client := dnsdisc.NewClient(dnsdisc.Config{})
+		if eth.dialCandidates, err = client.NewRandomNodes(config.DiscoveryURLs...); err != nil {
+			return nil, err
+		}
+		// The server dials from the candidates of every protocol, so attach them
+		// to a single one to avoid mixing in the same source several times.
+		eth.protocolManager.SubProtocols[0].DialCandidates = eth.dialCandidates
+	}
 	eth.miner = miner.New(eth, eth.chainConfig, eth.EventMux(), eth.engine)
 	eth.miner.SetExtra(makeExtraData(config.ExtraData))
 
@@ -269,10 +286,15 @@ func (s *Ethereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPrivateMinerAPI(s),
 			Public:    false,
+		}, {
+			Namespace: "txpool",
+			Version:   "1.0",
+			Service:   NewPrivateTxPoolAPI(s),
+			Public:    false,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
-			Service:   filters.NewPublicFilterAPI(s.APIBackend, false),
+			Service:   filters.NewPublicFilterAPI(s.APIBackend, false, &s.config.Logs),
 			Public:    true,
 		}, {
 			Namespace: "admin",
@@ -387,6 +409,12 @@ func (s *Ethereum) Start(srvr *p2p.Server) error {
 	// Start the bloom bits servicing goroutines
 	s.startBloomHandlers()
 
+	// Advertise the chain of the node on the discovery network
+	s.startEthEntryUpdate(srvr)
+
+	// Admit the nodes of the registry contract in permissioned mode
+	s.addRegistrySource(srvr)
+
 	// Start the RPC service
 	s.netRPCService = ethapi.NewPublicNetAPI(srvr, s.NetVersion())
 
@@ -412,6 +440,9 @@ func (s *Ethereum) Stop() error {
 	s.bloomIndexer.Close()
 	s.blockchain.Stop()
 	s.protocolManager.Stop()
+	if s.dialCandidates != nil {
+		s.dialCandidates.Close()
+	}
 	if s.lesServer != nil {
 		s.lesServer.Stop()
 	}
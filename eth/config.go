@@ -29,6 +29,7 @@ import (
 	"github.com/themis-network/go-themis/consensus/ethash"
 	"github.com/themis-network/go-themis/core"
 	"github.com/themis-network/go-themis/eth/downloader"
+	"github.com/themis-network/go-themis/eth/filters"
 	"github.com/themis-network/go-themis/eth/gasprice"
 	"github.com/themis-network/go-themis/params"
 )
@@ -55,6 +56,9 @@ var DefaultConfig = Config{
 		Blocks:     20,
 		Percentile: 60,
 	},
+	Logs: filters.DefaultConfig,
+
+	RPCEVMTimeout: 5 * time.Second,
 }
 
 func init() {
@@ -83,6 +87,14 @@ type Config struct {
 	SyncMode  downloader.SyncMode
 	NoPruning bool
 
+	// DiscoveryURLs lists enrtree:// URLs of DNS node lists used as an
+	// additional source of dial candidates.
+	DiscoveryURLs []string
+
+	// PermissionRegistry is the address of the node registry contract whose
+	// nodes are added to the allowlist of a permissioned node.
+	PermissionRegistry common.Address `toml:",omitempty"`
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
@@ -93,6 +105,8 @@ type Config struct {
 	DatabaseCache      int
 	TrieCache          int
 	TrieTimeout        time.Duration
+	Snapshot           bool // Maintain a flat state snapshot for faster state reads
+	ParallelExec       bool // Execute block transactions optimistically in parallel
 
 	// Mining-related options
 	Etherbase    common.Address `toml:",omitempty"`
@@ -109,6 +123,13 @@ type Config struct {
 	// Gas Price Oracle options
 	GPO gasprice.Config
 
+	// Log query limits
+	Logs filters.Config
+
+	// RPC call limits
+	RPCGasCap     uint64        // Gas allowance of a single eth_callBundle call (0 = unlimited)
+	RPCEVMTimeout time.Duration // Execution time allowance of eth_callBundle (0 = unlimited)
+
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -32,6 +33,7 @@ import (
 	"github.com/themis-network/go-themis/crypto"
 	"github.com/themis-network/go-themis/ethdb"
 	"github.com/themis-network/go-themis/event"
+	"github.com/themis-network/go-themis/log"
 	"github.com/themis-network/go-themis/params"
 	"github.com/themis-network/go-themis/trie"
 )
@@ -1753,3 +1755,40 @@ func testDeliverHeadersHang(t *testing.T, protocol int, mode SyncMode) {
 		tester.downloader.peers.peers["peer"].peer.(*floodingTestPeer).pend.Wait()
 	}
 }
+
+// scoredPeer is a peer with a fixed reputation score.
+type scoredPeer struct {
+	Peer
+	score float64
+}
+
+func (p *scoredPeer) Score() float64                 { return p.score }
+func (p *scoredPeer) RequestDone(time.Duration, int) {}
+
+// Tests that idle peers are ordered by their throughput weighted by reputation.
+func TestIdlePeerReputation(t *testing.T) {
+	ps := newPeerSet()
+	for _, p := range []struct {
+		id         string
+		score      float64
+		throughput float64
+	}{
+		{"bad", -MaxReputation, 150},
+		{"neutral", 0, 100},
+		{"good", MaxReputation, 80},
+		{"tied", MaxReputation / 2, 100},
+	} {
+		conn := newPeerConnection(p.id, 63, &scoredPeer{score: p.score}, log.New("peer", p.id))
+		ps.Register(conn)
+		conn.headerThroughput = p.throughput
+	}
+	idle, _ := ps.HeaderIdlePeers()
+	var order []string
+	for _, p := range idle {
+		order = append(order, p.id)
+	}
+	// tied: 125, good: 120, neutral: 100, bad: 75
+	if want := []string{"tied", "good", "neutral", "bad"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("wrong peer order %v, want %v", order, want)
+	}
+}
@@ -37,6 +37,7 @@ import (
 const (
 	maxLackingHashes  = 4096 // Maximum number of entries allowed on the list or lacking items
 	measurementImpact = 0.1  // The impact a single measurement has on a peer's final throughput value.
+	MaxReputation     = 100  // Absolute value of the highest and lowest reputation score of a peer
 )
 
 var (
@@ -90,6 +91,19 @@ type Peer interface {
 	RequestNodeData([]common.Hash) error
 }
 
+// ReputationPeer is implemented by peers that track a reputation score. The
+// downloader prefers peers with a higher score and reports the outcome of its
+// requests to them.
+type ReputationPeer interface {
+	// Score returns the reputation of the peer, in the range of -MaxReputation
+	// to MaxReputation.
+	Score() float64
+
+	// RequestDone is called when a request finished. If nothing was delivered,
+	// the request timed out or the peer didn't have the data.
+	RequestDone(elapsed time.Duration, delivered int)
+}
+
 // lightPeerWrapper wraps a LightPeer struct, stubbing out the Peer-only methods.
 type lightPeerWrapper struct {
 	peer LightPeer
@@ -266,13 +280,17 @@ func (p *peerConnection) setIdle(started time.Time, delivered int, throughput *f
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
+	// Report the outcome to peers tracking their reputation
+	elapsed := time.Since(started) + 1 // +1 (ns) to ensure non-zero divisor
+	if rp, ok := p.peer.(ReputationPeer); ok {
+		rp.RequestDone(elapsed, delivered)
+	}
 	// If nothing was delivered (hard timeout / unavailable data), reduce throughput to minimum
 	if delivered == 0 {
 		*throughput = 0
 		return
 	}
 	// Otherwise update the throughput with a new measurement
-	elapsed := time.Since(started) + 1 // +1 (ns) to ensure non-zero divisor
 	measured := float64(delivered) / (float64(elapsed) / float64(time.Second))
 
 	*throughput = (1-measurementImpact)*(*throughput) + measurementImpact*measured
@@ -320,6 +338,18 @@ func (p *peerConnection) NodeDataCapacity(targetRTT time.Duration) int {
 	return int(math.Min(1+math.Max(1, p.stateThroughput*float64(targetRTT)/float64(time.Second)), float64(MaxStateFetch)))
 }
 
+// reputationWeight returns the factor by which the peer's throughput is scaled
+// when choosing peers for retrievals, ranging from 0.5 for the worst to 1.5
+// for the best reputation. Peers without reputation have a weight of 1.
+func (p *peerConnection) reputationWeight() float64 {
+	rp, ok := p.peer.(ReputationPeer)
+	if !ok {
+		return 1
+	}
+	score := math.Max(-MaxReputation, math.Min(MaxReputation, rp.Score()))
+	return 1 + score/(2*MaxReputation)
+}
+
 // MarkLacking appends a new entity to the set of items (blocks, receipts, states)
 // that a peer is known not to have (i.e. have been requested before). If the
 // set reaches its maximum allowed capacity, items are randomly dropped off.
@@ -524,7 +554,8 @@ func (ps *peerSet) NodeDataIdlePeers() ([]*peerConnection, int) {
 
 // idlePeers retrieves a flat list of all currently idle peers satisfying the
 // protocol version constraints, using the provided function to check idleness.
-// The resulting set of peers are sorted by their measure throughput.
+// The resulting set of peers are sorted by their measure throughput, weighted by
+// their reputation.
 func (ps *peerSet) idlePeers(minProtocol, maxProtocol int, idleCheck func(*peerConnection) bool, throughput func(*peerConnection) float64) ([]*peerConnection, int) {
 	ps.lock.RLock()
 	defer ps.lock.RUnlock()
@@ -538,9 +569,14 @@ func (ps *peerSet) idlePeers(minProtocol, maxProtocol int, idleCheck func(*peerC
 			total++
 		}
 	}
+	weights := make(map[*peerConnection]float64, len(idle))
+	for _, p := range idle {
+		weights[p] = p.reputationWeight()
+	}
 	for i := 0; i < len(idle); i++ {
 		for j := i + 1; j < len(idle); j++ {
-			if throughput(idle[i]) < throughput(idle[j]) {
+			ti, tj := throughput(idle[i])*weights[idle[i]], throughput(idle[j])*weights[idle[j]]
+			if ti < tj || (ti == tj && weights[idle[i]] < weights[idle[j]]) {
 				idle[i], idle[j] = idle[j], idle[i]
 			}
 		}
@@ -26,6 +26,7 @@ import (
 	"github.com/themis-network/go-themis/core/rawdb"
 	"github.com/themis-network/go-themis/core/state"
 	"github.com/themis-network/go-themis/crypto/sha3"
+	"github.com/themis-network/go-themis/eth/snap"
 	"github.com/themis-network/go-themis/ethdb"
 	"github.com/themis-network/go-themis/log"
 	"github.com/themis-network/go-themis/trie"
@@ -212,7 +213,9 @@ func (d *Downloader) runStateSync(s *stateSync) *stateSync {
 // stateSync schedules requests for downloading a particular state trie defined
 // by a given state root.
 type stateSync struct {
-	d *Downloader // Downloader instance to access and manage current peerset
+	d    *Downloader // Downloader instance to access and manage current peerset
+	root common.Hash // State root currently being synced
+	snap bool        // Whether to retrieve the state in ranges from snap peers first
 
 	sched  *trie.Sync                 // State trie sync scheduler defining the tasks
 	keccak hash.Hash                  // Keccak256 hasher to verify deliveries with
@@ -239,6 +242,8 @@ type stateTask struct {
 func newStateSync(d *Downloader, root common.Hash) *stateSync {
 	return &stateSync{
 		d:       d,
+		root:    root,
+		snap:    d.mode == SnapSync,
 		sched:   state.NewStateSync(root, d.stateDB),
 		keccak:  sha3.NewKeccak256(),
 		tasks:   make(map[common.Hash]*stateTask),
@@ -252,10 +257,48 @@ func newStateSync(d *Downloader, root common.Hash) *stateSync {
 // it finishes, and finally notifying any goroutines waiting for the loop to
 // finish.
 func (s *stateSync) run() {
+	if s.snap {
+		if err := s.snapSync(); err != nil {
+			s.err = err
+			close(s.done)
+			return
+		}
+	}
 	s.err = s.loop()
 	close(s.done)
 }
 
+// snapSync retrieves the bulk of the state in ranges from the snap peers. The
+// trie nodes at the range boundaries are inconsistent, so the state is healed by
+// the regular trie node sync afterwards. If the snap sync stalls, e.g. because
+// no snap peer serves the state, the trie node sync retrieves the rest as well.
+func (s *stateSync) snapSync() error {
+	var (
+		cancel = make(chan struct{})
+		done   = make(chan struct{})
+	)
+	defer close(done)
+	go func() {
+		defer close(cancel)
+		select {
+		case <-s.cancel:
+		case <-s.d.cancelCh:
+		case <-done:
+		}
+	}()
+	if err := s.d.snapSyncer.Sync(s.root, cancel); err != nil {
+		switch err {
+		case snap.ErrCancelled:
+			return errCancelStateFetch
+		case snap.ErrStalled:
+			log.Warn("Snap sync stalled, falling back to trie node sync", "root", s.root)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
 // Wait blocks until the sync is done or canceled.
 func (s *stateSync) Wait() error {
 	<-s.done
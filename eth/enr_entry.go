@@ -0,0 +1,98 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/forkid"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/p2p"
+	"github.com/themis-network/go-themis/p2p/enr"
+	"github.com/themis-network/go-themis/params"
+	"github.com/themis-network/go-themis/rlp"
+)
+
+// ethEntry is the "eth" ENR entry which advertises the eth protocol and the
+// chain of the node on the discovery network.
+type ethEntry struct {
+	ForkID forkid.ID // Fork identifier of the chain, as defined by EIP-2124
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (e ethEntry) ENRKey() string {
+	return "eth"
+}
+
+// currentEthEntry constructs the eth entry of the current head of the chain.
+func currentEthEntry(config *params.ChainConfig, chain *core.BlockChain) *ethEntry {
+	head := chain.CurrentHeader().Number.Uint64()
+	return &ethEntry{ForkID: forkid.NewID(config, chain.Genesis().Hash(), head)}
+}
+
+// newDialFilter creates a dial filter rejecting nodes whose eth entry carries
+// a fork identifier incompatible with the local chain. Nodes not advertising
+// an eth entry are accepted.
+func newDialFilter(config *params.ChainConfig, chain *core.BlockChain) func(*enr.Record) bool {
+	filter := forkid.NewFilter(config, chain.Genesis().Hash(), func() uint64 {
+		return chain.CurrentHeader().Number.Uint64()
+	})
+	return func(r *enr.Record) bool {
+		var entry ethEntry
+		if err := r.Load(&entry); err != nil {
+			return enr.IsNotFound(err)
+		}
+		return filter(entry.ForkID) == nil
+	}
+}
+
+// startEthEntryUpdate announces the eth entry of the local node and keeps it
+// updated as the chain passes forks.
+func (eth *Ethereum) startEthEntryUpdate(srv *p2p.Server) {
+	current := currentEthEntry(eth.chainConfig, eth.blockchain)
+	if err := srv.SetLocalEntry(current); err != nil {
+		log.Warn("Failed to announce eth entry", "err", err)
+	}
+	var (
+		newHead = make(chan core.ChainHeadEvent, 10)
+		sub     = eth.blockchain.SubscribeChainHeadEvent(newHead)
+	)
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-newHead:
+				next := currentEthEntry(eth.chainConfig, eth.blockchain)
+				if next.ForkID == current.ForkID {
+					continue
+				}
+				if err := srv.SetLocalEntry(next); err != nil {
+					log.Warn("Failed to update eth entry", "err", err)
+					continue
+				}
+				current = next
+
+			case <-sub.Err():
+				return
+			case <-eth.shutdownChan:
+				return
+			}
+		}
+	}()
+}
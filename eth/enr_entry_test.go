@@ -0,0 +1,57 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"testing"
+
+	"github.com/themis-network/go-themis/core/forkid"
+	"github.com/themis-network/go-themis/eth/downloader"
+	"github.com/themis-network/go-themis/p2p/enr"
+	"github.com/themis-network/go-themis/params"
+)
+
+// Tests that the eth protocols only accept dialing nodes on the local chain,
+// or nodes that don't announce their chain at all.
+func TestDialFilter(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 4, nil, nil)
+	defer pm.Stop()
+
+	tests := []struct {
+		entry enr.Entry
+		want  bool
+	}{
+		{nil, true},
+		{currentEthEntry(pm.chainconfig, pm.blockchain), true},
+		{&ethEntry{ForkID: forkid.NewID(params.MainnetChainConfig, params.MainnetGenesisHash, 4)}, false},
+		{enr.WithEntry("eth", "invalid"), false},
+	}
+	for i, tt := range tests {
+		var r enr.Record
+		if tt.entry != nil {
+			r.Set(tt.entry)
+		}
+		for _, proto := range pm.SubProtocols {
+			if proto.Name != ProtocolName {
+				continue
+			}
+			if have := proto.DialFilter(&r); have != tt.want {
+				t.Errorf("test %d: %s/%d filter mismatch: have %v, want %v", i, proto.Name, proto.Version, have, tt.want)
+			}
+		}
+	}
+}
@@ -17,6 +17,7 @@
 package filters
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -31,6 +32,7 @@ import (
 	"github.com/themis-network/go-themis/core/types"
 	"github.com/themis-network/go-themis/ethdb"
 	"github.com/themis-network/go-themis/event"
+	"github.com/themis-network/go-themis/internal/ethapi"
 	"github.com/themis-network/go-themis/rpc"
 )
 
@@ -53,22 +55,31 @@ type filter struct {
 // information related to the Ethereum protocol such als blocks, transactions and logs.
 type PublicFilterAPI struct {
 	backend   Backend
+	config    *Config
 	mux       *event.TypeMux
 	quit      chan struct{}
 	chainDb   ethdb.Database
 	events    *EventSystem
 	filtersMu sync.Mutex
 	filters   map[rpc.ID]*filter
+	durableMu sync.Mutex
+	attached  map[string]bool // Durable subscriptions currently attached to a client
 }
 
-// NewPublicFilterAPI returns a new PublicFilterAPI instance.
-func NewPublicFilterAPI(backend Backend, lightMode bool) *PublicFilterAPI {
+// NewPublicFilterAPI returns a new PublicFilterAPI instance. The log queries are
+// limited by the given config, or the default one if nil.
+func NewPublicFilterAPI(backend Backend, lightMode bool, config *Config) *PublicFilterAPI {
+	if config == nil {
+		config = &DefaultConfig
+	}
 	api := &PublicFilterAPI{
-		backend: backend,
-		mux:     backend.EventMux(),
-		chainDb: backend.ChainDb(),
-		events:  NewEventSystem(backend.EventMux(), backend, lightMode),
-		filters: make(map[rpc.ID]*filter),
+		backend:  backend,
+		config:   config,
+		mux:      backend.EventMux(),
+		chainDb:  backend.ChainDb(),
+		events:   NewEventSystem(backend.EventMux(), backend, lightMode),
+		filters:  make(map[rpc.ID]*filter),
+		attached: make(map[string]bool),
 	}
 	go api.timeoutLoop()
 
@@ -104,7 +115,7 @@ func (api *PublicFilterAPI) timeoutLoop() {
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_newpendingtransactionfilter
 func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 	var (
-		pendingTxs   = make(chan []common.Hash)
+		pendingTxs   = make(chan []*types.Transaction)
 		pendingTxSub = api.events.SubscribePendingTxs(pendingTxs)
 	)
 
@@ -118,7 +129,9 @@ func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 			case ph := <-pendingTxs:
 				api.filtersMu.Lock()
 				if f, found := api.filters[pendingTxSub.ID]; found {
-					f.hashes = append(f.hashes, ph...)
+					for _, tx := range ph {
+						f.hashes = append(f.hashes, tx.Hash())
+					}
 				}
 				api.filtersMu.Unlock()
 			case <-pendingTxSub.Err():
@@ -133,27 +146,92 @@ func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 	return pendingTxSub.ID
 }
 
+// PendingTxCriteria selects the pending transactions notified to a subscriber.
+// A transaction matches if it matches every non-empty field: it is sent from one
+// of From, to one of To and its input starts with one of the method Selectors.
+type PendingTxCriteria struct {
+	From      []common.Address `json:"from"`
+	To        []common.Address `json:"to"`
+	Selectors []hexutil.Bytes  `json:"selectors"`
+}
+
+// validate checks that the criteria only contain 4 byte method selectors.
+func (crit *PendingTxCriteria) validate() error {
+	for i, selector := range crit.Selectors {
+		if len(selector) != 4 {
+			return fmt.Errorf("invalid method selector at index %d: have %d bytes, want 4", i, len(selector))
+		}
+	}
+	return nil
+}
+
+// matches reports whether the transaction meets the criteria.
+func (crit *PendingTxCriteria) matches(tx *types.Transaction) bool {
+	if len(crit.To) > 0 {
+		if tx.To() == nil || !includes(crit.To, *tx.To()) {
+			return false
+		}
+	}
+	if len(crit.Selectors) > 0 {
+		data, matched := tx.Data(), false
+		for _, selector := range crit.Selectors {
+			if bytes.HasPrefix(data, selector) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(crit.From) > 0 {
+		var signer types.Signer = types.FrontierSigner{}
+		if tx.Protected() {
+			signer = types.NewEIP155Signer(tx.ChainId())
+		}
+		from, err := types.Sender(signer, tx)
+		if err != nil || !includes(crit.From, from) {
+			return false
+		}
+	}
+	return true
+}
+
 // NewPendingTransactions creates a subscription that is triggered each time a transaction
 // enters the transaction pool and was signed from one of the transactions this nodes manages.
-func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+// The transaction hashes are sent, or the full transactions if fullTx is set. If crit is
+// given, only the transactions matching it are sent.
+func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context, fullTx *bool, crit *PendingTxCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
+	if crit != nil {
+		if err := crit.validate(); err != nil {
+			return nil, err
+		}
+	}
 
 	rpcSub := notifier.CreateSubscription()
 
 	go func() {
-		txHashes := make(chan []common.Hash, 128)
-		pendingTxSub := api.events.SubscribePendingTxs(txHashes)
+		txs := make(chan []*types.Transaction, 128)
+		pendingTxSub := api.events.SubscribePendingTxs(txs)
 
 		for {
 			select {
-			case hashes := <-txHashes:
+			case batch := <-txs:
 				// To keep the original behaviour, send a single tx hash in one notification.
 				// TODO(rjl493456442) Send a batch of tx hashes in one notification
-				for _, h := range hashes {
-					notifier.Notify(rpcSub.ID, h)
+				for _, tx := range batch {
+					if crit != nil && !crit.matches(tx) {
+						continue
+					}
+					if fullTx != nil && *fullTx {
+						notifier.Notify(rpcSub.ID, ethapi.NewRPCPendingTransaction(tx))
+					} else {
+						notifier.Notify(rpcSub.ID, tx.Hash())
+					}
 				}
 			case <-rpcSub.Err():
 				pendingTxSub.Unsubscribe()
@@ -321,24 +399,12 @@ func (api *PublicFilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
 }
 
 // GetLogs returns logs matching the given argument that are stored within the state.
+// Queries exceeding the log query limits fail, with the cursor to continue from
+// using GetLogsPage as error data.
 //
 // https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_getlogs
 func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([]*types.Log, error) {
-	// Convert the RPC block numbers into internal representations
-	if crit.FromBlock == nil {
-		crit.FromBlock = big.NewInt(rpc.LatestBlockNumber.Int64())
-	}
-	if crit.ToBlock == nil {
-		crit.ToBlock = big.NewInt(rpc.LatestBlockNumber.Int64())
-	}
-	// Create and run the filter to get all the logs
-	filter := New(api.backend, crit.FromBlock.Int64(), crit.ToBlock.Int64(), crit.Addresses, crit.Topics)
-
-	logs, err := filter.Logs(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return returnLogs(logs), err
+	return BoundedLogs(ctx, api.backend, api.config, crit)
 }
 
 // UninstallFilter removes the filter with the given filter id.
@@ -371,22 +437,7 @@ func (api *PublicFilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*ty
 		return nil, fmt.Errorf("filter not found")
 	}
 
-	begin := rpc.LatestBlockNumber.Int64()
-	if f.crit.FromBlock != nil {
-		begin = f.crit.FromBlock.Int64()
-	}
-	end := rpc.LatestBlockNumber.Int64()
-	if f.crit.ToBlock != nil {
-		end = f.crit.ToBlock.Int64()
-	}
-	// Create and run the filter to get all the logs
-	filter := New(api.backend, begin, end, f.crit.Addresses, f.crit.Topics)
-
-	logs, err := filter.Logs(ctx)
-	if err != nil {
-		return nil, err
-	}
-	return returnLogs(logs), nil
+	return BoundedLogs(ctx, api.backend, api.config, f.crit)
 }
 
 // GetFilterChanges returns the logs for the filter with the given id since
@@ -0,0 +1,392 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	ethereum "github.com/themis-network/go-themis"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/rlp"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// durableReplayBlocks is the number of blocks searched at once while replaying
+// the logs a durable subscription missed.
+const durableReplayBlocks = 1000
+
+var (
+	errEmptySubscriptionName = errors.New("empty subscription name")
+	errUnknownSubscription   = errors.New("unknown durable subscription")
+	errSubscriptionAttached  = errors.New("durable subscription already attached")
+	errSubscriptionMismatch  = errors.New("durable subscription exists with different criteria")
+	errUnknownAckBlock       = errors.New("acknowledged block not found")
+)
+
+// durableSubscription is the persisted state of a named log subscription, which
+// survives the connections it is attached to.
+type durableSubscription struct {
+	Addresses []common.Address
+	Topics    [][]common.Hash
+
+	Start     uint64      // First block to deliver the logs of, until one is acknowledged
+	Acked     bool        // Whether any log was acknowledged yet
+	AckNumber uint64      // Number of the block of the last acknowledged log
+	AckHash   common.Hash // Hash of the block of the last acknowledged log
+	AckIndex  uint        // Index of the last acknowledged log in its block
+}
+
+// matches reports whether the subscription was created with the given criteria.
+func (sub *durableSubscription) matches(crit *FilterCriteria) bool {
+	have, _ := rlp.EncodeToBytes([]interface{}{sub.Addresses, sub.Topics})
+	want, _ := rlp.EncodeToBytes([]interface{}{crit.Addresses, crit.Topics})
+	return bytes.Equal(have, want)
+}
+
+// loadDurable retrieves a durable subscription from the database, returning nil
+// if it doesn't exist.
+func (api *PublicFilterAPI) loadDurable(name string) (*durableSubscription, error) {
+	blob := rawdb.ReadDurableSubscription(api.chainDb, name)
+	if blob == nil {
+		return nil, nil
+	}
+	sub := new(durableSubscription)
+	if err := rlp.DecodeBytes(blob, sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// storeDurable persists a durable subscription into the database.
+func (api *PublicFilterAPI) storeDurable(name string, sub *durableSubscription) error {
+	blob, err := rlp.EncodeToBytes(sub)
+	if err != nil {
+		return err
+	}
+	rawdb.WriteDurableSubscription(api.chainDb, name, blob)
+	return nil
+}
+
+// DurableLogs attaches to the named durable log subscription, creating it with
+// the given criteria if it doesn't exist yet. New subscriptions start at the
+// criteria's from block, or the next block if unset; the to block is ignored.
+//
+// Every log since the last acknowledged one is delivered, the ones missed while
+// detached first. If the acknowledged logs were reorged out meanwhile, they are
+// delivered again with the removed flag set, as are the live logs being reorged
+// out. Delivery is at-least-once, clients must acknowledge the processed logs by
+// calling AckSubscription.
+func (api *PublicFilterAPI) DurableLogs(ctx context.Context, name string, crit *FilterCriteria) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if name == "" {
+		return nil, errEmptySubscriptionName
+	}
+	api.durableMu.Lock()
+	defer api.durableMu.Unlock()
+
+	if api.attached[name] {
+		return nil, errSubscriptionAttached
+	}
+	sub, err := api.loadDurable(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case sub == nil && crit == nil:
+		return nil, errUnknownSubscription
+
+	case sub == nil:
+		header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+		if header == nil {
+			return nil, err
+		}
+		sub = &durableSubscription{
+			Addresses: crit.Addresses,
+			Topics:    crit.Topics,
+			Start:     header.Number.Uint64() + 1,
+		}
+		if crit.FromBlock != nil && crit.FromBlock.Sign() >= 0 {
+			sub.Start = crit.FromBlock.Uint64()
+		}
+		if err := api.storeDurable(name, sub); err != nil {
+			return nil, err
+		}
+
+	case crit != nil && !sub.matches(crit):
+		return nil, errSubscriptionMismatch
+	}
+	// Subscribe to the live logs before replaying the missed ones, so none fall
+	// between the two
+	live := make(chan []*types.Log)
+	logsSub, err := api.events.SubscribeLogs(ethereum.FilterQuery{Addresses: sub.Addresses, Topics: sub.Topics}, live)
+	if err != nil {
+		return nil, err
+	}
+	api.attached[name] = true
+
+	rpcSub := notifier.CreateSubscription()
+	go api.deliverDurable(name, sub, notifier, rpcSub, logsSub, live)
+
+	return rpcSub, nil
+}
+
+// deliverDurable delivers the logs of an attached durable subscription until the
+// client detaches: the missed ones replayed from the database, followed by the
+// live ones queued meanwhile.
+func (api *PublicFilterAPI) deliverDurable(name string, sub *durableSubscription, notifier *rpc.Notifier, rpcSub *rpc.Subscription, logsSub *Subscription, live chan []*types.Log) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		logsSub.Unsubscribe()
+
+		api.durableMu.Lock()
+		delete(api.attached, name)
+		api.durableMu.Unlock()
+	}()
+	var (
+		replay   = make(chan *types.Log)
+		replayed = make(chan uint64, 1)
+		failed   = make(chan error, 1)
+	)
+	go func() {
+		// Notifications are dropped until the client received the subscription ID
+		select {
+		case <-rpcSub.Activated():
+		case <-ctx.Done():
+			return
+		}
+		head, err := api.replayDurable(ctx, sub, replay)
+		if err != nil {
+			failed <- err
+			return
+		}
+		replayed <- head
+	}()
+	var (
+		replaying = true
+		queued    []*types.Log
+		seen      uint64 // Last block whose logs were delivered by the replay
+	)
+	deliver := func(logs []*types.Log) {
+		for _, log := range logs {
+			switch {
+			case log.Removed:
+				// Logs of the removed blocks may be delivered again from the new chain
+				if log.BlockNumber <= seen {
+					seen = log.BlockNumber - 1
+				}
+				notifier.Notify(rpcSub.ID, log)
+
+			case log.BlockNumber > seen:
+				notifier.Notify(rpcSub.ID, log)
+			}
+		}
+	}
+	for {
+		select {
+		case log := <-replay:
+			notifier.Notify(rpcSub.ID, log)
+
+		case seen = <-replayed:
+			replaying = false
+			deliver(queued)
+			queued = nil
+
+		case err := <-failed:
+			// End the subscription, so the client reattaches instead of missing logs
+			log.Warn("Failed to replay durable subscription", "name", name, "err", err)
+			notifier.Fail(rpcSub.ID, err)
+			return
+
+		case logs := <-live:
+			if replaying {
+				queued = append(queued, logs...)
+			} else {
+				deliver(logs)
+			}
+		case <-rpcSub.Err(): // client send an unsubscribe request
+			return
+		case <-notifier.Closed(): // connection dropped
+			return
+		}
+	}
+}
+
+// replayDurable sends the logs a durable subscription missed since its last
+// acknowledged log, returning the last block whose logs were delivered.
+func (api *PublicFilterAPI) replayDurable(ctx context.Context, sub *durableSubscription, out chan<- *types.Log) (uint64, error) {
+	send := func(log *types.Log) error {
+		select {
+		case out <- log:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if header == nil {
+		if err == nil {
+			err = errors.New("current header not found")
+		}
+		return 0, err
+	}
+	head := header.Number.Uint64()
+
+	// Resume after the last acknowledged log, retracting it first if it was reorged out
+	from, skip := sub.Start, false
+	if sub.Acked {
+		removed, fork, err := api.reorgedLogs(ctx, sub)
+		if err != nil {
+			return 0, err
+		}
+		for _, log := range removed {
+			if err := send(log); err != nil {
+				return 0, err
+			}
+		}
+		if fork < sub.AckNumber {
+			from = fork + 1
+		} else {
+			from, skip = sub.AckNumber, true
+		}
+	}
+	for begin := from; begin <= head; begin += durableReplayBlocks {
+		end := begin + durableReplayBlocks - 1
+		if end > head {
+			end = head
+		}
+		logs, err := New(api.backend, int64(begin), int64(end), sub.Addresses, sub.Topics).Logs(ctx)
+		if err != nil {
+			return 0, err
+		}
+		for _, log := range logs {
+			if skip && log.BlockNumber == sub.AckNumber && log.Index <= sub.AckIndex {
+				continue
+			}
+			if err := send(log); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if from > head+1 {
+		return from - 1, nil
+	}
+	return head, nil
+}
+
+// reorgedLogs walks back the chain of the last acknowledged log until it meets the
+// canonical chain, returning the delivered logs of the abandoned blocks marked as
+// removed, in reverse chain order, along with the number of the common ancestor.
+func (api *PublicFilterAPI) reorgedLogs(ctx context.Context, sub *durableSubscription) ([]*types.Log, uint64, error) {
+	var (
+		removed []*types.Log
+		hash    = sub.AckHash
+		number  = sub.AckNumber
+	)
+	for {
+		header, err := api.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+		if err != nil {
+			return nil, 0, err
+		}
+		if header != nil && header.Hash() == hash {
+			return removed, number, nil
+		}
+		logs, err := api.backend.GetLogs(ctx, hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		var unfiltered []*types.Log
+		for _, txLogs := range logs {
+			unfiltered = append(unfiltered, txLogs...)
+		}
+		for _, log := range filterLogs(unfiltered, nil, nil, sub.Addresses, sub.Topics) {
+			if number == sub.AckNumber && log.Index > sub.AckIndex {
+				continue
+			}
+			retracted := *log
+			retracted.Removed = true
+			removed = append(removed, &retracted)
+		}
+		// Step to the parent, giving up at the genesis or an unknown block
+		abandoned := rawdb.ReadHeader(api.chainDb, hash, number)
+		if abandoned == nil || number == 0 {
+			if number == 0 {
+				return removed, 0, nil
+			}
+			return removed, number - 1, nil
+		}
+		hash, number = abandoned.ParentHash, number-1
+	}
+}
+
+// AckSubscription acknowledges the delivery of the logs of a durable subscription
+// up to and including the given one, identified by the hash of its block and its
+// index, which won't be delivered again on reattach. If the block was reorged out
+// meanwhile, its acknowledged logs are delivered as removed on reattach instead.
+// Acknowledgements behind the last one are ignored, unless it was reorged out.
+func (api *PublicFilterAPI) AckSubscription(ctx context.Context, name string, blockHash common.Hash, logIndex hexutil.Uint) error {
+	api.durableMu.Lock()
+	defer api.durableMu.Unlock()
+
+	sub, err := api.loadDurable(name)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		return errUnknownSubscription
+	}
+	number := rawdb.ReadHeaderNumber(api.chainDb, blockHash)
+	if number == nil {
+		return errUnknownAckBlock
+	}
+	if sub.Acked && (*number < sub.AckNumber || (*number == sub.AckNumber && uint(logIndex) <= sub.AckIndex)) {
+		if last, _ := api.backend.HeaderByNumber(ctx, rpc.BlockNumber(sub.AckNumber)); last != nil && last.Hash() == sub.AckHash {
+			return nil
+		}
+	}
+	sub.Acked = true
+	sub.AckNumber = *number
+	sub.AckHash = blockHash
+	sub.AckIndex = uint(logIndex)
+
+	return api.storeDurable(name, sub)
+}
+
+// DeleteDurableSubscription deletes a detached durable subscription, reporting
+// whether it existed.
+func (api *PublicFilterAPI) DeleteDurableSubscription(name string) (bool, error) {
+	api.durableMu.Lock()
+	defer api.durableMu.Unlock()
+
+	if api.attached[name] {
+		return false, errSubscriptionAttached
+	}
+	if rawdb.ReadDurableSubscription(api.chainDb, name) == nil {
+		return false, nil
+	}
+	rawdb.DeleteDurableSubscription(api.chainDb, name)
+	return true, nil
+}
@@ -0,0 +1,259 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/event"
+	"github.com/themis-network/go-themis/params"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// durablePosition identifies a delivered log by its position and removal flag.
+type durablePosition struct {
+	block   uint64
+	index   uint
+	removed bool
+}
+
+// attachDurable attaches to a durable subscription through the RPC client.
+func attachDurable(t *testing.T, client *rpc.Client, name string, crit interface{}) (*rpc.ClientSubscription, chan *types.Log) {
+	logs := make(chan *types.Log, 16)
+	args := []interface{}{"durableLogs", name}
+	if crit != nil {
+		args = append(args, crit)
+	}
+	sub, err := client.EthSubscribe(context.Background(), logs, args...)
+	if err != nil {
+		t.Fatalf("failed to attach durable subscription: %v", err)
+	}
+	return sub, logs
+}
+
+// receiveDurable waits for the given number of logs of a durable subscription,
+// ensuring no further ones are delivered.
+func receiveDurable(t *testing.T, logs chan *types.Log, count int) []durablePosition {
+	var have []durablePosition
+	for len(have) < count {
+		select {
+		case log := <-logs:
+			have = append(have, durablePosition{log.BlockNumber, log.Index, log.Removed})
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for logs, have %v, want %d", have, count)
+		}
+	}
+	select {
+	case log := <-logs:
+		t.Fatalf("unexpected log delivered: %+v", log)
+	case <-time.After(50 * time.Millisecond):
+	}
+	return have
+}
+
+// detachDurable unsubscribes from a durable subscription, waiting until it can
+// be attached again.
+func detachDurable(t *testing.T, api *PublicFilterAPI, sub *rpc.ClientSubscription, name string) {
+	sub.Unsubscribe()
+	for i := 0; i < 100; i++ {
+		api.durableMu.Lock()
+		attached := api.attached[name]
+		api.durableMu.Unlock()
+		if !attached {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("durable subscription not detached")
+}
+
+func TestDurableLogs(t *testing.T) {
+	var (
+		db       = ethdb.NewMemDatabase()
+		logsFeed = new(event.Feed)
+		backend  = &testBackend{new(event.TypeMux), db, 0, new(event.Feed), new(event.Feed), logsFeed, new(event.Feed)}
+		api      = NewPublicFilterAPI(backend, false, nil)
+		addr     = common.HexToAddress("0x01")
+	)
+	// Create a chain of 10 blocks with two logs in blocks 2 and 3
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {
+		if i != 1 && i != 2 {
+			return
+		}
+		receipt := types.NewReceipt(nil, false, 0)
+		for j := 0; j < 2; j++ {
+			receipt.Logs = append(receipt.Logs, &types.Log{Address: addr, BlockNumber: uint64(i + 1), Index: uint(j)})
+		}
+		gen.AddUncheckedReceipt(receipt)
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	// Reattaching requires an existing subscription, attaching one only once
+	if _, err := client.EthSubscribe(context.Background(), make(chan *types.Log), "durableLogs", "escrow"); err == nil {
+		t.Fatal("attached to unknown durable subscription")
+	}
+	crit := map[string]interface{}{"fromBlock": "0x0", "address": addr}
+	sub, logs := attachDurable(t, client, "escrow", crit)
+	if _, err := client.EthSubscribe(context.Background(), make(chan *types.Log), "durableLogs", "escrow"); err == nil {
+		t.Fatal("attached to durable subscription twice")
+	}
+	want := []durablePosition{{2, 0, false}, {2, 1, false}, {3, 0, false}, {3, 1, false}}
+	if have := receiveDurable(t, logs, 4); !reflect.DeepEqual(have, want) {
+		t.Fatalf("replayed logs mismatch: have %v, want %v", have, want)
+	}
+	// Only the logs after the acknowledged one must be delivered on reattach
+	if err := client.Call(nil, "eth_ackSubscription", "escrow", chain[1].Hash(), "0x1"); err != nil {
+		t.Fatalf("failed to acknowledge: %v", err)
+	}
+	detachDurable(t, api, sub, "escrow")
+
+	sub, logs = attachDurable(t, client, "escrow", nil)
+	want = []durablePosition{{3, 0, false}, {3, 1, false}}
+	if have := receiveDurable(t, logs, 2); !reflect.DeepEqual(have, want) {
+		t.Fatalf("resumed logs mismatch: have %v, want %v", have, want)
+	}
+	// Live logs must be delivered, apart from the ones already replayed
+	logsFeed.Send([]*types.Log{
+		{Address: addr, Topics: []common.Hash{}, BlockNumber: 3, Index: 1},
+		{Address: addr, Topics: []common.Hash{}, BlockNumber: 11, Index: 0},
+	})
+	want = []durablePosition{{11, 0, false}}
+	if have := receiveDurable(t, logs, 1); !reflect.DeepEqual(have, want) {
+		t.Fatalf("live logs mismatch: have %v, want %v", have, want)
+	}
+	if err := client.Call(nil, "eth_ackSubscription", "escrow", chain[2].Hash(), "0x1"); err != nil {
+		t.Fatalf("failed to acknowledge: %v", err)
+	}
+	// Stale acknowledgements must not rewind the subscription
+	if err := client.Call(nil, "eth_ackSubscription", "escrow", chain[1].Hash(), "0x0"); err != nil {
+		t.Fatalf("failed to acknowledge: %v", err)
+	}
+	detachDurable(t, api, sub, "escrow")
+
+	// Reorg out the acknowledged block while detached, its logs must be retracted
+	fork, _ := core.GenerateChain(params.TestChainConfig, chain[1], ethash.NewFaker(), db, 1, func(i int, gen *core.BlockGen) {
+		gen.SetExtra([]byte("fork"))
+	})
+	rawdb.WriteBlock(db, fork[0])
+	rawdb.WriteCanonicalHash(db, fork[0].Hash(), fork[0].NumberU64())
+
+	sub, logs = attachDurable(t, client, "escrow", nil)
+	want = []durablePosition{{3, 0, true}, {3, 1, true}}
+	if have := receiveDurable(t, logs, 2); !reflect.DeepEqual(have, want) {
+		t.Fatalf("retracted logs mismatch: have %v, want %v", have, want)
+	}
+	var deleted bool
+	if err := client.Call(&deleted, "eth_deleteDurableSubscription", "escrow"); err == nil {
+		t.Fatal("deleted attached durable subscription")
+	}
+	detachDurable(t, api, sub, "escrow")
+
+	if err := client.Call(&deleted, "eth_deleteDurableSubscription", "escrow"); err != nil || !deleted {
+		t.Fatalf("failed to delete durable subscription: %v", err)
+	}
+	if err := client.Call(nil, "eth_ackSubscription", "escrow", chain[2].Hash(), "0x0"); err == nil {
+		t.Fatal("acknowledged deleted durable subscription")
+	}
+}
+
+// Tests that acknowledging a log of a block reorged out after its delivery
+// retracts it on reattach, delivering all logs of the new chain's block.
+func TestDurableAckReorged(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		backend = &testBackend{new(event.TypeMux), db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed)}
+		api     = NewPublicFilterAPI(backend, false, nil)
+		addr    = common.HexToAddress("0x01")
+	)
+	// Create a chain of 3 blocks with two logs in block 3, and a fork replacing
+	// it with a block holding three logs
+	generate := func(count int) func(int, *core.BlockGen) {
+		return func(i int, gen *core.BlockGen) {
+			receipt := types.NewReceipt(nil, false, 0)
+			for j := 0; j < count; j++ {
+				receipt.Logs = append(receipt.Logs, &types.Log{Address: addr, BlockNumber: 3, Index: uint(j)})
+			}
+			gen.AddUncheckedReceipt(receipt)
+			gen.SetExtra([]byte{byte(count)})
+		}
+	}
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 2, nil)
+	head, headReceipts := core.GenerateChain(params.TestChainConfig, chain[1], ethash.NewFaker(), db, 1, generate(2))
+	fork, forkReceipts := core.GenerateChain(params.TestChainConfig, chain[1], ethash.NewFaker(), db, 1, generate(3))
+
+	for _, block := range append(chain, head...) {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+	}
+	rawdb.WriteReceipts(db, head[0].Hash(), 3, headReceipts[0])
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	sub, logs := attachDurable(t, client, "escrow", map[string]interface{}{"fromBlock": "0x0", "address": addr})
+	want := []durablePosition{{3, 0, false}, {3, 1, false}}
+	if have := receiveDurable(t, logs, 2); !reflect.DeepEqual(have, want) {
+		t.Fatalf("replayed logs mismatch: have %v, want %v", have, want)
+	}
+	// Reorg the delivered block out before acknowledging its logs
+	rawdb.WriteBlock(db, fork[0])
+	rawdb.WriteCanonicalHash(db, fork[0].Hash(), 3)
+	rawdb.WriteHeadBlockHash(db, fork[0].Hash())
+	rawdb.WriteReceipts(db, fork[0].Hash(), 3, forkReceipts[0])
+
+	if err := client.Call(nil, "eth_ackSubscription", "escrow", common.HexToHash("0xdead"), "0x0"); err == nil {
+		t.Fatal("acknowledged log of unknown block")
+	}
+	if err := client.Call(nil, "eth_ackSubscription", "escrow", head[0].Hash(), "0x1"); err != nil {
+		t.Fatalf("failed to acknowledge: %v", err)
+	}
+	detachDurable(t, api, sub, "escrow")
+
+	_, logs = attachDurable(t, client, "escrow", nil)
+	want = []durablePosition{{3, 0, true}, {3, 1, true}, {3, 0, false}, {3, 1, false}, {3, 2, false}}
+	if have := receiveDurable(t, logs, 5); !reflect.DeepEqual(have, want) {
+		t.Fatalf("reattached logs mismatch: have %v, want %v", have, want)
+	}
+}
@@ -53,6 +53,7 @@ type Filter struct {
 	begin, end int64
 	addresses  []common.Address
 	topics     [][]common.Hash
+	limit      int // Number of logs after which to stop the search (0 = unlimited)
 
 	matcher *bloombits.Matcher
 }
@@ -121,11 +122,11 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		} else {
 			logs, err = f.indexedLogs(ctx, indexed-1)
 		}
-		if err != nil {
+		if err != nil || f.limitReached(logs) {
 			return logs, err
 		}
 	}
-	rest, err := f.unindexedLogs(ctx, end)
+	rest, err := f.unindexedLogs(ctx, len(logs), end)
 	logs = append(logs, rest...)
 	return logs, err
 }
@@ -170,6 +171,9 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 				return logs, err
 			}
 			logs = append(logs, found...)
+			if f.limitReached(logs) {
+				return logs, nil
+			}
 
 		case <-ctx.Done():
 			return logs, ctx.Err()
@@ -177,12 +181,12 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 	}
 }
 
-// indexedLogs returns the logs matching the filter criteria based on raw block
-// iteration and bloom matching.
-func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+// unindexedLogs returns the logs matching the filter criteria based on raw block
+// iteration and bloom matching, stopping at the limit with the already found ones.
+func (f *Filter) unindexedLogs(ctx context.Context, found int, end uint64) ([]*types.Log, error) {
 	var logs []*types.Log
 
-	for ; f.begin <= int64(end); f.begin++ {
+	for ; f.begin <= int64(end) && (f.limit == 0 || found+len(logs) <= f.limit); f.begin++ {
 		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
 		if header == nil || err != nil {
 			return logs, err
@@ -198,6 +202,12 @@ func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, e
 	return logs, nil
 }
 
+// limitReached reports whether the search found more logs than its limit. The
+// search only stops between blocks, so all logs of the last block are included.
+func (f *Filter) limitReached(logs []*types.Log) bool {
+	return f.limit > 0 && len(logs) > f.limit
+}
+
 // checkMatches checks if the receipts belonging to the given header contain any log events that
 // match the filter criteria. This function is called when the bloom filter signals a potential match.
 func (f *Filter) checkMatches(ctx context.Context, header *types.Header) (logs []*types.Log, err error) {
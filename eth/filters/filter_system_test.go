@@ -17,7 +17,9 @@
 package filters
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -27,13 +29,16 @@ import (
 
 	ethereum "github.com/themis-network/go-themis"
 	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
 	"github.com/themis-network/go-themis/consensus/ethash"
 	"github.com/themis-network/go-themis/core"
 	"github.com/themis-network/go-themis/core/bloombits"
 	"github.com/themis-network/go-themis/core/rawdb"
 	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/crypto"
 	"github.com/themis-network/go-themis/ethdb"
 	"github.com/themis-network/go-themis/event"
+	"github.com/themis-network/go-themis/internal/ethapi"
 	"github.com/themis-network/go-themis/params"
 	"github.com/themis-network/go-themis/rpc"
 )
@@ -159,7 +164,7 @@ func TestBlockSubscription(t *testing.T) {
 		logsFeed    = new(event.Feed)
 		chainFeed   = new(event.Feed)
 		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api         = NewPublicFilterAPI(backend, false)
+		api         = NewPublicFilterAPI(backend, false, nil)
 		genesis     = new(core.Genesis).MustCommit(db)
 		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {})
 		chainEvents = []core.ChainEvent{}
@@ -216,7 +221,7 @@ func TestPendingTxFilter(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, nil)
 
 		transactions = []*types.Transaction{
 			types.NewTransaction(0, common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268"), new(big.Int), 0, new(big.Int), nil),
@@ -265,6 +270,160 @@ func TestPendingTxFilter(t *testing.T) {
 	}
 }
 
+// TestPendingTxSubscriptionCriteria tests that pending transaction subscriptions
+// deliver the full transactions matching their sender, recipient and method
+// selector criteria.
+func TestPendingTxSubscriptionCriteria(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux        = new(event.TypeMux)
+		db         = ethdb.NewMemDatabase()
+		txFeed     = new(event.Feed)
+		rmLogsFeed = new(event.Feed)
+		logsFeed   = new(event.Feed)
+		chainFeed  = new(event.Feed)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		api        = NewPublicFilterAPI(backend, false, nil)
+
+		key1, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		key2, _  = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		addr1    = crypto.PubkeyToAddress(key1.PublicKey)
+		trade    = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		other    = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+		selector = []byte{0xde, 0xad, 0xbe, 0xef}
+		signer   = types.NewEIP155Signer(big.NewInt(1))
+	)
+	sign := func(key *ecdsa.PrivateKey, nonce uint64, to *common.Address, data []byte) *types.Transaction {
+		var tx *types.Transaction
+		if to == nil {
+			tx = types.NewContractCreation(nonce, new(big.Int), 100000, new(big.Int), data)
+		} else {
+			tx = types.NewTransaction(nonce, *to, new(big.Int), 100000, new(big.Int), data)
+		}
+		tx, _ = types.SignTx(tx, signer, key)
+		return tx
+	}
+	transactions := []*types.Transaction{
+		sign(key1, 0, &trade, append(selector, 0x01)), // matches
+		sign(key2, 0, &trade, append(selector, 0x02)), // wrong sender
+		sign(key1, 1, &other, append(selector, 0x03)), // wrong recipient
+		sign(key1, 2, &trade, []byte{0xde, 0xad}),     // wrong selector
+		sign(key1, 3, nil, append(selector, 0x04)),    // contract creation
+		sign(key1, 4, &trade, append(selector, 0x05)), // matches
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	crit := map[string]interface{}{
+		"from":      []common.Address{addr1},
+		"to":        []common.Address{trade},
+		"selectors": []hexutil.Bytes{selector},
+	}
+	if _, err := client.EthSubscribe(context.Background(), make(chan common.Hash), "newPendingTransactions", false, map[string]interface{}{"selectors": []hexutil.Bytes{{0x01}}}); err == nil {
+		t.Fatal("subscription with invalid selector succeeded")
+	}
+	txs := make(chan *ethapi.RPCTransaction)
+	sub, err := client.EthSubscribe(context.Background(), txs, "newPendingTransactions", true, crit)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	time.Sleep(100 * time.Millisecond)
+	txFeed.Send(core.NewTxsEvent{Txs: transactions})
+
+	for _, want := range []*types.Transaction{transactions[0], transactions[5]} {
+		select {
+		case tx := <-txs:
+			if tx.Hash != want.Hash() || tx.From != addr1 || !bytes.Equal(tx.Input, want.Data()) {
+				t.Errorf("transaction mismatch: have %x from %x, want %x", tx.Hash, tx.From, want.Hash())
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription failed: %v", err)
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for transaction %x", want.Hash())
+		}
+	}
+	select {
+	case tx := <-txs:
+		t.Errorf("unexpected transaction %x", tx.Hash)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestPendingTxSubscriptionBodies tests that unfiltered pending transaction
+// subscriptions deliver the transaction hashes, or the full transactions along
+// with their senders if requested.
+func TestPendingTxSubscriptionBodies(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux        = new(event.TypeMux)
+		db         = ethdb.NewMemDatabase()
+		txFeed     = new(event.Feed)
+		rmLogsFeed = new(event.Feed)
+		logsFeed   = new(event.Feed)
+		chainFeed  = new(event.Feed)
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		api        = NewPublicFilterAPI(backend, false, nil)
+
+		key, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		signer = types.NewEIP155Signer(big.NewInt(1))
+	)
+	transactions := make([]*types.Transaction, 3)
+	for i := range transactions {
+		tx := types.NewTransaction(uint64(i), common.HexToAddress("0xaa"), big.NewInt(int64(i)), 100000, new(big.Int), []byte{byte(i)})
+		transactions[i], _ = types.SignTx(tx, signer, key)
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	hashes := make(chan common.Hash, len(transactions))
+	hashSub, err := client.EthSubscribe(context.Background(), hashes, "newPendingTransactions")
+	if err != nil {
+		t.Fatalf("failed to subscribe to hashes: %v", err)
+	}
+	defer hashSub.Unsubscribe()
+
+	txs := make(chan *ethapi.RPCTransaction, len(transactions))
+	txSub, err := client.EthSubscribe(context.Background(), txs, "newPendingTransactions", true)
+	if err != nil {
+		t.Fatalf("failed to subscribe to transactions: %v", err)
+	}
+	defer txSub.Unsubscribe()
+
+	time.Sleep(100 * time.Millisecond)
+	txFeed.Send(core.NewTxsEvent{Txs: transactions})
+
+	for _, want := range transactions {
+		select {
+		case hash := <-hashes:
+			if hash != want.Hash() {
+				t.Errorf("hash mismatch: have %x, want %x", hash, want.Hash())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for hash %x", want.Hash())
+		}
+		select {
+		case tx := <-txs:
+			if tx.Hash != want.Hash() || tx.From != crypto.PubkeyToAddress(key.PublicKey) || tx.Value.ToInt().Cmp(want.Value()) != 0 || !bytes.Equal(tx.Input, want.Data()) {
+				t.Errorf("transaction mismatch: have %x from %x, want %x", tx.Hash, tx.From, want.Hash())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for transaction %x", want.Hash())
+		}
+	}
+}
+
 // TestLogFilterCreation test whether a given filter criteria makes sense.
 // If not it must return an error.
 func TestLogFilterCreation(t *testing.T) {
@@ -276,7 +435,7 @@ func TestLogFilterCreation(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, nil)
 
 		testCases = []struct {
 			crit    FilterCriteria
@@ -325,7 +484,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, nil)
 	)
 
 	// different situations where log filter creation should fail.
@@ -355,7 +514,7 @@ func TestLogFilter(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, nil)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
@@ -474,7 +633,7 @@ func TestPendingLogsSubscription(t *testing.T) {
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
 		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
-		api        = NewPublicFilterAPI(backend, false)
+		api        = NewPublicFilterAPI(backend, false, nil)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
 		secondAddr     = common.HexToAddress("0x2222222222222222222222222222222222222222")
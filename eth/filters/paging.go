@@ -0,0 +1,155 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+var errInvalidCursor = errors.New("cursor outside of the queried block range")
+
+// Config are the limits of the log queries, protecting the node against queries
+// spanning the whole chain or returning enormous responses.
+type Config struct {
+	MaxBlockRange uint64 `toml:",omitempty"` // Maximum number of blocks a log query searches at once (0 = unlimited)
+	MaxResults    int    `toml:",omitempty"` // Maximum number of logs a log query returns at once (0 = unlimited)
+}
+
+// DefaultConfig contains the default log query limits. Log queries are unlimited
+// unless configured otherwise, so existing callers of eth_getLogs keep working.
+var DefaultConfig = Config{}
+
+// LogsCursor is the position in the chain at which a truncated log query resumes:
+// the first log not yet returned, or the first block not yet searched.
+type LogsCursor struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	LogIndex    hexutil.Uint   `json:"logIndex"`
+}
+
+// LogsPage is a page of the logs matching a query. The cursor is set if further
+// logs may match, and is nil once the queried range was searched entirely.
+type LogsPage struct {
+	Logs   []*types.Log `json:"logs"`
+	Cursor *LogsCursor  `json:"cursor"`
+}
+
+// logsLimitError is returned by the unpaginated log queries exceeding the limits,
+// carrying the cursor of the first page's end for eth_getLogsPage to resume at.
+type logsLimitError struct {
+	cursor *LogsCursor
+}
+
+func (e *logsLimitError) Error() string {
+	return fmt.Sprintf("query exceeds the log query limits, continue with eth_getLogsPage from block %d log index %d", e.cursor.BlockNumber, e.cursor.LogIndex)
+}
+
+func (e *logsLimitError) ErrorData() interface{} {
+	return e.cursor
+}
+
+// GetLogsPage returns a page of the logs matching the given argument that are
+// stored within the state. Queries exceeding the log query limits are truncated,
+// and continued by passing the returned cursor to the subsequent call.
+func (api *PublicFilterAPI) GetLogsPage(ctx context.Context, crit FilterCriteria, cursor *LogsCursor) (*LogsPage, error) {
+	logs, next, err := pageLogs(ctx, api.backend, api.config, crit, cursor)
+	if err != nil {
+		return nil, err
+	}
+	return &LogsPage{Logs: returnLogs(logs), Cursor: next}, nil
+}
+
+// pageLogs searches the logs matching the criteria from the cursor on, until the
+// end of the range or one of the limits is reached. The returned cursor is nil if
+// the range was searched entirely.
+func pageLogs(ctx context.Context, backend Backend, config *Config, crit FilterCriteria, cursor *LogsCursor) ([]*types.Log, *LogsCursor, error) {
+	// Resolve the queried range against the current head
+	header, err := backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if header == nil || err != nil {
+		return nil, nil, err
+	}
+	head := header.Number.Uint64()
+
+	begin, end := head, head
+	if crit.FromBlock != nil && crit.FromBlock.Sign() >= 0 {
+		begin = crit.FromBlock.Uint64()
+	}
+	if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 {
+		end = crit.ToBlock.Uint64()
+	}
+	var skip uint
+	if cursor != nil {
+		if uint64(cursor.BlockNumber) < begin || uint64(cursor.BlockNumber) > end {
+			return nil, nil, errInvalidCursor
+		}
+		begin, skip = uint64(cursor.BlockNumber), uint(cursor.LogIndex)
+	}
+	if begin > end {
+		return nil, nil, nil
+	}
+	// Cap the searched range and run the filter, stopping once enough logs are found
+	last := end
+	if limit := config.MaxBlockRange; limit > 0 && end-begin >= limit {
+		last = begin + limit - 1
+	}
+	filter := New(backend, int64(begin), int64(last), crit.Addresses, crit.Topics)
+	if config.MaxResults > 0 {
+		filter.limit = config.MaxResults + int(skip)
+	}
+	found, err := filter.Logs(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Drop the logs of the cursor's block which were already returned
+	logs := found[:0]
+	for _, log := range found {
+		if log.BlockNumber == begin && log.Index < skip {
+			continue
+		}
+		logs = append(logs, log)
+	}
+	// Truncate the logs to the limit, resuming from the first dropped one
+	if limit := config.MaxResults; limit > 0 && len(logs) > limit {
+		next := &LogsCursor{
+			BlockNumber: hexutil.Uint64(logs[limit].BlockNumber),
+			LogIndex:    hexutil.Uint(logs[limit].Index),
+		}
+		return logs[:limit], next, nil
+	}
+	if last < end {
+		return logs, &LogsCursor{BlockNumber: hexutil.Uint64(last + 1)}, nil
+	}
+	return logs, nil, nil
+}
+
+// BoundedLogs searches all logs matching the criteria within the given log query
+// limits, failing with the cursor to continue from if the query exceeds them.
+func BoundedLogs(ctx context.Context, backend Backend, config *Config, crit FilterCriteria) ([]*types.Log, error) {
+	logs, next, err := pageLogs(ctx, backend, config, crit, nil)
+	if err != nil {
+		return nil, err
+	}
+	if next != nil {
+		return nil, &logsLimitError{next}
+	}
+	return returnLogs(logs), nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package filters
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/event"
+	"github.com/themis-network/go-themis/params"
+)
+
+// logPosition identifies a log by its block number and index in the block.
+type logPosition struct {
+	block uint64
+	index uint
+}
+
+func TestGetLogsPage(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		backend = &testBackend{new(event.TypeMux), db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed)}
+		api     = NewPublicFilterAPI(backend, false, &Config{MaxBlockRange: 10, MaxResults: 3})
+		addr    = common.HexToAddress("0x01")
+	)
+	// Create a chain of 20 blocks, with two logs in blocks 2 and 3 and one in 15
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 20, func(i int, gen *core.BlockGen) {
+		count := map[int]int{1: 2, 2: 2, 14: 1}[i]
+		if count == 0 {
+			return
+		}
+		receipt := types.NewReceipt(nil, false, 0)
+		for j := 0; j < count; j++ {
+			receipt.Logs = append(receipt.Logs, &types.Log{Address: addr, BlockNumber: uint64(i + 1), Index: uint(j)})
+		}
+		gen.AddUncheckedReceipt(receipt)
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	crit := FilterCriteria{FromBlock: big.NewInt(0)}
+
+	// Page through the logs, checking the cursors and the union of the pages
+	var (
+		have    []logPosition
+		cursors []*LogsCursor
+		cursor  *LogsCursor
+	)
+	for {
+		page, err := api.GetLogsPage(context.Background(), crit, cursor)
+		if err != nil {
+			t.Fatalf("failed to get page: %v", err)
+		}
+		if len(page.Logs) > 3 {
+			t.Fatalf("page exceeds result limit: %d logs", len(page.Logs))
+		}
+		for _, log := range page.Logs {
+			have = append(have, logPosition{log.BlockNumber, log.Index})
+		}
+		if cursor = page.Cursor; cursor == nil {
+			break
+		}
+		cursors = append(cursors, cursor)
+	}
+	want := []logPosition{{2, 0}, {2, 1}, {3, 0}, {3, 1}, {15, 0}}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("paged logs mismatch: have %v, want %v", have, want)
+	}
+	wantCursors := []*LogsCursor{{BlockNumber: 3, LogIndex: 1}, {BlockNumber: 13}}
+	if !reflect.DeepEqual(cursors, wantCursors) {
+		t.Errorf("cursors mismatch: have %v, want %v", cursors, wantCursors)
+	}
+	// Unpaginated queries exceeding the limits must fail with the first cursor
+	if _, err := api.GetLogs(context.Background(), crit); err == nil {
+		t.Error("unbounded query succeeded")
+	} else if data, ok := err.(*logsLimitError); !ok || !reflect.DeepEqual(data.ErrorData(), wantCursors[0]) {
+		t.Errorf("limit error mismatch: have %v", err)
+	}
+	logs, err := api.GetLogs(context.Background(), FilterCriteria{FromBlock: big.NewInt(11)})
+	if err != nil || len(logs) != 1 {
+		t.Errorf("bounded query: have %d logs, error %v, want 1 log", len(logs), err)
+	}
+	// Queries are unlimited by default
+	logs, err = NewPublicFilterAPI(backend, false, nil).GetLogs(context.Background(), crit)
+	if err != nil || len(logs) != len(want) {
+		t.Errorf("default query: have %d logs, error %v, want %d logs", len(logs), err, len(want))
+	}
+	// Cursors outside of the queried range must be rejected
+	if _, err := api.GetLogsPage(context.Background(), FilterCriteria{FromBlock: big.NewInt(5)}, &LogsCursor{BlockNumber: 3}); err != errInvalidCursor {
+		t.Errorf("invalid cursor: have error %v, want %v", err, errInvalidCursor)
+	}
+}
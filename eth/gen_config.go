@@ -4,12 +4,14 @@ package eth
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/common/hexutil"
 	"github.com/themis-network/go-themis/consensus/ethash"
 	"github.com/themis-network/go-themis/core"
 	"github.com/themis-network/go-themis/eth/downloader"
+	"github.com/themis-network/go-themis/eth/filters"
 	"github.com/themis-network/go-themis/eth/gasprice"
 )
 
@@ -20,11 +22,15 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
-		LightServ               int  `toml:",omitempty"`
-		LightPeers              int  `toml:",omitempty"`
-		SkipBcVersionCheck      bool `toml:"-"`
-		DatabaseHandles         int  `toml:"-"`
+		DiscoveryURLs           []string
+		PermissionRegistry      common.Address `toml:",omitempty"`
+		LightServ               int            `toml:",omitempty"`
+		LightPeers              int            `toml:",omitempty"`
+		SkipBcVersionCheck      bool           `toml:"-"`
+		DatabaseHandles         int            `toml:"-"`
 		DatabaseCache           int
+		Snapshot                bool
+		ParallelExec            bool
 		Etherbase               common.Address `toml:",omitempty"`
 		MinerThreads            int            `toml:",omitempty"`
 		ExtraData               hexutil.Bytes  `toml:",omitempty"`
@@ -32,6 +38,9 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		Ethash                  ethash.Config
 		TxPool                  core.TxPoolConfig
 		GPO                     gasprice.Config
+		Logs                    filters.Config
+		RPCGasCap               uint64
+		RPCEVMTimeout           time.Duration
 		EnablePreimageRecording bool
 		DocRoot                 string `toml:"-"`
 	}
@@ -39,11 +48,15 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Genesis = c.Genesis
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
+	enc.DiscoveryURLs = c.DiscoveryURLs
+	enc.PermissionRegistry = c.PermissionRegistry
 	enc.LightServ = c.LightServ
 	enc.LightPeers = c.LightPeers
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
+	enc.Snapshot = c.Snapshot
+	enc.ParallelExec = c.ParallelExec
 	enc.Etherbase = c.Etherbase
 	enc.MinerThreads = c.MinerThreads
 	enc.ExtraData = c.ExtraData
@@ -51,6 +64,9 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Ethash = c.Ethash
 	enc.TxPool = c.TxPool
 	enc.GPO = c.GPO
+	enc.Logs = c.Logs
+	enc.RPCGasCap = c.RPCGasCap
+	enc.RPCEVMTimeout = c.RPCEVMTimeout
 	enc.EnablePreimageRecording = c.EnablePreimageRecording
 	enc.DocRoot = c.DocRoot
 	return &enc, nil
@@ -61,11 +77,15 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
-		LightServ               *int  `toml:",omitempty"`
-		LightPeers              *int  `toml:",omitempty"`
-		SkipBcVersionCheck      *bool `toml:"-"`
-		DatabaseHandles         *int  `toml:"-"`
+		DiscoveryURLs           []string
+		PermissionRegistry      *common.Address `toml:",omitempty"`
+		LightServ               *int            `toml:",omitempty"`
+		LightPeers              *int            `toml:",omitempty"`
+		SkipBcVersionCheck      *bool           `toml:"-"`
+		DatabaseHandles         *int            `toml:"-"`
 		DatabaseCache           *int
+		Snapshot                *bool
+		ParallelExec            *bool
 		Etherbase               *common.Address `toml:",omitempty"`
 		MinerThreads            *int            `toml:",omitempty"`
 		ExtraData               *hexutil.Bytes  `toml:",omitempty"`
@@ -73,6 +93,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		Ethash                  *ethash.Config
 		TxPool                  *core.TxPoolConfig
 		GPO                     *gasprice.Config
+		Logs                    *filters.Config
+		RPCGasCap               *uint64
+		RPCEVMTimeout           *time.Duration
 		EnablePreimageRecording *bool
 		DocRoot                 *string `toml:"-"`
 	}
@@ -89,6 +112,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SyncMode != nil {
 		c.SyncMode = *dec.SyncMode
 	}
+	if dec.DiscoveryURLs != nil {
+		c.DiscoveryURLs = dec.DiscoveryURLs
+	}
+	if dec.PermissionRegistry != nil {
+		c.PermissionRegistry = *dec.PermissionRegistry
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
@@ -104,6 +133,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseCache != nil {
 		c.DatabaseCache = *dec.DatabaseCache
 	}
+	if dec.Snapshot != nil {
+		c.Snapshot = *dec.Snapshot
+	}
+	if dec.ParallelExec != nil {
+		c.ParallelExec = *dec.ParallelExec
+	}
 	if dec.Etherbase != nil {
 		c.Etherbase = *dec.Etherbase
 	}
@@ -125,6 +160,15 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.GPO != nil {
 		c.GPO = *dec.GPO
 	}
+	if dec.Logs != nil {
+		c.Logs = *dec.Logs
+	}
+	if dec.RPCGasCap != nil {
+		c.RPCGasCap = *dec.RPCGasCap
+	}
+	if dec.RPCEVMTimeout != nil {
+		c.RPCEVMTimeout = *dec.RPCEVMTimeout
+	}
 	if dec.EnablePreimageRecording != nil {
 		c.EnablePreimageRecording = *dec.EnablePreimageRecording
 	}
@@ -33,6 +33,7 @@ import (
 	"github.com/themis-network/go-themis/core/types"
 	"github.com/themis-network/go-themis/eth/downloader"
 	"github.com/themis-network/go-themis/eth/fetcher"
+	"github.com/themis-network/go-themis/eth/snap"
 	"github.com/themis-network/go-themis/ethdb"
 	"github.com/themis-network/go-themis/event"
 	"github.com/themis-network/go-themis/log"
@@ -67,6 +68,7 @@ type ProtocolManager struct {
 	networkID uint64
 
 	fastSync  uint32 // Flag whether fast sync is enabled (gets disabled if we already have blocks)
+	snapSync  uint32 // Flag whether fast sync retrieves the state in ranges from snap peers
 	acceptTxs uint32 // Flag whether we're considered synchronised (enables transaction processing)
 
 	txpool      txPool
@@ -113,18 +115,23 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 		quitSync:    make(chan struct{}),
 	}
 	// Figure out whether to allow fast sync or not
-	if mode == downloader.FastSync && blockchain.CurrentBlock().NumberU64() > 0 {
+	if mode == downloader.SnapSync {
+		manager.snapSync = uint32(1)
+	}
+	fast := mode == downloader.FastSync || mode == downloader.SnapSync
+	if fast && blockchain.CurrentBlock().NumberU64() > 0 {
 		log.Warn("Blockchain not empty, fast sync disabled")
-		mode = downloader.FullSync
+		mode, fast = downloader.FullSync, false
 	}
-	if mode == downloader.FastSync {
+	if fast {
 		manager.fastSync = uint32(1)
 	}
 	// Initiate a sub-protocol for every implemented version we can handle
-	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions))
+	manager.SubProtocols = make([]p2p.Protocol, 0, len(ProtocolVersions)+len(snap.ProtocolVersions))
+	dialFilter := newDialFilter(config, blockchain)
 	for i, version := range ProtocolVersions {
 		// Skip protocol version if incompatible with the mode of operation
-		if mode == downloader.FastSync && version < eth63 {
+		if fast && version < eth63 {
 			continue
 		}
 		// Compatible; initialise the sub-protocol
@@ -153,6 +160,7 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 				}
 				return nil
 			},
+			DialFilter: dialFilter,
 		})
 	}
 	if len(manager.SubProtocols) == 0 {
@@ -161,6 +169,9 @@ func NewProtocolManager(config *params.ChainConfig, mode downloader.SyncMode, ne
 	// Construct the different synchronisation mechanisms
 	manager.downloader = downloader.New(mode, chaindb, manager.eventMux, blockchain, nil, manager.removePeer)
 
+	// Serve the state in ranges, and retrieve it from snap peers if snap syncing
+	manager.SubProtocols = append(manager.SubProtocols, snap.MakeProtocols(blockchain.StateCache(), manager.downloader.SnapSyncer())...)
+
 	validator := func(header *types.Header) error {
 		return engine.VerifyHeader(blockchain, header, true)
 	}
@@ -215,6 +226,9 @@ func (pm *ProtocolManager) Start(maxPeers int) {
 	// start sync handlers
 	go pm.syncer()
 	go pm.txsyncLoop()
+
+	// evict low scoring peers
+	go pm.evictLoop(evictInterval)
 }
 
 func (pm *ProtocolManager) Stop() {
@@ -242,6 +256,37 @@ func (pm *ProtocolManager) Stop() {
 	log.Info("Ethereum protocol stopped")
 }
 
+// evictLoop periodically evicts a low scoring peer while all peer slots are
+// taken, so that the dialer can replace it with a potentially better peer.
+func (pm *ProtocolManager) evictLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if pm.peers.Len() >= pm.maxPeers {
+				pm.evictPeer()
+			}
+		case <-pm.quitSync:
+			return
+		}
+	}
+}
+
+// evictPeer drops the peer with the lowest reputation if its score is below
+// evictScore. Trusted and static peers are never evicted. It returns whether
+// a peer was dropped.
+func (pm *ProtocolManager) evictPeer() bool {
+	worst := pm.peers.WorstPeer()
+	if worst == nil || worst.Score() >= evictScore {
+		return false
+	}
+	worst.Log().Debug("Evicting low scoring Ethereum peer", "score", worst.Score())
+	pm.removePeer(worst.id)
+	return true
+}
+
 func (pm *ProtocolManager) newPeer(pv int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 	return newPeer(pv, p, newMeteredMsgWriter(rw))
 }
@@ -249,8 +294,9 @@ func (pm *ProtocolManager) newPeer(pv int, p *p2p.Peer, rw p2p.MsgReadWriter) *p
 // handle is the callback invoked to manage the life cycle of an eth peer. When
 // this function terminates, the peer is disconnected.
 func (pm *ProtocolManager) handle(p *peer) error {
-	// Ignore maxPeers if this is a trusted peer
-	if pm.peers.Len() >= pm.maxPeers && !p.Peer.Info().Network.Trusted {
+	// Ignore maxPeers if this is a trusted peer, otherwise try to make room by
+	// evicting a low scoring peer
+	if pm.peers.Len() >= pm.maxPeers && !p.Peer.Info().Network.Trusted && !pm.evictPeer() {
 		return p2p.DiscTooManyPeers
 	}
 	p.Log().Debug("Ethereum peer connected", "name", p.Name())
@@ -627,6 +673,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				unknown = append(unknown, block)
 			}
 		}
+		p.announced(len(unknown), len(announces)-len(unknown))
 		for _, block := range unknown {
 			pm.fetcher.Notify(p.id, block.Hash, block.Number, time.Now(), p.RequestOneHeader, p.RequestBodies)
 		}
@@ -642,6 +689,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 		// Mark the peer as owning the block and schedule it for import
 		p.MarkBlock(request.Block.Hash())
+		if pm.blockchain.HasBlock(request.Block.Hash(), request.Block.NumberU64()) {
+			p.announced(0, 1)
+		} else {
+			p.announced(1, 0)
+		}
 		pm.fetcher.Enqueue(p.id, request.Block)
 
 		// Assuming the block is importable by the peer, but possibly not yet done so,
@@ -680,7 +732,21 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 			p.MarkTransaction(tx.Hash())
 		}
-		pm.txpool.AddRemotes(txs)
+		var useful, useless, invalid int
+		for _, err := range pm.txpool.AddRemotes(txs) {
+			switch {
+			case err == nil:
+				useful++
+			case isInvalidTx(err):
+				invalid++
+			default:
+				useless++
+			}
+		}
+		p.announced(useful, useless)
+		if invalid > 0 {
+			p.invalidData(invalid)
+		}
 
 	default:
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
@@ -520,3 +520,126 @@ func testDAOChallenge(t *testing.T, localForked, remoteForked bool, timeout bool
 		}
 	}
 }
+
+// waitFor polls the given condition until it holds, failing the test if it does
+// not within a reasonable time.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	for deadline := time.Now().Add(2 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// Tests that a peer connecting while all peer slots are taken evicts the lowest
+// scoring peer if it is below the eviction score, and is rejected otherwise.
+func TestEvictOnConnect(t *testing.T) {
+	pm, _, err := newLimitedTestProtocolManager(downloader.FullSync, 0, nil, nil, 1)
+	if err != nil {
+		t.Fatalf("failed to create protocol manager: %v", err)
+	}
+	defer pm.Stop()
+
+	first, _ := newTestPeer("first", eth63, pm, true)
+	defer first.close()
+	waitFor(t, "first peer to register", func() bool { return pm.peers.Peer(first.id) != nil })
+
+	// A peer above the eviction score keeps its slot
+	second, errc := newTestPeer("second", eth63, pm, false)
+	defer second.close()
+	select {
+	case err := <-errc:
+		if err != p2p.DiscTooManyPeers {
+			t.Fatalf("second peer error mismatch: have %v, want %v", err, p2p.DiscTooManyPeers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("second peer not rejected")
+	}
+	// A peer below the eviction score is replaced by the connecting one
+	first.invalidData(1)
+
+	third, _ := newTestPeer("third", eth63, pm, true)
+	defer third.close()
+	waitFor(t, "third peer to register", func() bool { return pm.peers.Peer(third.id) != nil })
+	if pm.peers.Peer(first.id) != nil {
+		t.Fatalf("low scoring peer not evicted")
+	}
+}
+
+// Tests that the eviction loop drops low scoring peers while all peer slots are
+// taken, keeping the others.
+func TestEvictLoop(t *testing.T) {
+	pm, _, err := newLimitedTestProtocolManager(downloader.FullSync, 0, nil, nil, 2)
+	if err != nil {
+		t.Fatalf("failed to create protocol manager: %v", err)
+	}
+	defer pm.Stop()
+
+	interval := 10 * time.Millisecond
+	go pm.evictLoop(interval)
+
+	good, _ := newTestPeer("good", eth63, pm, true)
+	defer good.close()
+	bad, _ := newTestPeer("bad", eth63, pm, true)
+	defer bad.close()
+	waitFor(t, "peers to register", func() bool { return pm.peers.Len() == 2 })
+
+	// Peers above the eviction score are kept
+	time.Sleep(10 * interval)
+	if peers := pm.peers.Len(); peers != 2 {
+		t.Fatalf("peer count mismatch: have %d, want %d", peers, 2)
+	}
+	// Peers below it are evicted
+	bad.invalidData(1)
+	waitFor(t, "low scoring peer eviction", func() bool { return pm.peers.Peer(bad.id) == nil })
+	if pm.peers.Peer(good.id) == nil {
+		t.Fatalf("good peer evicted")
+	}
+}
+
+// Tests that announced blocks and transactions are accounted in the score of
+// the announcing peer depending on whether they were known.
+func TestAnnouncementScores(t *testing.T) {
+	pm, _ := newTestProtocolManagerMust(t, downloader.FullSync, 4, nil, nil)
+	pm.acceptTxs = 1 // mark synced to accept transactions
+	defer pm.Stop()
+
+	p, _ := newTestPeer("peer", eth63, pm, true)
+	defer p.close()
+
+	checkAnns := func(useful, useless uint64) {
+		t.Helper()
+		waitFor(t, "announcement accounting", func() bool {
+			info := p.info()
+			return info.UsefulAnns == useful && info.UselessAnns == useless
+		})
+	}
+	// Announce two known block hashes and an unknown one
+	announces := newBlockHashesData{
+		{Hash: pm.blockchain.GetBlockByNumber(1).Hash(), Number: 1},
+		{Hash: pm.blockchain.GetBlockByNumber(2).Hash(), Number: 2},
+		{Hash: common.HexToHash("0xdeadbeef"), Number: 5},
+	}
+	if err := p2p.Send(p.app, NewBlockHashesMsg, announces); err != nil {
+		t.Fatalf("failed to send block hashes: %v", err)
+	}
+	checkAnns(1, 2)
+
+	// Propagate a known block
+	block := pm.blockchain.GetBlockByNumber(3)
+	if err := p2p.Send(p.app, NewBlockMsg, &newBlockData{Block: block, TD: pm.blockchain.GetTd(block.Hash(), 3)}); err != nil {
+		t.Fatalf("failed to send block: %v", err)
+	}
+	checkAnns(1, 3)
+
+	// Propagate transactions accepted by the pool
+	txs := []*types.Transaction{newTestTransaction(testAccount, 0, 0), newTestTransaction(testAccount, 1, 0)}
+	if err := p2p.Send(p.app, TxMsg, txs); err != nil {
+		t.Fatalf("failed to send transactions: %v", err)
+	}
+	checkAnns(3, 3)
+
+	if want := 3*usefulAnnReward - 3*uselessAnnPenalty; math.Abs(p.Score()-want) > 1e-9 {
+		t.Fatalf("score mismatch: have %v, want %v", p.Score(), want)
+	}
+}
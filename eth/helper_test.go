@@ -50,6 +50,12 @@ var (
 // with the given number of blocks already known, and potential notification
 // channels for different events.
 func newTestProtocolManager(mode downloader.SyncMode, blocks int, generator func(int, *core.BlockGen), newtx chan<- []*types.Transaction) (*ProtocolManager, *ethdb.MemDatabase, error) {
+	return newLimitedTestProtocolManager(mode, blocks, generator, newtx, 1000)
+}
+
+// newLimitedTestProtocolManager creates a new protocol manager for testing
+// purposes, accepting at most maxPeers peers.
+func newLimitedTestProtocolManager(mode downloader.SyncMode, blocks int, generator func(int, *core.BlockGen), newtx chan<- []*types.Transaction, maxPeers int) (*ProtocolManager, *ethdb.MemDatabase, error) {
 	var (
 		evmux  = new(event.TypeMux)
 		engine = ethash.NewFaker()
@@ -70,7 +76,7 @@ func newTestProtocolManager(mode downloader.SyncMode, blocks int, generator func
 	if err != nil {
 		return nil, nil, err
 	}
-	pm.Start(1000)
+	pm.Start(maxPeers)
 	return pm, db, nil
 }
 
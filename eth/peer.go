@@ -61,9 +61,10 @@ const (
 // PeerInfo represents a short summary of the Ethereum sub-protocol metadata known
 // about a connected peer.
 type PeerInfo struct {
-	Version    int      `json:"version"`    // Ethereum protocol version negotiated
-	Difficulty *big.Int `json:"difficulty"` // Total difficulty of the peer's blockchain
-	Head       string   `json:"head"`       // SHA3 hash of the peer's best owned block
+	Version    int        `json:"version"`    // Ethereum protocol version negotiated
+	Difficulty *big.Int   `json:"difficulty"` // Total difficulty of the peer's blockchain
+	Head       string     `json:"head"`       // SHA3 hash of the peer's best owned block
+	Reputation *PeerScore `json:"reputation"` // Reputation score and the statistics behind it
 }
 
 // propEvent is a block propagation, waiting for its turn in the broadcast queue.
@@ -81,6 +82,8 @@ type peer struct {
 	version  int         // Protocol version negotiated
 	forkDrop *time.Timer // Timed connection dropper if forks aren't validated in time
 
+	*peerScore // Reputation of the peer, reported to the downloader
+
 	head common.Hash
 	td   *big.Int
 	lock sync.RWMutex
@@ -98,6 +101,7 @@ func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 		Peer:        p,
 		rw:          rw,
 		version:     version,
+		peerScore:   new(peerScore),
 		id:          fmt.Sprintf("%x", p.ID().Bytes()[:8]),
 		knownTxs:    set.New(),
 		knownBlocks: set.New(),
@@ -151,6 +155,7 @@ func (p *peer) Info() *PeerInfo {
 		Version:    p.version,
 		Difficulty: td,
 		Head:       hash.Hex(),
+		Reputation: p.peerScore.info(),
 	}
 }
 
@@ -509,6 +514,30 @@ func (ps *peerSet) BestPeer() *peer {
 	return bestPeer
 }
 
+// WorstPeer retrieves the peer with the lowest reputation score, excluding
+// trusted and static peers.
+func (ps *peerSet) WorstPeer() *peer {
+	ps.lock.RLock()
+	peers := make([]*peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		peers = append(peers, p)
+	}
+	ps.lock.RUnlock()
+
+	// Check the connection flags without holding the lock, the p2p peer info
+	// queries the peer set for the eth protocol info.
+	var worst *peer
+	for _, p := range peers {
+		if info := p.Peer.Info(); info.Network.Trusted || info.Network.Static {
+			continue
+		}
+		if worst == nil || p.Score() < worst.Score() {
+			worst = p
+		}
+	}
+	return worst
+}
+
 // Close disconnects all peers.
 // No new peers can be registered after Close has returned.
 func (ps *peerSet) Close() {
@@ -0,0 +1,183 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/themis-network/go-themis/common/mclock"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/eth/downloader"
+)
+
+const (
+	minScore = -downloader.MaxReputation // Lowest possible reputation score of a peer
+	maxScore = downloader.MaxReputation  // Highest possible reputation score of a peer
+
+	usefulAnnReward   = 1    // Reward for announcing an unknown block or transaction
+	uselessAnnPenalty = 0.05 // Penalty for announcing a known block or transaction
+	responseReward    = 1    // Reward for a timely non-empty response to a request
+	timeoutPenalty    = 5    // Penalty for failing to answer a request
+	invalidPenalty    = 20   // Penalty for sending invalid data
+
+	// slowResponse is the response latency for which no reward is given.
+	// Faster responses are rewarded proportionally.
+	slowResponse = 5 * time.Second
+
+	// latencyImpact is the impact a single response has on the latency estimate.
+	latencyImpact = 0.1
+
+	// scoreDecay is the factor by which scores decay towards zero every
+	// scoreDecayInterval, so that old behaviour is gradually forgotten.
+	scoreDecay         = 0.95
+	scoreDecayInterval = time.Minute
+
+	// evictScore is the score below which peers are evicted when all peer slots
+	// are taken, making room for potentially better peers.
+	evictScore = -10
+
+	// evictInterval is the time between two evictions of low scoring peers.
+	evictInterval = time.Minute
+)
+
+// PeerScore is a summary of the reputation of a peer.
+type PeerScore struct {
+	Score       float64 `json:"score"`       // Current reputation score
+	UsefulAnns  uint64  `json:"usefulAnns"`  // Number of announced unknown blocks and transactions
+	UselessAnns uint64  `json:"uselessAnns"` // Number of announced known blocks and transactions
+	Invalid     uint64  `json:"invalid"`     // Number of invalid blocks and transactions received
+	Timeouts    uint64  `json:"timeouts"`    // Number of unanswered requests
+	Latency     string  `json:"latency"`     // Average response latency of requests
+}
+
+// peerScore tracks the reputation of a peer. The score rises with useful
+// announcements and timely responses, and falls with useless announcements,
+// timeouts and invalid data.
+type peerScore struct {
+	score       float64
+	usefulAnns  uint64
+	uselessAnns uint64
+	invalid     uint64
+	timeouts    uint64
+	latency     time.Duration  // Moving average of the response latency
+	decayed     mclock.AbsTime // Time up to which the score has been decayed
+	lock        sync.Mutex
+}
+
+// Score returns the current reputation score.
+func (s *peerScore) Score() float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.decay(mclock.Now())
+	return s.score
+}
+
+// info returns a summary of the score.
+func (s *peerScore) info() *PeerScore {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.decay(mclock.Now())
+	return &PeerScore{
+		Score:       s.score,
+		UsefulAnns:  s.usefulAnns,
+		UselessAnns: s.uselessAnns,
+		Invalid:     s.invalid,
+		Timeouts:    s.timeouts,
+		Latency:     s.latency.String(),
+	}
+}
+
+// announced records announcements of blocks or transactions, useful ones being
+// those which were not known before.
+func (s *peerScore) announced(useful, useless int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.usefulAnns += uint64(useful)
+	s.uselessAnns += uint64(useless)
+	s.add(float64(useful)*usefulAnnReward - float64(useless)*uselessAnnPenalty)
+}
+
+// invalidData records the receipt of invalid data.
+func (s *peerScore) invalidData(count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.invalid += uint64(count)
+	s.add(-float64(count) * invalidPenalty)
+}
+
+// RequestDone records the outcome of a downloader request. Requests which
+// delivered nothing count as timeouts.
+func (s *peerScore) RequestDone(elapsed time.Duration, delivered int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if delivered == 0 {
+		s.timeouts++
+		s.add(-timeoutPenalty)
+		return
+	}
+	if s.latency == 0 {
+		s.latency = elapsed
+	} else {
+		s.latency = time.Duration((1-latencyImpact)*float64(s.latency) + latencyImpact*float64(elapsed))
+	}
+	if elapsed < slowResponse {
+		s.add(responseReward * (1 - float64(elapsed)/float64(slowResponse)))
+	}
+}
+
+// decay moves the score towards zero by scoreDecay for every scoreDecayInterval
+// passed since the last decay.
+func (s *peerScore) decay(now mclock.AbsTime) {
+	if s.decayed == 0 {
+		s.decayed = now
+		return
+	}
+	if steps := time.Duration(now-s.decayed) / scoreDecayInterval; steps > 0 {
+		s.score *= math.Pow(scoreDecay, float64(steps))
+		s.decayed += mclock.AbsTime(steps * scoreDecayInterval)
+	}
+}
+
+// add changes the score by delta, keeping it within bounds.
+func (s *peerScore) add(delta float64) {
+	s.decay(mclock.Now())
+	s.score += delta
+	if s.score > maxScore {
+		s.score = maxScore
+	}
+	if s.score < minScore {
+		s.score = minScore
+	}
+}
+
+// isInvalidTx reports whether a transaction pool error shows that the
+// transaction is invalid, rather than just known or unwanted. Errors depending
+// on local state, like the block gas limit, don't count as invalid.
+func isInvalidTx(err error) bool {
+	switch err {
+	case core.ErrInvalidSender, core.ErrNegativeValue, core.ErrOversizedData, core.ErrIntrinsicGas:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis/common/mclock"
+	"github.com/themis-network/go-themis/core"
+)
+
+func TestPeerScoreAnnouncements(t *testing.T) {
+	s := new(peerScore)
+	s.announced(3, 20)
+	if want := 3*usefulAnnReward - 20*uselessAnnPenalty; s.Score() != want {
+		t.Fatalf("wrong score %v, want %v", s.Score(), want)
+	}
+	s.invalidData(1)
+	if want := 3*usefulAnnReward - 20*uselessAnnPenalty - invalidPenalty; s.Score() != want {
+		t.Fatalf("wrong score %v, want %v", s.Score(), want)
+	}
+	info := s.info()
+	if info.UsefulAnns != 3 || info.UselessAnns != 20 || info.Invalid != 1 {
+		t.Fatalf("wrong counters: %+v", info)
+	}
+	// Scores stay within bounds.
+	s.invalidData(100)
+	if s.Score() != minScore {
+		t.Fatalf("score %v below minimum", s.Score())
+	}
+	s.announced(1000, 0)
+	if s.Score() != maxScore {
+		t.Fatalf("score %v above maximum", s.Score())
+	}
+}
+
+func TestPeerScoreRequests(t *testing.T) {
+	s := new(peerScore)
+	s.RequestDone(time.Second, 0)
+	if s.Score() != -timeoutPenalty || s.info().Timeouts != 1 {
+		t.Fatalf("timeout not penalized: %+v", s.info())
+	}
+	// Fast responses earn more than slow ones, which earn nothing.
+	fast, slow := new(peerScore), new(peerScore)
+	fast.RequestDone(slowResponse/10, 1)
+	slow.RequestDone(slowResponse/2, 1)
+	if fast.Score() <= slow.Score() || slow.Score() <= 0 {
+		t.Fatalf("wrong response rewards: fast %v, slow %v", fast.Score(), slow.Score())
+	}
+	score := slow.Score()
+	slow.RequestDone(2*slowResponse, 1)
+	if slow.Score() != score {
+		t.Fatalf("late response rewarded: %v", slow.Score())
+	}
+	// The latency estimate moves towards new measurements.
+	if fast.latency != slowResponse/10 {
+		t.Fatalf("wrong initial latency %v", fast.latency)
+	}
+	fast.RequestDone(slowResponse, 1)
+	if fast.latency <= slowResponse/10 || fast.latency >= slowResponse {
+		t.Fatalf("wrong latency estimate %v", fast.latency)
+	}
+}
+
+func TestPeerScoreDecay(t *testing.T) {
+	good, bad := new(peerScore), new(peerScore)
+	good.announced(50, 0)
+	bad.invalidData(5)
+
+	// Scores don't decay within an interval
+	good.decayed -= mclock.AbsTime(scoreDecayInterval / 2)
+	if good.Score() != 50 {
+		t.Fatalf("score %v decayed early", good.Score())
+	}
+	// Both rewards and penalties decay towards zero
+	good.decayed -= mclock.AbsTime(scoreDecayInterval / 2)
+	if want := 50 * scoreDecay; good.Score() != want {
+		t.Fatalf("wrong decayed score %v, want %v", good.Score(), want)
+	}
+	bad.decayed -= mclock.AbsTime(100 * scoreDecayInterval)
+	if score := bad.Score(); score >= 0 || score <= evictScore {
+		t.Fatalf("penalty did not decay above eviction: %v", score)
+	}
+	// New behaviour counts fully on top of the decayed score
+	bad.invalidData(1)
+	if bad.Score() > evictScore {
+		t.Fatalf("new penalty not applied: %v", bad.Score())
+	}
+}
+
+func TestIsInvalidTx(t *testing.T) {
+	for _, err := range []error{core.ErrInvalidSender, core.ErrNegativeValue, core.ErrOversizedData, core.ErrIntrinsicGas} {
+		if !isInvalidTx(err) {
+			t.Errorf("%v not considered invalid", err)
+		}
+	}
+	for _, err := range []error{core.ErrNonceTooLow, core.ErrUnderpriced, core.ErrInsufficientFunds, core.ErrGasLimit, errors.New("known transaction")} {
+		if isInvalidTx(err) {
+			t.Errorf("%v considered invalid", err)
+		}
+	}
+}
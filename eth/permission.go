@@ -0,0 +1,58 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/themis-network/go-themis"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/internal/ethapi"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/p2p"
+	"github.com/themis-network/go-themis/p2p/permission"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// contractCaller executes contract calls against the local chain.
+type contractCaller struct {
+	api *ethapi.PublicBlockChainAPI
+}
+
+// CallContract implements ethereum.ContractCaller.
+func (c *contractCaller) CallContract(ctx context.Context, msg ethereum.CallMsg, number *big.Int) ([]byte, error) {
+	blockNr := rpc.LatestBlockNumber
+	if number != nil {
+		blockNr = rpc.BlockNumber(number.Int64())
+	}
+	return c.api.Call(ctx, ethapi.CallArgs{From: msg.From, To: msg.To, Data: msg.Data}, blockNr)
+}
+
+// addRegistrySource adds the node registry contract to the allowlist of a
+// permissioned node. The contract is read from the latest state, so it may
+// not be available until the chain is synced.
+func (s *Ethereum) addRegistrySource(srvr *p2p.Server) {
+	if srvr.Permissions == nil || s.config.PermissionRegistry == (common.Address{}) {
+		return
+	}
+	caller := &contractCaller{ethapi.NewPublicBlockChainAPI(s.APIBackend)}
+	src := permission.NewRegistrySource(caller, s.config.PermissionRegistry)
+	if err := srvr.Permissions.AddSource(src); err != nil {
+		log.Warn("Failed to load node registry", "address", s.config.PermissionRegistry, "err", err)
+	}
+}
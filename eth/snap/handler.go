@@ -0,0 +1,279 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/state"
+	"github.com/themis-network/go-themis/p2p"
+	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/rlp"
+	"github.com/themis-network/go-themis/trie"
+)
+
+// MakeProtocols constructs the snap protocols, serving the state of the given
+// database and delivering the responses of the peers to the syncer.
+func MakeProtocols(db state.Database, syncer *Syncer) []p2p.Protocol {
+	protocols := make([]p2p.Protocol, len(ProtocolVersions))
+	for i, version := range ProtocolVersions {
+		version := version // Closure for the run
+		protocols[i] = p2p.Protocol{
+			Name:    ProtocolName,
+			Version: version,
+			Length:  ProtocolLengths[i],
+			Run: func(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+				return Handle(db, syncer, NewPeer(version, p, rw))
+			},
+			PeerInfo: func(id discover.NodeID) interface{} {
+				return nil
+			},
+		}
+	}
+	return protocols
+}
+
+// Handle is the callback invoked to manage the life cycle of a snap peer. When
+// this function terminates, the peer is disconnected.
+func Handle(db state.Database, syncer *Syncer, peer *Peer) error {
+	if err := syncer.Register(peer); err != nil {
+		peer.Log().Error("Snap peer registration failed", "err", err)
+		return err
+	}
+	defer syncer.Unregister(peer.id)
+
+	for {
+		if err := handleMessage(db, syncer, peer); err != nil {
+			peer.Log().Debug("Snap message handling failed", "err", err)
+			return err
+		}
+	}
+}
+
+// handleMessage is invoked whenever an inbound message is received from a remote
+// peer. The remote connection is torn down upon returning any error.
+func handleMessage(db state.Database, syncer *Syncer, peer *Peer) error {
+	// Read the next message from the remote peer, and ensure it's fully consumed
+	msg, err := peer.rw.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(errMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	// Handle the message depending on its contents
+	switch msg.Code {
+	case GetAccountRangeMsg:
+		var req getAccountRangeData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(errDecode, "%v: %v", msg, err)
+		}
+		return p2p.Send(peer.rw, AccountRangeMsg, serviceAccountRange(db, &req))
+
+	case AccountRangeMsg:
+		var res accountRangeData
+		if err := msg.Decode(&res); err != nil {
+			return errResp(errDecode, "%v: %v", msg, err)
+		}
+		return syncer.onAccounts(peer, &res)
+
+	case GetStorageRangesMsg:
+		var req getStorageRangesData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(errDecode, "%v: %v", msg, err)
+		}
+		return p2p.Send(peer.rw, StorageRangesMsg, serviceStorageRanges(db, &req))
+
+	case StorageRangesMsg:
+		var res storageRangesData
+		if err := msg.Decode(&res); err != nil {
+			return errResp(errDecode, "%v: %v", msg, err)
+		}
+		return syncer.onStorage(peer, &res)
+
+	case GetByteCodesMsg:
+		var req getByteCodesData
+		if err := msg.Decode(&req); err != nil {
+			return errResp(errDecode, "%v: %v", msg, err)
+		}
+		return p2p.Send(peer.rw, ByteCodesMsg, serviceByteCodes(db, &req))
+
+	case ByteCodesMsg:
+		var res byteCodesData
+		if err := msg.Decode(&res); err != nil {
+			return errResp(errDecode, "%v: %v", msg, err)
+		}
+		return syncer.onByteCodes(peer, &res)
+
+	default:
+		return errResp(errInvalidMsgCode, "%v", msg.Code)
+	}
+}
+
+// responseLimit caps the soft response size requested by a peer.
+func responseLimit(bytes uint64) uint64 {
+	if bytes > softResponseLimit {
+		return softResponseLimit
+	}
+	return bytes
+}
+
+// proofList collects the trie nodes of Merkle proofs.
+type proofList [][]byte
+
+// Put implements ethdb.Putter.
+func (l *proofList) Put(key []byte, value []byte) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// serviceAccountRange assembles the response to an account range query. If the
+// state of the requested root is unavailable, an empty response without proof
+// is returned.
+func serviceAccountRange(db state.Database, req *getAccountRangeData) *accountRangeData {
+	res := &accountRangeData{ID: req.ID}
+
+	tr, err := trie.New(req.Root, db.TrieDB())
+	if err != nil {
+		return res
+	}
+	var (
+		limit = responseLimit(req.Bytes)
+		size  uint64
+		it    = trie.NewIterator(tr.NodeIterator(req.Origin[:]))
+	)
+	for size < limit && it.Next() {
+		hash := common.BytesToHash(it.Key)
+		if bytes.Compare(hash[:], req.Limit[:]) > 0 {
+			break
+		}
+		res.Accounts = append(res.Accounts, &accountData{Hash: hash, Body: common.CopyBytes(it.Value)})
+		size += uint64(common.HashLength + len(it.Value))
+	}
+	if it.Err != nil {
+		return &accountRangeData{ID: req.ID}
+	}
+	// Prove the range from the origin up to the last account, or up to the
+	// limit if it is empty
+	last := req.Limit
+	if len(res.Accounts) > 0 {
+		last = res.Accounts[len(res.Accounts)-1].Hash
+	}
+	if !proveRange(tr, req.Origin, last, (*proofList)(&res.Proof)) {
+		return &accountRangeData{ID: req.ID}
+	}
+	return res
+}
+
+// serviceStorageRanges assembles the response to a storage range query. If the
+// state of the requested root is unavailable, an empty response is returned.
+func serviceStorageRanges(db state.Database, req *getStorageRangesData) *storageRangesData {
+	res := &storageRangesData{ID: req.ID}
+
+	accTrie, err := trie.New(req.Root, db.TrieDB())
+	if err != nil {
+		return res
+	}
+	var (
+		limit = responseLimit(req.Bytes)
+		size  uint64
+	)
+	for i, account := range req.Accounts {
+		if size >= limit {
+			break
+		}
+		blob, err := accTrie.TryGet(account[:])
+		if err != nil || blob == nil {
+			return &storageRangesData{ID: req.ID}
+		}
+		var data state.Account
+		if err := rlp.DecodeBytes(blob, &data); err != nil {
+			return &storageRangesData{ID: req.ID}
+		}
+		stTrie, err := trie.New(data.Root, db.TrieDB())
+		if err != nil {
+			return &storageRangesData{ID: req.ID}
+		}
+		var origin common.Hash
+		if i == 0 {
+			origin = req.Origin
+		}
+		var (
+			slots     []*storageData
+			truncated bool
+			it        = trie.NewIterator(stTrie.NodeIterator(origin[:]))
+		)
+		for it.Next() {
+			if size >= limit {
+				truncated = true
+				break
+			}
+			slots = append(slots, &storageData{Hash: common.BytesToHash(it.Key), Body: common.CopyBytes(it.Value)})
+			size += uint64(common.HashLength + len(it.Value))
+		}
+		if it.Err != nil {
+			return &storageRangesData{ID: req.ID}
+		}
+		res.Slots = append(res.Slots, slots)
+
+		// If the slots were truncated, prove them from the origin and stop
+		if truncated {
+			if !proveRange(stTrie, origin, slots[len(slots)-1].Hash, (*proofList)(&res.Proof)) {
+				return &storageRangesData{ID: req.ID}
+			}
+			break
+		}
+	}
+	return res
+}
+
+// serviceByteCodes assembles the response to a byte code query.
+func serviceByteCodes(db state.Database, req *getByteCodesData) *byteCodesData {
+	res := &byteCodesData{ID: req.ID}
+
+	var (
+		limit = responseLimit(req.Bytes)
+		size  uint64
+	)
+	for i, hash := range req.Hashes {
+		if size >= limit || i >= maxCodeLookups {
+			break
+		}
+		if code, err := db.TrieDB().Node(hash); err == nil && len(code) > 0 {
+			res.Codes = append(res.Codes, code)
+			size += uint64(len(code))
+		}
+	}
+	return res
+}
+
+// proveRange collects the trie nodes proving the first and last key of a range,
+// reporting whether they could be resolved.
+func proveRange(tr *trie.Trie, first, last common.Hash, proof *proofList) bool {
+	if err := tr.Prove(first[:], 0, proof); err != nil {
+		return false
+	}
+	if last != first {
+		if err := tr.Prove(last[:], 0, proof); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snap implements the snap protocol, which serves contiguous ranges of
+// the account and storage tries along with boundary Merkle proofs, and a syncer
+// downloading the state of a block from such ranges.
+//
+// Ranges are retrieved in parallel and turned into trie nodes locally. The nodes
+// at the range boundaries don't match the remote trie, so the state is healed
+// afterwards by retrieving the missing trie nodes (eth/63 GetNodeData).
+package snap
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/rlp"
+)
+
+// Constants to match up protocol versions and messages
+const (
+	snap1 = 1
+)
+
+// ProtocolName is the official short name of the protocol used during capability negotiation.
+var ProtocolName = "snap"
+
+// ProtocolVersions are the supported versions of the snap protocol (first is primary).
+var ProtocolVersions = []uint{snap1}
+
+// ProtocolLengths are the number of implemented message corresponding to different protocol versions.
+var ProtocolLengths = []uint64{6}
+
+const (
+	ProtocolMaxMsgSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
+
+	softResponseLimit = 2 * 1024 * 1024 // Target maximum size of returned ranges or byte codes
+	maxCodeLookups    = 1024            // Maximum number of byte codes served in one response
+)
+
+// snap protocol message codes
+const (
+	GetAccountRangeMsg  = 0x00
+	AccountRangeMsg     = 0x01
+	GetStorageRangesMsg = 0x02
+	StorageRangesMsg    = 0x03
+	GetByteCodesMsg     = 0x04
+	ByteCodesMsg        = 0x05
+)
+
+var (
+	errMsgTooLarge    = errors.New("message too long")
+	errDecode         = errors.New("invalid message")
+	errInvalidMsgCode = errors.New("invalid message code")
+	errBadRequest     = errors.New("bad request")
+)
+
+// errResp wraps a protocol error with the message causing it.
+func errResp(err error, format string, v ...interface{}) error {
+	return fmt.Errorf("%v - %v", err, fmt.Sprintf(format, v...))
+}
+
+// getAccountRangeData represents an account range query.
+type getAccountRangeData struct {
+	ID     uint64      // Request ID to match up responses with
+	Root   common.Hash // Root hash of the account trie to serve
+	Origin common.Hash // Hash of the first account to retrieve
+	Limit  common.Hash // Hash of the last account to retrieve
+	Bytes  uint64      // Soft limit at which to stop returning data
+}
+
+// accountRangeData is the response to an account range query. The proof contains
+// the trie nodes proving the first and the last returned account, or the origin
+// and the limit if no account was returned, showing that none exists in between.
+// An empty proof denotes that the state is unknown.
+type accountRangeData struct {
+	ID       uint64         // ID of the request this is a response for
+	Accounts []*accountData // List of consecutive accounts from the trie
+	Proof    [][]byte       // List of trie nodes proving the account range
+}
+
+// accountData represents a single account in a range response.
+type accountData struct {
+	Hash common.Hash  // Hash of the account
+	Body rlp.RawValue // RLP encoded account, as stored in the trie
+}
+
+// getStorageRangesData represents a storage slot query for multiple accounts.
+// The origin applies to the first account only, allowing to continue retrieving
+// a large storage trie.
+type getStorageRangesData struct {
+	ID       uint64        // Request ID to match up responses with
+	Root     common.Hash   // Root hash of the account trie to serve
+	Accounts []common.Hash // Account hashes of the storage tries to serve
+	Origin   common.Hash   // Hash of the first storage slot of the first account
+	Bytes    uint64        // Soft limit at which to stop returning data
+}
+
+// storageRangesData is the response to a storage range query. Only the slots of
+// the last account may be truncated, in which case the proof contains the trie
+// nodes proving its first and last returned slot.
+type storageRangesData struct {
+	ID    uint64           // ID of the request this is a response for
+	Slots [][]*storageData // Lists of consecutive storage slots for the requested accounts
+	Proof [][]byte         // Trie nodes proving the truncated slot range, if any
+}
+
+// storageData represents a single storage slot in a range response.
+type storageData struct {
+	Hash common.Hash // Hash of the storage slot
+	Body []byte      // RLP encoded storage slot, as stored in the trie
+}
+
+// getByteCodesData represents a contract byte code query.
+type getByteCodesData struct {
+	ID     uint64        // Request ID to match up responses with
+	Hashes []common.Hash // Code hashes to retrieve the code for
+	Bytes  uint64        // Soft limit at which to stop returning data
+}
+
+// byteCodesData is the response to a byte code query, in the order of the
+// requested hashes. Unknown codes are omitted.
+type byteCodesData struct {
+	ID    uint64   // ID of the request this is a response for
+	Codes [][]byte // Requested contract byte codes
+}
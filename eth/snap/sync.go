@@ -0,0 +1,997 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/core/state"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/rlp"
+	"github.com/themis-network/go-themis/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCode is the known hash of the empty EVM bytecode.
+	emptyCode = crypto.Keccak256Hash(nil)
+)
+
+const (
+	accountConcurrency = 16               // Number of ranges the account hash space is split into
+	maxStorageAccounts = 128              // Maximum number of small storage tries requested together
+	maxCodeRequest     = 64               // Maximum number of byte codes requested together
+	requestTimeout     = 10 * time.Second // Maximum time to wait for a response
+)
+
+var (
+	requestBytes    = uint64(softResponseLimit) // Soft limit of the response size requested from peers
+	statelessExpiry = 30 * time.Second          // Time after which peers without the state are asked again
+	stallTimeout    = 2 * time.Minute           // Maximum time without any valid response
+)
+
+var (
+	// ErrCancelled is returned from Sync if it was cancelled before completing.
+	ErrCancelled = errors.New("sync cancelled")
+
+	// ErrStalled is returned from Sync if no peer delivered any of the state
+	// for too long, e.g. because no peer serves the requested root.
+	ErrStalled = errors.New("sync stalled")
+
+	errAlreadyRegistered = errors.New("peer is already registered")
+	errSyncRunning       = errors.New("snap sync already running")
+)
+
+// accountTask is a range of the account hash space to retrieve. Its exported
+// fields are persisted, allowing the sync to resume after a restart.
+type accountTask struct {
+	Next common.Hash `json:"next"` // Hash of the next account to retrieve
+	Last common.Hash `json:"last"` // Hash of the last account of the range
+	Root common.Hash `json:"root"` // Root of the partial trie of the retrieved accounts
+
+	req    *accountRequest // Request retrieving the next chunk of the range
+	chunk  *accountChunk   // Chunk of accounts waiting for their storage and code
+	trie   *trie.Trie      // Partial trie the retrieved accounts are inserted into
+	triedb *trie.Database  // Database committing the partial trie to disk
+	done   bool            // Flag whether the whole range was retrieved
+}
+
+// accountChunk is a verified chunk of accounts, inserted into the trie of its
+// range once the storage and code of all its accounts were retrieved.
+type accountChunk struct {
+	hashes   []common.Hash
+	bodies   [][]byte
+	accounts []*state.Account
+
+	storage []bool // Flags whether the storage of an account is still missing
+	code    []bool // Flags whether the code of an account is still missing
+	pending int    // Number of storage tries and codes still missing
+}
+
+// storageTask is the storage trie of an account to retrieve. Small tries are
+// retrieved in a single response, large ones chunk by chunk.
+type storageTask struct {
+	account common.Hash // Hash of the account owning the storage
+	root    common.Hash // Expected root of the storage trie
+
+	origin common.Hash    // Hash of the next slot to retrieve (large tries only)
+	trie   *trie.Trie     // Partial trie of the retrieved slots (large tries only)
+	triedb *trie.Database // Database committing the partial trie to disk
+}
+
+// accountRequest tracks a pending account range request.
+type accountRequest struct {
+	id    uint64
+	peer  string
+	timer *time.Timer
+
+	task *accountTask
+}
+
+// accountResponse is a delivered account range, or a failed request.
+type accountResponse struct {
+	req      *accountRequest
+	accounts []*accountData
+	proof    [][]byte
+	failed   bool // Flag whether the request timed out or the peer dropped
+}
+
+// storageRequest tracks a pending storage ranges request.
+type storageRequest struct {
+	id    uint64
+	peer  string
+	timer *time.Timer
+
+	tasks []*storageTask
+}
+
+// storageResponse is a delivered set of storage ranges, or a failed request.
+type storageResponse struct {
+	req    *storageRequest
+	slots  [][]*storageData
+	proof  [][]byte
+	failed bool // Flag whether the request timed out or the peer dropped
+}
+
+// codeRequest tracks a pending byte code request.
+type codeRequest struct {
+	id    uint64
+	peer  string
+	timer *time.Timer
+
+	hashes []common.Hash
+}
+
+// codeResponse is a delivered set of byte codes, or a failed request.
+type codeResponse struct {
+	req    *codeRequest
+	codes  [][]byte
+	failed bool // Flag whether the request timed out or the peer dropped
+}
+
+// syncStatus is the persisted progress of the sync.
+type syncStatus struct {
+	Tasks []*accountTask `json:"tasks"`
+}
+
+// Syncer retrieves the state of a block from the account and storage ranges
+// served by snap peers. The resulting state has inconsistent trie nodes at the
+// range boundaries and needs to be healed afterwards.
+type Syncer struct {
+	db ethdb.Database // Database to store the retrieved state into
+
+	peers  map[string]*Peer // Currently connected snap peers
+	update chan struct{}    // Notification channel for new peers
+
+	root         common.Hash                // Root of the state being retrieved
+	reqID        uint64                     // Last request ID handed out
+	accountReqs  map[uint64]*accountRequest // Pending account range requests
+	storageReqs  map[uint64]*storageRequest // Pending storage range requests
+	codeReqs     map[uint64]*codeRequest    // Pending byte code requests
+	accountResps chan *accountResponse      // Delivery channel of the running sync
+	storageResps chan *storageResponse      // Delivery channel of the running sync
+	codeResps    chan *codeResponse         // Delivery channel of the running sync
+	done         chan struct{}              // Closed when the running sync terminates
+
+	lock sync.Mutex // Protects the peers and the pending requests
+
+	// State only accessed from within the running sync
+	tasks        []*accountTask           // Account ranges still to retrieve
+	storageTasks []*storageTask           // Storage tries waiting for retrieval
+	codeTasks    map[common.Hash]struct{} // Byte codes waiting for retrieval
+	busy         map[string]struct{}      // Peers with a pending request
+	stateless    map[string]time.Time     // Peers without the state being retrieved, and since when
+	progressed   time.Time                // Time of the last valid response
+}
+
+// NewSyncer creates a syncer storing the retrieved state into the database.
+func NewSyncer(db ethdb.Database) *Syncer {
+	return &Syncer{
+		db:     db,
+		peers:  make(map[string]*Peer),
+		update: make(chan struct{}, 1),
+	}
+}
+
+// Register injects a new snap peer into the set of peers to retrieve from.
+func (s *Syncer) Register(peer *Peer) error {
+	s.lock.Lock()
+	if _, ok := s.peers[peer.id]; ok {
+		s.lock.Unlock()
+		return errAlreadyRegistered
+	}
+	s.peers[peer.id] = peer
+	s.lock.Unlock()
+
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Unregister removes a snap peer, rescheduling its pending requests.
+func (s *Syncer) Unregister(id string) error {
+	s.lock.Lock()
+	delete(s.peers, id)
+
+	var (
+		accountReqs []*accountRequest
+		storageReqs []*storageRequest
+		codeReqs    []*codeRequest
+	)
+	for _, req := range s.accountReqs {
+		if req.peer == id {
+			accountReqs = append(accountReqs, req)
+		}
+	}
+	for _, req := range s.storageReqs {
+		if req.peer == id {
+			storageReqs = append(storageReqs, req)
+		}
+	}
+	for _, req := range s.codeReqs {
+		if req.peer == id {
+			codeReqs = append(codeReqs, req)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, req := range accountReqs {
+		s.revertAccountRequest(req)
+	}
+	for _, req := range storageReqs {
+		s.revertStorageRequest(req)
+	}
+	for _, req := range codeReqs {
+		s.revertCodeRequest(req)
+	}
+	return nil
+}
+
+// Sync retrieves the ranges of the state with the given root which weren't
+// retrieved yet, returning once all of them are done or the sync is cancelled.
+// The progress is persisted, so a later sync, even of another root, continues
+// where this one stopped.
+func (s *Syncer) Sync(root common.Hash, cancel <-chan struct{}) error {
+	s.lock.Lock()
+	if s.done != nil {
+		s.lock.Unlock()
+		return errSyncRunning
+	}
+	s.root = root
+	s.accountReqs = make(map[uint64]*accountRequest)
+	s.storageReqs = make(map[uint64]*storageRequest)
+	s.codeReqs = make(map[uint64]*codeRequest)
+	s.accountResps = make(chan *accountResponse)
+	s.storageResps = make(chan *storageResponse)
+	s.codeResps = make(chan *codeResponse)
+	s.done = make(chan struct{})
+
+	accountResps, storageResps, codeResps := s.accountResps, s.storageResps, s.codeResps
+	s.lock.Unlock()
+
+	s.loadSyncStatus()
+	s.storageTasks = nil
+	s.codeTasks = make(map[common.Hash]struct{})
+	s.busy = make(map[string]struct{})
+	s.stateless = make(map[string]time.Time)
+	s.progressed = time.Now()
+
+	defer func() {
+		s.lock.Lock()
+		for _, req := range s.accountReqs {
+			req.timer.Stop()
+		}
+		for _, req := range s.storageReqs {
+			req.timer.Stop()
+		}
+		for _, req := range s.codeReqs {
+			req.timer.Stop()
+		}
+		s.accountReqs, s.storageReqs, s.codeReqs = nil, nil, nil
+		close(s.done)
+		s.done = nil
+		s.lock.Unlock()
+
+		s.saveSyncStatus()
+	}()
+	log.Debug("Starting snap sync", "root", root, "ranges", s.pendingTasks())
+
+	// Wake up regularly to retry peers whose stateless mark expired
+	retry := time.NewTicker(statelessExpiry / 2)
+	defer retry.Stop()
+
+	for {
+		if s.pendingTasks() == 0 {
+			log.Debug("Snap sync retrieved all ranges", "root", root)
+			return nil
+		}
+		if time.Since(s.progressed) > stallTimeout {
+			log.Debug("Snap sync stalled", "root", root, "ranges", s.pendingTasks())
+			return ErrStalled
+		}
+		// Assign tasks to the idle peers, completing started ranges first
+		s.assignCodeTasks()
+		s.assignStorageTasks()
+		s.assignAccountTasks()
+
+		select {
+		case <-s.update:
+			// New peer arrived, try to assign it tasks
+
+		case <-retry.C:
+			// Stateless marks may have expired, try to assign tasks again
+
+		case <-cancel:
+			return ErrCancelled
+
+		case res := <-accountResps:
+			s.processAccountResponse(res)
+
+		case res := <-storageResps:
+			s.processStorageResponse(res)
+
+		case res := <-codeResps:
+			s.processCodeResponse(res)
+		}
+	}
+}
+
+// loadSyncStatus retrieves the persisted progress, or splits the account hash
+// space into fresh ranges if there is none.
+func (s *Syncer) loadSyncStatus() {
+	var status syncStatus
+	if blob := rawdb.ReadSnapSyncStatus(s.db); blob != nil {
+		if err := json.Unmarshal(blob, &status); err != nil {
+			log.Error("Failed to decode snap sync status", "err", err)
+			status.Tasks = nil
+		} else {
+			log.Debug("Resuming snap sync", "ranges", len(status.Tasks))
+		}
+	} else {
+		var (
+			next = common.Hash{}
+			step = new(big.Int).Sub(new(big.Int).Lsh(common.Big1, 256), common.Big1)
+		)
+		step.Div(step, big.NewInt(accountConcurrency))
+		for i := 0; i < accountConcurrency; i++ {
+			last := common.BigToHash(new(big.Int).Add(next.Big(), step))
+			if i == accountConcurrency-1 {
+				// Make sure we don't overflow if the step is not a proper divisor
+				last = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+			}
+			status.Tasks = append(status.Tasks, &accountTask{Next: next, Last: last})
+			next = incHash(last)
+		}
+	}
+	for _, task := range status.Tasks {
+		task.triedb = trie.NewDatabase(s.db)
+		tr, err := trie.New(task.Root, task.triedb)
+		if err != nil {
+			// The partial trie is gone, the healing will retrieve its accounts
+			log.Warn("Snap sync range trie missing", "next", task.Next, "root", task.Root, "err", err)
+			task.Root = common.Hash{}
+			tr, _ = trie.New(common.Hash{}, task.triedb)
+		}
+		task.trie = tr
+	}
+	s.tasks = status.Tasks
+}
+
+// saveSyncStatus persists the progress of the ranges still to retrieve.
+func (s *Syncer) saveSyncStatus() {
+	status := syncStatus{Tasks: make([]*accountTask, 0, len(s.tasks))}
+	for _, task := range s.tasks {
+		if !task.done {
+			status.Tasks = append(status.Tasks, task)
+		}
+	}
+	blob, err := json.Marshal(&status)
+	if err != nil {
+		log.Crit("Failed to encode snap sync status", "err", err)
+	}
+	rawdb.WriteSnapSyncStatus(s.db, blob)
+}
+
+// pendingTasks returns the number of account ranges still to retrieve.
+func (s *Syncer) pendingTasks() int {
+	var pending int
+	for _, task := range s.tasks {
+		if !task.done {
+			pending++
+		}
+	}
+	return pending
+}
+
+// idlePeer returns a peer without pending request which has the state being
+// retrieved, or nil if there is none.
+func (s *Syncer) idlePeer() *Peer {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ids := make([]string, 0, len(s.peers))
+	for id := range s.peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		if _, ok := s.busy[id]; ok {
+			continue
+		}
+		if since, ok := s.stateless[id]; ok && time.Since(since) < statelessExpiry {
+			continue
+		}
+		return s.peers[id]
+	}
+	return nil
+}
+
+// assignAccountTasks requests the next chunk of the ranges without pending
+// request from the idle peers.
+func (s *Syncer) assignAccountTasks() {
+	for _, task := range s.tasks {
+		if task.done || task.req != nil || task.chunk != nil {
+			continue
+		}
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		req := &accountRequest{peer: peer.id, task: task}
+
+		s.lock.Lock()
+		s.reqID++
+		req.id = s.reqID
+		req.timer = time.AfterFunc(requestTimeout, func() {
+			peer.Log().Debug("Account range request timed out", "reqid", req.id)
+			s.revertAccountRequest(req)
+		})
+		s.accountReqs[req.id] = req
+		s.lock.Unlock()
+
+		s.busy[peer.id] = struct{}{}
+		task.req = req
+
+		if err := peer.RequestAccountRange(req.id, s.root, task.Next, task.Last, requestBytes); err != nil {
+			peer.Log().Debug("Failed to request account range", "err", err)
+			s.lock.Lock()
+			delete(s.accountReqs, req.id)
+			req.timer.Stop()
+			s.lock.Unlock()
+
+			delete(s.busy, peer.id)
+			task.req = nil
+			return
+		}
+	}
+}
+
+// assignStorageTasks requests the queued storage tries from the idle peers. A
+// large trie is requested alone, small ones are batched together.
+func (s *Syncer) assignStorageTasks() {
+	for len(s.storageTasks) > 0 {
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		n := 1
+		if s.storageTasks[0].trie == nil {
+			for n < len(s.storageTasks) && n < maxStorageAccounts && s.storageTasks[n].trie == nil {
+				n++
+			}
+		}
+		tasks := make([]*storageTask, n)
+		copy(tasks, s.storageTasks)
+		s.storageTasks = s.storageTasks[n:]
+
+		accounts := make([]common.Hash, n)
+		for i, task := range tasks {
+			accounts[i] = task.account
+		}
+		req := &storageRequest{peer: peer.id, tasks: tasks}
+
+		s.lock.Lock()
+		s.reqID++
+		req.id = s.reqID
+		req.timer = time.AfterFunc(requestTimeout, func() {
+			peer.Log().Debug("Storage ranges request timed out", "reqid", req.id)
+			s.revertStorageRequest(req)
+		})
+		s.storageReqs[req.id] = req
+		s.lock.Unlock()
+
+		s.busy[peer.id] = struct{}{}
+
+		if err := peer.RequestStorageRanges(req.id, s.root, accounts, tasks[0].origin, requestBytes); err != nil {
+			peer.Log().Debug("Failed to request storage ranges", "err", err)
+			s.lock.Lock()
+			delete(s.storageReqs, req.id)
+			req.timer.Stop()
+			s.lock.Unlock()
+
+			delete(s.busy, peer.id)
+			s.storageTasks = append(tasks, s.storageTasks...)
+			return
+		}
+	}
+}
+
+// assignCodeTasks requests the queued byte codes from the idle peers.
+func (s *Syncer) assignCodeTasks() {
+	for len(s.codeTasks) > 0 {
+		peer := s.idlePeer()
+		if peer == nil {
+			return
+		}
+		hashes := make([]common.Hash, 0, maxCodeRequest)
+		for hash := range s.codeTasks {
+			hashes = append(hashes, hash)
+			delete(s.codeTasks, hash)
+			if len(hashes) == maxCodeRequest {
+				break
+			}
+		}
+		req := &codeRequest{peer: peer.id, hashes: hashes}
+
+		s.lock.Lock()
+		s.reqID++
+		req.id = s.reqID
+		req.timer = time.AfterFunc(requestTimeout, func() {
+			peer.Log().Debug("Byte code request timed out", "reqid", req.id)
+			s.revertCodeRequest(req)
+		})
+		s.codeReqs[req.id] = req
+		s.lock.Unlock()
+
+		s.busy[peer.id] = struct{}{}
+
+		if err := peer.RequestByteCodes(req.id, hashes, requestBytes); err != nil {
+			peer.Log().Debug("Failed to request byte codes", "err", err)
+			s.lock.Lock()
+			delete(s.codeReqs, req.id)
+			req.timer.Stop()
+			s.lock.Unlock()
+
+			delete(s.busy, peer.id)
+			for _, hash := range hashes {
+				s.codeTasks[hash] = struct{}{}
+			}
+			return
+		}
+	}
+}
+
+// revertAccountRequest fails a pending account range request, if it's still
+// pending, so that the running sync reschedules it.
+func (s *Syncer) revertAccountRequest(req *accountRequest) {
+	s.lock.Lock()
+	if s.accountReqs[req.id] != req {
+		s.lock.Unlock()
+		return
+	}
+	delete(s.accountReqs, req.id)
+	req.timer.Stop()
+	resps, done := s.accountResps, s.done
+	s.lock.Unlock()
+
+	select {
+	case resps <- &accountResponse{req: req, failed: true}:
+	case <-done:
+	}
+}
+
+// revertStorageRequest fails a pending storage ranges request, if it's still
+// pending, so that the running sync reschedules it.
+func (s *Syncer) revertStorageRequest(req *storageRequest) {
+	s.lock.Lock()
+	if s.storageReqs[req.id] != req {
+		s.lock.Unlock()
+		return
+	}
+	delete(s.storageReqs, req.id)
+	req.timer.Stop()
+	resps, done := s.storageResps, s.done
+	s.lock.Unlock()
+
+	select {
+	case resps <- &storageResponse{req: req, failed: true}:
+	case <-done:
+	}
+}
+
+// revertCodeRequest fails a pending byte code request, if it's still pending,
+// so that the running sync reschedules it.
+func (s *Syncer) revertCodeRequest(req *codeRequest) {
+	s.lock.Lock()
+	if s.codeReqs[req.id] != req {
+		s.lock.Unlock()
+		return
+	}
+	delete(s.codeReqs, req.id)
+	req.timer.Stop()
+	resps, done := s.codeResps, s.done
+	s.lock.Unlock()
+
+	select {
+	case resps <- &codeResponse{req: req, failed: true}:
+	case <-done:
+	}
+}
+
+// onAccounts is invoked when a peer delivers an account range.
+func (s *Syncer) onAccounts(peer *Peer, packet *accountRangeData) error {
+	s.lock.Lock()
+	req, ok := s.accountReqs[packet.ID]
+	if !ok || req.peer != peer.id {
+		s.lock.Unlock()
+		peer.Log().Debug("Unrequested account range", "reqid", packet.ID)
+		return nil
+	}
+	delete(s.accountReqs, packet.ID)
+	req.timer.Stop()
+	resps, done := s.accountResps, s.done
+	s.lock.Unlock()
+
+	select {
+	case resps <- &accountResponse{req: req, accounts: packet.Accounts, proof: packet.Proof}:
+	case <-done:
+	}
+	return nil
+}
+
+// onStorage is invoked when a peer delivers storage ranges.
+func (s *Syncer) onStorage(peer *Peer, packet *storageRangesData) error {
+	s.lock.Lock()
+	req, ok := s.storageReqs[packet.ID]
+	if !ok || req.peer != peer.id {
+		s.lock.Unlock()
+		peer.Log().Debug("Unrequested storage ranges", "reqid", packet.ID)
+		return nil
+	}
+	delete(s.storageReqs, packet.ID)
+	req.timer.Stop()
+	resps, done := s.storageResps, s.done
+	s.lock.Unlock()
+
+	select {
+	case resps <- &storageResponse{req: req, slots: packet.Slots, proof: packet.Proof}:
+	case <-done:
+	}
+	return nil
+}
+
+// onByteCodes is invoked when a peer delivers byte codes.
+func (s *Syncer) onByteCodes(peer *Peer, packet *byteCodesData) error {
+	s.lock.Lock()
+	req, ok := s.codeReqs[packet.ID]
+	if !ok || req.peer != peer.id {
+		s.lock.Unlock()
+		peer.Log().Debug("Unrequested byte codes", "reqid", packet.ID)
+		return nil
+	}
+	delete(s.codeReqs, packet.ID)
+	req.timer.Stop()
+	resps, done := s.codeResps, s.done
+	s.lock.Unlock()
+
+	select {
+	case resps <- &codeResponse{req: req, codes: packet.Codes}:
+	case <-done:
+	}
+	return nil
+}
+
+// processAccountResponse verifies a delivered account range and schedules the
+// retrieval of the storage and code of its accounts.
+func (s *Syncer) processAccountResponse(res *accountResponse) {
+	task := res.req.task
+	task.req = nil
+	delete(s.busy, res.req.peer)
+
+	if res.failed {
+		return
+	}
+	if len(res.accounts) == 0 && len(res.proof) == 0 {
+		log.Debug("Peer doesn't have the state", "peer", res.req.peer, "root", s.root)
+		s.stateless[res.req.peer] = time.Now()
+		return
+	}
+	chunk, err := verifyAccountRange(s.root, task.Next, task.Last, res.accounts, res.proof)
+	if err != nil {
+		log.Debug("Invalid account range", "peer", res.req.peer, "err", err)
+		s.stateless[res.req.peer] = time.Now()
+		return
+	}
+	s.progressed = time.Now()
+	for i, account := range chunk.accounts {
+		if account.Root != emptyRoot {
+			if ok, _ := s.db.Has(account.Root[:]); !ok {
+				chunk.storage[i] = true
+				chunk.pending++
+				s.storageTasks = append(s.storageTasks, &storageTask{account: chunk.hashes[i], root: account.Root})
+			}
+		}
+		if code := common.BytesToHash(account.CodeHash); code != emptyCode {
+			if ok, _ := s.db.Has(code[:]); !ok {
+				chunk.code[i] = true
+				chunk.pending++
+				s.codeTasks[code] = struct{}{}
+			}
+		}
+	}
+	task.chunk = chunk
+	s.forwardAccountTask(task)
+}
+
+// forwardAccountTask inserts the chunk of a range into its trie once the storage
+// and code of all its accounts were retrieved, and persists the progress.
+func (s *Syncer) forwardAccountTask(task *accountTask) {
+	chunk := task.chunk
+	if chunk == nil || chunk.pending > 0 {
+		return
+	}
+	task.chunk = nil
+
+	for i, hash := range chunk.hashes {
+		task.trie.Update(hash[:], chunk.bodies[i])
+	}
+	root, err := task.trie.Commit(nil)
+	if err == nil {
+		err = task.triedb.Commit(root, false)
+	}
+	if err != nil {
+		// Retrieve the chunk again from the last persisted trie
+		log.Error("Failed to commit account range", "next", task.Next, "err", err)
+		task.trie, _ = trie.New(task.Root, task.triedb)
+		return
+	}
+	task.Root = root
+
+	if n := len(chunk.hashes); n == 0 || bytes.Compare(chunk.hashes[n-1][:], task.Last[:]) >= 0 {
+		task.done = true
+	} else {
+		task.Next = incHash(chunk.hashes[n-1])
+	}
+	log.Trace("Committed account range", "accounts", len(chunk.hashes), "next", task.Next, "done", task.done)
+	s.saveSyncStatus()
+}
+
+// processStorageResponse verifies the delivered storage ranges and stores the
+// completed storage tries.
+func (s *Syncer) processStorageResponse(res *storageResponse) {
+	tasks := res.req.tasks
+	delete(s.busy, res.req.peer)
+
+	if res.failed {
+		s.storageTasks = append(s.storageTasks, tasks...)
+		return
+	}
+	if len(res.slots) == 0 || len(res.slots) > len(tasks) {
+		log.Debug("Peer doesn't have the storage", "peer", res.req.peer, "root", s.root, "accounts", len(tasks), "ranges", len(res.slots))
+		s.stateless[res.req.peer] = time.Now()
+		s.storageTasks = append(s.storageTasks, tasks...)
+		return
+	}
+	for i, slots := range res.slots {
+		task := tasks[i]
+
+		// Only the last range may be truncated, signalled by the proof
+		var proof [][]byte
+		if i == len(res.slots)-1 {
+			proof = res.proof
+		}
+		if err := s.processStorageRange(task, slots, proof); err != nil {
+			log.Debug("Invalid storage range", "peer", res.req.peer, "account", task.account, "err", err)
+			s.stateless[res.req.peer] = time.Now()
+			s.storageTasks = append(s.storageTasks, tasks[i:]...)
+			return
+		}
+		s.progressed = time.Now()
+	}
+	s.storageTasks = append(s.storageTasks, tasks[len(res.slots):]...)
+}
+
+// processStorageRange stores a range of storage slots. A complete range yields a
+// storage trie which is checked against the account's storage root, whereas a
+// truncated one is proven complete up to its last slot and continued later.
+func (s *Syncer) processStorageRange(task *storageTask, slots []*storageData, proof [][]byte) error {
+	for i, slot := range slots {
+		if bytes.Compare(slot.Hash[:], task.origin[:]) < 0 {
+			return fmt.Errorf("slot %x before origin %x", slot.Hash, task.origin)
+		}
+		if i > 0 && bytes.Compare(slot.Hash[:], slots[i-1].Hash[:]) <= 0 {
+			return fmt.Errorf("slot %x out of order", slot.Hash)
+		}
+	}
+	truncated := len(proof) > 0
+	if truncated {
+		if len(slots) == 0 {
+			return errors.New("truncated range without slots")
+		}
+		keys, values := make([][]byte, len(slots)), make([][]byte, len(slots))
+		for i, slot := range slots {
+			keys[i], values[i] = slot.Hash[:], slot.Body
+		}
+		if err := trie.VerifyRangeProof(task.root, task.origin[:], keys, values, newProofDatabase(proof)); err != nil {
+			return err
+		}
+	}
+	// Large tries are committed chunk by chunk, small ones only if complete
+	triedb, tr := task.triedb, task.trie
+	if tr == nil {
+		triedb = trie.NewDatabase(s.db)
+		tr, _ = trie.New(common.Hash{}, triedb)
+	}
+	for _, slot := range slots {
+		tr.Update(slot.Hash[:], slot.Body)
+	}
+	if truncated {
+		root, err := tr.Commit(nil)
+		if err == nil {
+			err = triedb.Commit(root, false)
+		}
+		if err != nil {
+			return err
+		}
+		task.trie, task.triedb = tr, triedb
+		task.origin = incHash(slots[len(slots)-1].Hash)
+
+		// Continue the large trie before any other storage
+		s.storageTasks = append([]*storageTask{task}, s.storageTasks...)
+		return nil
+	}
+	if root := tr.Hash(); root != task.root {
+		// The range was incomplete, the healing will retrieve the trie instead
+		log.Debug("Storage trie mismatch", "account", task.account, "have", root, "want", task.root)
+	} else {
+		if _, err := tr.Commit(nil); err != nil {
+			return err
+		}
+		if err := triedb.Commit(root, false); err != nil {
+			return err
+		}
+	}
+	s.completeStorage(task.account)
+	return nil
+}
+
+// completeStorage marks the storage of an account as retrieved.
+func (s *Syncer) completeStorage(account common.Hash) {
+	for _, task := range s.tasks {
+		chunk := task.chunk
+		if chunk == nil {
+			continue
+		}
+		for i, hash := range chunk.hashes {
+			if hash == account && chunk.storage[i] {
+				chunk.storage[i] = false
+				chunk.pending--
+			}
+		}
+		s.forwardAccountTask(task)
+	}
+}
+
+// processCodeResponse stores the delivered byte codes, rescheduling the ones
+// which were not delivered.
+func (s *Syncer) processCodeResponse(res *codeResponse) {
+	delete(s.busy, res.req.peer)
+
+	if res.failed || len(res.codes) == 0 {
+		if !res.failed {
+			log.Debug("Peer doesn't have the byte codes", "peer", res.req.peer, "hashes", len(res.req.hashes))
+			s.stateless[res.req.peer] = time.Now()
+		}
+		for _, hash := range res.req.hashes {
+			s.codeTasks[hash] = struct{}{}
+		}
+		return
+	}
+	codes := make(map[common.Hash][]byte, len(res.codes))
+	for _, code := range res.codes {
+		codes[crypto.Keccak256Hash(code)] = code
+	}
+	for _, hash := range res.req.hashes {
+		code, ok := codes[hash]
+		if !ok {
+			s.codeTasks[hash] = struct{}{}
+			continue
+		}
+		if err := s.db.Put(hash[:], code); err != nil {
+			log.Error("Failed to store byte code", "hash", hash, "err", err)
+			s.codeTasks[hash] = struct{}{}
+			continue
+		}
+		s.progressed = time.Now()
+		s.completeCode(hash)
+	}
+}
+
+// completeCode marks the byte code with the given hash as retrieved.
+func (s *Syncer) completeCode(hash common.Hash) {
+	for _, task := range s.tasks {
+		chunk := task.chunk
+		if chunk == nil {
+			continue
+		}
+		for i, account := range chunk.accounts {
+			if chunk.code[i] && common.BytesToHash(account.CodeHash) == hash {
+				chunk.code[i] = false
+				chunk.pending--
+			}
+		}
+		s.forwardAccountTask(task)
+	}
+}
+
+// verifyAccountRange checks that the accounts are ordered within the requested
+// range and that the proofs of its boundaries show them to be all accounts from
+// the origin up to the last one, and decodes them.
+func verifyAccountRange(root common.Hash, origin, limit common.Hash, accounts []*accountData, proof [][]byte) (*accountChunk, error) {
+	chunk := &accountChunk{
+		hashes:   make([]common.Hash, len(accounts)),
+		bodies:   make([][]byte, len(accounts)),
+		accounts: make([]*state.Account, len(accounts)),
+		storage:  make([]bool, len(accounts)),
+		code:     make([]bool, len(accounts)),
+	}
+	for i, account := range accounts {
+		if bytes.Compare(account.Hash[:], origin[:]) < 0 || bytes.Compare(account.Hash[:], limit[:]) > 0 {
+			return nil, fmt.Errorf("account %x out of range", account.Hash)
+		}
+		if i > 0 && bytes.Compare(account.Hash[:], accounts[i-1].Hash[:]) <= 0 {
+			return nil, fmt.Errorf("account %x out of order", account.Hash)
+		}
+		chunk.accounts[i] = new(state.Account)
+		if err := rlp.DecodeBytes(account.Body, chunk.accounts[i]); err != nil {
+			return nil, fmt.Errorf("invalid account %x: %v", account.Hash, err)
+		}
+		chunk.hashes[i], chunk.bodies[i] = account.Hash, account.Body
+	}
+	// Verify the boundaries of the range, or the absence of any account if empty
+	proofDb := newProofDatabase(proof)
+	if len(accounts) == 0 {
+		if err := trie.VerifyEmptyRange(root, origin[:], limit[:], proofDb); err != nil {
+			return nil, err
+		}
+		return chunk, nil
+	}
+	keys := make([][]byte, len(accounts))
+	for i := range chunk.hashes {
+		keys[i] = chunk.hashes[i][:]
+	}
+	if err := trie.VerifyRangeProof(root, origin[:], keys, chunk.bodies, proofDb); err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// newProofDatabase indexes the trie nodes of a proof by their hashes.
+func newProofDatabase(proof [][]byte) *ethdb.MemDatabase {
+	db := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
+
+// incHash returns the hash following the given one, wrapping around on overflow.
+func incHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
@@ -0,0 +1,333 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/core/state"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/p2p"
+	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/trie"
+)
+
+// testAccount returns the address of the i-th account of the test state.
+func testAccount(i int) common.Address {
+	return common.BytesToAddress([]byte{0x01, byte(i >> 8), byte(i)})
+}
+
+// makeTestState creates a state with plain accounts, contracts, accounts with
+// small storage tries and an account with a large one.
+func makeTestState(t *testing.T, accounts int) (*ethdb.MemDatabase, common.Hash) {
+	db := ethdb.NewMemDatabase()
+	sdb := state.NewDatabase(db)
+	statedb, _ := state.New(common.Hash{}, sdb)
+
+	for i := 0; i < accounts; i++ {
+		addr := testAccount(i)
+		statedb.SetBalance(addr, big.NewInt(int64(i+1)))
+		statedb.SetNonce(addr, uint64(i))
+		if i%5 == 0 {
+			statedb.SetCode(addr, []byte{byte(i), byte(i >> 8), 0x60, 0x00})
+		}
+		if i%7 == 0 {
+			for j := 0; j < i%13+1; j++ {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(i+j+1))))
+			}
+		}
+	}
+	for j := 0; j < 1000; j++ {
+		statedb.SetState(testAccount(1), common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(j+1))))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := sdb.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	return db, root
+}
+
+// connectTestPeer connects a syncer to a peer serving the state of the source
+// database, returning a function tearing the connection down.
+func connectTestPeer(source ethdb.Database, syncer *Syncer, id byte) func() {
+	var (
+		app, net = p2p.MsgPipe()
+		server   discover.NodeID
+		client   discover.NodeID
+	)
+	server[0], client[0] = id, id+1
+
+	go Handle(state.NewDatabase(source), NewSyncer(ethdb.NewMemDatabase()), NewPeer(snap1, p2p.NewPeer(client, "client", nil), app))
+	go Handle(state.NewDatabase(syncer.db), syncer, NewPeer(snap1, p2p.NewPeer(server, "server", nil), net))
+
+	return func() {
+		app.Close()
+		net.Close()
+	}
+}
+
+// healState retrieves the trie nodes missing from the synced state from the
+// source database, returning the number of nodes retrieved.
+func healState(t *testing.T, source, db ethdb.Database, root common.Hash) int {
+	var (
+		sched  = state.NewStateSync(root, db)
+		healed int
+	)
+	for missing := sched.Missing(1024); len(missing) > 0; missing = sched.Missing(1024) {
+		results := make([]trie.SyncResult, len(missing))
+		for i, hash := range missing {
+			blob, err := source.Get(hash[:])
+			if err != nil {
+				t.Fatalf("failed to retrieve node %x: %v", hash, err)
+			}
+			results[i] = trie.SyncResult{Hash: hash, Data: blob}
+		}
+		if _, index, err := sched.Process(results); err != nil {
+			t.Fatalf("failed to process result #%d: %v", index, err)
+		}
+		if _, err := sched.Commit(db); err != nil {
+			t.Fatalf("failed to commit healed nodes: %v", err)
+		}
+		healed += len(missing)
+	}
+	return healed
+}
+
+// checkState verifies that the synced state contains all accounts, codes and
+// storage slots of the source state.
+func checkState(t *testing.T, source, db ethdb.Database, root common.Hash, accounts int) {
+	want, _ := state.New(root, state.NewDatabase(source))
+	have, err := state.New(root, state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open synced state: %v", err)
+	}
+	for i := 0; i < accounts; i++ {
+		addr := testAccount(i)
+		if have.GetBalance(addr).Cmp(want.GetBalance(addr)) != 0 || have.GetNonce(addr) != want.GetNonce(addr) {
+			t.Fatalf("account %d mismatch", i)
+		}
+		if !bytes.Equal(have.GetCode(addr), want.GetCode(addr)) {
+			t.Fatalf("account %d code mismatch", i)
+		}
+		slots := 13
+		if i == 1 {
+			slots = 1000
+		}
+		for j := 0; j < slots; j++ {
+			slot := common.BigToHash(big.NewInt(int64(j)))
+			if have.GetState(addr, slot) != want.GetState(addr, slot) {
+				t.Fatalf("account %d slot %d mismatch", i, j)
+			}
+		}
+	}
+}
+
+// Tests that the state is retrieved in ranges, only leaving the boundaries of
+// the ranges to be healed.
+func TestSync(t *testing.T) {
+	defer func(bytes uint64) { requestBytes = bytes }(requestBytes)
+	requestBytes = 4096
+
+	source, root := makeTestState(t, 1000)
+
+	db := ethdb.NewMemDatabase()
+	syncer := NewSyncer(db)
+	defer connectTestPeer(source, syncer, 0x10)()
+
+	if err := syncer.Sync(root, nil); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	healed := healState(t, source, db, root)
+	if nodes := source.Len(); healed*2 > nodes {
+		t.Errorf("too many nodes healed: %d of %d", healed, nodes)
+	}
+	checkState(t, source, db, root, 1000)
+}
+
+// Tests that a cancelled sync persists its progress and is resumed by a new
+// syncer.
+func TestSyncResume(t *testing.T) {
+	defer func(bytes uint64) { requestBytes = bytes }(requestBytes)
+	requestBytes = 1024
+
+	source, root := makeTestState(t, 2000)
+	db := ethdb.NewMemDatabase()
+
+	// Start syncing, and cancel it as soon as some progress was persisted
+	syncer := NewSyncer(db)
+	disconnect := connectTestPeer(source, syncer, 0x10)
+
+	var (
+		cancel = make(chan struct{})
+		errc   = make(chan error)
+	)
+	go func() { errc <- syncer.Sync(root, cancel) }()
+	for rawdb.ReadSnapSyncStatus(db) == nil {
+		time.Sleep(time.Millisecond)
+	}
+	close(cancel)
+	if err := <-errc; err != ErrCancelled {
+		t.Fatalf("sync error mismatch: have %v, want %v", err, ErrCancelled)
+	}
+	disconnect()
+
+	var status syncStatus
+	if err := json.Unmarshal(rawdb.ReadSnapSyncStatus(db), &status); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if len(status.Tasks) == 0 || len(status.Tasks) > accountConcurrency {
+		t.Fatalf("persisted range count mismatch: have %d", len(status.Tasks))
+	}
+	// Resume with a new syncer, which must complete the remaining ranges
+	syncer = NewSyncer(db)
+	defer connectTestPeer(source, syncer, 0x20)()
+
+	if err := syncer.Sync(root, nil); err != nil {
+		t.Fatalf("failed to resume sync: %v", err)
+	}
+	if err := json.Unmarshal(rawdb.ReadSnapSyncStatus(db), &status); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if len(status.Tasks) != 0 {
+		t.Fatalf("ranges left after sync: %d", len(status.Tasks))
+	}
+	healState(t, source, db, root)
+	checkState(t, source, db, root, 2000)
+}
+
+// Tests that a sync without any peer serving the state gives up, whereas peers
+// without the state are asked again once they may have retrieved it.
+func TestSyncStalled(t *testing.T) {
+	defer func(expiry, timeout time.Duration) { statelessExpiry, stallTimeout = expiry, timeout }(statelessExpiry, stallTimeout)
+	statelessExpiry, stallTimeout = 50*time.Millisecond, 500*time.Millisecond
+
+	source, root := makeTestState(t, 100)
+
+	// A peer without the state never delivers it
+	syncer := NewSyncer(ethdb.NewMemDatabase())
+	disconnect := connectTestPeer(ethdb.NewMemDatabase(), syncer, 0x10)
+	if err := syncer.Sync(root, nil); err != ErrStalled {
+		t.Fatalf("sync error mismatch: have %v, want %v", err, ErrStalled)
+	}
+	disconnect()
+
+	// A peer retrieving the state later on is asked again
+	var (
+		db    = ethdb.NewMemDatabase()
+		later = ethdb.NewMemDatabase()
+		errc  = make(chan error)
+	)
+	syncer = NewSyncer(db)
+	defer connectTestPeer(later, syncer, 0x20)()
+
+	go func() { errc <- syncer.Sync(root, nil) }()
+	time.Sleep(100 * time.Millisecond)
+	for _, key := range source.Keys() {
+		blob, _ := source.Get(key)
+		later.Put(key, blob)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	healState(t, source, db, root)
+	checkState(t, source, db, root, 100)
+}
+
+// Tests that peers without the requested state respond with empty ranges.
+func TestServeUnknownState(t *testing.T) {
+	source, _ := makeTestState(t, 10)
+	db := state.NewDatabase(source)
+
+	root := common.HexToHash("0xdeadbeef")
+	if res := serviceAccountRange(db, &getAccountRangeData{Root: root, Limit: common.HexToHash("0xff"), Bytes: 4096}); len(res.Accounts) != 0 || len(res.Proof) != 0 {
+		t.Errorf("accounts served for unknown root: %d accounts, %d proof nodes", len(res.Accounts), len(res.Proof))
+	}
+	if res := serviceStorageRanges(db, &getStorageRangesData{Root: root, Accounts: []common.Hash{{}}, Bytes: 4096}); len(res.Slots) != 0 {
+		t.Errorf("storage served for unknown root: %d ranges", len(res.Slots))
+	}
+}
+
+// Tests that empty account ranges are only accepted if proven to hold no account
+// up to the end of the requested range.
+func TestVerifyEmptyAccountRange(t *testing.T) {
+	source, root := makeTestState(t, 100)
+	db := state.NewDatabase(source)
+
+	tr, _ := trie.New(root, db.TrieDB())
+	var hashes []common.Hash
+	for it := trie.NewIterator(tr.NodeIterator(nil)); it.Next(); {
+		hashes = append(hashes, common.BytesToHash(it.Key))
+	}
+	for i := 0; i+2 < len(hashes); i++ {
+		origin := incHash(hashes[i])
+		if origin == hashes[i+1] {
+			continue
+		}
+		// The empty gap between two accounts must be served and accepted
+		res := serviceAccountRange(db, &getAccountRangeData{Root: root, Origin: origin, Limit: origin, Bytes: 4096})
+		if len(res.Accounts) != 0 {
+			t.Fatalf("gap %x: %d accounts served", origin, len(res.Accounts))
+		}
+		if _, err := verifyAccountRange(root, origin, origin, nil, res.Proof); err != nil {
+			t.Fatalf("gap %x: failed to verify empty range: %v", origin, err)
+		}
+		// An empty response to a range holding accounts must be rejected
+		if _, err := verifyAccountRange(root, origin, hashes[i+2], nil, res.Proof); err == nil {
+			t.Fatalf("range %x-%x: empty response accepted", origin, hashes[i+2])
+		}
+	}
+}
+
+// Tests that account ranges are only accepted if they contain all accounts from
+// the origin up to the last one.
+func TestVerifyAccountRange(t *testing.T) {
+	source, root := makeTestState(t, 100)
+	db := state.NewDatabase(source)
+
+	tr, _ := trie.New(root, db.TrieDB())
+	var hashes []common.Hash
+	for it := trie.NewIterator(tr.NodeIterator(nil)); it.Next(); {
+		hashes = append(hashes, common.BytesToHash(it.Key))
+	}
+	limit := common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	for i := 1; i+10 < len(hashes); i += 10 {
+		origin := incHash(hashes[i-1])
+		res := serviceAccountRange(db, &getAccountRangeData{Root: root, Origin: origin, Limit: limit, Bytes: 10 * 120})
+		if len(res.Accounts) < 3 {
+			t.Fatalf("range %x: %d accounts served", origin, len(res.Accounts))
+		}
+		if _, err := verifyAccountRange(root, origin, limit, res.Accounts, res.Proof); err != nil {
+			t.Fatalf("range %x: failed to verify: %v", origin, err)
+		}
+		// Responses omitting any account must be rejected
+		for _, omit := range []int{0, 1} {
+			accounts := append(append([]*accountData{}, res.Accounts[:omit]...), res.Accounts[omit+1:]...)
+			if _, err := verifyAccountRange(root, origin, limit, accounts, res.Proof); err == nil {
+				t.Fatalf("range %x: response without account %d accepted", origin, omit)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/vm"
+)
+
+// ResultTracer is a vm.Tracer that assembles a JSON result out of the traced
+// execution and which can be aborted midway.
+type ResultTracer interface {
+	vm.Tracer
+
+	// GetResult returns the JSON result of the trace, or any error that occurred
+	// during tracing.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates execution of the tracer at the first opportune moment.
+	Stop(err error)
+}
+
+// natives contains the Go implementations of some of the built in JavaScript
+// tracers, keyed by the same names. They produce the same output, but without
+// the cost of calling into the JavaScript VM on every opcode.
+var natives = map[string]func() ResultTracer{
+	"callTracer":     newCallTracer,
+	"prestateTracer": newPrestateTracer,
+	"4byteTracer":    newFourByteTracer,
+}
+
+// NewTracer creates a tracer from the name of a built in tracer or from custom
+// JavaScript code. Built in tracers with a native implementation are created
+// natively, everything else runs in the JavaScript VM.
+func NewTracer(code string) (ResultTracer, error) {
+	if constructor, ok := natives[code]; ok {
+		return constructor(), nil
+	}
+	return New(code)
+}
+
+// stopper implements the interruption of the native tracers.
+type stopper struct {
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (s *stopper) Stop(err error) {
+	s.reason = err
+	atomic.StoreUint32(&s.interrupt, 1)
+}
+
+// stopped returns the reason of the interruption if the tracer was stopped, or
+// nil otherwise.
+func (s *stopper) stopped() error {
+	if atomic.LoadUint32(&s.interrupt) > 0 {
+		return s.reason
+	}
+	return nil
+}
+
+// peekStack returns the nth-from-the-top element of the stack, or zero if the
+// stack is not deep enough.
+func peekStack(stack *vm.Stack, n int) *big.Int {
+	data := stack.Data()
+	if len(data) <= n {
+		return new(big.Int)
+	}
+	return data[len(data)-n-1]
+}
+
+// sliceMemory returns a copy of the requested range of memory, or nil if it is
+// out of bounds, the same way the JavaScript memory wrapper does.
+func sliceMemory(memory *vm.Memory, offset, size *big.Int) []byte {
+	end := new(big.Int).Add(offset, size)
+	if !end.IsUint64() || uint64(memory.Len()) < end.Uint64() {
+		return nil
+	}
+	return memory.Get(offset.Int64(), size.Int64())
+}
+
+// isPrecompiled reports whether the address is that of a precompiled contract.
+func isPrecompiled(addr common.Address) bool {
+	_, ok := vm.PrecompiledContractsByzantium[addr]
+	return ok
+}
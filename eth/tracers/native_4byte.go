@@ -0,0 +1,111 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/core/vm"
+)
+
+// fourByteTracer is the native implementation of the 4byteTracer, which counts
+// the 4byte method identifiers called by a transaction, along with the size of
+// the data supplied after them.
+type fourByteTracer struct {
+	stopper
+
+	ids   map[string]int // Call counts keyed by "<identifier>-<data size>"
+	input []byte         // Input of the outermost call
+
+	err error // Error interrupting the tracing
+}
+
+// newFourByteTracer creates a native 4byte tracer.
+func newFourByteTracer() ResultTracer {
+	return &fourByteTracer{ids: make(map[string]int)}
+}
+
+// store saves the given identifier and data size.
+func (t *fourByteTracer) store(id []byte, size string) {
+	t.ids[hexutil.Encode(id)+"-"+size]++
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *fourByteTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.input = input
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *fourByteTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.err != nil {
+		return nil
+	}
+	if t.err = t.stopped(); t.err != nil {
+		return nil
+	}
+	// Find the stack position of the input data, after the call value if any
+	var in int
+	switch op {
+	case vm.CALL, vm.CALLCODE:
+		in = 3
+	case vm.DELEGATECALL, vm.STATICCALL:
+		in = 2
+	default:
+		return nil
+	}
+	if isPrecompiled(common.BigToAddress(peekStack(stack, 1))) {
+		return nil
+	}
+	if size := peekStack(stack, in+1); size.Cmp(big.NewInt(4)) >= 0 {
+		id := sliceMemory(memory, peekStack(stack, in), big.NewInt(4))
+		t.store(id, new(big.Int).Sub(size, big.NewInt(4)).String())
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *fourByteTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *fourByteTracer) CaptureEnd(output []byte, gasUsed uint64, duration time.Duration, err error) error {
+	return nil
+}
+
+// GetResult returns the collected identifier counts, including the one of the
+// outermost call.
+func (t *fourByteTracer) GetResult() (json.RawMessage, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	ids := make(map[string]int, len(t.ids)+1)
+	for id, count := range t.ids {
+		ids[id] = count
+	}
+	if len(t.input) >= 4 {
+		ids[hexutil.Encode(t.input[:4])+"-"+strconv.Itoa(len(t.input)-4)]++
+	}
+	return json.Marshal(ids)
+}
@@ -0,0 +1,273 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/core/vm"
+)
+
+// callFrame is a single call of the call tracer's output. The fields are in the
+// same order and are omitted in the same cases as in the JavaScript tracer.
+type callFrame struct {
+	Type    string          `json:"type"`
+	From    *common.Address `json:"from,omitempty"`
+	To      *common.Address `json:"to,omitempty"`
+	Value   *hexutil.Big    `json:"value,omitempty"`
+	Gas     *hexutil.Uint64 `json:"gas,omitempty"`
+	GasUsed *hexutil.Uint64 `json:"gasUsed,omitempty"`
+	Input   *hexutil.Bytes  `json:"input,omitempty"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Time    string          `json:"time,omitempty"`
+	Calls   []*callFrame    `json:"calls,omitempty"`
+
+	gasIn   uint64   // Gas available before the call opcode
+	gasCost uint64   // Cost of the call opcode, including the forwarded gas
+	outOff  *big.Int // Memory offset of the call's return data
+	outLen  *big.Int // Memory size of the call's return data
+}
+
+// callTracer is the native implementation of the callTracer, which extracts the
+// nested calls made by a transaction along with their gas, input, output and
+// error.
+type callTracer struct {
+	stopper
+
+	callstack []*callFrame // Calls being executed, with a sentinel for the outermost one
+	descended bool         // Whether the last step entered a new call
+
+	// Context fields of the outermost call
+	create  bool
+	from    common.Address
+	to      common.Address
+	input   []byte
+	gas     uint64
+	value   *big.Int
+	output  []byte
+	gasUsed uint64
+	time    time.Duration
+	failure error
+
+	err error // Error interrupting the tracing
+}
+
+// newCallTracer creates a native call tracer.
+func newCallTracer() ResultTracer {
+	return &callTracer{callstack: []*callFrame{{}}}
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (t *callTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.create, t.from, t.to, t.input, t.gas, t.value = create, from, to, input, gas, value
+	return nil
+}
+
+// CaptureState implements the Tracer interface to trace a single step of VM execution.
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.err != nil {
+		return nil
+	}
+	if t.err = t.stopped(); t.err != nil {
+		return nil
+	}
+	if err != nil {
+		t.fault(err)
+		return nil
+	}
+	// Enter a new call frame on contract creations and calls
+	switch op {
+	case vm.CREATE:
+		from := contract.Address()
+		input := hexutil.Bytes(sliceMemory(memory, peekStack(stack, 1), peekStack(stack, 2)))
+
+		t.callstack = append(t.callstack, &callFrame{
+			Type:    op.String(),
+			From:    &from,
+			Input:   &input,
+			Value:   (*hexutil.Big)(new(big.Int).Set(peekStack(stack, 0))),
+			gasIn:   gas,
+			gasCost: cost,
+		})
+		t.descended = true
+		return nil
+
+	case vm.SELFDESTRUCT:
+		top := t.callstack[len(t.callstack)-1]
+		top.Calls = append(top.Calls, &callFrame{Type: op.String()})
+		return nil
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		to := common.BigToAddress(peekStack(stack, 1))
+		if isPrecompiled(to) {
+			return nil
+		}
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		from := contract.Address()
+		input := hexutil.Bytes(sliceMemory(memory, peekStack(stack, 2+off), peekStack(stack, 3+off)))
+
+		call := &callFrame{
+			Type:    op.String(),
+			From:    &from,
+			To:      &to,
+			Input:   &input,
+			gasIn:   gas,
+			gasCost: cost,
+			outOff:  new(big.Int).Set(peekStack(stack, 4+off)),
+			outLen:  new(big.Int).Set(peekStack(stack, 5+off)),
+		}
+		if off == 1 {
+			call.Value = (*hexutil.Big)(new(big.Int).Set(peekStack(stack, 2)))
+		}
+		t.callstack = append(t.callstack, call)
+		t.descended = true
+		return nil
+	}
+	// If we've just descended into an inner call, retrieve its true allowance
+	if t.descended {
+		if depth >= len(t.callstack) {
+			available := hexutil.Uint64(gas)
+			t.callstack[len(t.callstack)-1].Gas = &available
+		}
+		t.descended = false
+	}
+	// Reverting calls are marked failed, but are popped on the next step
+	if op == vm.REVERT {
+		t.callstack[len(t.callstack)-1].Error = "execution reverted"
+		return nil
+	}
+	// If an existing call is returning, pop it off the callstack
+	if depth != len(t.callstack)-1 {
+		return nil
+	}
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+
+	if call.Type == vm.CREATE.String() {
+		used := hexutil.Uint64(call.gasIn - call.gasCost - gas)
+		call.GasUsed = &used
+
+		if ret := peekStack(stack, 0); ret.Sign() != 0 {
+			to := common.BigToAddress(ret)
+			code := hexutil.Bytes(env.StateDB.GetCode(to))
+			call.To, call.Output = &to, &code
+		} else if call.Error == "" {
+			call.Error = "internal failure"
+		}
+	} else if call.Gas != nil {
+		used := hexutil.Uint64(call.gasIn - call.gasCost + uint64(*call.Gas) - gas)
+		call.GasUsed = &used
+
+		if ret := peekStack(stack, 0); ret.Sign() != 0 {
+			output := hexutil.Bytes(sliceMemory(memory, call.outOff, call.outLen))
+			call.Output = &output
+		} else if call.Error == "" {
+			call.Error = "internal failure"
+		}
+	}
+	parent := t.callstack[len(t.callstack)-1]
+	parent.Calls = append(parent.Calls, call)
+	return nil
+}
+
+// CaptureFault implements the Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract, depth int, err error) error {
+	if t.err == nil {
+		t.fault(err)
+	}
+	return nil
+}
+
+// fault pops the failed call off the callstack, unless it was already marked
+// as failed (i.e. reverted).
+func (t *callTracer) fault(err error) {
+	if t.callstack[len(t.callstack)-1].Error != "" {
+		return
+	}
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+
+	call.Error = err.Error()
+	if call.Gas != nil {
+		used := *call.Gas
+		call.GasUsed = &used
+	}
+	if len(t.callstack) > 0 {
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+		return
+	}
+	t.callstack = append(t.callstack, call)
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, duration time.Duration, err error) error {
+	t.output, t.gasUsed, t.time, t.failure = output, gasUsed, duration, err
+	return nil
+}
+
+// GetResult returns the outermost call along with all its nested calls.
+func (t *callTracer) GetResult() (json.RawMessage, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	var (
+		from    = t.from
+		to      = t.to
+		value   = new(big.Int)
+		gas     = hexutil.Uint64(t.gas)
+		gasUsed = hexutil.Uint64(t.gasUsed)
+		input   = hexutil.Bytes(t.input)
+		output  = hexutil.Bytes(t.output)
+	)
+	if t.value != nil {
+		value.Set(t.value)
+	}
+	result := &callFrame{
+		Type:    vm.CALL.String(),
+		From:    &from,
+		To:      &to,
+		Value:   (*hexutil.Big)(value),
+		Gas:     &gas,
+		GasUsed: &gasUsed,
+		Input:   &input,
+		Output:  &output,
+		Time:    t.time.String(),
+		Calls:   t.callstack[0].Calls,
+	}
+	if t.create {
+		result.Type = vm.CREATE.String()
+	}
+	if t.callstack[0].Error != "" {
+		result.Error = t.callstack[0].Error
+	} else if t.failure != nil {
+		result.Error = t.failure.Error()
+	}
+	if result.Error != "" {
+		result.Output = nil
+	}
+	return json.Marshal(result)
+}
@@ -18,6 +18,8 @@ package tracers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"path/filepath"
@@ -116,77 +118,180 @@ type callTracerTest struct {
 	Result  *callTrace    `json:"result"`
 }
 
-// Iterates over all the input-output datasets in the tracer test harness and
-// runs the JavaScript tracers against them.
-func TestCallTracer(t *testing.T) {
+// readCallTracerTests loads all the call tracer test cases from the testdata
+// folder, keyed by their camel cased names.
+func readCallTracerTests(tb testing.TB) map[string]*callTracerTest {
 	files, err := ioutil.ReadDir("testdata")
 	if err != nil {
-		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+		tb.Fatalf("failed to retrieve tracer test suite: %v", err)
 	}
+	tests := make(map[string]*callTracerTest)
 	for _, file := range files {
 		if !strings.HasPrefix(file.Name(), "call_tracer_") {
 			continue
 		}
-		file := file // capture range variable
-		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json")), func(t *testing.T) {
-			t.Parallel()
-
-			// Call tracer test found, read if from disk
-			blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
-			if err != nil {
-				t.Fatalf("failed to read testcase: %v", err)
-			}
-			test := new(callTracerTest)
-			if err := json.Unmarshal(blob, test); err != nil {
-				t.Fatalf("failed to parse testcase: %v", err)
-			}
-			// Configure a blockchain with the given prestate
-			tx := new(types.Transaction)
-			if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
-				t.Fatalf("failed to parse testcase input: %v", err)
-			}
-			signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
-			origin, _ := signer.Sender(tx)
-
-			context := vm.Context{
-				CanTransfer: core.CanTransfer,
-				Transfer:    core.Transfer,
-				Origin:      origin,
-				Coinbase:    test.Context.Miner,
-				BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
-				Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
-				Difficulty:  (*big.Int)(test.Context.Difficulty),
-				GasLimit:    uint64(test.Context.GasLimit),
-				GasPrice:    tx.GasPrice(),
-			}
-			statedb := tests.MakePreState(ethdb.NewMemDatabase(), test.Genesis.Alloc)
+		// Call tracer test found, read if from disk
+		blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+		if err != nil {
+			tb.Fatalf("failed to read testcase %s: %v", file.Name(), err)
+		}
+		test := new(callTracerTest)
+		if err := json.Unmarshal(blob, test); err != nil {
+			tb.Fatalf("failed to parse testcase %s: %v", file.Name(), err)
+		}
+		tests[camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json"))] = test
+	}
+	return tests
+}
 
-			// Create the tracer, the EVM environment and run it
-			tracer, err := New("callTracer")
-			if err != nil {
-				t.Fatalf("failed to create call tracer: %v", err)
-			}
-			evm := vm.NewEVM(context, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+// runTracer executes the transaction of a test case on top of its prestate with
+// the given tracer attached, returning the trace result.
+func runTracer(test *callTracerTest, tracer ResultTracer) (json.RawMessage, error) {
+	// Configure a blockchain with the given prestate
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		return nil, fmt.Errorf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
 
-			msg, err := tx.AsMessage(signer)
-			if err != nil {
-				t.Fatalf("failed to prepare transaction for tracing: %v", err)
-			}
-			st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
-			if _, _, _, err = st.TransitionDb(); err != nil {
-				t.Fatalf("failed to execute transaction: %v", err)
-			}
-			// Retrieve the trace result and compare against the etalon
-			res, err := tracer.GetResult()
-			if err != nil {
-				t.Fatalf("failed to retrieve trace result: %v", err)
-			}
-			ret := new(callTrace)
-			if err := json.Unmarshal(res, ret); err != nil {
-				t.Fatalf("failed to unmarshal trace result: %v", err)
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Origin:      origin,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+		GasPrice:    tx.GasPrice(),
+	}
+	statedb := tests.MakePreState(ethdb.NewMemDatabase(), test.Genesis.Alloc)
+
+	// Create the EVM environment with the tracer and run the transaction
+	evm := vm.NewEVM(context, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, _, _, err = st.TransitionDb(); err != nil {
+		return nil, fmt.Errorf("failed to execute transaction: %v", err)
+	}
+	return tracer.GetResult()
+}
+
+// Iterates over all the input-output datasets in the tracer test harness and
+// runs both the JavaScript and the native call tracers against them.
+func TestCallTracer(t *testing.T) {
+	constructors := map[string]func() (ResultTracer, error){
+		"js":     func() (ResultTracer, error) { return New("callTracer") },
+		"native": func() (ResultTracer, error) { return natives["callTracer"](), nil },
+	}
+	for name, test := range readCallTracerTests(t) {
+		for kind, constructor := range constructors {
+			test, constructor := test, constructor // capture range variables
+			t.Run(name+"/"+kind, func(t *testing.T) {
+				t.Parallel()
+
+				tracer, err := constructor()
+				if err != nil {
+					t.Fatalf("failed to create call tracer: %v", err)
+				}
+				res, err := runTracer(test, tracer)
+				if err != nil {
+					t.Fatalf("failed to trace transaction: %v", err)
+				}
+				// Compare the trace result against the etalon
+				ret := new(callTrace)
+				if err := json.Unmarshal(res, ret); err != nil {
+					t.Fatalf("failed to unmarshal trace result: %v", err)
+				}
+				if !reflect.DeepEqual(ret, test.Result) {
+					t.Fatalf("trace mismatch: have %+v, want %+v", ret, test.Result)
+				}
+			})
+		}
+	}
+}
+
+// Tests that the native tracers produce the same output as the JavaScript ones
+// they replace.
+func TestNativeTracers(t *testing.T) {
+	tests := readCallTracerTests(t)
+	for name := range natives {
+		for test, data := range tests {
+			name, data := name, data // capture range variables
+			t.Run(name+"/"+test, func(t *testing.T) {
+				t.Parallel()
+
+				tracer, err := New(name)
+				if err != nil {
+					t.Fatalf("failed to create JavaScript tracer: %v", err)
+				}
+				want, err := runTracer(data, tracer)
+				if err != nil {
+					t.Fatalf("failed to trace with JavaScript tracer: %v", err)
+				}
+				have, err := runTracer(data, natives[name]())
+				if err != nil {
+					t.Fatalf("failed to trace with native tracer: %v", err)
+				}
+				// Compare the decoded results, ignoring the execution time
+				var wantRes, haveRes map[string]interface{}
+				if err := json.Unmarshal(want, &wantRes); err != nil {
+					t.Fatalf("failed to unmarshal JavaScript result: %v", err)
+				}
+				if err := json.Unmarshal(have, &haveRes); err != nil {
+					t.Fatalf("failed to unmarshal native result: %v", err)
+				}
+				delete(wantRes, "time")
+				delete(haveRes, "time")
+
+				if !reflect.DeepEqual(haveRes, wantRes) {
+					t.Fatalf("result mismatch:\nhave %s\nwant %s", have, want)
+				}
+			})
+		}
+	}
+}
+
+// Tests that stopping a native tracer aborts it with the given reason.
+func TestNativeTracerStop(t *testing.T) {
+	test := readCallTracerTests(t)["deepCalls"]
+	for name, constructor := range natives {
+		tracer := constructor()
+		tracer.Stop(errors.New("stopped"))
+
+		if _, err := runTracer(test, tracer); err == nil || err.Error() != "stopped" {
+			t.Errorf("%s: error mismatch: have %v, want %v", name, err, "stopped")
+		}
+	}
+}
+
+// Benchmarks the JavaScript and the native implementations of the built in
+// tracers against each other on a transaction with deeply nested calls.
+func BenchmarkTracers(b *testing.B) {
+	test := readCallTracerTests(b)["deepCalls"]
+	for name, constructor := range natives {
+		constructor := constructor // capture range variable
+		b.Run(name+"/js", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tracer, err := New(name)
+				if err != nil {
+					b.Fatalf("failed to create tracer: %v", err)
+				}
+				if _, err := runTracer(test, tracer); err != nil {
+					b.Fatalf("failed to trace transaction: %v", err)
+				}
 			}
-			if !reflect.DeepEqual(ret, test.Result) {
-				t.Fatalf("trace mismatch: have %+v, want %+v", ret, test.Result)
+		})
+		b.Run(name+"/native", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := runTracer(test, constructor()); err != nil {
+					b.Fatalf("failed to trace transaction: %v", err)
+				}
 			}
 		})
 	}
@@ -425,7 +425,7 @@ func (ec *Client) PendingTransactionCount(ctx context.Context) (uint, error) {
 	return uint(num), err
 }
 
-// TODO: SubscribePendingTransactions (needs server side)
+// Pending transaction subscriptions are provided by the themisclient package.
 
 // Contract Calling
 
@@ -0,0 +1,324 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package failover
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/themis-network/go-themis"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/ethclient"
+	"github.com/themis-network/go-themis/event"
+	"github.com/themis-network/go-themis/log"
+)
+
+// HeaderByNumber returns a block header from the current canonical chain. If
+// number is nil, the latest known header is returned.
+func (c *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var header *types.Header
+	err := c.do(ctx, false, func(e *endpoint, ec *ethclient.Client) (err error) {
+		header, err = ec.HeaderByNumber(ctx, number)
+		return err
+	})
+	return header, err
+}
+
+// TransactionReceipt returns the receipt of a mined transaction.
+func (c *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var receipt *types.Receipt
+	err := c.do(ctx, false, func(e *endpoint, ec *ethclient.Client) (err error) {
+		receipt, err = ec.TransactionReceipt(ctx, txHash)
+		return err
+	})
+	return receipt, err
+}
+
+// CodeAt returns the contract code of the given account. The block number can
+// be nil, in which case the code is taken from the latest known block.
+func (c *Client) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	var code []byte
+	err := c.do(ctx, false, func(e *endpoint, ec *ethclient.Client) (err error) {
+		code, err = ec.CodeAt(ctx, account, blockNumber)
+		return err
+	})
+	return code, err
+}
+
+// StorageAt returns the value of key in the contract storage of the given
+// account. The block number can be nil, in which case the value is taken from
+// the latest known block.
+func (c *Client) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	var value []byte
+	err := c.do(ctx, false, func(e *endpoint, ec *ethclient.Client) (err error) {
+		value, err = ec.StorageAt(ctx, account, key, blockNumber)
+		return err
+	})
+	return value, err
+}
+
+// CallContract executes a message call transaction, which is directly executed
+// in the VM of a node, but never mined into the blockchain.
+func (c *Client) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var result []byte
+	err := c.do(ctx, false, func(e *endpoint, ec *ethclient.Client) (err error) {
+		result, err = ec.CallContract(ctx, msg, blockNumber)
+		return err
+	})
+	return result, err
+}
+
+// FilterLogs executes a filter query.
+func (c *Client) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	err := c.do(ctx, false, func(e *endpoint, ec *ethclient.Client) (err error) {
+		logs, err = ec.FilterLogs(ctx, q)
+		return err
+	})
+	return logs, err
+}
+
+// The requests below depend on the pending state of a node, so they stick to the
+// write endpoint.
+
+// PendingCodeAt returns the contract code of the given account in the pending
+// state.
+func (c *Client) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	var code []byte
+	err := c.do(ctx, true, func(e *endpoint, ec *ethclient.Client) (err error) {
+		code, err = ec.PendingCodeAt(ctx, account)
+		return err
+	})
+	return code, err
+}
+
+// PendingNonceAt returns the account nonce of the given account in the pending
+// state. This is the nonce that should be used for the next transaction.
+func (c *Client) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var nonce uint64
+	err := c.do(ctx, true, func(e *endpoint, ec *ethclient.Client) (err error) {
+		nonce, err = ec.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+// PendingCallContract executes a message call transaction using the EVM, with
+// the state seen by the contract being the pending state.
+func (c *Client) PendingCallContract(ctx context.Context, msg ethereum.CallMsg) ([]byte, error) {
+	var result []byte
+	err := c.do(ctx, true, func(e *endpoint, ec *ethclient.Client) (err error) {
+		result, err = ec.PendingCallContract(ctx, msg)
+		return err
+	})
+	return result, err
+}
+
+// SuggestGasPrice retrieves the currently suggested gas price to allow a timely
+// execution of a transaction.
+func (c *Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	var price *big.Int
+	err := c.do(ctx, true, func(e *endpoint, ec *ethclient.Client) (err error) {
+		price, err = ec.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+// EstimateGas tries to estimate the gas needed to execute a specific transaction
+// based on the pending state of the write endpoint.
+func (c *Client) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	var gas uint64
+	err := c.do(ctx, true, func(e *endpoint, ec *ethclient.Client) (err error) {
+		gas, err = ec.EstimateGas(ctx, msg)
+		return err
+	})
+	return gas, err
+}
+
+// SendTransaction injects a signed transaction into the pending pool for
+// execution. If the write endpoint fails, the transaction is resubmitted to
+// another one, which may already know it.
+func (c *Client) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	resent := false
+	return c.do(ctx, true, func(e *endpoint, ec *ethclient.Client) error {
+		err := ec.SendTransaction(ctx, tx)
+		if resent && err != nil && strings.HasPrefix(err.Error(), "known transaction") {
+			return nil
+		}
+		resent = true
+		return err
+	})
+}
+
+// SubscribeNewHead subscribes to notifications about the current blockchain
+// head, resubscribing on another endpoint if the serving one fails.
+func (c *Client) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	heads := make(chan *types.Header)
+	subscribe := func(ctx context.Context, ec *ethclient.Client) (ethereum.Subscription, error) {
+		return ec.SubscribeNewHead(ctx, heads)
+	}
+	sub, e, err := c.subscribe(ctx, subscribe)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer func() {
+			if sub != nil {
+				sub.Unsubscribe()
+			}
+		}()
+		for {
+			select {
+			case head := <-heads:
+				select {
+				case ch <- head:
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				if sub, e, err = c.resubscribe(e, err, quit, subscribe); sub == nil {
+					return err
+				}
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// SubscribeFilterLogs subscribes to the results of a streaming filter query. If
+// the serving endpoint fails, the query is resubscribed on another one, which
+// delivers the logs missed meanwhile.
+func (c *Client) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	logs := make(chan types.Log)
+	subscribe := func(ctx context.Context, ec *ethclient.Client) (ethereum.Subscription, error) {
+		return ec.SubscribeFilterLogs(ctx, q, logs)
+	}
+	sub, e, err := c.subscribe(ctx, subscribe)
+	if err != nil {
+		return nil, err
+	}
+	start := c.bestHead()
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer func() {
+			if sub != nil {
+				sub.Unsubscribe()
+			}
+		}()
+
+		var (
+			delivered bool   // Whether any log was delivered yet
+			block     uint64 // Block number of the last delivered log
+			index     uint   // Index of the last delivered log
+		)
+		deliver := func(log types.Log) bool {
+			if !log.Removed && delivered && (log.BlockNumber < block || log.BlockNumber == block && log.Index <= index) {
+				return true // Already delivered before the failover
+			}
+			select {
+			case ch <- log:
+			case <-quit:
+				return false
+			}
+			delivered, block, index = true, log.BlockNumber, log.Index
+			return true
+		}
+		for {
+			select {
+			case log := <-logs:
+				if !deliver(log) {
+					return nil
+				}
+			case err := <-sub.Err():
+				if sub, e, err = c.resubscribe(e, err, quit, subscribe); sub == nil {
+					return err
+				}
+				// Deliver the logs emitted since the last delivered one, or since
+				// subscribing if there was none
+				from := start
+				if delivered {
+					from = block
+				}
+				missed := q
+				if missed.FromBlock == nil || missed.FromBlock.Uint64() < from {
+					missed.FromBlock = new(big.Int).SetUint64(from)
+				}
+				past, err := c.FilterLogs(context.Background(), missed)
+				if err != nil {
+					log.Warn("Failed to retrieve logs missed during failover", "err", err)
+				}
+				for _, log := range past {
+					if !deliver(log) {
+						return nil
+					}
+				}
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
+// subscribeFunc creates a subscription on an endpoint.
+type subscribeFunc func(context.Context, *ethclient.Client) (ethereum.Subscription, error)
+
+// subscribe creates a subscription on the best endpoint supporting them.
+func (c *Client) subscribe(ctx context.Context, subscribe subscribeFunc) (ethereum.Subscription, *endpoint, error) {
+	var (
+		sub     ethereum.Subscription
+		serving *endpoint
+	)
+	err := c.do(ctx, false, func(e *endpoint, ec *ethclient.Client) (err error) {
+		sub, err = subscribe(ctx, ec)
+		serving = e
+		return err
+	})
+	return sub, serving, err
+}
+
+// resubscribe handles the failure of the subscription served by the given
+// endpoint, subscribing again on the healthy endpoints until it succeeds or quit
+// is closed. A nil subscription is returned along with the error to end the
+// subscription with.
+func (c *Client) resubscribe(failed *endpoint, err error, quit <-chan struct{}, subscribe subscribeFunc) (ethereum.Subscription, *endpoint, error) {
+	if err != nil {
+		failed.fail(failed.conn(), err)
+	}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.HealthTimeout)
+		sub, e, err := c.subscribe(ctx, subscribe)
+		cancel()
+
+		switch {
+		case err == nil:
+			log.Info("Resubscribed on RPC endpoint", "url", e.url)
+			return sub, e, nil
+		case err != ErrNoEndpoint && !isConnectivityError(err):
+			return nil, nil, err
+		}
+		select {
+		case <-time.After(c.config.HealthInterval):
+		case <-quit:
+			return nil, nil, nil
+		}
+	}
+}
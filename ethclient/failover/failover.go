@@ -0,0 +1,336 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package failover provides an Ethereum RPC client spreading the requests over
+// multiple nodes, failing over to the healthy ones when a node goes down.
+//
+// Reads are routed to the node with the most recent head, while the requests
+// depending on the pending state of a node, such as nonce retrieval and
+// transaction submission, stick to a single node as long as it is healthy.
+// Subscriptions are transparently re-established on another node when the one
+// serving them fails.
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/themis-network/go-themis"
+	"github.com/themis-network/go-themis/ethclient"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// ErrNoEndpoint is returned if no endpoint is healthy enough to serve a request.
+var ErrNoEndpoint = errors.New("no healthy endpoint")
+
+// Config are the health checking settings of the client.
+type Config struct {
+	HealthInterval time.Duration // Interval between the health checks of the endpoints
+	HealthTimeout  time.Duration // Timeout of a single health check, including dialing
+	MaxLag         uint64        // Number of blocks an endpoint may lag behind the best one while healthy
+}
+
+// DefaultConfig contains the default health checking settings.
+var DefaultConfig = Config{
+	HealthInterval: 5 * time.Second,
+	HealthTimeout:  2 * time.Second,
+	MaxLag:         3,
+}
+
+// EndpointStatus is the health of an endpoint as of its last check.
+type EndpointStatus struct {
+	URL     string
+	Healthy bool
+	Head    uint64        // Number of the head block
+	Latency time.Duration // Round trip time of the head retrieval
+	Err     error         // Failure of the last check or request, if any
+}
+
+// endpoint is a node the client connects to, along with its health.
+type endpoint struct {
+	url string
+
+	client  *ethclient.Client // Connection to the node, nil if down
+	head    uint64
+	latency time.Duration
+	err     error
+	lock    sync.RWMutex
+}
+
+// conn returns the connection to the endpoint, nil if it's down.
+func (e *endpoint) conn() *ethclient.Client {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.client
+}
+
+// check dials the endpoint if it's down and updates its head.
+func (e *endpoint) check(ctx context.Context) {
+	client := e.conn()
+	if client == nil {
+		c, err := rpc.DialContext(ctx, e.url)
+		if err != nil {
+			e.fail(nil, err)
+			return
+		}
+		client = ethclient.NewClient(c)
+
+		e.lock.Lock()
+		e.client = client
+		e.lock.Unlock()
+	}
+	start := time.Now()
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		e.fail(client, err)
+		return
+	}
+	e.lock.Lock()
+	e.head, e.latency, e.err = header.Number.Uint64(), time.Since(start), nil
+	e.lock.Unlock()
+}
+
+// fail marks the endpoint as down, closing the given connection to it so the
+// next health check dials it again.
+func (e *endpoint) fail(client *ethclient.Client, err error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.err == nil {
+		log.Warn("RPC endpoint failed", "url", e.url, "err", err)
+	}
+	e.err = err
+	if client != nil && client == e.client {
+		client.Close()
+		e.client = nil
+	}
+}
+
+// status returns the health of the endpoint, given the head of the best one.
+func (e *endpoint) status(best uint64, maxLag uint64) EndpointStatus {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return EndpointStatus{
+		URL:     e.url,
+		Healthy: e.client != nil && e.err == nil && e.head+maxLag >= best,
+		Head:    e.head,
+		Latency: e.latency,
+		Err:     e.err,
+	}
+}
+
+// Client is an Ethereum RPC client failing over between multiple endpoints. It
+// implements bind.ContractBackend.
+type Client struct {
+	config    Config
+	endpoints []*endpoint
+
+	writer *endpoint // Endpoint the pending state requests stick to
+	lock   sync.Mutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Dial connects a client to the given URLs with the default configuration.
+func Dial(urls ...string) (*Client, error) {
+	return DialContext(context.Background(), DefaultConfig, urls...)
+}
+
+// DialContext connects a client to the given URLs, failing if none of them is
+// reachable. The unreachable ones are dialed again by the periodic health checks.
+func DialContext(ctx context.Context, config Config, urls ...string) (*Client, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no endpoint URLs")
+	}
+	c := &Client{
+		config: config,
+		quit:   make(chan struct{}),
+	}
+	for _, url := range urls {
+		c.endpoints = append(c.endpoints, &endpoint{url: url})
+	}
+	c.checkHealth(ctx)
+	if len(c.healthy()) == 0 {
+		var failures []string
+		for _, e := range c.endpoints {
+			failures = append(failures, fmt.Sprintf("%s: %v", e.url, e.status(0, 0).Err))
+		}
+		c.close()
+		return nil, fmt.Errorf("no reachable endpoint (%s)", strings.Join(failures, ", "))
+	}
+	c.wg.Add(1)
+	go c.loop()
+	return c, nil
+}
+
+// Close stops the health checks and closes the connections to the endpoints.
+func (c *Client) Close() {
+	close(c.quit)
+	c.wg.Wait()
+	c.close()
+}
+
+// close closes the connections to the endpoints.
+func (c *Client) close() {
+	for _, e := range c.endpoints {
+		if client := e.conn(); client != nil {
+			client.Close()
+		}
+	}
+}
+
+// Status returns the health of the endpoints as of their last check.
+func (c *Client) Status() []EndpointStatus {
+	best := c.bestHead()
+
+	statuses := make([]EndpointStatus, len(c.endpoints))
+	for i, e := range c.endpoints {
+		statuses[i] = e.status(best, c.config.MaxLag)
+	}
+	return statuses
+}
+
+// loop periodically checks the health of the endpoints until the client is
+// closed.
+func (c *Client) loop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.config.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.checkHealth(context.Background())
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// checkHealth checks all endpoints concurrently.
+func (c *Client) checkHealth(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.HealthTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, e := range c.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			e.check(ctx)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// bestHead returns the most recent head among the reachable endpoints.
+func (c *Client) bestHead() uint64 {
+	var best uint64
+	for _, e := range c.endpoints {
+		if status := e.status(0, 0); status.Err == nil && status.Head > best {
+			best = status.Head
+		}
+	}
+	return best
+}
+
+// healthy returns the healthy endpoints, the most recent head first and the
+// lowest latency among equal heads.
+func (c *Client) healthy() []*endpoint {
+	var (
+		best      = c.bestHead()
+		endpoints []*endpoint
+		statuses  = make(map[*endpoint]EndpointStatus)
+	)
+	for _, e := range c.endpoints {
+		if status := e.status(best, c.config.MaxLag); status.Healthy {
+			endpoints = append(endpoints, e)
+			statuses[e] = status
+		}
+	}
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		a, b := statuses[endpoints[i]], statuses[endpoints[j]]
+		if a.Head != b.Head {
+			return a.Head > b.Head
+		}
+		return a.Latency < b.Latency
+	})
+	return endpoints
+}
+
+// do runs a request against the healthy endpoints until one serves it, marking
+// the ones failing with connectivity errors as down. Sticky requests go to the
+// writer endpoint as long as it is healthy.
+func (c *Client) do(ctx context.Context, sticky bool, request func(*endpoint, *ethclient.Client) error) error {
+	err := ErrNoEndpoint
+	for _, e := range c.candidates(sticky) {
+		client := e.conn()
+		if client == nil {
+			continue
+		}
+		if err = request(e, client); err == nil || ctx.Err() != nil {
+			return err
+		}
+		if err == rpc.ErrNotificationsUnsupported {
+			continue
+		}
+		if !isConnectivityError(err) {
+			return err
+		}
+		e.fail(client, err)
+	}
+	return err
+}
+
+// candidates returns the endpoints to try a request against, in order.
+func (c *Client) candidates(sticky bool) []*endpoint {
+	endpoints := c.healthy()
+	if !sticky || len(endpoints) == 0 {
+		return endpoints
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, e := range endpoints {
+		if e == c.writer {
+			return append([]*endpoint{e}, append(endpoints[:i:i], endpoints[i+1:]...)...)
+		}
+	}
+	if c.writer != nil {
+		log.Info("Switching RPC write endpoint", "from", c.writer.url, "to", endpoints[0].url)
+	}
+	c.writer = endpoints[0]
+	return endpoints
+}
+
+// isConnectivityError reports whether a request failed due to the endpoint,
+// rather than the request itself.
+func isConnectivityError(err error) bool {
+	if _, ok := err.(rpc.Error); ok {
+		return false
+	}
+	return err != ethereum.NotFound
+}
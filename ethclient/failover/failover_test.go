@@ -0,0 +1,187 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package failover
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis"
+	"github.com/themis-network/go-themis/accounts/abi/bind"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// Verify that Client implements the contract binding interfaces.
+var (
+	_ = bind.ContractBackend(&Client{})
+	_ = bind.DeployBackend(&Client{})
+	_ = bind.PendingContractCaller(&Client{})
+)
+
+// EthAPI is a node stub serving a fixed head and logs in the eth namespace.
+type EthAPI struct {
+	id   uint64      // Returned as the nonce of every account
+	head uint64      // Number of the head block
+	logs []types.Log // Logs returned by eth_getLogs
+	live chan types.Log
+}
+
+func (api *EthAPI) GetBlockByNumber(number rpc.BlockNumber, full bool) *types.Header {
+	return &types.Header{Number: new(big.Int).SetUint64(atomic.LoadUint64(&api.head)), Difficulty: new(big.Int), Time: new(big.Int), Extra: []byte{}}
+}
+
+func (api *EthAPI) GetTransactionCount(account common.Address, number rpc.BlockNumber) hexutil.Uint64 {
+	return hexutil.Uint64(api.id)
+}
+
+func (api *EthAPI) GetLogs(crit map[string]interface{}) []types.Log {
+	return api.logs
+}
+
+func (api *EthAPI) Logs(ctx context.Context, crit map[string]interface{}) (*rpc.Subscription, error) {
+	notifier, _ := rpc.NotifierFromContext(ctx)
+	sub := notifier.CreateSubscription()
+	go func() {
+		<-sub.Activated()
+		for {
+			select {
+			case log := <-api.live:
+				notifier.Notify(sub.ID, &log)
+			case <-sub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// newTestNode starts a websocket RPC server backed by the given stub.
+func newTestNode(t *testing.T, api *EthAPI) (*rpc.Server, *httptest.Server) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatal(err)
+	}
+	http := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	return server, http
+}
+
+// stopTestNode shuts down a node, dropping its connections.
+func stopTestNode(server *rpc.Server, http *httptest.Server) {
+	server.Stop()
+	http.CloseClientConnections()
+	http.Close()
+}
+
+func wsURL(http *httptest.Server) string {
+	return "ws" + strings.TrimPrefix(http.URL, "http")
+}
+
+func newTestLog(block uint64) types.Log {
+	return types.Log{BlockNumber: block, Topics: []common.Hash{}, Data: []byte{}}
+}
+
+func TestFailover(t *testing.T) {
+	var (
+		apiA = &EthAPI{id: 1, head: 10, live: make(chan types.Log)}
+		apiB = &EthAPI{id: 2, head: 8, live: make(chan types.Log), logs: []types.Log{newTestLog(5), newTestLog(6)}}
+		apiC = &EthAPI{id: 3, head: 2, live: make(chan types.Log)}
+	)
+	serverA, httpA := newTestNode(t, apiA)
+	serverB, httpB := newTestNode(t, apiB)
+	defer stopTestNode(serverB, httpB)
+	serverC, httpC := newTestNode(t, apiC)
+	defer stopTestNode(serverC, httpC)
+
+	config := Config{HealthInterval: 20 * time.Millisecond, HealthTimeout: time.Second, MaxLag: 3}
+	client, err := DialContext(context.Background(), config, wsURL(httpA), wsURL(httpB), wsURL(httpC), "ws://127.0.0.1:1")
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	// The endpoints lagging behind or unreachable must not be used
+	healthy := []bool{true, true, false, false}
+	for i, status := range client.Status() {
+		if status.Healthy != healthy[i] {
+			t.Errorf("endpoint %d: health mismatch: have %v, want %v", i, status.Healthy, healthy[i])
+		}
+	}
+	header, err := client.HeaderByNumber(context.Background(), nil)
+	if err != nil || header.Number.Uint64() != 10 {
+		t.Fatalf("head mismatch: have %v, error %v, want 10", header, err)
+	}
+	if nonce, err := client.PendingNonceAt(context.Background(), common.Address{}); err != nil || nonce != 1 {
+		t.Fatalf("nonce mismatch: have %d, error %v, want 1", nonce, err)
+	}
+	logs := make(chan types.Log)
+	sub, err := client.SubscribeFilterLogs(context.Background(), ethereum.FilterQuery{}, logs)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	receive := func(want uint64) {
+		select {
+		case log := <-logs:
+			if log.BlockNumber != want {
+				t.Fatalf("log mismatch: have block %d, want %d", log.BlockNumber, want)
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription failed: %v", err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for log of block %d", want)
+		}
+	}
+	apiA.live <- newTestLog(5)
+	receive(5)
+
+	// Stop the best node, the requests and the subscription must fail over
+	stopTestNode(serverA, httpA)
+
+	receive(6) // Missed while failing over
+	apiB.live <- newTestLog(7)
+	receive(7)
+
+	header, err = client.HeaderByNumber(context.Background(), nil)
+	if err != nil || header.Number.Uint64() != 8 {
+		t.Fatalf("head mismatch after failover: have %v, error %v, want 8", header, err)
+	}
+	if nonce, err := client.PendingNonceAt(context.Background(), common.Address{}); err != nil || nonce != 2 {
+		t.Fatalf("nonce mismatch after failover: have %d, error %v, want 2", nonce, err)
+	}
+	// Writes must stick to the current endpoint even if a better one appears
+	atomic.StoreUint64(&apiC.head, 10)
+	for i := 0; i < 100 && client.bestHead() != 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if header, _ := client.HeaderByNumber(context.Background(), nil); header == nil || header.Number.Uint64() != 10 {
+		t.Fatalf("reads not routed to the best endpoint: have %v", header)
+	}
+	if nonce, err := client.PendingNonceAt(context.Background(), common.Address{}); err != nil || nonce != 2 {
+		t.Fatalf("nonce mismatch with better endpoint: have %d, error %v, want 2", nonce, err)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/core/state"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/rlp"
+	"github.com/themis-network/go-themis/trie"
+)
+
+// AccountResult is the merkle proof of an account and of a set of its storage
+// slots, as returned by eth_getProof.
+type AccountResult struct {
+	Address      common.Address
+	AccountProof [][]byte
+	Balance      *big.Int
+	CodeHash     common.Hash
+	Nonce        uint64
+	StorageHash  common.Hash
+	StorageProof []StorageResult
+}
+
+// StorageResult is the merkle proof of a single storage slot.
+type StorageResult struct {
+	Key   common.Hash
+	Value *big.Int
+	Proof [][]byte
+}
+
+type rpcAccountResult struct {
+	Address      common.Address     `json:"address"`
+	AccountProof []hexutil.Bytes    `json:"accountProof"`
+	Balance      *hexutil.Big       `json:"balance"`
+	CodeHash     common.Hash        `json:"codeHash"`
+	Nonce        hexutil.Uint64     `json:"nonce"`
+	StorageHash  common.Hash        `json:"storageHash"`
+	StorageProof []rpcStorageResult `json:"storageProof"`
+}
+
+type rpcStorageResult struct {
+	Key   string          `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// GetProof returns the merkle proof of the given account and of the given storage
+// keys. The block number can be nil, in which case the proof is taken from the
+// latest known block.
+func (ec *Client) GetProof(ctx context.Context, account common.Address, keys []common.Hash, blockNumber *big.Int) (*AccountResult, error) {
+	strKeys := make([]string, len(keys))
+	for i, key := range keys {
+		strKeys[i] = key.Hex()
+	}
+	var res rpcAccountResult
+	if err := ec.c.CallContext(ctx, &res, "eth_getProof", account, strKeys, toBlockNumArg(blockNumber)); err != nil {
+		return nil, err
+	}
+	result := &AccountResult{
+		Address:      res.Address,
+		AccountProof: fromHexSlice(res.AccountProof),
+		Balance:      (*big.Int)(res.Balance),
+		CodeHash:     res.CodeHash,
+		Nonce:        uint64(res.Nonce),
+		StorageHash:  res.StorageHash,
+		StorageProof: make([]StorageResult, len(res.StorageProof)),
+	}
+	if result.Balance == nil {
+		result.Balance = new(big.Int)
+	}
+	for i, st := range res.StorageProof {
+		result.StorageProof[i] = StorageResult{
+			Key:   common.HexToHash(st.Key),
+			Value: (*big.Int)(st.Value),
+			Proof: fromHexSlice(st.Proof),
+		}
+		if result.StorageProof[i].Value == nil {
+			result.StorageProof[i].Value = new(big.Int)
+		}
+	}
+	return result, nil
+}
+
+// Verify checks the account proof against the given state root and every storage
+// proof against the storage root of the proven account. It returns an error if
+// any proof is invalid or doesn't match the values reported alongside it.
+func (res *AccountResult) Verify(root common.Hash) error {
+	value, err := verifyProof(root, crypto.Keccak256(res.Address.Bytes()), res.AccountProof)
+	if err != nil {
+		return fmt.Errorf("invalid account proof: %v", err)
+	}
+	want := state.Account{
+		Nonce:    res.Nonce,
+		Balance:  res.Balance,
+		Root:     res.StorageHash,
+		CodeHash: res.CodeHash.Bytes(),
+	}
+	if value == nil {
+		// The account is absent from the trie, it must look like an empty one.
+		if want.Nonce != 0 || want.Balance.Sign() != 0 || want.Root != types.EmptyRootHash || res.CodeHash != crypto.Keccak256Hash(nil) {
+			return fmt.Errorf("account %x proven absent but reported non-empty", res.Address)
+		}
+	} else {
+		enc, err := rlp.EncodeToBytes(&want)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(enc, value) {
+			return fmt.Errorf("account %x doesn't match its proof", res.Address)
+		}
+	}
+	for _, st := range res.StorageProof {
+		if err := st.Verify(res.StorageHash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks the storage proof against the given storage trie root.
+func (res *StorageResult) Verify(root common.Hash) error {
+	if root == types.EmptyRootHash && len(res.Proof) == 0 {
+		if res.Value.Sign() != 0 {
+			return fmt.Errorf("slot %x in empty storage reported non-zero", res.Key)
+		}
+		return nil
+	}
+	value, err := verifyProof(root, crypto.Keccak256(res.Key.Bytes()), res.Proof)
+	if err != nil {
+		return fmt.Errorf("invalid storage proof for slot %x: %v", res.Key, err)
+	}
+	have := new(big.Int)
+	if value != nil {
+		_, content, _, err := rlp.Split(value)
+		if err != nil {
+			return fmt.Errorf("invalid storage value for slot %x: %v", res.Key, err)
+		}
+		have.SetBytes(content)
+	}
+	if have.Cmp(res.Value) != 0 {
+		return fmt.Errorf("slot %x doesn't match its proof: have %v, want %v", res.Key, res.Value, have)
+	}
+	return nil
+}
+
+// verifyProof checks a list of proof nodes for key against root, returning the
+// proven value or nil if the proof shows the key is absent.
+func verifyProof(root common.Hash, key []byte, proof [][]byte) ([]byte, error) {
+	db := ethdb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	value, _, err := trie.VerifyProof(root, key, db)
+	return value, err
+}
+
+func fromHexSlice(h []hexutil.Bytes) [][]byte {
+	r := make([][]byte, len(h))
+	for i := range h {
+		r[i] = h[i]
+	}
+	return r
+}
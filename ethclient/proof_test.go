@@ -0,0 +1,162 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethclient
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/eth"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/node"
+	"github.com/themis-network/go-themis/params"
+)
+
+var (
+	testKey, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr     = crypto.PubkeyToAddress(testKey.PublicKey)
+	testContract = common.HexToAddress("0xc0de")
+	testSlot1    = common.BytesToHash([]byte{1})
+	testSlot2    = common.BytesToHash([]byte{2})
+)
+
+// newTestBackend starts an in-process node whose chain contains a contract with
+// a storage slot set in genesis, and a block storing a second slot.
+func newTestBackend(t *testing.T) *node.Node {
+	var (
+		config  = params.AllEthashProtocolChanges
+		genesis = &core.Genesis{
+			Config: config,
+			Alloc: core.GenesisAlloc{
+				testAddr: {Balance: big.NewInt(1e18)},
+				testContract: {
+					Balance: big.NewInt(1),
+					Code:    []byte{0x60, 0x2a, 0x60, 0x02, 0x55}, // PUSH1 0x2a PUSH1 0x02 SSTORE
+					Storage: map[common.Hash]common.Hash{testSlot1: common.BytesToHash([]byte{0x11})},
+				},
+			},
+		}
+		db         = ethdb.NewMemDatabase()
+		genesisBlk = genesis.MustCommit(db)
+	)
+	blocks, _ := core.GenerateChain(config, genesisBlk, ethash.NewFaker(), db, 1, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(testAddr), testContract, new(big.Int), 100000, big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		b.AddTx(tx)
+	})
+	stack, err := node.New(&node.Config{})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	var ethservice *eth.Ethereum
+	err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		ethservice, err = eth.New(ctx, &eth.Config{Genesis: genesis, Ethash: ethash.Config{PowMode: ethash.ModeFake}})
+		return ethservice, err
+	})
+	if err != nil {
+		t.Fatalf("failed to register Ethereum service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	if _, err := ethservice.BlockChain().InsertChain(blocks); err != nil {
+		stack.Stop()
+		t.Fatalf("failed to import blocks: %v", err)
+	}
+	return stack
+}
+
+func TestGetProof(t *testing.T) {
+	stack := newTestBackend(t)
+	defer stack.Stop()
+
+	rpcClient, err := stack.Attach()
+	if err != nil {
+		t.Fatalf("failed to attach to node: %v", err)
+	}
+	defer rpcClient.Close()
+	var (
+		ec   = NewClient(rpcClient)
+		ctx  = context.Background()
+		keys = []common.Hash{testSlot1, testSlot2, common.BytesToHash([]byte{0xff})}
+	)
+	for _, number := range []*big.Int{big.NewInt(0), nil} {
+		header, err := ec.HeaderByNumber(ctx, number)
+		if err != nil {
+			t.Fatalf("block %v: failed to retrieve header: %v", number, err)
+		}
+		// Existing contract with set and missing slots
+		res, err := ec.GetProof(ctx, testContract, keys, number)
+		if err != nil {
+			t.Fatalf("block %v: failed to retrieve proof: %v", number, err)
+		}
+		if err := res.Verify(header.Root); err != nil {
+			t.Fatalf("block %v: valid proof rejected: %v", number, err)
+		}
+		if res.Balance.Cmp(big.NewInt(1)) != 0 || res.CodeHash != crypto.Keccak256Hash([]byte{0x60, 0x2a, 0x60, 0x02, 0x55}) {
+			t.Errorf("block %v: wrong account fields: balance %v, code hash %x", number, res.Balance, res.CodeHash)
+		}
+		if len(res.StorageProof) != len(keys) || res.StorageProof[0].Value.Int64() != 0x11 {
+			t.Fatalf("block %v: wrong storage proofs: %v", number, res.StorageProof)
+		}
+		want := int64(0x2a)
+		if number != nil {
+			want = 0 // slot 2 is only written by block 1
+		}
+		if res.StorageProof[1].Value.Int64() != want {
+			t.Errorf("block %v: wrong value of slot 2: %v, want %d", number, res.StorageProof[1].Value, want)
+		}
+		// Proofs don't hold against a different root
+		if err := res.Verify(common.Hash{1}); err == nil {
+			t.Errorf("block %v: proof accepted against wrong root", number)
+		}
+		// Missing account
+		res, err = ec.GetProof(ctx, common.HexToAddress("0xdeadbeef"), keys, number)
+		if err != nil {
+			t.Fatalf("block %v: failed to retrieve absence proof: %v", number, err)
+		}
+		if err := res.Verify(header.Root); err != nil {
+			t.Fatalf("block %v: valid absence proof rejected: %v", number, err)
+		}
+	}
+	// Tampered account and storage values
+	res, err := ec.GetProof(ctx, testContract, keys, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve proof: %v", err)
+	}
+	header, err := ec.HeaderByNumber(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve header: %v", err)
+	}
+	res.Balance = big.NewInt(1000)
+	if err := res.Verify(header.Root); err == nil {
+		t.Errorf("tampered balance accepted")
+	}
+	res.Balance = big.NewInt(1)
+	res.StorageProof[0].Value = big.NewInt(3)
+	if err := res.Verify(header.Root); err == nil {
+		t.Errorf("tampered storage value accepted")
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package themisclient provides a client for the node specific RPC APIs, such
+// as the debug, admin, txpool and clique namespaces, complementing ethclient.
+package themisclient
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+
+	"github.com/themis-network/go-themis"
+	"github.com/themis-network/go-themis/apitypes"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/consensus/clique"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/p2p"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// Client defines typed wrappers for the node specific RPC APIs.
+type Client struct {
+	c *rpc.Client
+}
+
+// Dial connects a client to the given URL.
+func Dial(rawurl string) (*Client, error) {
+	return DialContext(context.Background(), rawurl)
+}
+
+// DialContext connects a client to the given URL, with ctx bounding the
+// connection establishment.
+func DialContext(ctx context.Context, rawurl string) (*Client, error) {
+	c, err := rpc.DialContext(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return New(c), nil
+}
+
+// New creates a client that uses the given RPC client.
+func New(c *rpc.Client) *Client {
+	return &Client{c}
+}
+
+// Close closes the underlying RPC connection.
+func (tc *Client) Close() {
+	tc.c.Close()
+}
+
+// Debug
+
+// TraceTransaction replays a transaction with the default structured logger,
+// returning its trace. The config may be nil, its Tracer must not be set.
+func (tc *Client) TraceTransaction(ctx context.Context, hash common.Hash, config *apitypes.TraceConfig) (*apitypes.ExecutionResult, error) {
+	var result *apitypes.ExecutionResult
+	if err := tc.c.CallContext(ctx, &result, "debug_traceTransaction", hash, config); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, ethereum.NotFound
+	}
+	return result, nil
+}
+
+// TraceTransactionWithTracer replays a transaction with the given JavaScript
+// tracer, or the name of a built-in one, returning the raw result of the
+// tracer. The config may be nil, its Tracer is overridden.
+func (tc *Client) TraceTransactionWithTracer(ctx context.Context, hash common.Hash, tracer string, config *apitypes.TraceConfig) (json.RawMessage, error) {
+	cfg := apitypes.TraceConfig{Tracer: &tracer}
+	if config != nil {
+		cfg = *config
+		cfg.Tracer = &tracer
+	}
+	var result json.RawMessage
+	if err := tc.c.CallContext(ctx, &result, "debug_traceTransaction", hash, &cfg); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Admin
+
+// Peers returns the information about the connected remote nodes.
+func (tc *Client) Peers(ctx context.Context) ([]*p2p.PeerInfo, error) {
+	var peers []*p2p.PeerInfo
+	err := tc.c.CallContext(ctx, &peers, "admin_peers")
+	return peers, err
+}
+
+// NodeInfo returns the information about the node on the peer-to-peer network.
+func (tc *Client) NodeInfo(ctx context.Context) (*p2p.NodeInfo, error) {
+	var info *p2p.NodeInfo
+	err := tc.c.CallContext(ctx, &info, "admin_nodeInfo")
+	return info, err
+}
+
+// AddPeer requests connecting to the remote node with the given enode URL.
+func (tc *Client) AddPeer(ctx context.Context, url string) error {
+	var ok bool
+	return tc.c.CallContext(ctx, &ok, "admin_addPeer", url)
+}
+
+// RemovePeer requests disconnecting from the remote node with the given enode
+// URL.
+func (tc *Client) RemovePeer(ctx context.Context, url string) error {
+	var ok bool
+	return tc.c.CallContext(ctx, &ok, "admin_removePeer", url)
+}
+
+// Datadir returns the data directory of the node.
+func (tc *Client) Datadir(ctx context.Context) (string, error) {
+	var dir string
+	err := tc.c.CallContext(ctx, &dir, "admin_datadir")
+	return dir, err
+}
+
+// TxPool
+
+// TxPoolContent returns the pending and queued transactions of the pool,
+// grouped by status ("pending" or "queued"), sender and nonce.
+func (tc *Client) TxPoolContent(ctx context.Context) (map[string]map[string]map[string]*apitypes.RPCTransaction, error) {
+	var content map[string]map[string]map[string]*apitypes.RPCTransaction
+	err := tc.c.CallContext(ctx, &content, "txpool_content")
+	return content, err
+}
+
+// TxPoolContentFrom returns the pending and queued transactions of the pool
+// sent by the given account, grouped by status and nonce.
+func (tc *Client) TxPoolContentFrom(ctx context.Context, account common.Address) (map[string]map[string]*apitypes.RPCTransaction, error) {
+	var content map[string]map[string]*apitypes.RPCTransaction
+	err := tc.c.CallContext(ctx, &content, "txpool_contentFrom", account)
+	return content, err
+}
+
+// TxPoolInspect returns a textual summary of the pending and queued
+// transactions of the pool, grouped by status, sender and nonce.
+func (tc *Client) TxPoolInspect(ctx context.Context) (map[string]map[string]map[string]string, error) {
+	var summary map[string]map[string]map[string]string
+	err := tc.c.CallContext(ctx, &summary, "txpool_inspect")
+	return summary, err
+}
+
+// TxPoolStatus returns the number of pending and queued transactions of the
+// pool.
+func (tc *Client) TxPoolStatus(ctx context.Context) (pending uint, queued uint, err error) {
+	var status map[string]hexutil.Uint
+	if err := tc.c.CallContext(ctx, &status, "txpool_status"); err != nil {
+		return 0, 0, err
+	}
+	return uint(status["pending"]), uint(status["queued"]), nil
+}
+
+// SubscribePendingTransactions subscribes to the hashes of the transactions
+// entering the pool.
+func (tc *Client) SubscribePendingTransactions(ctx context.Context, ch chan<- common.Hash) (ethereum.Subscription, error) {
+	return tc.c.EthSubscribe(ctx, ch, "newPendingTransactions")
+}
+
+// SubscribeFullPendingTransactions subscribes to the transactions entering the
+// pool, delivered with their full bodies.
+func (tc *Client) SubscribeFullPendingTransactions(ctx context.Context, ch chan<- *types.Transaction) (ethereum.Subscription, error) {
+	return tc.c.EthSubscribe(ctx, ch, "newPendingTransactions", true)
+}
+
+// PendingTransactionFilter selects the pending transactions to subscribe to. A
+// transaction matches if it matches every non-empty field.
+type PendingTransactionFilter struct {
+	From      []common.Address // Senders of the transactions
+	To        []common.Address // Recipients of the transactions, excluding contract creations
+	Selectors [][4]byte        // Method selectors the transaction inputs start with
+}
+
+// SubscribeFilteredPendingTransactions subscribes to the transactions entering
+// the pool which match the filter, delivered with their full bodies and senders.
+func (tc *Client) SubscribeFilteredPendingTransactions(ctx context.Context, filter PendingTransactionFilter, ch chan<- *apitypes.RPCTransaction) (ethereum.Subscription, error) {
+	return tc.c.EthSubscribe(ctx, ch, "newPendingTransactions", true, toPendingFilterArg(filter))
+}
+
+func toPendingFilterArg(filter PendingTransactionFilter) interface{} {
+	arg := map[string]interface{}{}
+	if len(filter.From) > 0 {
+		arg["from"] = filter.From
+	}
+	if len(filter.To) > 0 {
+		arg["to"] = filter.To
+	}
+	if len(filter.Selectors) > 0 {
+		selectors := make([]hexutil.Bytes, len(filter.Selectors))
+		for i := range filter.Selectors {
+			selectors[i] = filter.Selectors[i][:]
+		}
+		arg["selectors"] = selectors
+	}
+	return arg
+}
+
+// Clique
+
+// CliqueSnapshot returns the authorization voting state at the given block. If
+// number is nil, the state at the latest known block is returned.
+func (tc *Client) CliqueSnapshot(ctx context.Context, number *big.Int) (*clique.Snapshot, error) {
+	var snap *clique.Snapshot
+	err := tc.c.CallContext(ctx, &snap, "clique_getSnapshot", toBlockNumArg(number))
+	return snap, err
+}
+
+// CliqueSigners returns the authorized signers at the given block. If number is
+// nil, the signers at the latest known block are returned.
+func (tc *Client) CliqueSigners(ctx context.Context, number *big.Int) ([]common.Address, error) {
+	var signers []common.Address
+	err := tc.c.CallContext(ctx, &signers, "clique_getSigners", toBlockNumArg(number))
+	return signers, err
+}
+
+// CliqueSignersAtHash returns the authorized signers at the given block.
+func (tc *Client) CliqueSignersAtHash(ctx context.Context, hash common.Hash) ([]common.Address, error) {
+	var signers []common.Address
+	err := tc.c.CallContext(ctx, &signers, "clique_getSignersAtHash", hash)
+	return signers, err
+}
+
+// CliqueProposals returns the authorization proposals the node is voting on,
+// mapped to whether they authorize or deauthorize the account.
+func (tc *Client) CliqueProposals(ctx context.Context) (map[common.Address]bool, error) {
+	var proposals map[common.Address]bool
+	err := tc.c.CallContext(ctx, &proposals, "clique_proposals")
+	return proposals, err
+}
+
+// CliquePropose makes the node vote on authorizing or deauthorizing the given
+// account.
+func (tc *Client) CliquePropose(ctx context.Context, account common.Address, auth bool) error {
+	return tc.c.CallContext(ctx, nil, "clique_propose", account, auth)
+}
+
+// CliqueDiscard drops the node's proposal about the given account.
+func (tc *Client) CliqueDiscard(ctx context.Context, account common.Address) error {
+	return tc.c.CallContext(ctx, nil, "clique_discard", account)
+}
+
+func toBlockNumArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	return hexutil.EncodeBig(number)
+}
@@ -0,0 +1,299 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package themisclient
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis/apitypes"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/core/vm"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/eth"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/node"
+	"github.com/themis-network/go-themis/params"
+)
+
+var (
+	testKey, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr     = crypto.PubkeyToAddress(testKey.PublicKey)
+	testContract = common.HexToAddress("0xc0de") // stores a value in slot 0
+	testSigner   = types.HomesteadSigner{}
+)
+
+// newTestBackend starts an in-process node whose chain contains a block with a
+// successful and an out of gas call of a contract, returning the transactions.
+func newTestBackend(t *testing.T) (*node.Node, *eth.Ethereum, []*types.Transaction) {
+	var (
+		config  = params.AllEthashProtocolChanges
+		genesis = &core.Genesis{
+			Config: config,
+			Alloc: core.GenesisAlloc{
+				testAddr:     {Balance: big.NewInt(1e18)},
+				testContract: {Balance: big.NewInt(0), Code: []byte{0x60, 0x2a, 0x60, 0x00, 0x55}}, // PUSH1 0x2a PUSH1 0 SSTORE
+			},
+		}
+		db         = ethdb.NewMemDatabase()
+		genesisBlk = genesis.MustCommit(db)
+		txs        []*types.Transaction
+	)
+	blocks, _ := core.GenerateChain(config, genesisBlk, ethash.NewFaker(), db, 1, func(i int, b *core.BlockGen) {
+		for _, gas := range []uint64{100000, 23000} {
+			tx, err := types.SignTx(types.NewTransaction(b.TxNonce(testAddr), testContract, new(big.Int), gas, big.NewInt(1), nil), testSigner, testKey)
+			if err != nil {
+				t.Fatalf("failed to sign transaction: %v", err)
+			}
+			b.AddTx(tx)
+			txs = append(txs, tx)
+		}
+	})
+	stack, err := node.New(&node.Config{})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	var ethservice *eth.Ethereum
+	err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		ethservice, err = eth.New(ctx, &eth.Config{Genesis: genesis, Ethash: ethash.Config{PowMode: ethash.ModeFake}, TxPool: core.DefaultTxPoolConfig})
+		return ethservice, err
+	})
+	if err != nil {
+		t.Fatalf("failed to register Ethereum service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	if _, err := ethservice.BlockChain().InsertChain(blocks); err != nil {
+		stack.Stop()
+		t.Fatalf("failed to import blocks: %v", err)
+	}
+	return stack, ethservice, txs
+}
+
+// newTestClient attaches a client to the node.
+func newTestClient(t *testing.T, stack *node.Node) *Client {
+	c, err := stack.Attach()
+	if err != nil {
+		t.Fatalf("failed to attach to node: %v", err)
+	}
+	return New(c)
+}
+
+// pendingTx signs a transaction following the ones of the chain.
+func pendingTx(t *testing.T, nonce uint64) *types.Transaction {
+	tx, err := types.SignTx(types.NewTransaction(nonce, testContract, big.NewInt(1), 100000, big.NewInt(params.Shannon), []byte{0xde, 0xad, 0xbe, 0xef}), testSigner, testKey)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+func TestTraceTransaction(t *testing.T) {
+	stack, _, txs := newTestBackend(t)
+	defer stack.Stop()
+	client := newTestClient(t, stack)
+	defer client.Close()
+
+	// The successful call must be traced up to its end
+	result, err := client.TraceTransaction(context.Background(), txs[0].Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to trace: %v", err)
+	}
+	ops := make([]string, len(result.StructLogs))
+	for i, log := range result.StructLogs {
+		ops[i] = log.Op
+		if log.Error != "" {
+			t.Errorf("step %d: unexpected error", i)
+		}
+	}
+	if result.Failed || strings.Join(ops, " ") != "PUSH1 PUSH1 SSTORE STOP" {
+		t.Errorf("trace mismatch: have failed %v, ops %v", result.Failed, ops)
+	}
+	// The out of gas call must be traced up to its failing step
+	result, err = client.TraceTransaction(context.Background(), txs[1].Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to trace: %v", err)
+	}
+	if n := len(result.StructLogs); !result.Failed || n == 0 || result.StructLogs[n-1].Op != "SSTORE" || result.StructLogs[n-1].Error != vm.ErrOutOfGas.Error() {
+		t.Errorf("failed trace mismatch: have %+v", result)
+	}
+	// Traces of unknown transactions must be reported missing
+	if _, err := client.TraceTransaction(context.Background(), common.Hash{0x01}, nil); err == nil {
+		t.Error("unknown transaction traced")
+	}
+	// Built in tracers must return their raw result
+	raw, err := client.TraceTransactionWithTracer(context.Background(), txs[0].Hash(), "callTracer", nil)
+	if err != nil {
+		t.Fatalf("failed to trace with tracer: %v", err)
+	}
+	var call struct {
+		Type string
+		To   common.Address
+	}
+	if err := json.Unmarshal(raw, &call); err != nil || call.Type != "CALL" || call.To != testContract {
+		t.Errorf("call trace mismatch: have %s, error %v", raw, err)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	stack, _, _ := newTestBackend(t)
+	defer stack.Stop()
+	client := newTestClient(t, stack)
+	defer client.Close()
+
+	info, err := client.NodeInfo(context.Background())
+	if err != nil {
+		t.Fatalf("failed to retrieve node info: %v", err)
+	}
+	if want := stack.Server().NodeInfo(); info.ID != want.ID || info.Enode != want.Enode {
+		t.Errorf("node info mismatch: have %s, want %s", info.Enode, want.Enode)
+	}
+	if _, ok := info.Protocols["eth"]; !ok {
+		t.Errorf("eth protocol missing from node info: %v", info.Protocols)
+	}
+	peers, err := client.Peers(context.Background())
+	if err != nil || len(peers) != 0 {
+		t.Errorf("peers mismatch: have %v, error %v", peers, err)
+	}
+	if dir, err := client.Datadir(context.Background()); err != nil || dir != stack.DataDir() {
+		t.Errorf("datadir mismatch: have %q, want %q, error %v", dir, stack.DataDir(), err)
+	}
+}
+
+func TestTxPool(t *testing.T) {
+	stack, ethservice, txs := newTestBackend(t)
+	defer stack.Stop()
+	client := newTestClient(t, stack)
+	defer client.Close()
+
+	// Add an executable and a gapped transaction to the pool
+	pending, queued := pendingTx(t, uint64(len(txs))), pendingTx(t, uint64(len(txs)+2))
+	for _, err := range ethservice.TxPool().AddLocals([]*types.Transaction{pending, queued}) {
+		if err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	if p, q, err := client.TxPoolStatus(context.Background()); err != nil || p != 1 || q != 1 {
+		t.Errorf("status mismatch: have %d pending, %d queued, error %v", p, q, err)
+	}
+	content, err := client.TxPoolContent(context.Background())
+	if err != nil {
+		t.Fatalf("failed to retrieve content: %v", err)
+	}
+	if tx := content["pending"][testAddr.Hex()]["2"]; tx == nil || tx.Hash != pending.Hash() || tx.From != testAddr {
+		t.Errorf("pending content mismatch: have %+v", tx)
+	}
+	if tx := content["queued"][testAddr.Hex()]["4"]; tx == nil || tx.Hash != queued.Hash() {
+		t.Errorf("queued content mismatch: have %+v", tx)
+	}
+	from, err := client.TxPoolContentFrom(context.Background(), testAddr)
+	if err != nil {
+		t.Fatalf("failed to retrieve account content: %v", err)
+	}
+	if tx := from["pending"]["2"]; tx == nil || tx.Hash != pending.Hash() {
+		t.Errorf("account content mismatch: have %+v", tx)
+	}
+	summary, err := client.TxPoolInspect(context.Background())
+	if err != nil || !strings.HasPrefix(summary["queued"][testAddr.Hex()]["4"], testContract.Hex()) {
+		t.Errorf("summary mismatch: have %v, error %v", summary, err)
+	}
+}
+
+func TestSubscribePendingTransactions(t *testing.T) {
+	stack, ethservice, txs := newTestBackend(t)
+	defer stack.Stop()
+	client := newTestClient(t, stack)
+	defer client.Close()
+
+	var (
+		hashes   = make(chan common.Hash, 1)
+		full     = make(chan *types.Transaction, 1)
+		filtered = make(chan *apitypes.RPCTransaction, 1)
+		ignored  = make(chan *apitypes.RPCTransaction, 1)
+	)
+	sub, err := client.SubscribePendingTransactions(context.Background(), hashes)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	fullSub, err := client.SubscribeFullPendingTransactions(context.Background(), full)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer fullSub.Unsubscribe()
+
+	filteredSub, err := client.SubscribeFilteredPendingTransactions(context.Background(), PendingTransactionFilter{
+		From:      []common.Address{testAddr},
+		To:        []common.Address{testContract},
+		Selectors: [][4]byte{{0xde, 0xad, 0xbe, 0xef}},
+	}, filtered)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer filteredSub.Unsubscribe()
+
+	ignoredSub, err := client.SubscribeFilteredPendingTransactions(context.Background(), PendingTransactionFilter{To: []common.Address{testAddr}}, ignored)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer ignoredSub.Unsubscribe()
+
+	// Add a transaction to the pool and wait for its notifications
+	tx := pendingTx(t, uint64(len(txs)))
+	if err := ethservice.TxPool().AddLocal(tx); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	timeout := time.After(time.Second)
+	select {
+	case hash := <-hashes:
+		if hash != tx.Hash() {
+			t.Errorf("hash mismatch: have %x, want %x", hash, tx.Hash())
+		}
+	case <-timeout:
+		t.Fatal("timeout waiting for pending transaction hash")
+	}
+	select {
+	case have := <-full:
+		if have.Hash() != tx.Hash() {
+			t.Errorf("transaction mismatch: have %x, want %x", have.Hash(), tx.Hash())
+		}
+	case <-timeout:
+		t.Fatal("timeout waiting for pending transaction")
+	}
+	select {
+	case have := <-filtered:
+		if have.Hash != tx.Hash() || have.From != testAddr {
+			t.Errorf("filtered transaction mismatch: have %x from %x, want %x", have.Hash, have.From, tx.Hash())
+		}
+	case <-timeout:
+		t.Fatal("timeout waiting for filtered pending transaction")
+	}
+	select {
+	case have := <-ignored:
+		t.Errorf("transaction %x delivered despite the filter", have.Hash)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -17,9 +17,13 @@
 package ethdb
 
 import (
+	"bytes"
 	"errors"
+	"sort"
+	"strings"
 	"sync"
 
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/themis-network/go-themis/common"
 )
 
@@ -88,6 +92,22 @@ func (db *MemDatabase) Delete(key []byte) error {
 	return nil
 }
 
+// NewIteratorWithPrefix returns a iterator to iterate over a point-in-time copy
+// of the database content with a particular prefix.
+func (db *MemDatabase) NewIteratorWithPrefix(prefix []byte) iterator.Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var items kvs
+	for key, value := range db.db {
+		if strings.HasPrefix(key, string(prefix)) {
+			items = append(items, kv{[]byte(key), common.CopyBytes(value)})
+		}
+	}
+	sort.Sort(items)
+	return iterator.NewArrayIterator(items)
+}
+
 func (db *MemDatabase) Close() {}
 
 func (db *MemDatabase) NewBatch() Batch {
@@ -98,6 +118,19 @@ func (db *MemDatabase) Len() int { return len(db.db) }
 
 type kv struct{ k, v []byte }
 
+// kvs is a sorted list of key-value pairs, implementing iterator.Array.
+type kvs []kv
+
+func (s kvs) Len() int           { return len(s) }
+func (s kvs) Less(i, j int) bool { return bytes.Compare(s[i].k, s[j].k) < 0 }
+func (s kvs) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s kvs) Search(key []byte) int {
+	return sort.Search(len(s), func(i int) bool { return bytes.Compare(s[i].k, key) >= 0 })
+}
+
+func (s kvs) Index(i int) (key, value []byte) { return s[i].k, s[i].v }
+
 type memBatch struct {
 	db     *MemDatabase
 	writes []kv
@@ -0,0 +1,261 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/consensus/ethash"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/eth"
+	"github.com/themis-network/go-themis/eth/filters"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/node"
+	"github.com/themis-network/go-themis/params"
+)
+
+var (
+	testKey, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr     = crypto.PubkeyToAddress(testKey.PublicKey)
+	testContract = common.HexToAddress("0xc0de") // emits an empty log
+)
+
+func TestBuildSchema(t *testing.T) {
+	// Make sure the schema can be parsed and matched up to the resolvers.
+	if _, err := New(nil, nil, nil); err != nil {
+		t.Fatalf("could not create new service: %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	service, err := New(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create new service: %v", err)
+	}
+	handlers := service.HTTPHandlers()
+
+	// Queries must be executed against the schema
+	srv := httptest.NewServer(handlers["/graphql"])
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"query": "{ __type(name: \"Block\") { name } }"}`))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		Data struct {
+			Type struct {
+				Name string
+			} `json:"__type"`
+		}
+		Errors []interface{}
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(result.Errors) > 0 || result.Data.Type.Name != "Block" {
+		t.Fatalf("introspection mismatch: have %+v", result)
+	}
+	// Other methods must be rejected
+	if res, err := http.Get(srv.URL); err != nil {
+		t.Fatalf("request failed: %v", err)
+	} else if res.Body.Close(); res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status mismatch: have %d, want %d", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+	// The GraphiQL page must be served
+	ui := httptest.NewRecorder()
+	handlers["/graphql/ui"].ServeHTTP(ui, httptest.NewRequest(http.MethodGet, "/graphql/ui", nil))
+	if !strings.Contains(ui.Body.String(), "GraphiQL") {
+		t.Fatal("GraphiQL page not served")
+	}
+}
+
+// newTestBackend starts an in-process node with a chain of a few blocks, each
+// containing a transaction emitting a log, returning the blocks.
+func newTestBackend(t *testing.T) (*node.Node, *eth.Ethereum, []*types.Block) {
+	var (
+		config  = params.AllEthashProtocolChanges
+		genesis = &core.Genesis{
+			Config: config,
+			Alloc: core.GenesisAlloc{
+				testAddr:     {Balance: big.NewInt(1e18)},
+				testContract: {Balance: big.NewInt(0), Code: []byte{0x60, 0x00, 0x60, 0x00, 0xa0}}, // PUSH1 0 PUSH1 0 LOG0
+			},
+		}
+		db         = ethdb.NewMemDatabase()
+		genesisBlk = genesis.MustCommit(db)
+		signer     = types.NewEIP155Signer(config.ChainID)
+	)
+	blocks, _ := core.GenerateChain(config, genesisBlk, ethash.NewFaker(), db, 3, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(testAddr), testContract, big.NewInt(1), 100000, big.NewInt(1), nil), signer, testKey)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		b.AddTx(tx)
+	})
+	stack, err := node.New(&node.Config{})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	var ethservice *eth.Ethereum
+	err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
+		ethservice, err = eth.New(ctx, &eth.Config{Genesis: genesis, Ethash: ethash.Config{PowMode: ethash.ModeFake}})
+		return ethservice, err
+	})
+	if err != nil {
+		t.Fatalf("failed to register Ethereum service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	if _, err := ethservice.BlockChain().InsertChain(blocks); err != nil {
+		stack.Stop()
+		t.Fatalf("failed to import blocks: %v", err)
+	}
+	return stack, ethservice, blocks
+}
+
+// query executes a query against the service, decoding its data into result.
+func query(t *testing.T, service *Service, query string, result interface{}) error {
+	t.Helper()
+
+	res := service.schema.Exec(context.Background(), query, "", nil)
+	if len(res.Errors) > 0 {
+		return res.Errors[0]
+	}
+	if err := json.Unmarshal(res.Data, result); err != nil {
+		t.Fatalf("invalid response data %s: %v", res.Data, err)
+	}
+	return nil
+}
+
+func TestResolveBlocks(t *testing.T) {
+	stack, ethservice, blocks := newTestBackend(t)
+	defer stack.Stop()
+
+	service, err := New(ethservice.APIBackend, nil, nil)
+	if err != nil {
+		t.Fatalf("could not create new service: %v", err)
+	}
+	// A single block must be resolved along with its transactions and state
+	var single struct {
+		Block struct {
+			Number       hexutil.Uint64
+			Hash         common.Hash
+			Transactions []struct{ Hash common.Hash }
+			Account      struct {
+				Balance          hexutil.Big
+				TransactionCount hexutil.Uint64
+			}
+		}
+	}
+	q := fmt.Sprintf(`{ block(number: 2) { number hash transactions { hash } account(address: "%s") { balance transactionCount } } }`, testAddr.Hex())
+	if err := query(t, service, q, &single); err != nil {
+		t.Fatalf("failed to query block: %v", err)
+	}
+	block := blocks[1]
+	if single.Block.Number != 2 || single.Block.Hash != block.Hash() {
+		t.Errorf("block mismatch: have #%d %x, want #2 %x", single.Block.Number, single.Block.Hash, block.Hash())
+	}
+	if len(single.Block.Transactions) != 1 || single.Block.Transactions[0].Hash != block.Transactions()[0].Hash() {
+		t.Errorf("transactions mismatch: have %v, want [%x]", single.Block.Transactions, block.Transactions()[0].Hash())
+	}
+	state, _ := ethservice.BlockChain().StateAt(block.Root())
+	if balance := state.GetBalance(testAddr); single.Block.Account.Balance.ToInt().Cmp(balance) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", single.Block.Account.Balance.ToInt(), balance)
+	}
+	if single.Block.Account.TransactionCount != 2 {
+		t.Errorf("nonce mismatch: have %d, want 2", single.Block.Account.TransactionCount)
+	}
+	// A range of blocks must be resolved in order
+	var ranged struct {
+		Blocks []struct{ Hash common.Hash }
+	}
+	if err := query(t, service, `{ blocks(from: 1, to: 3) { hash } }`, &ranged); err != nil {
+		t.Fatalf("failed to query blocks: %v", err)
+	}
+	if len(ranged.Blocks) != len(blocks) {
+		t.Fatalf("block count mismatch: have %d, want %d", len(ranged.Blocks), len(blocks))
+	}
+	for i, block := range blocks {
+		if ranged.Blocks[i].Hash != block.Hash() {
+			t.Errorf("block %d: hash mismatch: have %x, want %x", i+1, ranged.Blocks[i].Hash, block.Hash())
+		}
+	}
+	// Ranges over the limit must be rejected
+	q = fmt.Sprintf(`{ blocks(from: 0, to: %d) { hash } }`, maxBlocks)
+	if err := query(t, service, q, &ranged); err == nil {
+		t.Errorf("range of %d blocks accepted", maxBlocks+1)
+	}
+}
+
+func TestResolveLogs(t *testing.T) {
+	stack, ethservice, blocks := newTestBackend(t)
+	defer stack.Stop()
+
+	tests := []struct {
+		config *filters.Config
+		fail   bool
+	}{
+		{&filters.Config{}, false},
+		{&filters.Config{MaxBlockRange: 4, MaxResults: 3}, false},
+		{&filters.Config{MaxBlockRange: 2}, true},
+		{&filters.Config{MaxResults: 2}, true},
+	}
+	for i, tt := range tests {
+		service, err := New(ethservice.APIBackend, tt.config, nil)
+		if err != nil {
+			t.Fatalf("test %d: could not create new service: %v", i, err)
+		}
+		var result struct {
+			Logs []struct {
+				Transaction struct{ Hash common.Hash }
+			}
+		}
+		err = query(t, service, `{ logs(filter: {fromBlock: 0, toBlock: 3}) { transaction { hash } } }`, &result)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: query exceeding the limits succeeded", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to query logs: %v", i, err)
+		}
+		if len(result.Logs) != len(blocks) {
+			t.Fatalf("test %d: log count mismatch: have %d, want %d", i, len(result.Logs), len(blocks))
+		}
+		for j, block := range blocks {
+			if have, want := result.Logs[j].Transaction.Hash, block.Transactions()[0].Hash(); have != want {
+				t.Errorf("test %d, log %d: transaction mismatch: have %x, want %x", i, j, have, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/graph-gophers/graphql-go"
+	"github.com/themis-network/go-themis/eth/filters"
+	"github.com/themis-network/go-themis/p2p"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// maxRequestContentLength is the maximum size of a GraphQL request body.
+const maxRequestContentLength = 1024 * 512
+
+// Service encapsulates a GraphQL service, served on the HTTP-RPC endpoint of the
+// node under /graphql, along with a GraphiQL page under /graphql/ui.
+type Service struct {
+	schema *graphql.Schema
+}
+
+// New constructs a new GraphQL service resolving the queries against the given
+// backend. The log queries are bounded by the given limits of eth_getLogs, and
+// the queries equivalent to RPC methods by the timeouts of those methods.
+func New(backend Backend, logs *filters.Config, limits *rpc.Limits) (*Service, error) {
+	if logs == nil {
+		logs = &filters.DefaultConfig
+	}
+	s, err := graphql.ParseSchema(schema, &Resolver{backend: backend, logs: logs, limits: limits})
+	if err != nil {
+		return nil, err
+	}
+	return &Service{schema: s}, nil
+}
+
+// Protocols returns the list of protocols exported by this service.
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs returns the list of APIs exported by this service.
+func (s *Service) APIs() []rpc.API { return nil }
+
+// Start is called after all services have been constructed and the networking
+// layer was also initialized to spawn any goroutines required by the service.
+func (s *Service) Start(server *p2p.Server) error { return nil }
+
+// Stop terminates all goroutines belonging to the service, blocking until they
+// are all terminated.
+func (s *Service) Stop() error { return nil }
+
+// HTTPHandlers returns the handlers to mount on the HTTP-RPC endpoint.
+func (s *Service) HTTPHandlers() map[string]http.Handler {
+	return map[string]http.Handler{
+		"/graphql":    &handler{s.schema},
+		"/graphql/ui": http.HandlerFunc(serveGraphiQL),
+	}
+}
+
+// request is a GraphQL query as posted by the clients.
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// handler executes GraphQL queries posted over HTTP.
+type handler struct {
+	schema *graphql.Schema
+}
+
+// ServeHTTP executes a posted query and replies with its JSON encoded response.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestContentLength)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	response := h.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	blob, err := json.Marshal(response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(blob)
+}
+
+// serveGraphiQL serves the GraphiQL page to explore the schema and run queries
+// from the browser.
+func serveGraphiQL(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(graphiql)
+}
+
+// graphiql is the GraphiQL page, posting the queries to the /graphql endpoint.
+var graphiql = []byte(`<!DOCTYPE html>
+<html>
+	<head>
+		<title>GraphiQL</title>
+		<link href="https://cdnjs.cloudflare.com/ajax/libs/graphiql/0.11.11/graphiql.min.css" rel="stylesheet" />
+		<script src="https://cdnjs.cloudflare.com/ajax/libs/es6-promise/4.1.1/es6-promise.auto.min.js"></script>
+		<script src="https://cdnjs.cloudflare.com/ajax/libs/fetch/2.0.3/fetch.min.js"></script>
+		<script src="https://cdnjs.cloudflare.com/ajax/libs/react/16.2.0/umd/react.production.min.js"></script>
+		<script src="https://cdnjs.cloudflare.com/ajax/libs/react-dom/16.2.0/umd/react-dom.production.min.js"></script>
+		<script src="https://cdnjs.cloudflare.com/ajax/libs/graphiql/0.11.11/graphiql.min.js"></script>
+	</head>
+	<body style="width: 100%; height: 100%; margin: 0; overflow: hidden;">
+		<div id="graphiql" style="height: 100vh;">Loading...</div>
+		<script>
+			function graphQLFetcher(graphQLParams) {
+				return fetch("/graphql", {
+					method: "post",
+					body: JSON.stringify(graphQLParams),
+					headers: {"Content-Type": "application/json"},
+					credentials: "include",
+				}).then(function (response) {
+					return response.text();
+				}).then(function (responseBody) {
+					try {
+						return JSON.parse(responseBody);
+					} catch (error) {
+						return responseBody;
+					}
+				});
+			}
+			ReactDOM.render(
+				React.createElement(GraphiQL, {fetcher: graphQLFetcher}),
+				document.getElementById("graphiql")
+			);
+		</script>
+	</body>
+</html>
+`)
@@ -28,12 +28,14 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/themis-network/go-themis/accounts"
 	"github.com/themis-network/go-themis/accounts/keystore"
+	"github.com/themis-network/go-themis/apitypes"
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/common/hexutil"
 	"github.com/themis-network/go-themis/common/math"
 	"github.com/themis-network/go-themis/consensus/ethash"
 	"github.com/themis-network/go-themis/core"
 	"github.com/themis-network/go-themis/core/rawdb"
+	"github.com/themis-network/go-themis/core/state"
 	"github.com/themis-network/go-themis/core/types"
 	"github.com/themis-network/go-themis/core/vm"
 	"github.com/themis-network/go-themis/crypto"
@@ -118,7 +120,7 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	for account, txs := range pending {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["pending"][account.Hex()] = dump
 	}
@@ -126,13 +128,31 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	for account, txs := range queue {
 		dump := make(map[string]*RPCTransaction)
 		for _, tx := range txs {
-			dump[fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+			dump[fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
 		}
 		content["queued"][account.Hex()] = dump
 	}
 	return content
 }
 
+// ContentFrom returns the pending and queued transactions of a single account
+// within the transaction pool, keyed by nonce.
+func (s *PublicTxPoolAPI) ContentFrom(addr common.Address) map[string]map[string]*RPCTransaction {
+	content := map[string]map[string]*RPCTransaction{
+		"pending": make(map[string]*RPCTransaction),
+		"queued":  make(map[string]*RPCTransaction),
+	}
+	pending, queue := s.b.TxPoolContentFrom(addr)
+
+	for _, tx := range pending {
+		content["pending"][fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
+	}
+	for _, tx := range queue {
+		content["queued"][fmt.Sprintf("%d", tx.Nonce())] = NewRPCPendingTransaction(tx)
+	}
+	return content
+}
+
 // Status returns the number of pending and queued transaction in the pool.
 func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
 	pending, queue := s.b.Stats()
@@ -601,6 +621,82 @@ func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address common.A
 	return res[:], state.Error()
 }
 
+// AccountResult is the result of an eth_getProof call, containing the merkle
+// proof of an account along with the proofs of the requested storage slots.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the merkle proof of a single storage slot of an account.
+type StorageResult struct {
+	Key   string          `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// GetProof returns the merkle proof of the given account and of its requested
+// storage keys in the state of the given block number (EIP-1186). The proofs
+// can be verified against the state root of the corresponding block header.
+func (s *PublicBlockChainAPI) GetProof(ctx context.Context, address common.Address, storageKeys []string, blockNr rpc.BlockNumber) (*AccountResult, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	var (
+		storageTrie  = state.StorageTrie(address)
+		storageHash  = types.EmptyRootHash
+		codeHash     = state.GetCodeHash(address)
+		storageProof = make([]StorageResult, len(storageKeys))
+	)
+	if storageTrie != nil {
+		storageHash = storageTrie.Hash()
+	} else {
+		// A missing storage trie means the account doesn't exist, report the
+		// values an empty account would carry in the trie.
+		codeHash = crypto.Keccak256Hash(nil)
+	}
+	for i, key := range storageKeys {
+		if storageTrie == nil {
+			storageProof[i] = StorageResult{key, &hexutil.Big{}, []hexutil.Bytes{}}
+			continue
+		}
+		slot := common.HexToHash(key)
+		proof, err := state.GetStorageProof(address, slot)
+		if err != nil {
+			return nil, err
+		}
+		storageProof[i] = StorageResult{key, (*hexutil.Big)(state.GetState(address, slot).Big()), toHexSlice(proof)}
+	}
+	accountProof, err := state.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountResult{
+		Address:      address,
+		AccountProof: toHexSlice(accountProof),
+		Balance:      (*hexutil.Big)(state.GetBalance(address)),
+		CodeHash:     codeHash,
+		Nonce:        hexutil.Uint64(state.GetNonce(address)),
+		StorageHash:  storageHash,
+		StorageProof: storageProof,
+	}, state.Error()
+}
+
+// toHexSlice converts a list of raw byte slices into their RPC representation.
+func toHexSlice(b [][]byte) []hexutil.Bytes {
+	r := make([]hexutil.Bytes, len(b))
+	for i := range b {
+		r[i] = hexutil.Bytes(b[i])
+	}
+	return r
+}
+
 // CallArgs represents the arguments for a call.
 type CallArgs struct {
 	From     common.Address  `json:"from"`
@@ -619,14 +715,8 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 		return nil, 0, false, err
 	}
 	// Set sender address or use a default if none specified
-	addr := args.From
-	if addr == (common.Address{}) {
-		if wallets := s.b.AccountManager().Wallets(); len(wallets) > 0 {
-			if accounts := wallets[0].Accounts(); len(accounts) > 0 {
-				addr = accounts[0].Address
-			}
-		}
-	}
+	addr := s.callSender(args.From)
+
 	// Set default gas & gas price if none were set
 	gas, gasPrice := uint64(args.Gas), args.GasPrice.ToInt()
 	if gas == 0 {
@@ -673,6 +763,12 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	return res, gas, failed, err
 }
 
+// DoCall executes the given call on the state of the given block number like Call
+// does, but additionally returns the gas used and whether execution failed.
+func DoCall(ctx context.Context, b Backend, args CallArgs, blockNr rpc.BlockNumber, timeout time.Duration) ([]byte, uint64, bool, error) {
+	return (&PublicBlockChainAPI{b}).doCall(ctx, args, blockNr, vm.Config{}, timeout)
+}
+
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
 func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
@@ -680,6 +776,186 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr r
 	return (hexutil.Bytes)(result), err
 }
 
+// callSender returns the sender of a call, defaulting to the first local account
+// if none was specified.
+func (s *PublicBlockChainAPI) callSender(from common.Address) common.Address {
+	if from == (common.Address{}) {
+		if wallets := s.b.AccountManager().Wallets(); len(wallets) > 0 {
+			if accounts := wallets[0].Accounts(); len(accounts) > 0 {
+				return accounts[0].Address
+			}
+		}
+	}
+	return from
+}
+
+// OverrideAccount holds the fields of an account to override before simulating
+// calls. Nil fields are left untouched, storage slots are overridden one by one.
+type OverrideAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   *hexutil.Uint64             `json:"nonce"`
+	Code    *hexutil.Bytes              `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// StateOverride is the set of accounts to override before simulating calls.
+type StateOverride map[common.Address]OverrideAccount
+
+// Apply overrides the accounts in the given state.
+func (overrides StateOverride) Apply(state *state.StateDB) {
+	for addr, account := range overrides {
+		if account.Balance != nil {
+			state.SetBalance(addr, account.Balance.ToInt())
+		}
+		if account.Nonce != nil {
+			state.SetNonce(addr, uint64(*account.Nonce))
+		}
+		if account.Code != nil {
+			state.SetCode(addr, *account.Code)
+		}
+		for key, value := range account.Storage {
+			state.SetState(addr, key, value)
+		}
+	}
+}
+
+// BlockOverrides holds the fields of the block context to override before
+// simulating calls.
+type BlockOverrides struct {
+	Number   *hexutil.Big    `json:"number"`
+	Time     *hexutil.Big    `json:"timestamp"`
+	Coinbase *common.Address `json:"coinbase"`
+}
+
+// Apply returns a copy of the header with the block context overridden.
+func (overrides *BlockOverrides) Apply(header *types.Header) *types.Header {
+	header = types.CopyHeader(header)
+	if overrides.Number != nil {
+		header.Number = overrides.Number.ToInt()
+	}
+	if overrides.Time != nil {
+		header.Time = overrides.Time.ToInt()
+	}
+	if overrides.Coinbase != nil {
+		header.Coinbase = *overrides.Coinbase
+	}
+	return header
+}
+
+// CallBundleResult is the outcome of a single call of a simulated bundle.
+type CallBundleResult struct {
+	ReturnValue hexutil.Bytes  `json:"returnValue"`
+	Logs        []*types.Log   `json:"logs"`
+	GasUsed     hexutil.Uint64 `json:"gasUsed"`
+	Failed      bool           `json:"failed"`
+}
+
+// CallBundle executes an ordered list of calls on top of the state of the given
+// block, each seeing the state changes of the ones before it, and returns their
+// results. The state and the block context may be overridden before execution.
+// Unlike Call, the senders are not funded, so the calls run on the actual (or
+// overridden) balances, with a default gas price of zero. Nothing is persisted.
+//
+// The logs of a call carry a synthetic transaction hash derived from the block
+// hash and the position of the call, as the calls are not real transactions.
+func (s *PublicBlockChainAPI) CallBundle(ctx context.Context, calls []CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride, blockOverrides *BlockOverrides) ([]*CallBundleResult, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM call bundle finished", "calls", len(calls), "runtime", time.Since(start)) }(time.Now())
+
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	state = state.Copy()
+	if overrides != nil {
+		overrides.Apply(state)
+	}
+	var (
+		blockHash = header.Hash()
+		coinbase  common.Address
+	)
+	if blockOverrides != nil {
+		// The author of an overridden header can't be recovered (e.g. a clique
+		// seal over a different number), so resolve it from the original one.
+		if blockOverrides.Coinbase != nil {
+			coinbase = *blockOverrides.Coinbase
+		} else if coinbase, err = s.b.Engine().Author(header); err != nil {
+			coinbase = header.Coinbase
+		}
+		header = blockOverrides.Apply(header)
+	}
+	// Setup a context so the whole bundle is cancelled after a timeout
+	var cancel context.CancelFunc
+	if timeout := s.b.RPCEVMTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	var (
+		results     = make([]*CallBundleResult, 0, len(calls))
+		config      = s.b.ChainConfig()
+		gasCap      = s.b.RPCGasCap()
+		deleteEmpty = config.IsEIP158(header.Number)
+	)
+	for i, args := range calls {
+		// Create the call message, defaulting the gas to the block's allowance
+		gas := uint64(args.Gas)
+		if gas == 0 {
+			gas = header.GasLimit
+		}
+		if gasCap != 0 && gas > gasCap {
+			log.Warn("Caller gas above allowance, capping", "requested", gas, "cap", gasCap)
+			gas = gasCap
+		}
+		msg := types.NewMessage(s.callSender(args.From), args.To, 0, args.Value.ToInt(), gas, args.GasPrice.ToInt(), args.Data, false)
+
+		// Get a new instance of the EVM, reverting the funding of the sender
+		balance := new(big.Int).Set(state.GetBalance(msg.From()))
+		callHash := crypto.Keccak256Hash(blockHash.Bytes(), new(big.Int).SetInt64(int64(i)).Bytes())
+		state.Prepare(callHash, blockHash, i)
+
+		evm, vmError, err := s.b.GetEVM(ctx, msg, state, header, vm.Config{})
+		if err != nil {
+			return nil, err
+		}
+		state.SetBalance(msg.From(), balance)
+		if blockOverrides != nil {
+			evm.Coinbase = coinbase
+		}
+		// Cancel the EVM if the bundle times out
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				evm.Cancel()
+			case <-done:
+			}
+		}()
+		res, gas, failed, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(math.MaxUint64))
+		close(done)
+
+		if err := vmError(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %v", i, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("call %d: execution aborted: %v", i, err)
+		}
+		state.Finalise(deleteEmpty)
+
+		results = append(results, &CallBundleResult{
+			ReturnValue: res,
+			Logs:        append([]*types.Log{}, state.GetLogs(callHash)...),
+			GasUsed:     hexutil.Uint64(gas),
+			Failed:      failed,
+		})
+	}
+	return results, nil
+}
+
 // EstimateGas returns an estimate of the amount of gas needed to execute the
 // given transaction against the current pending block.
 func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
@@ -729,67 +1005,6 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 	return hexutil.Uint64(hi), nil
 }
 
-// ExecutionResult groups all structured logs emitted by the EVM
-// while replaying a transaction in debug mode as well as transaction
-// execution status, the amount of gas used and the return value
-type ExecutionResult struct {
-	Gas         uint64         `json:"gas"`
-	Failed      bool           `json:"failed"`
-	ReturnValue string         `json:"returnValue"`
-	StructLogs  []StructLogRes `json:"structLogs"`
-}
-
-// StructLogRes stores a structured log emitted by the EVM while replaying a
-// transaction in debug mode
-type StructLogRes struct {
-	Pc      uint64             `json:"pc"`
-	Op      string             `json:"op"`
-	Gas     uint64             `json:"gas"`
-	GasCost uint64             `json:"gasCost"`
-	Depth   int                `json:"depth"`
-	Error   error              `json:"error,omitempty"`
-	Stack   *[]string          `json:"stack,omitempty"`
-	Memory  *[]string          `json:"memory,omitempty"`
-	Storage *map[string]string `json:"storage,omitempty"`
-}
-
-// formatLogs formats EVM returned structured logs for json output
-func FormatLogs(logs []vm.StructLog) []StructLogRes {
-	formatted := make([]StructLogRes, len(logs))
-	for index, trace := range logs {
-		formatted[index] = StructLogRes{
-			Pc:      trace.Pc,
-			Op:      trace.Op.String(),
-			Gas:     trace.Gas,
-			GasCost: trace.GasCost,
-			Depth:   trace.Depth,
-			Error:   trace.Err,
-		}
-		if trace.Stack != nil {
-			stack := make([]string, len(trace.Stack))
-			for i, stackValue := range trace.Stack {
-				stack[i] = fmt.Sprintf("%x", math.PaddedBigBytes(stackValue, 32))
-			}
-			formatted[index].Stack = &stack
-		}
-		if trace.Memory != nil {
-			memory := make([]string, 0, (len(trace.Memory)+31)/32)
-			for i := 0; i+32 <= len(trace.Memory); i += 32 {
-				memory = append(memory, fmt.Sprintf("%x", trace.Memory[i:i+32]))
-			}
-			formatted[index].Memory = &memory
-		}
-		if trace.Storage != nil {
-			storage := make(map[string]string)
-			for i, storageValue := range trace.Storage {
-				storage[fmt.Sprintf("%x", i)] = fmt.Sprintf("%x", storageValue)
-			}
-			formatted[index].Storage = &storage
-		}
-	}
-	return formatted
-}
-
 // RPCMarshalBlock converts the given block to the RPC output which depends on fullTx. If inclTx is true transactions are
 // returned. When fullTx is true the returned block contains full transaction details, otherwise it will only contain
 // transaction hashes.
@@ -857,22 +1072,7 @@ func (s *PublicBlockChainAPI) rpcOutputBlock(b *types.Block, inclTx bool, fullTx
 }
 
 // RPCTransaction represents a transaction that will serialize to the RPC representation of a transaction
-type RPCTransaction struct {
-	BlockHash        common.Hash     `json:"blockHash"`
-	BlockNumber      *hexutil.Big    `json:"blockNumber"`
-	From             common.Address  `json:"from"`
-	Gas              hexutil.Uint64  `json:"gas"`
-	GasPrice         *hexutil.Big    `json:"gasPrice"`
-	Hash             common.Hash     `json:"hash"`
-	Input            hexutil.Bytes   `json:"input"`
-	Nonce            hexutil.Uint64  `json:"nonce"`
-	To               *common.Address `json:"to"`
-	TransactionIndex hexutil.Uint    `json:"transactionIndex"`
-	Value            *hexutil.Big    `json:"value"`
-	V                *hexutil.Big    `json:"v"`
-	R                *hexutil.Big    `json:"r"`
-	S                *hexutil.Big    `json:"s"`
-}
+type RPCTransaction = apitypes.RPCTransaction
 
 // newRPCTransaction returns a transaction that will serialize to the RPC
 // representation, with the given location metadata set (if available).
@@ -905,8 +1105,8 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 	return result
 }
 
-// newRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
-func newRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
+// NewRPCPendingTransaction returns a pending transaction that will serialize to the RPC representation
+func NewRPCPendingTransaction(tx *types.Transaction) *RPCTransaction {
 	return newRPCTransaction(tx, common.Hash{}, 0, 0)
 }
 
@@ -1018,7 +1218,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionByHash(ctx context.Context, has
 	}
 	// No finalized transaction, try to retrieve it from the pool
 	if tx := s.b.GetPoolTransaction(hash); tx != nil {
-		return newRPCPendingTransaction(tx)
+		return NewRPCPendingTransaction(tx)
 	}
 	// Transaction unknown, return as such
 	return nil
@@ -1320,7 +1520,7 @@ func (s *PublicTransactionPoolAPI) PendingTransactions() ([]*RPCTransaction, err
 		}
 		from, _ := types.Sender(signer, tx)
 		if _, exists := accounts[from]; exists {
-			transactions = append(transactions, newRPCPendingTransaction(tx))
+			transactions = append(transactions, NewRPCPendingTransaction(tx))
 		}
 	}
 	return transactions, nil
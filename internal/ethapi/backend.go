@@ -20,9 +20,11 @@ package ethapi
 import (
 	"context"
 	"math/big"
+	"time"
 
 	"github.com/themis-network/go-themis/accounts"
 	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/consensus"
 	"github.com/themis-network/go-themis/core"
 	"github.com/themis-network/go-themis/core/state"
 	"github.com/themis-network/go-themis/core/types"
@@ -44,6 +46,8 @@ type Backend interface {
 	ChainDb() ethdb.Database
 	EventMux() *event.TypeMux
 	AccountManager() *accounts.Manager
+	RPCGasCap() uint64            // global gas cap for eth_callBundle over rpc: DoS protection
+	RPCEVMTimeout() time.Duration // global timeout for eth_callBundle over rpc: DoS protection
 
 	// BlockChain API
 	SetHead(number uint64)
@@ -65,9 +69,11 @@ type Backend interface {
 	GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error)
 	Stats() (pending int, queued int)
 	TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions)
+	TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions)
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
 
 	ChainConfig() *params.ChainConfig
+	Engine() consensus.Engine
 	CurrentBlock() *types.Block
 }
 
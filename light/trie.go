@@ -23,6 +23,7 @@ import (
 
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/core/state"
+	"github.com/themis-network/go-themis/core/state/snapshot"
 	"github.com/themis-network/go-themis/core/types"
 	"github.com/themis-network/go-themis/crypto"
 	"github.com/themis-network/go-themis/ethdb"
@@ -89,6 +90,10 @@ func (db *odrDatabase) TrieDB() *trie.Database {
 	return nil
 }
 
+func (db *odrDatabase) Snapshots() *snapshot.Tree {
+	return nil
+}
+
 type odrTrie struct {
 	db   *odrDatabase
 	id   *TrieID
@@ -75,6 +75,48 @@ func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
 	return true, nil
 }
 
+// AllowPeer adds a node to the allowlist of a permissioned node, assigning it the
+// given roles. The change is persisted in the data directory.
+func (api *PrivateAdminAPI) AllowPeer(url string, roles []string) (bool, error) {
+	// Make sure the server is running in permissioned mode, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if server.Permissions == nil {
+		return false, ErrNotPermissioned
+	}
+	node, err := discover.ParseNode(url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	if err := server.Permissions.Allow(node.ID, roles); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DenyPeer removes a node from the allowlist of a permissioned node and drops
+// the connection to it, if any.
+func (api *PrivateAdminAPI) DenyPeer(url string) (bool, error) {
+	// Make sure the server is running in permissioned mode, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	if server.Permissions == nil {
+		return false, ErrNotPermissioned
+	}
+	node, err := discover.ParseNode(url)
+	if err != nil {
+		return false, fmt.Errorf("invalid enode: %v", err)
+	}
+	if err := server.Permissions.Deny(node.ID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *PrivateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
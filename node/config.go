@@ -33,6 +33,8 @@ import (
 	"github.com/themis-network/go-themis/log"
 	"github.com/themis-network/go-themis/p2p"
 	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/p2p/permission"
+	"github.com/themis-network/go-themis/rpc"
 )
 
 const (
@@ -41,6 +43,9 @@ const (
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
 	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+
+	datadirPermissionedNodes   = "permissioned-nodes.json"   // Path within the datadir to the node allowlist
+	datadirPermissionOverrides = "permission-overrides.json" // Path within the datadir to the allowlist changes made via RPC
 )
 
 // Config represents a small collection of configuration values to fine tune the
@@ -69,6 +74,15 @@ type Config struct {
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
+	// Permissioned restricts peering to the nodes of an allowlist. The list is
+	// loaded from the permissioned-nodes.json file in the instance directory and
+	// can be changed through the admin API.
+	Permissioned bool `toml:",omitempty"`
+
+	// PermissionSigner is the account which must sign the allowlist file. It is
+	// required if the allowlist is loaded from the data directory.
+	PermissionSigner common.Address `toml:",omitempty"`
+
 	// KeyStoreDir is the file system folder that contains private keys. The directory can
 	// be specified as a relative path, in which case it is resolved relative to the
 	// current directory.
@@ -145,6 +159,25 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// RPCAuth configures the token based authentication of the HTTP and websocket
+	// RPC endpoints, along with the methods each token is permitted to call. If
+	// nil, the endpoints are open to anyone able to reach them. A relative audit
+	// log path is resolved in the instance directory.
+	RPCAuth *rpc.AuthConfig `toml:",omitempty"`
+
+	// RPCLimits limits the request rates, batch sizes, concurrency and execution
+	// times of the HTTP and websocket RPC clients. If nil, they are unlimited.
+	RPCLimits *rpc.Limits `toml:",omitempty"`
+
+	// RPCTLS configures the TLS termination of the HTTP and websocket RPC
+	// endpoints, optionally verifying client certificates. If nil, they are served
+	// in plain text. Relative file paths are resolved in the instance directory and
+	// the files are reloaded when the process receives SIGHUP.
+	//
+	// If the websocket endpoint is configured on the same host and port as the HTTP
+	// one, both are served by the same listener on the same path.
+	RPCTLS *rpc.TLSConfig `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 }
@@ -340,6 +373,20 @@ func (c *Config) TrustedNodes() []*discover.Node {
 	return c.parsePersistentNodes(c.resolvePath(datadirTrustedNodes))
 }
 
+// permissionList creates the node allowlist of permissioned mode. Without a
+// data directory, the list only contains the nodes allowed via the admin API.
+func (c *Config) permissionList() (*permission.List, error) {
+	var cfg permission.Config
+	if c.DataDir != "" {
+		cfg.Sources = []permission.Source{
+			permission.NewFileSource(c.resolvePath(datadirPermissionedNodes), c.PermissionSigner),
+		}
+		cfg.OverridesFile = c.resolvePath(datadirPermissionOverrides)
+		cfg.OverridesKey = c.NodeKey()
+	}
+	return permission.NewList(cfg)
+}
+
 // parsePersistentNodes parses a list of discovery node URLs loaded from a .json
 // file from within the data directory.
 func (c *Config) parsePersistentNodes(path string) []*discover.Node {
@@ -29,6 +29,9 @@ var (
 	ErrNodeRunning    = errors.New("node already running")
 	ErrServiceUnknown = errors.New("unknown service")
 
+	ErrNotPermissioned    = errors.New("node not running in permissioned mode")
+	ErrPermissionUnsigned = errors.New("permissioned mode requires an allowlist signer")
+
 	datadirInUseErrnos = map[uint]bool{11: true, 32: true, 35: true}
 )
 
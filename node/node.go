@@ -20,18 +20,23 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
+	"syscall"
 
 	"github.com/themis-network/go-themis/accounts"
+	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/ethdb"
 	"github.com/themis-network/go-themis/event"
 	"github.com/themis-network/go-themis/internal/debug"
 	"github.com/themis-network/go-themis/log"
 	"github.com/themis-network/go-themis/p2p"
+	"github.com/themis-network/go-themis/p2p/permission"
 	"github.com/themis-network/go-themis/rpc"
 	"github.com/prometheus/prometheus/util/flock"
 )
@@ -46,7 +51,8 @@ type Node struct {
 	instanceDirLock   flock.Releaser // prevents concurrent use of instance directory
 
 	serverConfig p2p.Config
-	server       *p2p.Server // Currently running P2P networking layer
+	server       *p2p.Server      // Currently running P2P networking layer
+	permissions  *permission.List // Node allowlist created for permissioned mode (nil = not owned by the node)
 
 	serviceFuncs []ServiceConstructor     // Service constructors (in dependency order)
 	services     map[reflect.Type]Service // Currently running services
@@ -58,14 +64,20 @@ type Node struct {
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
 	ipcHandler  *rpc.Server  // IPC RPC request handler to process the API requests
 
-	httpEndpoint  string       // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
-	httpWhitelist []string     // HTTP RPC modules to allow through this endpoint
-	httpListener  net.Listener // HTTP RPC listener socket to server API requests
-	httpHandler   *rpc.Server  // HTTP RPC request handler to process the API requests
+	httpEndpoint  string                  // HTTP endpoint (interface + port) to listen at (empty = HTTP disabled)
+	httpWhitelist []string                // HTTP RPC modules to allow through this endpoint
+	httpListener  net.Listener            // HTTP RPC listener socket to server API requests
+	httpHandler   *rpc.Server             // HTTP RPC request handler to process the API requests
+	httpHandlers  map[string]http.Handler // Additional HTTP handlers of the services, keyed by path
 
 	wsEndpoint string       // Websocket endpoint (interface + port) to listen at (empty = websocket disabled)
 	wsListener net.Listener // Websocket RPC listener socket to server API requests
 	wsHandler  *rpc.Server  // Websocket RPC request handler to process the API requests
+	wsShared   bool         // Whether the websocket endpoint is served by the HTTP listener
+
+	rpcAuth    *rpc.Authenticator // Authenticator of the HTTP and websocket endpoints (nil = disabled)
+	rpcTLS     *rpc.TLSTerminator // TLS termination of the HTTP and websocket endpoints (nil = disabled)
+	rpcTLSQuit chan struct{}      // Channel to stop reloading the TLS certificates on SIGHUP
 
 	stop chan struct{} // Channel to wait for termination notifications
 	lock sync.RWMutex
@@ -97,6 +109,11 @@ func New(conf *Config) (*Node, error) {
 	if strings.HasSuffix(conf.Name, ".ipc") {
 		return nil, errors.New(`Config.Name cannot end in ".ipc"`)
 	}
+	// Ensure that the allowlist file is signed, otherwise anyone able to write
+	// it could admit arbitrary peers.
+	if conf.Permissioned && conf.DataDir != "" && conf.PermissionSigner == (common.Address{}) {
+		return nil, ErrPermissionUnsigned
+	}
 	// Ensure that the AccountManager method works before the node has started.
 	// We rely on this in cmd/geth.
 	am, ephemeralKeystore, err := makeAccountManager(conf)
@@ -162,6 +179,20 @@ func (n *Node) Start() error {
 	if n.serverConfig.NodeDatabase == "" {
 		n.serverConfig.NodeDatabase = n.config.NodeDB()
 	}
+	if n.config.Permissioned && n.serverConfig.Permissions == nil {
+		perms, err := n.config.permissionList()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			// Release the list if startup fails.
+			if n.server == nil {
+				perms.Close()
+			}
+		}()
+		n.serverConfig.Permissions = perms
+		n.permissions = perms
+	}
 	running := &p2p.Server{Config: n.serverConfig}
 	n.log.Info("Starting peer-to-peer node", "instance", n.serverConfig.Name)
 
@@ -252,9 +283,17 @@ func (n *Node) openDataDir() error {
 func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	// Gather all the possible APIs to surface
 	apis := n.apis()
+	handlers := make(map[string]http.Handler)
 	for _, service := range services {
 		apis = append(apis, service.APIs()...)
+		if service, ok := service.(HTTPService); ok {
+			for path, handler := range service.HTTPHandlers() {
+				handlers[path] = handler
+			}
+		}
 	}
+	n.httpHandlers = handlers
+
 	// Start the various API endpoints, terminating all in case of errors
 	if err := n.startInProc(apis); err != nil {
 		return err
@@ -263,13 +302,28 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		n.stopInProc()
 		return err
 	}
+	if err := n.startRPCAuth(); err != nil {
+		n.stopIPC()
+		n.stopInProc()
+		return err
+	}
+	if err := n.startRPCTLS(); err != nil {
+		n.stopRPCAuth()
+		n.stopIPC()
+		n.stopInProc()
+		return err
+	}
 	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts); err != nil {
+		n.stopRPCTLS()
+		n.stopRPCAuth()
 		n.stopIPC()
 		n.stopInProc()
 		return err
 	}
 	if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll); err != nil {
 		n.stopHTTP()
+		n.stopRPCTLS()
+		n.stopRPCAuth()
 		n.stopIPC()
 		n.stopInProc()
 		return err
@@ -330,17 +384,121 @@ func (n *Node) stopIPC() {
 	}
 }
 
-// startHTTP initializes and starts the HTTP RPC endpoint.
+// startRPCAuth initializes the authentication of the HTTP and websocket RPC
+// endpoints, if configured.
+func (n *Node) startRPCAuth() error {
+	if n.config.RPCAuth == nil {
+		return nil
+	}
+	config := *n.config.RPCAuth
+	if config.AuditLog != "" && n.config.DataDir != "" {
+		config.AuditLog = n.config.resolvePath(config.AuditLog)
+	}
+	auth, err := rpc.NewAuthenticator(&config)
+	if err != nil {
+		return err
+	}
+	n.rpcAuth = auth
+	return nil
+}
+
+// stopRPCAuth releases the authentication of the HTTP and websocket RPC endpoints.
+func (n *Node) stopRPCAuth() {
+	if n.rpcAuth != nil {
+		if err := n.rpcAuth.Close(); err != nil {
+			n.log.Error("Failed to close RPC audit log", "err", err)
+		}
+		n.rpcAuth = nil
+	}
+}
+
+// startRPCTLS loads the certificates of the HTTP and websocket RPC endpoints, if
+// configured, reloading them whenever the process receives SIGHUP.
+func (n *Node) startRPCTLS() error {
+	if n.config.RPCTLS == nil {
+		return nil
+	}
+	config := *n.config.RPCTLS
+	for _, path := range []*string{&config.CertFile, &config.KeyFile, &config.ClientCAFile} {
+		if *path != "" && n.config.DataDir != "" {
+			*path = n.config.resolvePath(*path)
+		}
+	}
+	terminator, err := rpc.NewTLSTerminator(&config)
+	if err != nil {
+		return err
+	}
+	n.rpcTLS = terminator
+	n.rpcTLSQuit = make(chan struct{})
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func(quit chan struct{}) {
+		defer signal.Stop(sighup)
+		for {
+			select {
+			case <-sighup:
+				if err := terminator.Reload(); err != nil {
+					n.log.Error("Failed to reload RPC TLS certificates", "err", err)
+				} else {
+					n.log.Info("Reloaded RPC TLS certificates")
+				}
+			case <-quit:
+				return
+			}
+		}
+	}(n.rpcTLSQuit)
+	return nil
+}
+
+// stopRPCTLS stops reloading the certificates of the HTTP and websocket RPC
+// endpoints.
+func (n *Node) stopRPCTLS() {
+	if n.rpcTLS != nil {
+		close(n.rpcTLSQuit)
+		n.rpcTLS, n.rpcTLSQuit = nil, nil
+	}
+}
+
+// rpcScheme returns the scheme of the HTTP or websocket RPC endpoint URLs,
+// depending on whether TLS is enabled.
+func (n *Node) rpcScheme(scheme string) string {
+	if n.rpcTLS != nil {
+		return scheme + "s"
+	}
+	return scheme
+}
+
+// startHTTP initializes and starts the HTTP RPC endpoint. If the websocket
+// endpoint is configured on the same port, it is served by the same listener.
 func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors []string, vhosts []string) error {
 	// Short circuit if the HTTP endpoint isn't being exposed
 	if endpoint == "" {
 		return nil
 	}
-	listener, handler, err := rpc.StartHTTPEndpoint(endpoint, apis, modules, cors, vhosts)
+	var (
+		ws        http.Handler
+		wsHandler *rpc.Server
+		err       error
+	)
+	if n.sharesWS(endpoint) {
+		wsHandler, ws, err = rpc.NewWSHandler(apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll, n.rpcAuth, n.config.RPCLimits)
+		if err != nil {
+			return err
+		}
+	}
+	listener, handler, err := rpc.StartHTTPEndpoint(endpoint, apis, modules, cors, vhosts, n.rpcAuth, n.config.RPCLimits, n.httpHandlers, ws, n.rpcTLS)
 	if err != nil {
+		if wsHandler != nil {
+			wsHandler.Stop()
+		}
 		return err
 	}
-	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s", endpoint), "cors", strings.Join(cors, ","), "vhosts", strings.Join(vhosts, ","))
+	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("%s://%s", n.rpcScheme("http"), endpoint), "cors", strings.Join(cors, ","), "vhosts", strings.Join(vhosts, ","))
+	if wsHandler != nil {
+		n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("%s://%s", n.rpcScheme("ws"), listener.Addr()))
+		n.wsHandler, n.wsShared = wsHandler, true
+	}
 	// All listeners booted successfully
 	n.httpEndpoint = endpoint
 	n.httpListener = listener
@@ -349,13 +507,27 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 	return nil
 }
 
-// stopHTTP terminates the HTTP RPC endpoint.
+// sharesWS reports whether the websocket endpoint is served by an HTTP listener
+// on the given endpoint. Endpoints with a random port are never shared.
+func (n *Node) sharesWS(endpoint string) bool {
+	if endpoint != n.wsEndpoint || n.wsHandler != nil {
+		return false
+	}
+	_, port, err := net.SplitHostPort(endpoint)
+	return err == nil && port != "0"
+}
+
+// stopHTTP terminates the HTTP RPC endpoint, along with the websocket endpoint if
+// it is served by the same listener.
 func (n *Node) stopHTTP() {
+	if n.wsShared {
+		n.stopWS()
+	}
 	if n.httpListener != nil {
 		n.httpListener.Close()
 		n.httpListener = nil
 
-		n.log.Info("HTTP endpoint closed", "url", fmt.Sprintf("http://%s", n.httpEndpoint))
+		n.log.Info("HTTP endpoint closed", "url", fmt.Sprintf("%s://%s", n.rpcScheme("http"), n.httpEndpoint))
 	}
 	if n.httpHandler != nil {
 		n.httpHandler.Stop()
@@ -365,15 +537,16 @@ func (n *Node) stopHTTP() {
 
 // startWS initializes and starts the websocket RPC endpoint.
 func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrigins []string, exposeAll bool) error {
-	// Short circuit if the WS endpoint isn't being exposed
-	if endpoint == "" {
+	// Short circuit if the WS endpoint isn't being exposed, or is served by the
+	// HTTP listener already
+	if endpoint == "" || n.wsShared {
 		return nil
 	}
-	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll)
+	listener, handler, err := rpc.StartWSEndpoint(endpoint, apis, modules, wsOrigins, exposeAll, n.rpcAuth, n.config.RPCLimits, n.rpcTLS)
 	if err != nil {
 		return err
 	}
-	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", listener.Addr()))
+	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("%s://%s", n.rpcScheme("ws"), listener.Addr()))
 	// All listeners booted successfully
 	n.wsEndpoint = endpoint
 	n.wsListener = listener
@@ -382,18 +555,20 @@ func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrig
 	return nil
 }
 
-// stopWS terminates the websocket RPC endpoint.
+// stopWS terminates the websocket RPC endpoint. If it is served by the HTTP
+// listener, new upgrade requests are rejected until the HTTP endpoint restarts.
 func (n *Node) stopWS() {
 	if n.wsListener != nil {
 		n.wsListener.Close()
 		n.wsListener = nil
-
-		n.log.Info("WebSocket endpoint closed", "url", fmt.Sprintf("ws://%s", n.wsEndpoint))
 	}
 	if n.wsHandler != nil {
 		n.wsHandler.Stop()
 		n.wsHandler = nil
+
+		n.log.Info("WebSocket endpoint closed", "url", fmt.Sprintf("%s://%s", n.rpcScheme("ws"), n.wsEndpoint))
 	}
+	n.wsShared = false
 }
 
 // Stop terminates a running node along with all it's services. In the node was
@@ -410,6 +585,8 @@ func (n *Node) Stop() error {
 	// Terminate the API, services and the p2p server.
 	n.stopWS()
 	n.stopHTTP()
+	n.stopRPCTLS()
+	n.stopRPCAuth()
 	n.stopIPC()
 	n.rpcAPIs = nil
 	failure := &StopError{
@@ -423,6 +600,10 @@ func (n *Node) Stop() error {
 	n.server.Stop()
 	n.services = nil
 	n.server = nil
+	if n.permissions != nil {
+		n.permissions.Close()
+		n.permissions = nil
+	}
 
 	// Release instance directory lock.
 	if n.instanceDirLock != nil {
@@ -24,6 +24,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/crypto"
 	"github.com/themis-network/go-themis/p2p"
 	"github.com/themis-network/go-themis/rpc"
@@ -573,3 +574,31 @@ func TestAPIGather(t *testing.T) {
 		}
 	}
 }
+
+// Tests that permissioned nodes only load signed allowlists from their data
+// directory.
+func TestNodePermissionedSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Without a signer, the allowlist file must be refused
+	if _, err := New(&Config{DataDir: dir, Permissioned: true}); err != ErrPermissionUnsigned {
+		t.Fatalf("unsigned allowlist failure mismatch: have %v, want %v", err, ErrPermissionUnsigned)
+	}
+	// Without a data directory, no allowlist file is loaded
+	if _, err := New(&Config{Permissioned: true}); err != nil {
+		t.Fatalf("failed to create ephemeral protocol stack: %v", err)
+	}
+	// With a signer, the node must start
+	signed, err := New(&Config{DataDir: dir, Permissioned: true, PermissionSigner: common.HexToAddress("0x01"), P2P: p2p.Config{PrivateKey: testNodeKey}})
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	if err := signed.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	signed.Stop()
+}
@@ -17,6 +17,7 @@
 package node
 
 import (
+	"net/http"
 	"reflect"
 
 	"github.com/themis-network/go-themis/accounts"
@@ -96,3 +97,13 @@ type Service interface {
 	// are all terminated.
 	Stop() error
 }
+
+// HTTPService is a service which, besides its RPC APIs, serves plain HTTP handlers
+// on the HTTP-RPC endpoint.
+type HTTPService interface {
+	Service
+
+	// HTTPHandlers retrieves the handlers to mount on the HTTP endpoint, keyed by
+	// their path.
+	HTTPHandlers() map[string]http.Handler
+}
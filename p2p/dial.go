@@ -26,7 +26,9 @@ import (
 
 	"github.com/themis-network/go-themis/log"
 	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/p2p/enr"
 	"github.com/themis-network/go-themis/p2p/netutil"
+	"github.com/themis-network/go-themis/p2p/permission"
 )
 
 const (
@@ -72,11 +74,13 @@ type dialstate struct {
 	maxDynDials int
 	ntab        discoverTable
 	netrestrict *netutil.Netlist
+	permissions *permission.List
 
 	lookupRunning bool
 	dialing       map[discover.NodeID]connFlag
 	lookupBuf     []*discover.Node // current discovery lookup results
 	randomNodes   []*discover.Node // filled from Table
+	sources       []NodeSource     // additional sources of dial candidates
 	static        map[discover.NodeID]*dialTask
 	hist          *dialHistory
 
@@ -90,6 +94,8 @@ type discoverTable interface {
 	Resolve(target discover.NodeID) *discover.Node
 	Lookup(target discover.NodeID) []*discover.Node
 	ReadRandomNodes([]*discover.Node) int
+	RequestENR(*discover.Node) (*enr.Record, error)
+	SetLocalEntry(enr.Entry) error
 }
 
 // the dial history remembers recent dials.
@@ -226,6 +232,19 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 			}
 		}
 	}
+	// Use nodes from the additional sources for half of the remaining dynamic
+	// dials. Unlike table nodes, source nodes are often connected already, so
+	// all returned nodes are considered.
+	for _, src := range s.sources {
+		sourceCandidates := (needDynDials + 1) / 2
+		n := src.ReadRandomNodes(s.randomNodes)
+		for i := 0; sourceCandidates > 0 && i < n; i++ {
+			if addDial(dynDialedConn, s.randomNodes[i]) {
+				needDynDials--
+				sourceCandidates--
+			}
+		}
+	}
 	// Create dynamic dials from random lookup results, removing tried
 	// items from the result buffer.
 	i := 0
@@ -258,6 +277,7 @@ var (
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
+	errNotAllowed       = errors.New("not contained in node allowlist")
 )
 
 func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer) error {
@@ -271,6 +291,8 @@ func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer)
 		return errSelf
 	case s.netrestrict != nil && !s.netrestrict.Contains(n.IP):
 		return errNotWhitelisted
+	case s.permissions != nil && !s.permissions.Allowed(n.ID):
+		return errNotAllowed
 	case s.hist.contains(n.ID):
 		return errRecentlyDialed
 	}
@@ -294,6 +316,9 @@ func (t *dialTask) Do(srv *Server) {
 			return
 		}
 	}
+	if t.flags&dynDialedConn != 0 && !t.checkRecord(srv) {
+		return
+	}
 	err := t.dial(srv, t.dest)
 	if err != nil {
 		log.Trace("Dial error", "task", t, "err", err)
@@ -340,6 +365,33 @@ func (t *dialTask) resolve(srv *Server) bool {
 	return true
 }
 
+// checkRecord retrieves the node record of a discovered destination and runs
+// it through the dial filters of the protocols. Nodes whose record can't be
+// retrieved are dialed nonetheless.
+func (t *dialTask) checkRecord(srv *Server) bool {
+	var filters []func(*enr.Record) bool
+	for _, proto := range srv.Protocols {
+		if proto.DialFilter != nil {
+			filters = append(filters, proto.DialFilter)
+		}
+	}
+	if len(filters) == 0 || srv.ntab == nil {
+		return true
+	}
+	record, err := srv.ntab.RequestENR(t.dest)
+	if err != nil {
+		log.Trace("Node record unavailable", "id", t.dest.ID, "err", err)
+		return true
+	}
+	for _, filter := range filters {
+		if !filter(record) {
+			log.Debug("Skipping filtered node", "id", t.dest.ID, "seq", record.Seq())
+			return false
+		}
+	}
+	return true
+}
+
 type dialError struct {
 	error
 }
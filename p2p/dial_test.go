@@ -18,6 +18,7 @@ package p2p
 
 import (
 	"encoding/binary"
+	"errors"
 	"net"
 	"reflect"
 	"testing"
@@ -25,6 +26,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/p2p/enr"
 	"github.com/themis-network/go-themis/p2p/netutil"
 )
 
@@ -83,6 +85,11 @@ func (t fakeTable) Close()                                   {}
 func (t fakeTable) Lookup(discover.NodeID) []*discover.Node  { return nil }
 func (t fakeTable) Resolve(discover.NodeID) *discover.Node   { return nil }
 func (t fakeTable) ReadRandomNodes(buf []*discover.Node) int { return copy(buf, t) }
+func (t fakeTable) SetLocalEntry(enr.Entry) error            { return nil }
+
+func (t fakeTable) RequestENR(*discover.Node) (*enr.Record, error) {
+	return nil, errors.New("record unavailable")
+}
 
 // This test checks that dynamic dials are launched from discovery results.
 func TestDialStateDynDial(t *testing.T) {
@@ -307,6 +314,45 @@ func TestDialStateDynDialBootnode(t *testing.T) {
 	})
 }
 
+// This test checks that dynamic dials are launched from additional node
+// sources, like DNS node lists.
+func TestDialStateDynDialFromSource(t *testing.T) {
+	state := newDialState(nil, nil, fakeTable{{ID: uintID(1)}, {ID: uintID(2)}}, 8, nil)
+	state.sources = []NodeSource{fakeTable{
+		{ID: uintID(3)},
+		{ID: uintID(4)},
+		{ID: uintID(5)},
+		{ID: uintID(6)},
+	}}
+	runDialTest(t, dialtest{
+		init: state,
+		rounds: []round{
+			// 2 dials from the table, 3 from the source for half of the
+			// remaining dials, and a lookup for the rest.
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(1)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(2)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(3)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(4)}},
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(5)}},
+					&discoverTask{},
+				},
+			},
+			// Dials of source nodes aren't repeated while they're in the dial
+			// history.
+			{
+				done: []task{
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(3)}},
+				},
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: &discover.Node{ID: uintID(6)}},
+				},
+			},
+		},
+	})
+}
+
 func TestDialStateDynDialFromTable(t *testing.T) {
 	// This table always returns the same random nodes
 	// in the order given below.
@@ -655,6 +701,47 @@ func TestDialResolve(t *testing.T) {
 	}
 }
 
+// This test checks that dynamic dials are skipped if the node record of the
+// destination is rejected by a protocol.
+func TestDialFilter(t *testing.T) {
+	var (
+		accepted = discover.NewNode(uintID(1), net.IP{127, 0, 0, 1}, 30303, 30303)
+		rejected = discover.NewNode(uintID(2), net.IP{127, 0, 0, 2}, 30303, 30303)
+		noentry  = discover.NewNode(uintID(3), net.IP{127, 0, 0, 3}, 30303, 30303)
+		unknown  = discover.NewNode(uintID(4), net.IP{127, 0, 0, 4}, 30303, 30303)
+	)
+	table := &recordMock{records: make(map[discover.NodeID]*enr.Record)}
+	for node, version := range map[*discover.Node]uint{accepted: 1, rejected: 2} {
+		var r enr.Record
+		r.Set(enr.WithEntry("test", version))
+		table.records[node.ID] = &r
+	}
+	table.records[noentry.ID] = new(enr.Record)
+
+	filter := func(r *enr.Record) bool {
+		var version uint
+		if err := r.Load(enr.WithEntry("test", &version)); enr.IsNotFound(err) {
+			return true
+		}
+		return version == 1
+	}
+	dialer := new(dialRecorder)
+	srv := &Server{ntab: table, Config: Config{
+		Dialer:    dialer,
+		Protocols: []Protocol{{Name: "test", DialFilter: filter}},
+	}}
+	for _, node := range []*discover.Node{accepted, rejected, noentry, unknown} {
+		(&dialTask{flags: dynDialedConn, dest: node}).Do(srv)
+	}
+	// Static dials are never filtered.
+	(&dialTask{flags: staticDialedConn, dest: rejected, lastResolved: time.Now()}).Do(srv)
+
+	want := []discover.NodeID{accepted.ID, noentry.ID, unknown.ID, rejected.ID}
+	if !reflect.DeepEqual(dialer.dialed, want) {
+		t.Errorf("dialed nodes mismatch:\n  got:  %v\n  want: %v", dialer.dialed, want)
+	}
+}
+
 // compares task lists but doesn't care about the order.
 func sametasks(a, b []task) bool {
 	if len(a) != len(b) {
@@ -694,3 +781,31 @@ func (t *resolveMock) Close()                                   {}
 func (t *resolveMock) Bootstrap([]*discover.Node)               {}
 func (t *resolveMock) Lookup(discover.NodeID) []*discover.Node  { return nil }
 func (t *resolveMock) ReadRandomNodes(buf []*discover.Node) int { return 0 }
+func (t *resolveMock) SetLocalEntry(enr.Entry) error            { return nil }
+
+func (t *resolveMock) RequestENR(*discover.Node) (*enr.Record, error) {
+	return nil, errors.New("record unavailable")
+}
+
+// implements discoverTable for TestDialFilter
+type recordMock struct {
+	fakeTable
+	records map[discover.NodeID]*enr.Record
+}
+
+func (t *recordMock) RequestENR(n *discover.Node) (*enr.Record, error) {
+	if r, ok := t.records[n.ID]; ok {
+		return r, nil
+	}
+	return nil, errors.New("record unavailable")
+}
+
+// implements NodeDialer for TestDialFilter
+type dialRecorder struct {
+	dialed []discover.NodeID
+}
+
+func (d *dialRecorder) Dial(n *discover.Node) (net.Conn, error) {
+	d.dialed = append(d.dialed, n.ID)
+	return nil, errors.New("connection refused")
+}
@@ -55,8 +55,9 @@ type nodeDB struct {
 
 // Schema layout for the node database
 var (
-	nodeDBVersionKey = []byte("version") // Version of the database to flush if changes
-	nodeDBItemPrefix = []byte("n:")      // Identifier to prefix node entries with
+	nodeDBVersionKey = []byte("version")  // Version of the database to flush if changes
+	nodeDBItemPrefix = []byte("n:")       // Identifier to prefix node entries with
+	nodeDBLocalSeq   = []byte("localseq") // Sequence number of the local node record
 
 	nodeDBDiscoverRoot      = ":discover"
 	nodeDBDiscoverPing      = nodeDBDiscoverRoot + ":lastping"
@@ -303,6 +304,16 @@ func (db *nodeDB) updateFindFails(id NodeID, fails int) error {
 	return db.storeInt64(makeKey(id, nodeDBDiscoverFindFails), int64(fails))
 }
 
+// localSeq retrieves the sequence number of the last published local node record.
+func (db *nodeDB) localSeq() uint64 {
+	return uint64(db.fetchInt64(nodeDBLocalSeq))
+}
+
+// storeLocalSeq stores the sequence number of the published local node record.
+func (db *nodeDB) storeLocalSeq(seq uint64) error {
+	return db.storeInt64(nodeDBLocalSeq, int64(seq))
+}
+
 // querySeeds retrieves random nodes to be used as potential seed nodes
 // for bootstrapping.
 func (db *nodeDB) querySeeds(n int, maxAge time.Duration) []*Node {
@@ -35,6 +35,7 @@ import (
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/crypto"
 	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/p2p/enr"
 	"github.com/themis-network/go-themis/p2p/netutil"
 )
 
@@ -87,6 +88,9 @@ type Table struct {
 type transport interface {
 	ping(NodeID, *net.UDPAddr) error
 	findnode(toid NodeID, addr *net.UDPAddr, target NodeID) ([]*Node, error)
+	requestENR(toid NodeID, addr *net.UDPAddr) (*enr.Record, error)
+	localRecord() *enr.Record
+	setLocalEntry(e enr.Entry) error
 	close()
 }
 
@@ -148,6 +152,23 @@ func (tab *Table) Self() *Node {
 	return tab.self
 }
 
+// Record returns the signed record of the local node.
+// The returned record should not be modified by the caller.
+func (tab *Table) Record() *enr.Record {
+	return tab.net.localRecord()
+}
+
+// SetLocalEntry adds or updates an entry of the local node record and signs
+// the record with an incremented sequence number.
+func (tab *Table) SetLocalEntry(e enr.Entry) error {
+	return tab.net.setLocalEntry(e)
+}
+
+// RequestENR retrieves the current record of the given node.
+func (tab *Table) RequestENR(n *Node) (*enr.Record, error) {
+	return tab.net.requestENR(n.ID, n.addr())
+}
+
 // ReadRandomNodes fills the given slice with random nodes from the
 // table. It will not write the same node more than once. The nodes in
 // the slice are copies and can be modified by the caller.
@@ -30,6 +30,7 @@ import (
 
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/p2p/enr"
 )
 
 func TestTable_pingReplace(t *testing.T) {
@@ -216,6 +217,14 @@ func (t *pingRecorder) ping(toid NodeID, toaddr *net.UDPAddr) error {
 
 func (t *pingRecorder) close() {}
 
+func (t *pingRecorder) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	return nil, errTimeout
+}
+
+func (t *pingRecorder) localRecord() *enr.Record { return nil }
+
+func (t *pingRecorder) setLocalEntry(e enr.Entry) error { return nil }
+
 func TestTable_closest(t *testing.T) {
 	t.Parallel()
 
@@ -573,6 +582,12 @@ func (tn *preminedTestnet) findnode(toid NodeID, toaddr *net.UDPAddr, target Nod
 func (*preminedTestnet) close()                                      {}
 func (*preminedTestnet) waitping(from NodeID) error                  { return nil }
 func (*preminedTestnet) ping(toid NodeID, toaddr *net.UDPAddr) error { return nil }
+func (*preminedTestnet) localRecord() *enr.Record                    { return nil }
+func (*preminedTestnet) setLocalEntry(e enr.Entry) error             { return nil }
+
+func (*preminedTestnet) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	return nil, errTimeout
+}
 
 // mine generates a testnet struct literal with nodes at
 // various distances to the given target.
@@ -23,10 +23,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/themis-network/go-themis/crypto"
 	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/p2p/enr"
 	"github.com/themis-network/go-themis/p2p/nat"
 	"github.com/themis-network/go-themis/p2p/netutil"
 	"github.com/themis-network/go-themis/rlp"
@@ -42,6 +44,7 @@ var (
 	errTimeout          = errors.New("RPC timeout")
 	errClockWarp        = errors.New("reply deadline too far in the future")
 	errClosed           = errors.New("socket closed")
+	errRecordMismatch   = errors.New("record of different node")
 )
 
 // Timeouts
@@ -60,6 +63,8 @@ const (
 	pongPacket
 	findnodePacket
 	neighborsPacket
+	enrRequestPacket
+	enrResponsePacket
 )
 
 // RPC request structures
@@ -101,6 +106,21 @@ type (
 		Rest []rlp.RawValue `rlp:"tail"`
 	}
 
+	// enrRequest is a query for the current node record of the recipient.
+	enrRequest struct {
+		Expiration uint64
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// enrResponse is the reply to enrRequest.
+	enrResponse struct {
+		ReplyTok []byte // Hash of the enrRequest packet.
+		Record   enr.Record
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
 	rpcNode struct {
 		IP  net.IP // len 4 for IPv4 or 16 for IPv6
 		UDP uint16 // for discovery protocol
@@ -161,6 +181,9 @@ type udp struct {
 	priv        *ecdsa.PrivateKey
 	ourEndpoint rpcEndpoint
 
+	recordMu sync.Mutex
+	record   *enr.Record // signed record of the local node, replaced on every change
+
 	addpending chan *pending
 	gotreply   chan reply
 
@@ -257,11 +280,57 @@ func newUDP(c conn, cfg Config) (*Table, *udp, error) {
 	}
 	udp.Table = tab
 
+	if err := udp.initRecord(realaddr); err != nil {
+		tab.Close()
+		return nil, nil, err
+	}
 	go udp.loop()
 	go udp.readLoop(cfg.Unhandled)
 	return udp.Table, udp, nil
 }
 
+// initRecord creates the record of the local node, continuing the sequence
+// numbers of the records published before.
+func (t *udp) initRecord(addr *net.UDPAddr) error {
+	var r enr.Record
+	if !addr.IP.IsUnspecified() {
+		r.Set(enr.IP(addr.IP))
+	}
+	r.Set(enr.UDP(addr.Port))
+	r.Set(enr.TCP(t.ourEndpoint.TCP))
+	r.SetSeq(t.db.localSeq())
+
+	if err := enr.SignV4(&r, t.priv); err != nil {
+		return err
+	}
+	t.record = &r
+	return t.db.storeLocalSeq(r.Seq())
+}
+
+// localRecord returns the current record of the local node. The returned
+// record must not be modified.
+func (t *udp) localRecord() *enr.Record {
+	t.recordMu.Lock()
+	defer t.recordMu.Unlock()
+
+	return t.record
+}
+
+// setLocalEntry adds or updates an entry of the local node record, signing
+// it with a new sequence number.
+func (t *udp) setLocalEntry(e enr.Entry) error {
+	t.recordMu.Lock()
+	defer t.recordMu.Unlock()
+
+	r := *t.record
+	r.Set(e)
+	if err := enr.SignV4(&r, t.priv); err != nil {
+		return err
+	}
+	t.record = &r
+	return t.db.storeLocalSeq(r.Seq())
+}
+
 func (t *udp) close() {
 	close(t.closing)
 	t.conn.Close()
@@ -335,6 +404,46 @@ func (t *udp) findnode(toid NodeID, toaddr *net.UDPAddr, target NodeID) ([]*Node
 	return nodes, <-errc
 }
 
+// requestENR sends an ENR request to the given node and waits for the node
+// record in the reply.
+func (t *udp) requestENR(toid NodeID, toaddr *net.UDPAddr) (*enr.Record, error) {
+	// Like findnode, the request is only answered if the destination node
+	// has a recent endpoint proof of ours.
+	if time.Since(t.db.lastPingReceived(toid)) > nodeDBNodeExpiration {
+		t.ping(toid, toaddr)
+		t.waitping(toid)
+	}
+	req := &enrRequest{
+		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	}
+	packet, hash, err := encodePacket(t.priv, enrRequestPacket, req)
+	if err != nil {
+		return nil, err
+	}
+	var record *enr.Record
+	errc := t.pending(toid, enrResponsePacket, func(r interface{}) bool {
+		reply := r.(*enrResponse)
+		if !bytes.Equal(reply.ReplyTok, hash) {
+			return false
+		}
+		record = &reply.Record
+		return true
+	})
+	t.write(toaddr, req.name(), packet)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	// The record is signed, but ensure it was signed by the requested node
+	var pubkey enr.Secp256k1
+	if err := record.Load(&pubkey); err != nil {
+		return nil, err
+	}
+	if PubkeyID((*ecdsa.PublicKey)(&pubkey)) != toid {
+		return nil, errRecordMismatch
+	}
+	return record, nil
+}
+
 // pending adds a reply callback to the pending reply queue.
 // see the documentation of type pending for a detailed explanation.
 func (t *udp) pending(id NodeID, ptype byte, callback func(interface{}) bool) <-chan error {
@@ -586,6 +695,10 @@ func decodePacket(buf []byte) (packet, NodeID, []byte, error) {
 		req = new(findnode)
 	case neighborsPacket:
 		req = new(neighbors)
+	case enrRequestPacket:
+		req = new(enrRequest)
+	case enrResponsePacket:
+		req = new(enrResponse)
 	default:
 		return nil, fromID, hash, fmt.Errorf("unknown type: %d", ptype)
 	}
@@ -684,6 +797,33 @@ func (req *neighbors) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byt
 
 func (req *neighbors) name() string { return "NEIGHBORS/v4" }
 
+func (req *enrRequest) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	if !t.db.hasBond(fromID) {
+		// Same as findnode, the response is much bigger than the request and
+		// must not be sent to unverified endpoints.
+		return errUnknownNode
+	}
+	t.send(from, enrResponsePacket, &enrResponse{
+		ReplyTok: mac,
+		Record:   *t.localRecord(),
+	})
+	return nil
+}
+
+func (req *enrRequest) name() string { return "ENRREQUEST/v4" }
+
+func (req *enrResponse) handle(t *udp, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if !t.handleReply(fromID, enrResponsePacket, req) {
+		return errUnsolicitedReply
+	}
+	return nil
+}
+
+func (req *enrResponse) name() string { return "ENRRESPONSE/v4" }
+
 func expired(ts uint64) bool {
 	return time.Unix(int64(ts), 0).Before(time.Now())
 }
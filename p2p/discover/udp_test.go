@@ -36,6 +36,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/themis-network/go-themis/common"
 	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/p2p/enr"
 	"github.com/themis-network/go-themis/rlp"
 )
 
@@ -128,6 +129,8 @@ func TestUDP_packetErrors(t *testing.T) {
 	test.packetIn(errUnsolicitedReply, pongPacket, &pong{ReplyTok: []byte{}, Expiration: futureExp})
 	test.packetIn(errUnknownNode, findnodePacket, &findnode{Expiration: futureExp})
 	test.packetIn(errUnsolicitedReply, neighborsPacket, &neighbors{Expiration: futureExp})
+	test.packetIn(errUnknownNode, enrRequestPacket, &enrRequest{Expiration: futureExp})
+	test.packetIn(errUnsolicitedReply, enrResponsePacket, &enrResponse{Record: *test.udp.localRecord()})
 }
 
 func TestUDP_pingTimeout(t *testing.T) {
@@ -323,6 +326,104 @@ func TestUDP_findnodeMultiReply(t *testing.T) {
 	}
 }
 
+func TestUDP_enrRequest(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	// ensure there's a bond with the test node,
+	// the request won't be answered otherwise.
+	test.table.db.updateLastPongReceived(PubkeyID(&test.remotekey.PublicKey), time.Now())
+
+	seq := test.udp.localRecord().Seq()
+	if err := test.table.SetLocalEntry(enr.WithEntry("foo", "bar")); err != nil {
+		t.Fatalf("can't set local entry: %v", err)
+	}
+	test.packetIn(nil, enrRequestPacket, &enrRequest{Expiration: futureExp})
+	test.waitPacketOut(func(p *enrResponse) {
+		reqhash := test.sent[0][:macSize]
+		if !bytes.Equal(p.ReplyTok, reqhash) {
+			t.Errorf("got enrResponse.ReplyTok %x, want %x", p.ReplyTok, reqhash)
+		}
+		if p.Record.Seq() <= seq {
+			t.Errorf("record sequence number not increased: got %d, had %d", p.Record.Seq(), seq)
+		}
+		var foo string
+		if err := p.Record.Load(enr.WithEntry("foo", &foo)); err != nil || foo != "bar" {
+			t.Errorf("wrong local entry: %q, %v", foo, err)
+		}
+		var id enr.Secp256k1
+		p.Record.Load(&id)
+		if PubkeyID((*ecdsa.PublicKey)(&id)) != PubkeyID(&test.localkey.PublicKey) {
+			t.Errorf("record signed by wrong key")
+		}
+	})
+}
+
+func TestUDP_requestENR(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	rid := PubkeyID(&test.remotekey.PublicKey)
+	test.table.db.updateLastPingReceived(rid, time.Now())
+
+	// queue a pending ENR request
+	resultc, errc := make(chan *enr.Record), make(chan error)
+	go func() {
+		r, err := test.udp.requestENR(rid, test.remoteaddr)
+		if err != nil {
+			errc <- err
+		} else {
+			resultc <- r
+		}
+	}()
+
+	// reply with a record of the remote node
+	var record enr.Record
+	record.Set(enr.WithEntry("foo", "bar"))
+	if err := enr.SignV4(&record, test.remotekey); err != nil {
+		t.Fatalf("can't sign record: %v", err)
+	}
+	reqhash, _ := test.waitPacketOut(func(p *enrRequest) {})
+	test.packetIn(nil, enrResponsePacket, &enrResponse{ReplyTok: reqhash, Record: record})
+
+	select {
+	case result := <-resultc:
+		if result.Seq() != record.Seq() {
+			t.Errorf("record mismatch: got seq %d, want %d", result.Seq(), record.Seq())
+		}
+	case err := <-errc:
+		t.Errorf("requestENR error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Error("requestENR did not return within 5 seconds")
+	}
+}
+
+func TestUDP_requestENRWrongNode(t *testing.T) {
+	test := newUDPTest(t)
+	defer test.table.Close()
+
+	rid := PubkeyID(&test.remotekey.PublicKey)
+	test.table.db.updateLastPingReceived(rid, time.Now())
+
+	errc := make(chan error)
+	go func() {
+		_, err := test.udp.requestENR(rid, test.remoteaddr)
+		errc <- err
+	}()
+
+	// reply with a record signed by some other node
+	var record enr.Record
+	if err := enr.SignV4(&record, newkey()); err != nil {
+		t.Fatalf("can't sign record: %v", err)
+	}
+	reqhash, _ := test.waitPacketOut(func(p *enrRequest) {})
+	test.packetIn(nil, enrResponsePacket, &enrResponse{ReplyTok: reqhash, Record: record})
+
+	if err := <-errc; err != errRecordMismatch {
+		t.Errorf("error mismatch: got %v, want %v", err, errRecordMismatch)
+	}
+}
+
 func TestUDP_successfulPing(t *testing.T) {
 	test := newUDPTest(t)
 	added := make(chan *Node, 1)
@@ -0,0 +1,410 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dnsdisc implements node discovery via DNS (EIP-1459). Node lists are
+// published as merkle trees of node records in DNS TXT records, signed with the
+// key of the list operator.
+package dnsdisc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/p2p/enr"
+)
+
+// Client discovers nodes by querying DNS servers.
+type Client struct {
+	cfg     Config
+	entries *lru.Cache
+}
+
+// Config holds configuration options for the client.
+type Config struct {
+	Timeout         time.Duration // timeout used for DNS lookups (default 5s)
+	RecheckInterval time.Duration // time between tree root update checks (default 30min)
+	CacheLimit      int           // maximum number of cached records (default 1000)
+	Resolver        Resolver      // the DNS resolver to use (defaults to system DNS)
+	Logger          log.Logger    // destination of client log messages (defaults to root logger)
+}
+
+// Resolver is a DNS resolver that can query TXT records.
+type Resolver interface {
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+}
+
+func (cfg Config) withDefaults() Config {
+	const (
+		defaultTimeout = 5 * time.Second
+		defaultRecheck = 30 * time.Minute
+		defaultCache   = 1000
+	)
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.RecheckInterval == 0 {
+		cfg.RecheckInterval = defaultRecheck
+	}
+	if cfg.CacheLimit == 0 {
+		cfg.CacheLimit = defaultCache
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = new(net.Resolver)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = log.Root()
+	}
+	return cfg
+}
+
+// NewClient creates a client.
+func NewClient(cfg Config) *Client {
+	cfg = cfg.withDefaults()
+	cache, err := lru.New(cfg.CacheLimit)
+	if err != nil {
+		panic(err)
+	}
+	return &Client{cfg: cfg, entries: cache}
+}
+
+// SyncTree downloads the entire node tree at the given URL.
+func (c *Client) SyncTree(url string) (*Tree, error) {
+	loc, err := parseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrtree URL: %v", err)
+	}
+	t := &Tree{entries: make(map[string]entry)}
+	root, err := c.syncTree(context.Background(), loc, t.entries)
+	if err != nil {
+		return nil, err
+	}
+	t.root = &root
+	return t, nil
+}
+
+// syncTree retrieves the root and all entries of a tree, storing the entries
+// in dest.
+func (c *Client) syncTree(ctx context.Context, loc *linkEntry, dest map[string]entry) (rootEntry, error) {
+	root, err := c.resolveRoot(ctx, loc)
+	if err != nil {
+		return rootEntry{}, err
+	}
+	if err := c.syncSubtree(ctx, loc.domain, root.eroot, false, dest); err != nil {
+		return rootEntry{}, err
+	}
+	if err := c.syncSubtree(ctx, loc.domain, root.lroot, true, dest); err != nil {
+		return rootEntry{}, err
+	}
+	return root, nil
+}
+
+// syncSubtree retrieves the entry with the given hash and all of its children.
+func (c *Client) syncSubtree(ctx context.Context, domain, hash string, link bool, dest map[string]entry) error {
+	e, err := c.resolveEntry(ctx, domain, hash)
+	if err != nil {
+		return err
+	}
+	dest[hash] = e
+
+	switch e := e.(type) {
+	case *branchEntry:
+		for _, child := range e.children {
+			if err := c.syncSubtree(ctx, domain, child, link, dest); err != nil {
+				return err
+			}
+		}
+	case *enrEntry:
+		if link {
+			return errENRInLinkTree
+		}
+	case *linkEntry:
+		if !link {
+			return errLinkInENRTree
+		}
+	}
+	return nil
+}
+
+// resolveRoot retrieves a root entry via DNS and verifies its signature.
+func (c *Client) resolveRoot(ctx context.Context, loc *linkEntry) (rootEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, loc.domain)
+	c.cfg.Logger.Trace("Updating DNS discovery root", "tree", loc.domain, "err", err)
+	if err != nil {
+		return rootEntry{}, err
+	}
+	for _, txt := range txts {
+		if strings.HasPrefix(txt, rootPrefix) {
+			e, err := parseRoot(txt)
+			if err != nil {
+				return rootEntry{}, nameError{loc.domain, err}
+			}
+			if !e.verifySignature(loc.pubkey) {
+				return rootEntry{}, nameError{loc.domain, entryError{typ: "root", err: errInvalidSig}}
+			}
+			return e, nil
+		}
+	}
+	return rootEntry{}, nameError{loc.domain, errNoRoot}
+}
+
+// resolveEntry retrieves an entry from the cache or fetches it from the network
+// if it isn't cached.
+func (c *Client) resolveEntry(ctx context.Context, domain, hash string) (entry, error) {
+	cacheKey := hash + "." + domain
+	if e, ok := c.entries.Get(cacheKey); ok {
+		return e.(entry), nil
+	}
+	wantHash, err := b32format.DecodeString(hash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base32 hash")
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, cacheKey)
+	c.cfg.Logger.Trace("DNS discovery lookup", "name", cacheKey, "err", err)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		e, err := parseEntry(txt)
+		if err == errUnknownEntry {
+			continue
+		}
+		if !bytes.HasPrefix(crypto.Keccak256([]byte(txt)), wantHash) {
+			return nil, nameError{cacheKey, errHashMismatch}
+		}
+		if err != nil {
+			return nil, nameError{cacheKey, err}
+		}
+		c.entries.Add(cacheKey, e)
+		return e, nil
+	}
+	return nil, nameError{cacheKey, errNoEntry}
+}
+
+// RandomNodes is a source of random dial candidates, drawn from the nodes of a
+// set of trees and of all trees linked by them. The trees are synced in the
+// background and rechecked for updates periodically.
+type RandomNodes struct {
+	c      *Client
+	links  []*linkEntry
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	lock  sync.Mutex
+	nodes []*discover.Node
+	rand  *mrand.Rand
+}
+
+// syncedTree is the last synced state of a tree.
+type syncedTree struct {
+	root  rootEntry
+	nodes []*discover.Node
+	links []*linkEntry
+}
+
+// NewRandomNodes creates a source of random nodes from the trees at the given
+// URLs. The source doesn't return any nodes until the trees were synced for the
+// first time.
+func (c *Client) NewRandomNodes(urls ...string) (*RandomNodes, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no enrtree URLs given")
+	}
+	links := make([]*linkEntry, len(urls))
+	for i, url := range urls {
+		loc, err := parseURL(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enrtree URL %q: %v", url, err)
+		}
+		links[i] = loc
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rn := &RandomNodes{
+		c:      c,
+		links:  links,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		rand:   mrand.New(mrand.NewSource(time.Now().UnixNano())),
+	}
+	go rn.loop()
+	return rn, nil
+}
+
+// ReadRandomNodes fills the given slice with random nodes of the synced trees.
+// It doesn't write the same node more than once.
+func (rn *RandomNodes) ReadRandomNodes(buf []*discover.Node) int {
+	rn.lock.Lock()
+	defer rn.lock.Unlock()
+
+	n := 0
+	for _, i := range rn.rand.Perm(len(rn.nodes)) {
+		if n == len(buf) {
+			break
+		}
+		node := *rn.nodes[i]
+		buf[n] = &node
+		n++
+	}
+	return n
+}
+
+// Close stops syncing the trees.
+func (rn *RandomNodes) Close() {
+	rn.cancel()
+	<-rn.done
+}
+
+// loop syncs the trees until the source is closed.
+func (rn *RandomNodes) loop() {
+	defer close(rn.done)
+
+	var (
+		synced = make(map[string]*syncedTree)
+		timer  = time.NewTimer(0)
+	)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			synced = rn.sync(synced)
+			timer.Reset(rn.c.cfg.RecheckInterval)
+		case <-rn.ctx.Done():
+			return
+		}
+	}
+}
+
+// sync updates all trees reachable from the configured ones and replaces the
+// node set. Trees failing to sync keep their previously synced nodes.
+func (rn *RandomNodes) sync(prev map[string]*syncedTree) map[string]*syncedTree {
+	var (
+		next    = make(map[string]*syncedTree)
+		queue   = append([]*linkEntry{}, rn.links...)
+		nodes   []*discover.Node
+		visited = make(map[string]bool)
+	)
+	for len(queue) > 0 {
+		loc := queue[0]
+		queue = queue[1:]
+		url := loc.url()
+		if visited[url] {
+			continue
+		}
+		visited[url] = true
+
+		tree, err := rn.syncTree(loc, prev[url])
+		if err != nil {
+			rn.c.cfg.Logger.Debug("Failed to sync DNS discovery tree", "tree", loc.domain, "err", err)
+			if tree = prev[url]; tree == nil {
+				continue
+			}
+		}
+		next[url] = tree
+		nodes = append(nodes, tree.nodes...)
+		queue = append(queue, tree.links...)
+	}
+	rn.lock.Lock()
+	rn.nodes = nodes
+	rn.lock.Unlock()
+
+	return next
+}
+
+// syncTree syncs a single tree, skipping the download if its root didn't change
+// since the last sync.
+func (rn *RandomNodes) syncTree(loc *linkEntry, prev *syncedTree) (*syncedTree, error) {
+	if prev != nil {
+		root, err := rn.c.resolveRoot(rn.ctx, loc)
+		if err != nil {
+			return nil, err
+		}
+		if root.eroot == prev.root.eroot && root.lroot == prev.root.lroot {
+			return prev, nil
+		}
+	}
+	entries := make(map[string]entry)
+	root, err := rn.c.syncTree(rn.ctx, loc, entries)
+	if err != nil {
+		return nil, err
+	}
+	tree := &syncedTree{root: root}
+	for _, e := range entries {
+		switch e := e.(type) {
+		case *enrEntry:
+			n, err := nodeFromRecord(e.record)
+			if err != nil {
+				rn.c.cfg.Logger.Trace("Skipping unusable DNS discovery node", "tree", loc.domain, "err", err)
+				continue
+			}
+			tree.nodes = append(tree.nodes, n)
+		case *linkEntry:
+			tree.links = append(tree.links, e)
+		}
+	}
+	rn.c.cfg.Logger.Debug("Synced DNS discovery tree", "tree", loc.domain, "seq", root.seq, "nodes", len(tree.nodes), "links", len(tree.links))
+	return tree, nil
+}
+
+// nodeFromRecord creates a dialable node from a node record.
+func nodeFromRecord(r *enr.Record) (*discover.Node, error) {
+	var (
+		pubkey enr.Secp256k1
+		ip     enr.IP
+		tcp    enr.TCP
+		udp    enr.UDP
+	)
+	if err := r.Load(&pubkey); err != nil {
+		return nil, err
+	}
+	if err := r.Load(&ip); err != nil {
+		return nil, err
+	}
+	if err := r.Load(&tcp); err != nil {
+		return nil, err
+	}
+	if err := r.Load(&udp); err != nil {
+		udp = enr.UDP(tcp)
+	}
+	id := discover.PubkeyID((*ecdsa.PublicKey)(&pubkey))
+	return discover.NewNode(id, net.IP(ip), uint16(udp), uint16(tcp)), nil
+}
+
+// parseURL parses an enrtree:// URL into its link entry.
+func parseURL(url string) (*linkEntry, error) {
+	if !strings.HasPrefix(url, "enrtree://") {
+		return nil, errNotTreeURL
+	}
+	return parseLink(url)
+}
@@ -0,0 +1,259 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/p2p/enr"
+)
+
+const (
+	signingKeySeed = 0x111111
+	nodesSeed1     = 0x2945237
+	nodesSeed2     = 0x4567299
+)
+
+func TestClientSyncTree(t *testing.T) {
+	var (
+		key   = testKey(signingKeySeed)
+		nodes = testNodes(testKeys(nodesSeed1, 30))
+		links = []string{linkURL(testKey(nodesSeed2), "other.example.org")}
+	)
+	tree, url := makeTestTree(t, key, "n", 1, nodes, links)
+
+	r := newMapResolver(tree.ToTXT("n"))
+	c := NewClient(Config{Resolver: r})
+	synced, err := c.SyncTree(url)
+	if err != nil {
+		t.Fatal("sync error:", err)
+	}
+	if !reflect.DeepEqual(synced.Nodes(), sortByNodeAddr(nodes)) {
+		t.Errorf("wrong nodes in synced tree: %d, want %d", len(synced.Nodes()), len(nodes))
+	}
+	if !reflect.DeepEqual(synced.Links(), links) {
+		t.Errorf("wrong links in synced tree: %v", synced.Links())
+	}
+	if synced.Seq() != 1 || synced.Signature() != tree.Signature() {
+		t.Errorf("wrong root in synced tree: seq %d, sig %s", synced.Seq(), synced.Signature())
+	}
+}
+
+// In this test, syncing the tree fails because it is signed by a different key
+// than the one in the URL.
+func TestClientSyncTreeBadSignature(t *testing.T) {
+	tree, _ := makeTestTree(t, testKey(signingKeySeed), "n", 1, testNodes(testKeys(nodesSeed1, 3)), nil)
+
+	r := newMapResolver(tree.ToTXT("n"))
+	c := NewClient(Config{Resolver: r})
+	wantErr := nameError{"n", entryError{"root", errInvalidSig}}
+	if _, err := c.SyncTree(linkURL(testKey(nodesSeed2), "n")); err != wantErr {
+		t.Fatalf("expected signature error %q, got %q", wantErr, err)
+	}
+}
+
+// In this test, syncing the tree fails because an entry doesn't match its hash.
+func TestClientSyncTreeBadEntry(t *testing.T) {
+	tree, url := makeTestTree(t, testKey(signingKeySeed), "n", 1, testNodes(testKeys(nodesSeed1, 30)), nil)
+
+	txt := tree.ToTXT("n")
+	var broken string
+	for name, e := range txt {
+		if name != "n" && bytes.HasPrefix([]byte(e), []byte("enr:")) {
+			broken = name
+			break
+		}
+	}
+	txt[broken] = RecordText(testNodes(testKeys(nodesSeed2, 1))[0])
+
+	c := NewClient(Config{Resolver: newMapResolver(txt)})
+	wantErr := nameError{broken, errHashMismatch}
+	if _, err := c.SyncTree(url); err != wantErr {
+		t.Fatalf("expected hash mismatch error %q, got %q", wantErr, err)
+	}
+}
+
+// In this test, the random node source follows a link to a second tree and
+// picks up updates of the trees.
+func TestRandomNodes(t *testing.T) {
+	var (
+		key1, key2 = testKey(signingKeySeed), testKey(nodesSeed2 + 1)
+		nodes1     = testNodes(testKeys(nodesSeed1, 10))
+		nodes2     = testNodes(testKeys(nodesSeed2, 10))
+	)
+	tree2, url2 := makeTestTree(t, key2, "n2", 1, nodes2, nil)
+	tree1, url1 := makeTestTree(t, key1, "n1", 1, nodes1, []string{url2})
+
+	r := newMapResolver(tree1.ToTXT("n1"), tree2.ToTXT("n2"))
+	c := NewClient(Config{Resolver: r, RecheckInterval: 20 * time.Millisecond})
+	rn, err := c.NewRandomNodes(url1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rn.Close()
+
+	want := append(toNodes(t, nodes1), toNodes(t, nodes2)...)
+	waitNodes(t, rn, want)
+
+	// Publish an update of the second tree.
+	nodes2 = testNodes(testKeys(nodesSeed2, 15))
+	tree2, _ = makeTestTree(t, key2, "n2", 2, nodes2, nil)
+	r.add(tree2.ToTXT("n2"))
+
+	want = append(toNodes(t, nodes1), toNodes(t, nodes2)...)
+	waitNodes(t, rn, want)
+}
+
+// waitNodes waits until the random node source returns exactly the given nodes.
+func waitNodes(t *testing.T, rn *RandomNodes, want []*discover.Node) {
+	sortNodes(want)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		buf := make([]*discover.Node, len(want)+1)
+		have := buf[:rn.ReadRandomNodes(buf)]
+		sortNodes(have)
+		if reflect.DeepEqual(have, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("wrong nodes returned: have %d, want %d", len(have), len(want))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func toNodes(t *testing.T, records []*enr.Record) []*discover.Node {
+	nodes := make([]*discover.Node, len(records))
+	for i, r := range records {
+		n, err := nodeFromRecord(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes[i] = n
+	}
+	return nodes
+}
+
+func sortNodes(nodes []*discover.Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return bytes.Compare(nodes[i].ID[:], nodes[j].ID[:]) < 0
+	})
+}
+
+func makeTestTree(t *testing.T, key *ecdsa.PrivateKey, domain string, seq uint, nodes []*enr.Record, links []string) (*Tree, string) {
+	tree, err := MakeTree(seq, nodes, links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := tree.Sign(key, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree, url
+}
+
+// testKeys creates deterministic private keys for testing.
+func testKeys(seed int64, n int) []*ecdsa.PrivateKey {
+	keys := make([]*ecdsa.PrivateKey, n)
+	for i := 0; i < n; i++ {
+		keys[i] = testKey(seed + int64(i))
+	}
+	return keys
+}
+
+func testKey(seed int64) *ecdsa.PrivateKey {
+	var blob [8]byte
+	binary.BigEndian.PutUint64(blob[:], uint64(seed))
+	key, err := crypto.ToECDSA(crypto.Keccak256(blob[:]))
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func testNodes(keys []*ecdsa.PrivateKey) []*enr.Record {
+	records := make([]*enr.Record, len(keys))
+	for i, key := range keys {
+		var r enr.Record
+		r.Set(enr.IP(net.IP{127, 0, 0, 1}))
+		r.Set(enr.TCP(30303 + i))
+		r.Set(enr.UDP(30303 + i))
+		if err := enr.SignV4(&r, key); err != nil {
+			panic(err)
+		}
+		records[i] = &r
+	}
+	return records
+}
+
+func sortByNodeAddr(records []*enr.Record) []*enr.Record {
+	sorted := make([]*enr.Record, len(records))
+	copy(sorted, records)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].NodeAddr(), sorted[j].NodeAddr()) < 0
+	})
+	return sorted
+}
+
+func linkURL(key *ecdsa.PrivateKey, domain string) string {
+	return (&linkEntry{domain: domain, pubkey: &key.PublicKey}).url()
+}
+
+// mapResolver is an in-process DNS resolver serving a set of TXT records.
+type mapResolver struct {
+	lock    sync.Mutex
+	records map[string]string
+}
+
+func newMapResolver(maps ...map[string]string) *mapResolver {
+	r := &mapResolver{records: make(map[string]string)}
+	for _, m := range maps {
+		r.add(m)
+	}
+	return r
+}
+
+func (r *mapResolver) add(m map[string]string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for k, v := range m {
+		r.records[k] = v
+	}
+}
+
+func (r *mapResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if record, ok := r.records[name]; ok {
+		return []string{record}, nil
+	}
+	return nil, errors.New("not found")
+}
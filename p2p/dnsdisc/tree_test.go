@@ -0,0 +1,193 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"crypto/ecdsa"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+	"github.com/themis-network/go-themis/crypto"
+)
+
+func TestParseRoot(t *testing.T) {
+	tests := []struct {
+		input string
+		e     rootEntry
+		err   error
+	}{
+		{
+			input: "enrtree-root:v1 e=TO4Q75OQ2N7DX4EOOR7X66A6OM seq=3 sig=N-YY6UB9xD0hFx1Gmnt7v0RfSxch5tKyry2SRDoLx7B4GfPXagwLxQqyf7gAMvApFn_ORwZQekMWa_pXrcGCtw",
+			err:   entryError{"root", errSyntax},
+		},
+		{
+			input: "enrtree-root:v1 e=TO4Q75OQ2N7DX4EOOR7X66A6OM l=TO4Q75OQ2N7DX4EOOR7X66A6OM seq=3 sig=N-YY6UB9xD0hFx1Gmnt7v0RfSxch5tKyry2SRDoLx7B4GfPXagwLxQqyf7gAMvApFn_ORwZQekMWa_pXrcGEE",
+			err:   entryError{"root", errInvalidSig},
+		},
+	}
+	for i, test := range tests {
+		e, err := parseRoot(test.input)
+		if !reflect.DeepEqual(e, test.e) {
+			t.Errorf("test %d: wrong entry %+v, want %+v", i, e, test.e)
+		}
+		if err != test.err {
+			t.Errorf("test %d: wrong error %q, want %q", i, err, test.err)
+		}
+	}
+	// Valid roots must survive encoding.
+	root := rootEntry{
+		eroot: "QFT4PBCRX4XQCV3VUYJ6BTCEPU",
+		lroot: "JGUFMSAGI7KZYB3P7IZW4S5Y3A",
+		seq:   3,
+		sig:   make([]byte, sigLength),
+	}
+	if e, err := parseRoot(root.String()); err != nil || !reflect.DeepEqual(e, root) {
+		t.Errorf("root doesn't round-trip: %+v, %v", e, err)
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	testkey := testKey(signingKeySeed)
+	tests := []struct {
+		input string
+		e     entry
+		err   error
+	}{
+		// Subtrees:
+		{
+			input: "enrtree-branch:1,2",
+			err:   entryError{"branch", errInvalidChild},
+		},
+		{
+			input: "enrtree-branch:AAAAAAAAAAAAAAAA",
+			err:   entryError{"branch", errInvalidChild},
+		},
+		{
+			input: "enrtree-branch:",
+			e:     &branchEntry{},
+		},
+		{
+			input: "enrtree-branch:AAAAAAAAAAAAAAAAAAAAAAAAAA",
+			e:     &branchEntry{[]string{"AAAAAAAAAAAAAAAAAAAAAAAAAA"}},
+		},
+		{
+			input: "enrtree-branch:AAAAAAAAAAAAAAAAAAAAAAAAAA,BBBBBBBBBBBBBBBBBBBBBBBBBB",
+			e:     &branchEntry{[]string{"AAAAAAAAAAAAAAAAAAAAAAAAAA", "BBBBBBBBBBBBBBBBBBBBBBBBBB"}},
+		},
+		// Links
+		{
+			input: "enrtree-link:" + b32format.EncodeToString(crypto.CompressPubkey(&testkey.PublicKey)) + "@nodes.example.org",
+			e:     &linkEntry{"nodes.example.org", &testkey.PublicKey},
+		},
+		{
+			input: "enrtree-link:nodes.example.org",
+			err:   entryError{"link", errNoPubkey},
+		},
+		{
+			input: "enrtree-link:AP62DT7WOTEQZGQZOU474PP3KMEGVTTE7A7NPRXKX3DUD57@nodes.example.org",
+			err:   entryError{"link", errBadPubkey},
+		},
+		// ENRs
+		{
+			input: RecordText(testNodes([]*ecdsa.PrivateKey{testkey})[0]),
+			e:     &enrEntry{testNodes([]*ecdsa.PrivateKey{testkey})[0]},
+		},
+		{
+			input: "enr:!!!",
+			err:   entryError{"enr", errInvalidENR},
+		},
+		// Invalid:
+		{input: "", err: errUnknownEntry},
+		{input: "foo", err: errUnknownEntry},
+		{input: "enrtree", err: errUnknownEntry},
+		{input: "enrtree-x=", err: errUnknownEntry},
+	}
+	for i, test := range tests {
+		e, err := parseEntry(test.input)
+		if !reflect.DeepEqual(e, test.e) {
+			t.Errorf("test %d: wrong entry %s, want %s", i, spew.Sdump(e), spew.Sdump(test.e))
+		}
+		if !reflect.DeepEqual(err, test.err) {
+			t.Errorf("test %d: wrong error %q, want %q", i, err, test.err)
+		}
+	}
+}
+
+func TestMakeTree(t *testing.T) {
+	var (
+		keys  = testKeys(nodesSeed1, 50)
+		nodes = testNodes(keys)
+		links = []string{linkURL(testKey(signingKeySeed), "nodes.example.org")}
+	)
+	tree, err := MakeTree(2, nodes, links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := tree.Nodes(); !reflect.DeepEqual(n, sortByNodeAddr(nodes)) {
+		t.Errorf("wrong nodes in tree: %d, want %d", len(n), len(nodes))
+	}
+	if l := tree.Links(); !reflect.DeepEqual(l, links) {
+		t.Errorf("wrong links in tree: %v, want %v", l, links)
+	}
+	// Every entry must fit into a single TXT record.
+	for name, txt := range tree.ToTXT("n") {
+		if len(txt) > 370 {
+			t.Errorf("record %s too long: %d bytes", name, len(txt))
+		}
+		if !strings.HasPrefix(txt, rootPrefix) {
+			if _, err := parseEntry(txt); err != nil {
+				t.Errorf("record %s can't be parsed: %v", name, err)
+			}
+		}
+	}
+}
+
+func TestSignTree(t *testing.T) {
+	key := testKey(signingKeySeed)
+	tree, err := MakeTree(1, testNodes(testKeys(nodesSeed1, 3)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url, err := tree.Sign(key, "nodes.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := linkURL(key, "nodes.example.org"); url != want {
+		t.Errorf("wrong URL %q, want %q", url, want)
+	}
+	domain, pubkey, err := ParseURL(url)
+	if err != nil || domain != "nodes.example.org" || !reflect.DeepEqual(pubkey, &key.PublicKey) {
+		t.Errorf("URL doesn't round-trip: %q, %v, %v", domain, pubkey, err)
+	}
+	root, err := parseRoot(tree.ToTXT("nodes.example.org")["nodes.example.org"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.verifySignature(&key.PublicKey) {
+		t.Error("root signature invalid")
+	}
+	// Signatures can be moved between identical trees.
+	copy, _ := MakeTree(1, testNodes(testKeys(nodesSeed1, 3)), nil)
+	if err := copy.SetSignature(&key.PublicKey, tree.Signature()); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := copy.SetSignature(&testKey(nodesSeed1).PublicKey, tree.Signature()); err != errInvalidSig {
+		t.Errorf("signature of other key accepted: %v", err)
+	}
+}
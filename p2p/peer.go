@@ -412,9 +412,10 @@ func (rw *protoRW) ReadMsg() (Msg, error) {
 // peer. Sub-protocol independent fields are contained and initialized here, with
 // protocol specifics delegated to all connected sub-protocols.
 type PeerInfo struct {
-	ID      string   `json:"id"`   // Unique node identifier (also the encryption key)
-	Name    string   `json:"name"` // Name of the node, including client type, version, OS, custom data
-	Caps    []string `json:"caps"` // Sum-protocols advertised by this particular peer
+	ID      string   `json:"id"`              // Unique node identifier (also the encryption key)
+	Name    string   `json:"name"`            // Name of the node, including client type, version, OS, custom data
+	Caps    []string `json:"caps"`            // Sum-protocols advertised by this particular peer
+	Roles   []string `json:"roles,omitempty"` // Roles of the node in a permissioned network
 	Network struct {
 		LocalAddress  string `json:"localAddress"`  // Local endpoint of the TCP data connection
 		RemoteAddress string `json:"remoteAddress"` // Remote endpoint of the TCP data connection
@@ -0,0 +1,134 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package permission
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/rlp"
+)
+
+var (
+	errUnsigned     = errors.New("allowlist is not signed")
+	errWrongSigner  = errors.New("allowlist signed by unauthorized account")
+	errBadSignature = errors.New("invalid allowlist signature")
+	errOldSequence  = errors.New("allowlist sequence number too low")
+)
+
+// Allowlist is the content of an allowlist file. The signer increments Seq
+// whenever it publishes a new list, so older signed lists can't be replayed.
+type Allowlist struct {
+	Seq       uint64          `json:"seq"`
+	Nodes     []AllowlistNode `json:"nodes"`
+	Signature hexutil.Bytes   `json:"signature,omitempty"`
+}
+
+// AllowlistNode is a node entry of an allowlist file.
+type AllowlistNode struct {
+	ID    discover.NodeID `json:"id"`
+	Roles []string        `json:"roles,omitempty"`
+}
+
+// sigHash returns the hash signed by the allowlist signer.
+func (a *Allowlist) sigHash() []byte {
+	enc, _ := rlp.EncodeToBytes([]interface{}{a.Seq, a.Nodes})
+	return crypto.Keccak256(enc)
+}
+
+// Sign signs the allowlist with the given key.
+func (a *Allowlist) Sign(key *ecdsa.PrivateKey) error {
+	sig, err := crypto.Sign(a.sigHash(), key)
+	if err != nil {
+		return err
+	}
+	a.Signature = sig
+	return nil
+}
+
+// Signer returns the account which signed the allowlist.
+func (a *Allowlist) Signer() (common.Address, error) {
+	if len(a.Signature) == 0 {
+		return common.Address{}, errUnsigned
+	}
+	pubkey, err := crypto.SigToPub(a.sigHash(), a.Signature)
+	if err != nil {
+		return common.Address{}, errBadSignature
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// FileSource reads allowlist entries from a JSON file.
+type FileSource struct {
+	path   string
+	signer common.Address
+
+	mu  sync.Mutex
+	seq uint64 // highest sequence number of a loaded signed list
+}
+
+// NewFileSource creates a source reading the allowlist file at path. If signer
+// is not the zero address, the file must be signed by that account and its
+// sequence number must not be lower than that of any list loaded before.
+func NewFileSource(path string, signer common.Address) *FileSource {
+	return &FileSource{path: path, signer: signer}
+}
+
+// Entries implements Source. A missing file contains no entries.
+func (s *FileSource) Entries() ([]Entry, error) {
+	var list Allowlist
+	if err := common.LoadJSON(s.path, &list); err != nil {
+		if os.IsNotExist(err) {
+			log.Debug("Node allowlist file not found", "path", s.path)
+			return nil, nil
+		}
+		return nil, err
+	}
+	if s.signer != (common.Address{}) {
+		signer, err := list.Signer()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", s.path, err)
+		}
+		if signer != s.signer {
+			return nil, fmt.Errorf("%s: %v %s", s.path, errWrongSigner, signer.Hex())
+		}
+	}
+	entries := make([]Entry, len(list.Nodes))
+	for i, n := range list.Nodes {
+		if err := ValidateRoles(n.Roles); err != nil {
+			return nil, fmt.Errorf("%s: node %x: %v", s.path, n.ID[:8], err)
+		}
+		entries[i] = Entry{ID: n.ID, Roles: n.Roles}
+	}
+	if s.signer != (common.Address{}) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if list.Seq < s.seq {
+			return nil, fmt.Errorf("%s: %v: %d < %d", s.path, errOldSequence, list.Seq, s.seq)
+		}
+		s.seq = list.Seq
+	}
+	return entries, nil
+}
@@ -0,0 +1,432 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package permission implements the node allowlist of permissioned networks.
+//
+// A List merges the nodes of several sources, e.g. a signed allowlist file and
+// an on-chain registry contract, with local overrides made through the admin
+// API. Sources are reloaded periodically, so the list can change while the node
+// is running.
+package permission
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/event"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/rlp"
+)
+
+// Node roles.
+const (
+	RoleSigner = "signer" // node seals blocks
+	RoleEscrow = "escrow" // node runs the escrow service
+	RoleRPC    = "rpc"    // node serves public RPC
+)
+
+// roles lists all known roles. The position of a role is its bit in the role
+// bitmask of the registry contract.
+var roles = []string{RoleSigner, RoleEscrow, RoleRPC}
+
+// ValidateRoles checks that all given roles are known.
+func ValidateRoles(rs []string) error {
+	for _, r := range rs {
+		if roleBit(r) < 0 {
+			return fmt.Errorf("unknown role %q", r)
+		}
+	}
+	return nil
+}
+
+func roleBit(role string) int {
+	for i, r := range roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Entry is a node admitted by an allowlist.
+type Entry struct {
+	ID    discover.NodeID
+	Roles []string
+}
+
+// Source provides allowlist entries.
+type Source interface {
+	Entries() ([]Entry, error)
+}
+
+// Config holds the settings of a List.
+type Config struct {
+	// Sources contains the initial sources of the list.
+	Sources []Source
+
+	// OverridesFile is the file which stores the changes made by Allow and
+	// Deny. If empty, overrides are kept in memory only.
+	OverridesFile string
+
+	// OverridesKey signs the overrides file. Nodes allowed by a file which
+	// isn't signed with this key are ignored on load, denials are always kept.
+	OverridesKey *ecdsa.PrivateKey
+
+	// ReloadInterval is the time between reloads of all sources.
+	// It defaults to one minute.
+	ReloadInterval time.Duration
+}
+
+const defaultReloadInterval = time.Minute
+
+// List is the set of nodes allowed to connect in a permissioned network.
+type List struct {
+	cfg Config
+
+	mu        sync.RWMutex
+	sources   []Source
+	loaded    [][]Entry // last good entries of each source
+	overrides overrides
+	nodes     map[discover.NodeID][]string
+
+	feed    event.Feed
+	quit    chan struct{}
+	closeMu sync.Mutex
+	wg      sync.WaitGroup
+}
+
+// overrides are changes made to the list through Allow and Deny.
+type overrides struct {
+	Allowed map[discover.NodeID][]string `json:"allowed,omitempty"`
+	Denied  map[discover.NodeID]bool     `json:"denied,omitempty"`
+
+	Signature hexutil.Bytes `json:"signature,omitempty"`
+}
+
+// sigHash returns the hash signed by the overrides key.
+func (o *overrides) sigHash() []byte {
+	allowed := make([]AllowlistNode, 0, len(o.Allowed))
+	for id, rs := range o.Allowed {
+		allowed = append(allowed, AllowlistNode{ID: id, Roles: rs})
+	}
+	sort.Slice(allowed, func(i, j int) bool {
+		return bytes.Compare(allowed[i].ID[:], allowed[j].ID[:]) < 0
+	})
+	denied := make([]discover.NodeID, 0, len(o.Denied))
+	for id := range o.Denied {
+		denied = append(denied, id)
+	}
+	sort.Slice(denied, func(i, j int) bool {
+		return bytes.Compare(denied[i][:], denied[j][:]) < 0
+	})
+	enc, _ := rlp.EncodeToBytes([]interface{}{allowed, denied})
+	return crypto.Keccak256(enc)
+}
+
+// signedBy reports whether the overrides are signed with the given key.
+func (o *overrides) signedBy(key *ecdsa.PrivateKey) bool {
+	if key == nil || len(o.Signature) == 0 {
+		return false
+	}
+	pubkey, err := crypto.SigToPub(o.sigHash(), o.Signature)
+	if err != nil {
+		return false
+	}
+	return crypto.PubkeyToAddress(*pubkey) == crypto.PubkeyToAddress(key.PublicKey)
+}
+
+// NewList creates a list and loads all its sources. Loading fails if any
+// source is invalid. The list reloads its sources in the background until
+// Close is called.
+func NewList(cfg Config) (*List, error) {
+	if cfg.ReloadInterval == 0 {
+		cfg.ReloadInterval = defaultReloadInterval
+	}
+	l := &List{
+		cfg:       cfg,
+		sources:   cfg.Sources,
+		loaded:    make([][]Entry, len(cfg.Sources)),
+		overrides: overrides{Allowed: make(map[discover.NodeID][]string), Denied: make(map[discover.NodeID]bool)},
+		quit:      make(chan struct{}),
+	}
+	if cfg.OverridesFile != "" {
+		if err := common.LoadJSON(cfg.OverridesFile, &l.overrides); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("can't load permission overrides: %v", err)
+		}
+		if len(l.overrides.Allowed) > 0 && !l.overrides.signedBy(cfg.OverridesKey) {
+			log.Warn("Ignoring allowed nodes of unsigned permission overrides", "file", cfg.OverridesFile, "nodes", len(l.overrides.Allowed))
+			l.overrides.Allowed = nil
+		}
+		if l.overrides.Allowed == nil {
+			l.overrides.Allowed = make(map[discover.NodeID][]string)
+		}
+		if l.overrides.Denied == nil {
+			l.overrides.Denied = make(map[discover.NodeID]bool)
+		}
+	}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	l.wg.Add(1)
+	go l.loop()
+	return l, nil
+}
+
+// Close stops reloading the list.
+func (l *List) Close() {
+	l.closeMu.Lock()
+	defer l.closeMu.Unlock()
+
+	select {
+	case <-l.quit:
+	default:
+		close(l.quit)
+		l.wg.Wait()
+	}
+}
+
+func (l *List) loop() {
+	defer l.wg.Done()
+
+	reload := time.NewTicker(l.cfg.ReloadInterval)
+	defer reload.Stop()
+	for {
+		select {
+		case <-reload.C:
+			if err := l.Reload(); err != nil {
+				log.Warn("Failed to reload node allowlist", "err", err)
+			}
+		case <-l.quit:
+			return
+		}
+	}
+}
+
+// AddSource adds a source to the list and loads it. The source is added even
+// if loading fails, its entries are then loaded by the next reload.
+func (l *List) AddSource(src Source) error {
+	entries, err := src.Entries()
+	l.mu.Lock()
+	l.sources = append(l.sources, src)
+	l.loaded = append(l.loaded, entries)
+	changed := l.update()
+	l.mu.Unlock()
+
+	if changed {
+		l.feed.Send(struct{}{})
+	}
+	return err
+}
+
+// Reload loads all sources. Sources that fail to load keep their previous
+// entries, the first error is returned.
+func (l *List) Reload() error {
+	l.mu.RLock()
+	sources := make([]Source, len(l.sources))
+	copy(sources, l.sources)
+	l.mu.RUnlock()
+
+	var (
+		firstErr error
+		loaded   = make([][]Entry, len(sources))
+		ok       = make([]bool, len(sources))
+	)
+	for i, src := range sources {
+		entries, err := src.Entries()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		loaded[i], ok[i] = entries, true
+	}
+
+	l.mu.Lock()
+	for i := range sources {
+		if ok[i] {
+			l.loaded[i] = loaded[i]
+		}
+	}
+	changed := l.update()
+	l.mu.Unlock()
+
+	if changed {
+		log.Info("Node allowlist changed", "nodes", l.Len())
+		l.feed.Send(struct{}{})
+	}
+	return firstErr
+}
+
+// Allow adds a node to the list with the given roles. The roles replace those
+// of all sources. Allow also reverts a previous Deny of the node.
+func (l *List) Allow(id discover.NodeID, roles []string) error {
+	if err := ValidateRoles(roles); err != nil {
+		return err
+	}
+	return l.override(func(o *overrides) {
+		delete(o.Denied, id)
+		o.Allowed[id] = append([]string{}, roles...)
+	})
+}
+
+// Deny removes a node from the list, even if a source contains it.
+func (l *List) Deny(id discover.NodeID) error {
+	return l.override(func(o *overrides) {
+		delete(o.Allowed, id)
+		o.Denied[id] = true
+	})
+}
+
+func (l *List) override(fn func(*overrides)) error {
+	l.mu.Lock()
+	fn(&l.overrides)
+	if l.cfg.OverridesFile != "" {
+		l.overrides.Signature = nil
+		if l.cfg.OverridesKey != nil {
+			sig, err := crypto.Sign(l.overrides.sigHash(), l.cfg.OverridesKey)
+			if err != nil {
+				l.mu.Unlock()
+				return fmt.Errorf("can't sign permission overrides: %v", err)
+			}
+			l.overrides.Signature = sig
+		}
+		if err := saveJSON(l.cfg.OverridesFile, &l.overrides); err != nil {
+			l.mu.Unlock()
+			return fmt.Errorf("can't store permission overrides: %v", err)
+		}
+	}
+	changed := l.update()
+	l.mu.Unlock()
+
+	if changed {
+		l.feed.Send(struct{}{})
+	}
+	return nil
+}
+
+// update recomputes the allowed nodes. It returns whether the set of nodes or
+// their roles changed. The caller must hold l.mu.
+func (l *List) update() bool {
+	nodes := make(map[discover.NodeID][]string)
+	for _, entries := range l.loaded {
+		for _, e := range entries {
+			nodes[e.ID] = mergeRoles(nodes[e.ID], e.Roles)
+		}
+	}
+	for id, rs := range l.overrides.Allowed {
+		nodes[id] = mergeRoles(nil, rs)
+	}
+	for id := range l.overrides.Denied {
+		delete(nodes, id)
+	}
+	changed := !equalNodes(l.nodes, nodes)
+	l.nodes = nodes
+	return changed
+}
+
+// Allowed reports whether the node may connect.
+func (l *List) Allowed(id discover.NodeID) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	_, ok := l.nodes[id]
+	return ok
+}
+
+// Roles returns the roles of a node.
+func (l *List) Roles(id discover.NodeID) []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.nodes[id]
+}
+
+// Len returns the number of allowed nodes.
+func (l *List) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.nodes)
+}
+
+// SubscribeChanges subscribes to changes of the list. The subscriber is notified
+// whenever nodes are added, removed or change their roles.
+func (l *List) SubscribeChanges(ch chan<- struct{}) event.Subscription {
+	return l.feed.Subscribe(ch)
+}
+
+// mergeRoles adds the roles in add to rs, returning a sorted set.
+func mergeRoles(rs, add []string) []string {
+	merged := make([]string, 0, len(rs)+len(add))
+	merged = append(merged, rs...)
+	for _, r := range add {
+		found := false
+		for _, have := range merged {
+			if have == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, r)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func equalNodes(a, b map[discover.NodeID][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, ra := range a {
+		rb, ok := b[id]
+		if !ok || len(ra) != len(rb) {
+			return false
+		}
+		for i := range ra {
+			if ra[i] != rb[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// saveJSON atomically replaces the content of file with the JSON encoding of val.
+func saveJSON(file string, val interface{}) error {
+	content, err := json.MarshalIndent(val, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
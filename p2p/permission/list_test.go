@@ -0,0 +1,293 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package permission
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis"
+	"github.com/themis-network/go-themis/accounts/abi"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/crypto"
+	"github.com/themis-network/go-themis/p2p/discover"
+)
+
+var (
+	testID1 = discover.NodeID{1}
+	testID2 = discover.NodeID{2}
+	testID3 = discover.NodeID{3}
+)
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "permission-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		key, _   = crypto.GenerateKey()
+		other, _ = crypto.GenerateKey()
+		signer   = crypto.PubkeyToAddress(key.PublicKey)
+		path     = filepath.Join(dir, "allowlist.json")
+		src      = NewFileSource(path, signer)
+	)
+	// A missing file is empty.
+	if entries, err := src.Entries(); err != nil || len(entries) != 0 {
+		t.Fatalf("missing file: %v, %v", entries, err)
+	}
+	list := &Allowlist{Nodes: []AllowlistNode{
+		{ID: testID1, Roles: []string{RoleSigner}},
+		{ID: testID2},
+	}}
+	writeAllowlist(t, path, list)
+	if _, err := src.Entries(); err == nil || !strings.Contains(err.Error(), errUnsigned.Error()) {
+		t.Fatalf("unsigned file accepted: %v", err)
+	}
+	list.Sign(other)
+	writeAllowlist(t, path, list)
+	if _, err := src.Entries(); err == nil || !strings.Contains(err.Error(), errWrongSigner.Error()) {
+		t.Fatalf("file of wrong signer accepted: %v", err)
+	}
+	list.Sign(key)
+	writeAllowlist(t, path, list)
+	entries, err := src.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{{ID: testID1, Roles: []string{RoleSigner}}, {ID: testID2}}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("wrong entries %v, want %v", entries, want)
+	}
+	// Modifying the nodes invalidates the signature.
+	signed := *list
+	list.Nodes = list.Nodes[:1]
+	writeAllowlist(t, path, list)
+	if _, err := src.Entries(); err == nil {
+		t.Fatal("modified file accepted")
+	}
+	// Older lists can't be replayed once a newer one was loaded.
+	list.Seq = 1
+	list.Sign(key)
+	writeAllowlist(t, path, list)
+	if entries, err := src.Entries(); err != nil || len(entries) != 1 {
+		t.Fatalf("newer list not accepted: %v, %v", entries, err)
+	}
+	writeAllowlist(t, path, &signed)
+	if _, err := src.Entries(); err == nil || !strings.Contains(err.Error(), errOldSequence.Error()) {
+		t.Fatalf("replayed list accepted: %v", err)
+	}
+}
+
+func TestListOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "permission-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		src       = &staticSource{entries: []Entry{{ID: testID1, Roles: []string{RoleRPC}}, {ID: testID2}}}
+		overrides = filepath.Join(dir, "overrides.json")
+		key, _    = crypto.GenerateKey()
+		other, _  = crypto.GenerateKey()
+	)
+	l, err := NewList(Config{Sources: []Source{src}, OverridesFile: overrides, OverridesKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan struct{}, 10)
+	sub := l.SubscribeChanges(changes)
+	defer sub.Unsubscribe()
+
+	if err := l.Allow(testID3, []string{"miner"}); err == nil {
+		t.Fatal("unknown role accepted")
+	}
+	if err := l.Allow(testID1, []string{RoleSigner, RoleEscrow}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Allow(testID3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Deny(testID2); err != nil {
+		t.Fatal(err)
+	}
+	checkList := func(l *List) {
+		t.Helper()
+		if !l.Allowed(testID1) || l.Allowed(testID2) || !l.Allowed(testID3) {
+			t.Errorf("wrong nodes allowed: %t %t %t", l.Allowed(testID1), l.Allowed(testID2), l.Allowed(testID3))
+		}
+		if rs := l.Roles(testID1); !reflect.DeepEqual(rs, []string{RoleEscrow, RoleSigner}) {
+			t.Errorf("wrong roles of overridden node: %v", rs)
+		}
+	}
+	checkList(l)
+	if len(changes) != 3 {
+		t.Errorf("wrong number of change notifications %d, want 3", len(changes))
+	}
+	l.Close()
+
+	// Overrides survive restarts.
+	l, err = NewList(Config{Sources: []Source{src}, OverridesFile: overrides, OverridesKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkList(l)
+	l.Close()
+
+	// Nodes allowed by overrides of another key are ignored, denials are kept.
+	l, err = NewList(Config{Sources: []Source{src}, OverridesFile: overrides, OverridesKey: other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if !l.Allowed(testID1) || l.Allowed(testID2) || l.Allowed(testID3) {
+		t.Errorf("wrong nodes allowed: %t %t %t", l.Allowed(testID1), l.Allowed(testID2), l.Allowed(testID3))
+	}
+	if rs := l.Roles(testID1); !reflect.DeepEqual(rs, []string{RoleRPC}) {
+		t.Errorf("roles of unsigned override applied: %v", rs)
+	}
+}
+
+func TestListReload(t *testing.T) {
+	src := &staticSource{entries: []Entry{{ID: testID1}}}
+	l, err := NewList(Config{Sources: []Source{src}, ReloadInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	changes := make(chan struct{}, 1)
+	sub := l.SubscribeChanges(changes)
+	defer sub.Unsubscribe()
+
+	src.set([]Entry{{ID: testID2, Roles: []string{RoleSigner}}})
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("list not reloaded")
+	}
+	if l.Allowed(testID1) || !l.Allowed(testID2) {
+		t.Fatal("reload didn't update nodes")
+	}
+	// Failing sources keep their previous entries.
+	src.setErr(ethereum.NotFound)
+	if err := l.Reload(); err != ethereum.NotFound {
+		t.Fatalf("wrong reload error %v", err)
+	}
+	if !l.Allowed(testID2) {
+		t.Fatal("failing source dropped its entries")
+	}
+}
+
+func TestRegistrySource(t *testing.T) {
+	want := []Entry{
+		{ID: testID1, Roles: []string{RoleSigner, RoleRPC}},
+		{ID: discover.NodeID{63: 0xff}, Roles: []string{RoleEscrow}},
+		{ID: testID3},
+	}
+	output, err := registryOutput(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caller := &registryCaller{output: output}
+	entries, err := NewRegistrySource(caller, caller.address).Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("wrong entries %v, want %v", entries, want)
+	}
+}
+
+func writeAllowlist(t *testing.T, path string, list *Allowlist) {
+	content, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// registryOutput encodes the result of the registry's getNodes function.
+func registryOutput(entries []Entry) ([]byte, error) {
+	parsed, err := abi.JSON(strings.NewReader(RegistryABI))
+	if err != nil {
+		return nil, err
+	}
+	var (
+		high  = make([][32]byte, len(entries))
+		low   = make([][32]byte, len(entries))
+		masks = make([]uint8, len(entries))
+	)
+	for i, e := range entries {
+		copy(high[i][:], e.ID[:32])
+		copy(low[i][:], e.ID[32:])
+		for _, r := range e.Roles {
+			masks[i] |= 1 << uint(roleBit(r))
+		}
+	}
+	return parsed.Methods["getNodes"].Outputs.Pack(high, low, masks)
+}
+
+type registryCaller struct {
+	address common.Address
+	output  []byte
+}
+
+func (c *registryCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if *call.To != c.address {
+		return nil, ethereum.NotFound
+	}
+	return c.output, nil
+}
+
+// staticSource is a source with settable entries.
+type staticSource struct {
+	mu      sync.Mutex
+	entries []Entry
+	err     error
+}
+
+func (s *staticSource) Entries() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries, s.err
+}
+
+func (s *staticSource) set(entries []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+}
+
+func (s *staticSource) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
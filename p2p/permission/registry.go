@@ -0,0 +1,95 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package permission
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/themis-network/go-themis"
+	"github.com/themis-network/go-themis/accounts/abi"
+	"github.com/themis-network/go-themis/common"
+)
+
+// RegistryABI is the interface of the node registry contract. Node IDs don't
+// fit into a single word, so each ID is split into its high and low 32 bytes.
+// Roles are a bitmask with bit 0 for signer, bit 1 for escrow and bit 2 for
+// RPC nodes.
+const RegistryABI = `[{"constant":true,"inputs":[],"name":"getNodes","outputs":[{"name":"idHigh","type":"bytes32[]"},{"name":"idLow","type":"bytes32[]"},{"name":"roles","type":"uint8[]"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+const registryCallTimeout = 10 * time.Second
+
+var errRegistryResult = errors.New("node registry returned inconsistent lists")
+
+// RegistrySource reads allowlist entries from a node registry contract.
+type RegistrySource struct {
+	caller  ethereum.ContractCaller
+	address common.Address
+	abi     abi.ABI
+}
+
+// NewRegistrySource creates a source reading the registry contract at address.
+func NewRegistrySource(caller ethereum.ContractCaller, address common.Address) *RegistrySource {
+	parsed, err := abi.JSON(strings.NewReader(RegistryABI))
+	if err != nil {
+		panic(err)
+	}
+	return &RegistrySource{caller: caller, address: address, abi: parsed}
+}
+
+// Entries implements Source by calling getNodes on the latest state.
+func (s *RegistrySource) Entries() ([]Entry, error) {
+	input, err := s.abi.Pack("getNodes")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), registryCallTimeout)
+	defer cancel()
+	output, err := s.caller.CallContract(ctx, ethereum.CallMsg{To: &s.address, Data: input}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		IdHigh, IdLow [][32]byte
+		Roles         []uint8
+	}
+	if err := s.abi.Unpack(&result, "getNodes", output); err != nil {
+		return nil, err
+	}
+	if len(result.IdHigh) != len(result.IdLow) || len(result.IdHigh) != len(result.Roles) {
+		return nil, errRegistryResult
+	}
+	entries := make([]Entry, len(result.IdHigh))
+	for i := range entries {
+		copy(entries[i].ID[:32], result.IdHigh[i][:])
+		copy(entries[i].ID[32:], result.IdLow[i][:])
+		entries[i].Roles = rolesFromMask(result.Roles[i])
+	}
+	return entries, nil
+}
+
+func rolesFromMask(mask uint8) []string {
+	var rs []string
+	for i, r := range roles {
+		if mask&(1<<uint(i)) != 0 {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/p2p/enr"
 )
 
 // Protocol represents a P2P subprotocol implementation.
@@ -52,6 +53,23 @@ type Protocol struct {
 	// about a certain peer in the network. If an info retrieval function is set,
 	// but returns nil, it is assumed that the protocol handshake is still running.
 	PeerInfo func(id discover.NodeID) interface{}
+
+	// DialFilter is an optional helper method to check the node record of a
+	// discovered node before dialing it. If the record is retrieved and any
+	// protocol's filter returns false, the node is not dialed. Filters should
+	// accept records that don't contain protocol specific entries.
+	DialFilter func(r *enr.Record) bool
+
+	// DialCandidates is an optional source of nodes to dial, like a DNS node
+	// list, consulted by the dialer in addition to the discovery table.
+	DialCandidates NodeSource
+}
+
+// NodeSource is a source of dial candidates.
+type NodeSource interface {
+	// ReadRandomNodes fills the given slice with random nodes, returning the
+	// number of nodes written. It must not block.
+	ReadRandomNodes([]*discover.Node) int
 }
 
 func (p Protocol) cap() Cap {
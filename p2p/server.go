@@ -31,8 +31,10 @@ import (
 	"github.com/themis-network/go-themis/log"
 	"github.com/themis-network/go-themis/p2p/discover"
 	"github.com/themis-network/go-themis/p2p/discv5"
+	"github.com/themis-network/go-themis/p2p/enr"
 	"github.com/themis-network/go-themis/p2p/nat"
 	"github.com/themis-network/go-themis/p2p/netutil"
+	"github.com/themis-network/go-themis/p2p/permission"
 )
 
 const (
@@ -106,6 +108,11 @@ type Config struct {
 	// IP networks contained in the list are considered.
 	NetRestrict *netutil.Netlist `toml:",omitempty"`
 
+	// Permissions enables permissioned mode if set. Only nodes contained in the
+	// allowlist can become peers, this includes static and trusted nodes.
+	// Connected peers are dropped when they are removed from the list.
+	Permissions *permission.List `toml:"-"`
+
 	// NodeDatabase is the path to the database containing the previously seen
 	// live nodes in the network.
 	NodeDatabase string `toml:",omitempty"`
@@ -336,6 +343,21 @@ func (srv *Server) makeSelf(listener net.Listener, ntab discoverTable) *discover
 	return ntab.Self()
 }
 
+// SetLocalEntry adds or updates an entry of the local node record announced
+// by the discovery protocol. It does nothing if discovery is disabled.
+func (srv *Server) SetLocalEntry(e enr.Entry) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if !srv.running {
+		return errServerStopped
+	}
+	if srv.ntab == nil {
+		return nil
+	}
+	return srv.ntab.SetLocalEntry(e)
+}
+
 // Stop terminates the server and all active peer connections.
 // It blocks until all active connections have been closed.
 func (srv *Server) Stop() {
@@ -484,6 +506,12 @@ func (srv *Server) Start() (err error) {
 
 	dynPeers := srv.maxDialedConns()
 	dialer := newDialState(srv.StaticNodes, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	for _, p := range srv.Protocols {
+		if p.DialCandidates != nil {
+			dialer.sources = append(dialer.sources, p.DialCandidates)
+		}
+	}
+	dialer.permissions = srv.Permissions
 
 	// handshake
 	srv.ourHandshake = &protoHandshake{Version: baseProtocolVersion, Name: srv.Name, ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
@@ -544,7 +572,13 @@ func (srv *Server) run(dialstate dialer) {
 		taskdone     = make(chan task, maxActiveDialTasks)
 		runningTasks []task
 		queuedTasks  []task // tasks that can't run yet
+		permChanges  = make(chan struct{}, 1)
 	)
+	// Watch the allowlist to drop peers which are no longer allowed.
+	if srv.Permissions != nil {
+		sub := srv.Permissions.SubscribeChanges(permChanges)
+		defer sub.Unsubscribe()
+	}
 	// Put trusted nodes into a map to speed up checks.
 	// Trusted peers are loaded on startup and cannot be
 	// modified while the server is running.
@@ -605,6 +639,14 @@ running:
 			if p, ok := peers[n.ID]; ok {
 				p.Disconnect(DiscRequested)
 			}
+		case <-permChanges:
+			// The allowlist changed, disconnect peers that were removed.
+			for id, p := range peers {
+				if !srv.Permissions.Allowed(id) {
+					srv.log.Debug("Dropping peer removed from allowlist", "id", id)
+					p.Disconnect(DiscUselessPeer)
+				}
+			}
 		case op := <-srv.peerOp:
 			// This channel is used by Peers and PeerCount.
 			op(peers)
@@ -711,6 +753,8 @@ func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCo
 		return DiscAlreadyConnected
 	case c.id == srv.Self().ID:
 		return DiscSelf
+	case srv.Permissions != nil && !srv.Permissions.Allowed(c.id):
+		return DiscUselessPeer
 	default:
 		return nil
 	}
@@ -954,7 +998,11 @@ func (srv *Server) PeersInfo() []*PeerInfo {
 	infos := make([]*PeerInfo, 0, srv.PeerCount())
 	for _, peer := range srv.Peers() {
 		if peer != nil {
-			infos = append(infos, peer.Info())
+			info := peer.Info()
+			if srv.Permissions != nil {
+				info.Roles = srv.Permissions.Roles(peer.ID())
+			}
+			infos = append(infos, info)
 		}
 	}
 	// Sort the result array alphabetically by node identifier
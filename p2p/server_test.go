@@ -29,6 +29,7 @@ import (
 	"github.com/themis-network/go-themis/crypto/sha3"
 	"github.com/themis-network/go-themis/log"
 	"github.com/themis-network/go-themis/p2p/discover"
+	"github.com/themis-network/go-themis/p2p/permission"
 )
 
 func init() {
@@ -366,6 +367,56 @@ func TestServerAtCap(t *testing.T) {
 
 }
 
+func TestServerPermissions(t *testing.T) {
+	allowedID := randomID()
+	perms, err := permission.NewList(permission.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer perms.Close()
+	perms.Allow(allowedID, []string{permission.RoleSigner})
+
+	srv := &Server{
+		Config: Config{
+			PrivateKey:  newkey(),
+			MaxPeers:    10,
+			NoDial:      true,
+			Permissions: perms,
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(id discover.NodeID) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(id, fd)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, id: id, cont: make(chan error)}
+	}
+	// Nodes outside the allowlist are rejected.
+	if err := srv.checkpoint(newconn(randomID()), srv.posthandshake); err != DiscUselessPeer {
+		t.Error("wrong error for node outside allowlist:", err)
+	}
+	// Allowed nodes are accepted and report their roles.
+	if err := srv.checkpoint(newconn(allowedID), srv.addpeer); err != nil {
+		t.Fatal("could not add allowed conn:", err)
+	}
+	infos := srv.PeersInfo()
+	if len(infos) != 1 || !reflect.DeepEqual(infos[0].Roles, []string{permission.RoleSigner}) {
+		t.Fatalf("wrong peer infos: %+v", infos)
+	}
+	// Denying the node drops it.
+	perms.Deny(allowedID)
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.PeerCount() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("denied peer not dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func TestServerSetupConn(t *testing.T) {
 	id := randomID()
 	srvkey := newkey()
@@ -0,0 +1,353 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/themis-network/go-themis/common/hexutil"
+	"github.com/themis-network/go-themis/log"
+)
+
+var (
+	errMissingToken    = errors.New("missing authentication token")
+	errInvalidToken    = errors.New("invalid authentication token")
+	errExpiredToken    = errors.New("authentication token expired")
+	errUnknownAPIKey   = errors.New("unknown API key")
+	errUnauthenticated = errors.New("unauthenticated")
+)
+
+// AuthConfig is the configuration of the token based authentication of the HTTP
+// and WebSocket RPC endpoints. Callers present either an API key or a JWT signed
+// with the shared secret, and may only call the methods their scopes allow.
+type AuthConfig struct {
+	// JWTSecret is the hex encoded secret of the accepted HS256 signed JWTs. The
+	// "scopes" claim of a token lists the scopes granted to it and the "sub" claim
+	// identifies the caller in the audit log.
+	JWTSecret string `toml:",omitempty"`
+
+	// APIKeys are the static keys accepted, along with the scopes they grant.
+	APIKeys []APIKey `toml:",omitempty"`
+
+	// Scopes maps scope names to the methods they allow, given as patterns like
+	// "eth_*" or "net_version". Patterns prefixed with "!" deny the methods they
+	// match, which takes precedence over any pattern allowing them. A scope name
+	// that isn't defined here is used as a pattern itself.
+	Scopes map[string][]string `toml:",omitempty"`
+
+	// AuditLog is the file denied requests are appended to as JSON lines, on top
+	// of being logged as warnings. Empty disables the audit file.
+	AuditLog string `toml:",omitempty"`
+}
+
+// APIKey is a static key accepted by the RPC endpoints.
+type APIKey struct {
+	Name   string   // Name of the key holder, reported in the audit log
+	Key    string   // Secret presented by the caller
+	Scopes []string // Scopes granted to the holder
+}
+
+// principal is an authenticated caller along with the methods it may call.
+type principal struct {
+	name  string
+	allow []string // Patterns of the allowed methods
+	deny  []string // Patterns of the denied methods
+}
+
+// permits reports whether the principal may call the given method.
+func (p *principal) permits(method string) bool {
+	for _, pattern := range p.deny {
+		if ok, _ := path.Match(pattern, method); ok {
+			return false
+		}
+	}
+	for _, pattern := range p.allow {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// principalKey is the context key of the authenticated caller.
+type principalKey struct{}
+
+// withPrincipal returns a copy of the context carrying the given caller.
+func withPrincipal(ctx context.Context, p *principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFromContext retrieves the authenticated caller from the context.
+func principalFromContext(ctx context.Context) (*principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*principal)
+	return p, ok
+}
+
+// Authenticator authenticates the callers of the HTTP and WebSocket endpoints
+// and authorizes the methods they call.
+type Authenticator struct {
+	secret []byte                // JWT signing secret, nil if JWTs are not accepted
+	keys   map[string]*principal // Callers identified by their API keys
+	scopes map[string][]string   // Method patterns of the configured scopes
+
+	audit   *os.File // Audit log of the denied requests, nil if disabled
+	auditMu sync.Mutex
+}
+
+// NewAuthenticator creates an authenticator from the given configuration.
+func NewAuthenticator(config *AuthConfig) (*Authenticator, error) {
+	if config.JWTSecret == "" && len(config.APIKeys) == 0 {
+		return nil, errors.New("neither JWT secret nor API keys configured")
+	}
+	a := &Authenticator{
+		keys:   make(map[string]*principal),
+		scopes: config.Scopes,
+	}
+	for name, patterns := range config.Scopes {
+		for _, pattern := range patterns {
+			if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q in scope %q", pattern, name)
+			}
+		}
+	}
+	if config.JWTSecret != "" {
+		secret, err := hexutil.Decode(config.JWTSecret)
+		if err != nil {
+			if secret, err = hexutil.Decode("0x" + config.JWTSecret); err != nil {
+				return nil, fmt.Errorf("invalid JWT secret: %v", err)
+			}
+		}
+		if len(secret) < 32 {
+			return nil, errors.New("JWT secret shorter than 32 bytes")
+		}
+		a.secret = secret
+	}
+	for _, key := range config.APIKeys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("empty API key for %q", key.Name)
+		}
+		if _, ok := a.keys[key.Key]; ok {
+			return nil, fmt.Errorf("duplicate API key for %q", key.Name)
+		}
+		p, err := a.principal(key.Name, key.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		a.keys[key.Key] = p
+	}
+	if config.AuditLog != "" {
+		file, err := os.OpenFile(config.AuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		a.audit = file
+	}
+	return a, nil
+}
+
+// Close releases the audit log of the authenticator.
+func (a *Authenticator) Close() error {
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+
+	if a.audit == nil {
+		return nil
+	}
+	err := a.audit.Close()
+	a.audit = nil
+	return err
+}
+
+// principal creates a caller with the methods of the given scopes.
+func (a *Authenticator) principal(name string, scopes []string) (*principal, error) {
+	p := &principal{name: name}
+	for _, scope := range scopes {
+		patterns, ok := a.scopes[scope]
+		if !ok {
+			patterns = []string{scope}
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+				return nil, fmt.Errorf("invalid scope %q of %q", pattern, name)
+			}
+			if strings.HasPrefix(pattern, "!") {
+				p.deny = append(p.deny, pattern[1:])
+			} else {
+				p.allow = append(p.allow, pattern)
+			}
+		}
+	}
+	return p, nil
+}
+
+// authenticate identifies the caller of an HTTP request by the bearer token of
+// its Authorization header, its X-API-Key header or, for WebSocket upgrades that
+// browsers can't attach headers to, its "token" query parameter.
+func (a *Authenticator) authenticate(r *http.Request) (*principal, error) {
+	var token string
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return nil, errInvalidToken
+		}
+		token = strings.TrimSpace(auth[len("Bearer "):])
+	} else if key := r.Header.Get("X-API-Key"); key != "" {
+		token = key
+	} else if r.Method == http.MethodGet {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return nil, errMissingToken
+	}
+	if a.secret != nil && strings.Count(token, ".") == 2 {
+		return a.verifyJWT(token)
+	}
+	if p, ok := a.keys[token]; ok {
+		return p, nil
+	}
+	return nil, errUnknownAPIKey
+}
+
+// jwtClaims are the JWT claims interpreted by the authenticator.
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Scopes    []string `json:"scopes"`
+	Expiry    *int64   `json:"exp"`
+	NotBefore *int64   `json:"nbf"`
+}
+
+// verifyJWT checks the signature and validity period of an HS256 signed JWT and
+// returns the caller it identifies.
+func (a *Authenticator) verifyJWT(token string) (*principal, error) {
+	parts := strings.Split(token, ".")
+
+	blob, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(blob, &header); err != nil || header.Alg != "HS256" {
+		return nil, errInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errInvalidToken
+	}
+	if blob, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, errInvalidToken
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(blob, &claims); err != nil {
+		return nil, errInvalidToken
+	}
+	now := time.Now().Unix()
+	if claims.Expiry != nil && now >= *claims.Expiry {
+		return nil, errExpiredToken
+	}
+	if claims.NotBefore != nil && now < *claims.NotBefore {
+		return nil, errInvalidToken
+	}
+	return a.principal(claims.Subject, claims.Scopes)
+}
+
+// authorize checks whether the caller in the context may call the method,
+// reporting denied requests to the audit log.
+func (a *Authenticator) authorize(ctx context.Context, method string) Error {
+	p, ok := principalFromContext(ctx)
+	if !ok {
+		a.deny(ctx, "", method, errUnauthenticated)
+		return &unauthorizedError{errUnauthenticated.Error()}
+	}
+	if !p.permits(method) {
+		a.deny(ctx, p.name, method, errors.New("method not permitted"))
+		return &unauthorizedError{fmt.Sprintf("method %s not permitted", method)}
+	}
+	return nil
+}
+
+// auditEntry is a line of the audit log.
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Caller string    `json:"caller,omitempty"`
+	Remote string    `json:"remote,omitempty"`
+	Method string    `json:"method,omitempty"`
+	Reason string    `json:"reason"`
+}
+
+// deny reports a denied request to the log and the audit log.
+func (a *Authenticator) deny(ctx context.Context, caller string, method string, reason error) {
+	remote, _ := ctx.Value("remote").(string)
+	log.Warn("Denied RPC request", "caller", caller, "remote", remote, "method", method, "reason", reason)
+
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+
+	if a.audit == nil {
+		return
+	}
+	blob, _ := json.Marshal(&auditEntry{
+		Time:   time.Now(),
+		Caller: caller,
+		Remote: remote,
+		Method: method,
+		Reason: reason.Error(),
+	})
+	if _, err := a.audit.Write(append(blob, '\n')); err != nil {
+		log.Error("Failed to write RPC audit log", "err", err)
+	}
+}
+
+// Handler protects a plain HTTP handler served alongside the RPC endpoint, like
+// the GraphQL one, with the authenticator. Callers must be permitted the given
+// pseudo-method by their scopes.
+func (a *Authenticator) Handler(method string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "remote", r.RemoteAddr)
+
+		p, err := a.authenticate(r)
+		if err != nil {
+			a.deny(ctx, "", method, err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		ctx = withPrincipal(ctx, p)
+		if err := a.authorize(ctx, method); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
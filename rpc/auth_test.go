@@ -0,0 +1,270 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+var testJWTSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// signJWT creates an HS256 signed JWT with the given claims.
+func signJWT(secret []byte, claims interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	blob, _ := json.Marshal(claims)
+	payload := base64.RawURLEncoding.EncodeToString(blob)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newAuthTestServer creates an HTTP RPC server with the test service registered
+// and authentication enabled.
+func newAuthTestServer(t *testing.T, auditLog string) (*httptest.Server, *Authenticator) {
+	auth, err := NewAuthenticator(&AuthConfig{
+		JWTSecret: "0x" + hex.EncodeToString(testJWTSecret),
+		APIKeys: []APIKey{
+			{Name: "reader", Key: "reader-key", Scopes: []string{"readonly"}},
+			{Name: "admin", Key: "admin-key", Scopes: []string{"*"}},
+		},
+		Scopes: map[string][]string{
+			"readonly": {"test_*", "!test_sleep"},
+		},
+		AuditLog: auditLog,
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	server := NewServer()
+	server.SetAuthenticator(auth)
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(server), auth
+}
+
+// authCall issues a raw JSON-RPC call with the given headers, returning the HTTP
+// status and the decoded response.
+func authCall(t *testing.T, url string, method string, header map[string]string) (int, *jsonrpcMessage) {
+	body := `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":[]}`
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, nil
+	}
+	msg := new(jsonrpcMessage)
+	if err := json.NewDecoder(res.Body).Decode(msg); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	return res.StatusCode, msg
+}
+
+func TestAuthHTTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpc-auth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	audit := filepath.Join(dir, "audit.log")
+
+	hs, auth := newAuthTestServer(t, audit)
+	defer hs.Close()
+	defer auth.Close()
+
+	now := time.Now().Unix()
+	tests := []struct {
+		header  map[string]string
+		method  string
+		status  int
+		allowed bool
+	}{
+		// Missing or invalid credentials are rejected outright
+		{nil, "test_rets", http.StatusUnauthorized, false},
+		{map[string]string{"Authorization": "Basic Zm9vOmJhcg=="}, "test_rets", http.StatusUnauthorized, false},
+		{map[string]string{"X-API-Key": "unknown"}, "test_rets", http.StatusUnauthorized, false},
+		{map[string]string{"Authorization": "Bearer " + signJWT([]byte("wrong secret, wrong secret, wrong"), map[string]interface{}{"scopes": []string{"*"}})}, "test_rets", http.StatusUnauthorized, false},
+		{map[string]string{"Authorization": "Bearer " + signJWT(testJWTSecret, map[string]interface{}{"scopes": []string{"*"}, "exp": now - 1})}, "test_rets", http.StatusUnauthorized, false},
+
+		// API keys are permitted their scopes, with denials taking precedence
+		{map[string]string{"X-API-Key": "reader-key"}, "test_rets", http.StatusOK, true},
+		{map[string]string{"Authorization": "Bearer reader-key"}, "test_rets", http.StatusOK, true},
+		{map[string]string{"X-API-Key": "reader-key"}, "test_sleep", http.StatusOK, false},
+		{map[string]string{"X-API-Key": "reader-key"}, "rpc_modules", http.StatusOK, false},
+		{map[string]string{"X-API-Key": "admin-key"}, "rpc_modules", http.StatusOK, true},
+
+		// JWTs are permitted the scopes of their claims
+		{map[string]string{"Authorization": "Bearer " + signJWT(testJWTSecret, map[string]interface{}{"sub": "jwt", "scopes": []string{"readonly"}, "exp": now + 60})}, "test_rets", http.StatusOK, true},
+		{map[string]string{"Authorization": "Bearer " + signJWT(testJWTSecret, map[string]interface{}{"sub": "jwt", "scopes": []string{"readonly"}})}, "test_sleep", http.StatusOK, false},
+		{map[string]string{"Authorization": "Bearer " + signJWT(testJWTSecret, map[string]interface{}{"sub": "jwt", "scopes": []string{"rpc_modules"}})}, "rpc_modules", http.StatusOK, true},
+	}
+	for i, tt := range tests {
+		status, msg := authCall(t, hs.URL, tt.method, tt.header)
+		if status != tt.status {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, status, tt.status)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+		if allowed := msg.Error == nil; allowed != tt.allowed {
+			t.Errorf("test %d: permission mismatch: have %v, want %v (error %v)", i, allowed, tt.allowed, msg.Error)
+		}
+		if msg.Error != nil && msg.Error.Code != -32001 {
+			t.Errorf("test %d: error code mismatch: have %d, want %d", i, msg.Error.Code, -32001)
+		}
+	}
+	// Every denied request must have been audit logged
+	file, err := os.Open(audit)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var entries []auditEntry
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid audit entry %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	var denied int
+	for _, tt := range tests {
+		if !tt.allowed {
+			denied++
+		}
+	}
+	if len(entries) != denied {
+		t.Fatalf("audit entry count mismatch: have %d, want %d", len(entries), denied)
+	}
+	if entry := entries[len(entries)-1]; entry.Caller != "jwt" || entry.Method != "test_sleep" {
+		t.Errorf("audit entry mismatch: have caller %q method %q, want %q %q", entry.Caller, entry.Method, "jwt", "test_sleep")
+	}
+}
+
+func TestAuthWebsocket(t *testing.T) {
+	auth, err := NewAuthenticator(&AuthConfig{
+		APIKeys: []APIKey{{Name: "reader", Key: "reader-key", Scopes: []string{"test_rets"}}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	server := NewServer()
+	server.SetAuthenticator(auth)
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	defer hs.Close()
+
+	endpoint := "ws" + strings.TrimPrefix(hs.URL, "http")
+
+	// Connections without credentials must be refused during the handshake
+	if _, err := websocket.Dial(endpoint, "", "http://localhost"); err == nil {
+		t.Fatal("unauthenticated websocket connection accepted")
+	}
+	// Authenticated connections must be limited to their scopes
+	config, _ := websocket.NewConfig(endpoint, "http://localhost")
+	config.Header.Set("X-API-Key", "reader-key")
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatalf("authenticated websocket connection refused: %v", err)
+	}
+	defer conn.Close()
+
+	for _, tt := range []struct {
+		method  string
+		allowed bool
+	}{{"test_rets", true}, {"test_noArgsRets", false}} {
+		if err := websocket.JSON.Send(conn, map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": tt.method}); err != nil {
+			t.Fatal(err)
+		}
+		var msg jsonrpcMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if allowed := msg.Error == nil; allowed != tt.allowed {
+			t.Errorf("%s: permission mismatch: have %v, want %v", tt.method, allowed, tt.allowed)
+		}
+	}
+	// Query tokens must be accepted for browsers unable to set headers
+	if conn, err := websocket.Dial(endpoint+"?token=reader-key", "", "http://localhost"); err != nil {
+		t.Errorf("websocket connection with query token refused: %v", err)
+	} else {
+		conn.Close()
+	}
+}
+
+func TestAuthHandler(t *testing.T) {
+	auth, err := NewAuthenticator(&AuthConfig{
+		APIKeys: []APIKey{
+			{Name: "graphql", Key: "graphql-key", Scopes: []string{"graphql"}},
+			{Name: "reader", Key: "reader-key", Scopes: []string{"test_*"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create authenticator: %v", err)
+	}
+	server := NewServer()
+	server.SetAuthenticator(auth)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	hs := httptest.NewServer(newHTTPMux(server, auth, map[string]http.Handler{"/graphql": ok}))
+	defer hs.Close()
+
+	for _, tt := range []struct {
+		key    string
+		status int
+	}{{"", http.StatusUnauthorized}, {"reader-key", http.StatusForbidden}, {"graphql-key", http.StatusOK}} {
+		req, _ := http.NewRequest(http.MethodPost, hs.URL+"/graphql", nil)
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.status {
+			t.Errorf("key %q: status mismatch: have %d, want %d", tt.key, res.StatusCode, tt.status)
+		}
+	}
+}
@@ -634,14 +634,23 @@ func (c *Client) handleNotification(msg *jsonrpcMessage) {
 	var subResult struct {
 		ID     string          `json:"subscription"`
 		Result json.RawMessage `json:"result"`
+		Error  *jsonError      `json:"error"`
 	}
 	if err := json.Unmarshal(msg.Params, &subResult); err != nil {
 		log.Debug("dropping invalid subscription message", "msg", msg)
 		return
 	}
-	if c.subs[subResult.ID] != nil {
-		c.subs[subResult.ID].deliver(subResult.Result)
+	sub := c.subs[subResult.ID]
+	if sub == nil {
+		return
+	}
+	// The server terminates failed subscriptions with an error
+	if subResult.Error != nil {
+		delete(c.subs, subResult.ID)
+		sub.quitWithError(subResult.Error, false)
+		return
 	}
+	sub.deliver(subResult.Result)
 }
 
 func (c *Client) handleResponse(msg *jsonrpcMessage) {
@@ -251,6 +251,30 @@ func TestClientSubscribe(t *testing.T) {
 	}
 }
 
+// Tests that subscriptions failed by the server end with the server's error.
+func TestClientSubscriptionFailure(t *testing.T) {
+	server := newTestServer("eth", new(NotificationTestService))
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	nc := make(chan int)
+	sub, err := client.EthSubscribe(context.Background(), nc, "failingSubscription", "replay failed")
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	select {
+	case v := <-nc:
+		t.Fatal("received value from failed subscription:", v)
+	case err := <-sub.Err():
+		if err == nil || err.Error() != "replay failed" {
+			t.Fatalf("subscription error mismatch: have %v, want %q", err, "replay failed")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("subscription not failed within 1s")
+	}
+}
+
 func TestClientSubscribeCustomNamespace(t *testing.T) {
 	namespace := "custom"
 	server := newTestServer(namespace, new(NotificationTestService))
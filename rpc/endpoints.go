@@ -17,13 +17,22 @@
 package rpc
 
 import (
+	"bufio"
 	"net"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/themis-network/go-themis/log"
 )
 
-// StartHTTPEndpoint starts the HTTP RPC endpoint, configured with cors/vhosts/modules
-func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []string, vhosts []string) (net.Listener, *Server, error) {
+// StartHTTPEndpoint starts the HTTP RPC endpoint, configured with cors/vhosts/modules.
+// If auth is non-nil, callers must authenticate and are only permitted the methods
+// of their scopes. If limits is non-nil, the requests of the callers are limited.
+// Additional handlers are mounted on their paths next to the RPC server. If ws is
+// non-nil, websocket upgrade requests are passed to it, serving both on the same
+// port and path. If tls is non-nil, the endpoint is served over TLS.
+func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []string, vhosts []string, auth *Authenticator, limits *Limits, handlers map[string]http.Handler, ws http.Handler, tls *TLSTerminator) (net.Listener, *Server, error) {
 	// Generate the whitelist based on the allowed modules
 	whitelist := make(map[string]bool)
 	for _, module := range modules {
@@ -31,6 +40,8 @@ func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []str
 	}
 	// Register all the APIs exposed by the services
 	handler := NewServer()
+	handler.SetAuthenticator(auth)
+	handler.SetLimits(limits)
 	for _, api := range apis {
 		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -44,16 +55,40 @@ func StartHTTPEndpoint(endpoint string, apis []API, modules []string, cors []str
 		listener net.Listener
 		err      error
 	)
-	if listener, err = net.Listen("tcp", endpoint); err != nil {
+	if listener, err = listen(endpoint, tls); err != nil {
 		return nil, nil, err
 	}
-	go NewHTTPServer(cors, vhosts, handler).Serve(listener)
+	server := NewHTTPServer(cors, vhosts, newHTTPMux(handler, auth, handlers))
+	if ws != nil {
+		server.Handler = &upgradeHandler{http: server.Handler, ws: ws}
+	}
+	go server.Serve(listener)
 	return listener, handler, err
 }
 
-// StartWSEndpoint starts a websocket endpoint
-func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []string, exposeAll bool) (net.Listener, *Server, error) {
+// StartWSEndpoint starts a websocket endpoint. If auth is non-nil, callers must
+// authenticate and are only permitted the methods of their scopes. If limits is
+// non-nil, the requests of the callers are limited. If tls is non-nil, the
+// endpoint is served over TLS.
+func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []string, exposeAll bool, auth *Authenticator, limits *Limits, tls *TLSTerminator) (net.Listener, *Server, error) {
+	handler, ws, err := NewWSHandler(apis, modules, wsOrigins, exposeAll, auth, limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	// All APIs registered, start the HTTP listener
+	var listener net.Listener
+	if listener, err = listen(endpoint, tls); err != nil {
+		return nil, nil, err
+	}
+	go (&http.Server{Handler: ws}).Serve(listener)
+	return listener, handler, err
 
+}
+
+// NewWSHandler creates the RPC server of a websocket endpoint along with the
+// handler upgrading the connections to it, without starting a listener. It is
+// used to serve websockets next to an HTTP endpoint.
+func NewWSHandler(apis []API, modules []string, wsOrigins []string, exposeAll bool, auth *Authenticator, limits *Limits) (*Server, http.Handler, error) {
 	// Generate the whitelist based on the allowed modules
 	whitelist := make(map[string]bool)
 	for _, module := range modules {
@@ -61,6 +96,8 @@ func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []
 	}
 	// Register all the APIs exposed by the services
 	handler := NewServer()
+	handler.SetAuthenticator(auth)
+	handler.SetLimits(limits)
 	for _, api := range apis {
 		if exposeAll || whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -69,17 +106,7 @@ func StartWSEndpoint(endpoint string, apis []API, modules []string, wsOrigins []
 			log.Debug("WebSocket registered", "service", api.Service, "namespace", api.Namespace)
 		}
 	}
-	// All APIs registered, start the HTTP listener
-	var (
-		listener net.Listener
-		err      error
-	)
-	if listener, err = net.Listen("tcp", endpoint); err != nil {
-		return nil, nil, err
-	}
-	go NewWSServer(wsOrigins, handler).Serve(listener)
-	return listener, handler, err
-
+	return handler, handler.WebsocketHandler(wsOrigins), nil
 }
 
 // StartIPCEndpoint starts an IPC endpoint.
@@ -100,3 +127,73 @@ func StartIPCEndpoint(ipcEndpoint string, apis []API) (net.Listener, *Server, er
 	go handler.ServeListener(listener)
 	return listener, handler, nil
 }
+
+// newHTTPMux mounts the additional handlers of an HTTP endpoint next to the RPC
+// server, protecting them with the authenticator if one is set. The pseudo-method
+// callers need to be permitted is the first segment of the handler's path.
+func newHTTPMux(srv *Server, auth *Authenticator, handlers map[string]http.Handler) http.Handler {
+	if len(handlers) == 0 {
+		return srv
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", srv)
+	for path, handler := range handlers {
+		if auth != nil {
+			handler = auth.Handler(strings.SplitN(strings.Trim(path, "/"), "/", 2)[0], handler)
+		}
+		mux.Handle(path, handler)
+		log.Debug("HTTP handler registered", "path", path)
+	}
+	return mux
+}
+
+// listen starts a TCP listener on the endpoint, terminating TLS if tls is non-nil.
+func listen(endpoint string, tls *TLSTerminator) (net.Listener, error) {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if tls != nil {
+		listener = tls.Listener(listener)
+	}
+	return listener, nil
+}
+
+// upgradeHandler passes the websocket upgrade requests of an HTTP endpoint to the
+// websocket handler and all other requests to the HTTP one.
+type upgradeHandler struct {
+	http http.Handler
+	ws   http.Handler
+}
+
+// ServeHTTP implements http.Handler.
+func (h *upgradeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		h.http.ServeHTTP(w, r)
+		return
+	}
+	if hijacker, ok := w.(http.Hijacker); ok {
+		w = &upgradeResponseWriter{ResponseWriter: w, hijacker: hijacker}
+	}
+	h.ws.ServeHTTP(w, r)
+}
+
+// upgradeResponseWriter clears the deadlines the HTTP server sets on connections
+// when they are hijacked, as they would otherwise time out long-lived websockets.
+type upgradeResponseWriter struct {
+	http.ResponseWriter
+	hijacker http.Hijacker
+}
+
+// Hijack implements http.Hijacker.
+func (w *upgradeResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, rw, nil
+}
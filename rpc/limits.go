@@ -0,0 +1,158 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"math"
+	"net"
+	"path"
+	"sync"
+	"time"
+)
+
+// rateLimiterPruneInterval is the interval at which the idle clients are dropped
+// from the rate limiter.
+const rateLimiterPruneInterval = time.Minute
+
+// Limits configures the protection of an RPC server against clients hogging its
+// resources. Zero values disable the respective limit.
+type Limits struct {
+	// RequestsPerSecond is the sustained rate of requests a single client may
+	// issue, clients being identified by their authentication token or, lacking
+	// one, by their IP address. Every call of a batch counts as a request.
+	RequestsPerSecond float64 `toml:",omitempty"`
+
+	// RequestBurst is the number of requests a client may issue at once over the
+	// sustained rate. Defaults to one second worth of requests.
+	RequestBurst int `toml:",omitempty"`
+
+	// MaxBatchSize is the maximum number of calls in a batch request.
+	MaxBatchSize int `toml:",omitempty"`
+
+	// MaxConcurrentRequests is the maximum number of requests executed at the
+	// same time for a single connection. Batches count as a single request.
+	MaxConcurrentRequests int `toml:",omitempty"`
+
+	// MethodTimeouts maps method patterns like "debug_trace*" to the time their
+	// execution is allowed to take. When several patterns match, the longest one
+	// applies. The timeout is enforced through the context passed to the method,
+	// so it does not apply to methods not accepting one.
+	MethodTimeouts map[string]time.Duration `toml:",omitempty"`
+}
+
+// MethodTimeout returns the execution timeout of the given method, or zero if it
+// is not limited. Services answering outside of the RPC server (e.g. GraphQL) use
+// it to apply the timeout of the method they are equivalent to.
+func (l *Limits) MethodTimeout(method string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	var (
+		timeout time.Duration
+		longest = -1
+	)
+	for pattern, limit := range l.MethodTimeouts {
+		if ok, _ := path.Match(pattern, method); ok && len(pattern) > longest {
+			timeout, longest = limit, len(pattern)
+		}
+	}
+	return timeout
+}
+
+// bucket is the token bucket of a single client.
+type bucket struct {
+	tokens float64   // Requests the client may currently issue
+	last   time.Time // Time of the last refill of the bucket
+}
+
+// rateLimiter limits the request rate of the clients with a token bucket each.
+type rateLimiter struct {
+	rate  float64 // Tokens added to the buckets per second
+	burst float64 // Capacity of the buckets
+
+	buckets map[string]*bucket
+	pruned  time.Time // Time the idle buckets were last dropped
+	lock    sync.Mutex
+}
+
+// newRateLimiter creates a rate limiter allowing the given sustained rate and
+// burst of requests per client.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		pruned:  time.Now(),
+	}
+}
+
+// allow consumes a token of the client's bucket, reporting whether the client
+// may issue the request.
+func (l *rateLimiter) allow(client string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.pruned) > rateLimiterPruneInterval {
+		l.prune(now)
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune drops the buckets that have been refilled to their capacity since, as
+// they are indistinguishable from the ones of new clients.
+func (l *rateLimiter) prune(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.pruned = now
+}
+
+// clientFromContext identifies the client issuing a request by its authenticated
+// name or its IP address. Local clients of the IPC and in-process endpoints are
+// not identified.
+func clientFromContext(ctx context.Context) (string, bool) {
+	if p, ok := principalFromContext(ctx); ok {
+		return "token:" + p.name, true
+	}
+	remote, _ := ctx.Value("remote").(string)
+	if remote == "" {
+		return "", false
+	}
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host, true
+	}
+	return remote, true
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// newLimitsTestServer creates an RPC server with the test service registered and
+// the given limits enabled.
+func newLimitsTestServer(t *testing.T, limits *Limits) *Server {
+	server := NewServer()
+	server.SetLimits(limits)
+	if err := server.RegisterName("test", new(Service)); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// postRaw posts a raw JSON-RPC request and decodes the response into result.
+func postRaw(t *testing.T, url string, body string, result interface{}) {
+	res, err := http.Post(url, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(1, 2)
+	for i := 0; i < 2; i++ {
+		if !limiter.allow("a") {
+			t.Fatalf("request %d within burst denied", i)
+		}
+	}
+	if limiter.allow("a") {
+		t.Fatal("request over burst allowed")
+	}
+	if !limiter.allow("b") {
+		t.Fatal("request of other client denied")
+	}
+	// Refill the bucket and ensure it's pruned as idle
+	limiter.buckets["a"].last = time.Now().Add(-time.Hour)
+	if !limiter.allow("a") {
+		t.Fatal("request after refill denied")
+	}
+	limiter.buckets["b"].last = time.Now().Add(-time.Hour)
+	limiter.prune(time.Now())
+	if _, ok := limiter.buckets["b"]; ok {
+		t.Fatal("idle client not pruned")
+	}
+}
+
+func TestLimitsRequestRate(t *testing.T) {
+	hs := httptest.NewServer(newLimitsTestServer(t, &Limits{RequestsPerSecond: 0.001, RequestBurst: 3}))
+	defer hs.Close()
+
+	// The burst is shared by all the calls of a batch
+	var batch []jsonrpcMessage
+	postRaw(t, hs.URL, `[{"jsonrpc":"2.0","id":1,"method":"test_rets"},{"jsonrpc":"2.0","id":2,"method":"test_rets"}]`, &batch)
+	for i, msg := range batch {
+		if msg.Error != nil {
+			t.Fatalf("call %d within burst failed: %v", i, msg.Error)
+		}
+	}
+	var msg jsonrpcMessage
+	postRaw(t, hs.URL, `{"jsonrpc":"2.0","id":3,"method":"test_rets"}`, &msg)
+	if msg.Error != nil {
+		t.Fatalf("call within burst failed: %v", msg.Error)
+	}
+	msg = jsonrpcMessage{}
+	postRaw(t, hs.URL, `{"jsonrpc":"2.0","id":4,"method":"test_rets"}`, &msg)
+	if msg.Error == nil || msg.Error.Code != -32005 {
+		t.Fatalf("call over burst: have error %v, want code -32005", msg.Error)
+	}
+}
+
+func TestLimitsBatchSize(t *testing.T) {
+	hs := httptest.NewServer(newLimitsTestServer(t, &Limits{MaxBatchSize: 2}))
+	defer hs.Close()
+
+	var batch []jsonrpcMessage
+	postRaw(t, hs.URL, `[{"jsonrpc":"2.0","id":1,"method":"test_rets"},{"jsonrpc":"2.0","id":2,"method":"test_rets"}]`, &batch)
+	if len(batch) != 2 {
+		t.Fatalf("batch within limit: have %d responses, want 2", len(batch))
+	}
+	var msg jsonrpcMessage
+	postRaw(t, hs.URL, `[{"jsonrpc":"2.0","id":1,"method":"test_rets"},{"jsonrpc":"2.0","id":2,"method":"test_rets"},{"jsonrpc":"2.0","id":3,"method":"test_rets"}]`, &msg)
+	if msg.Error == nil || msg.Error.Code != -32005 {
+		t.Fatalf("batch over limit: have error %v, want code -32005", msg.Error)
+	}
+}
+
+func TestLimitsMethodTimeout(t *testing.T) {
+	hs := httptest.NewServer(newLimitsTestServer(t, &Limits{
+		MethodTimeouts: map[string]time.Duration{
+			"test_*":     time.Hour,
+			"test_sleep": 50 * time.Millisecond,
+		},
+	}))
+	defer hs.Close()
+
+	start := time.Now()
+	var msg jsonrpcMessage
+	postRaw(t, hs.URL, `{"jsonrpc":"2.0","id":1,"method":"test_sleep","params":[10000000000]}`, &msg)
+	if msg.Error == nil || msg.Error.Code != -32002 {
+		t.Fatalf("have error %v, want code -32002", msg.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("timeout not enforced, call took %v", elapsed)
+	}
+	msg = jsonrpcMessage{}
+	postRaw(t, hs.URL, `{"jsonrpc":"2.0","id":2,"method":"test_sleep","params":[1000000]}`, &msg)
+	if msg.Error != nil {
+		t.Fatalf("call within timeout failed: %v", msg.Error)
+	}
+}
+
+func TestLimitsConcurrentRequests(t *testing.T) {
+	hs := httptest.NewServer(newLimitsTestServer(t, &Limits{MaxConcurrentRequests: 1}).WebsocketHandler([]string{"*"}))
+	defer hs.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(hs.URL, "http"), "", "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Issue a second request while the first is still executing
+	for id := 1; id <= 2; id++ {
+		req := map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": "test_sleep", "params": []interface{}{int64(200 * time.Millisecond)}}
+		if err := websocket.JSON.Send(conn, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	results := make(map[string]*jsonError)
+	for i := 0; i < 2; i++ {
+		var msg jsonrpcMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			t.Fatal(err)
+		}
+		results[string(msg.ID)] = msg.Error
+	}
+	if results["1"] != nil {
+		t.Errorf("first request failed: %v", results["1"])
+	}
+	if results["2"] == nil || results["2"].Code != -32005 {
+		t.Errorf("concurrent request: have error %v, want code -32005", results["2"])
+	}
+}
@@ -158,6 +158,11 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 	s.codecs.Add(codec)
 	s.codecsMu.Unlock()
 
+	// Track the requests executing concurrently if limited
+	var slots chan struct{}
+	if s.limits != nil && s.limits.MaxConcurrentRequests > 0 && !singleShot {
+		slots = make(chan struct{}, s.limits.MaxConcurrentRequests)
+	}
 	// test if the server is ordered to stop
 	for atomic.LoadInt32(&s.run) == 1 {
 		reqs, batch, err := s.readRequest(codec)
@@ -175,18 +180,19 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 		// check if server is ordered to shutdown and return an error
 		// telling the client that his request failed.
 		if atomic.LoadInt32(&s.run) != 1 {
-			err = &shutdownError{}
-			if batch {
-				resps := make([]interface{}, len(reqs))
-				for i, r := range reqs {
-					resps[i] = codec.CreateErrorResponse(&r.id, err)
-				}
-				codec.Write(resps)
-			} else {
-				codec.Write(codec.CreateErrorResponse(&reqs[0].id, err))
-			}
+			writeErrors(codec, reqs, batch, &shutdownError{})
 			return nil
 		}
+		// Reject batches exceeding the allowed size as a whole
+		if batch && s.limits != nil && s.limits.MaxBatchSize > 0 && len(reqs) > s.limits.MaxBatchSize {
+			codec.Write(codec.CreateErrorResponse(nil, &limitExceededError{
+				fmt.Sprintf("batch too large (%d>%d)", len(reqs), s.limits.MaxBatchSize),
+			}))
+			if singleShot {
+				return nil
+			}
+			continue
+		}
 		// If a single shot request is executing, run and return immediately
 		if singleShot {
 			if batch {
@@ -196,11 +202,25 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 			}
 			return nil
 		}
-		// For multi-shot connections, start a goroutine to serve and loop back
+		// For multi-shot connections, start a goroutine to serve and loop back,
+		// unless the connection is already executing its allowance of requests
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			default:
+				writeErrors(codec, reqs, batch, &limitExceededError{
+					fmt.Sprintf("too many concurrent requests (max %d)", cap(slots)),
+				})
+				continue
+			}
+		}
 		pend.Add(1)
 
 		go func(reqs []*serverRequest, batch bool) {
 			defer pend.Done()
+			if slots != nil {
+				defer func() { <-slots }()
+			}
 			if batch {
 				s.execBatch(ctx, codec, reqs)
 			} else {
@@ -211,6 +231,22 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 	return nil
 }
 
+// SetLimits enables the limits protecting the server against clients hogging its
+// resources. It must be called before serving requests.
+func (s *Server) SetLimits(limits *Limits) {
+	s.limits, s.limiter = limits, nil
+	if limits != nil && limits.RequestsPerSecond > 0 {
+		s.limiter = newRateLimiter(limits.RequestsPerSecond, limits.RequestBurst)
+	}
+}
+
+// SetAuthenticator enables the authorization of the called methods against the
+// caller authenticated by the HTTP and WebSocket handlers. Requests without an
+// authenticated caller are denied. It must be called before serving requests.
+func (s *Server) SetAuthenticator(auth *Authenticator) {
+	s.auth = auth
+}
+
 // ServeCodec reads incoming requests from codec, calls the appropriate callback and writes the
 // response back using the given codec. It will block until the codec is closed or the server is
 // stopped. In either case the codec is closed.
@@ -256,6 +292,18 @@ func (s *Server) createSubscription(ctx context.Context, c ServerCodec, req *ser
 
 // handle executes a request and returns the response from the callback.
 func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverRequest) (interface{}, func()) {
+	if s.limiter != nil {
+		if client, ok := clientFromContext(ctx); ok && !s.limiter.allow(client) {
+			return codec.CreateErrorResponse(&req.id, &limitExceededError{"request rate limit exceeded"}), nil
+		}
+	}
+	// Authorize calls of existing methods before even looking at their arguments.
+	// Unsubscribing is always permitted, it only concerns the caller's own subscriptions.
+	if s.auth != nil && req.method != "" {
+		if err := s.auth.authorize(ctx, req.method); err != nil {
+			return codec.CreateErrorResponse(&req.id, err), nil
+		}
+	}
 	if req.err != nil {
 		return codec.CreateErrorResponse(&req.id, req.err), nil
 	}
@@ -300,8 +348,14 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 		return codec.CreateErrorResponse(&req.id, rpcErr), nil
 	}
 
+	timeout := s.limits.MethodTimeout(req.method)
 	arguments := []reflect.Value{req.callb.rcvr}
 	if req.callb.hasCtx {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
 		arguments = append(arguments, reflect.ValueOf(ctx))
 	}
 	if len(req.args) > 0 {
@@ -310,12 +364,18 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 
 	// execute RPC method and return result
 	reply := req.callb.method.Func.Call(arguments)
+	if timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		return codec.CreateErrorResponse(&req.id, &timeoutError{fmt.Sprintf("%s timed out after %v", req.method, timeout)}), nil
+	}
 	if len(reply) == 0 {
 		return codec.CreateResponse(req.id, nil), nil
 	}
 	if req.callb.errPos >= 0 { // test if method returned an error
 		if !reply[req.callb.errPos].IsNil() {
 			e := reply[req.callb.errPos].Interface().(error)
+			if de, ok := e.(DataError); ok {
+				return codec.CreateErrorResponseWithInfo(&req.id, &callbackError{e.Error()}, de.ErrorData()), nil
+			}
 			res := codec.CreateErrorResponse(&req.id, &callbackError{e.Error()})
 			return res, nil
 		}
@@ -325,13 +385,7 @@ func (s *Server) handle(ctx context.Context, codec ServerCodec, req *serverReque
 
 // exec executes the given request and writes the result back using the codec.
 func (s *Server) exec(ctx context.Context, codec ServerCodec, req *serverRequest) {
-	var response interface{}
-	var callback func()
-	if req.err != nil {
-		response = codec.CreateErrorResponse(&req.id, req.err)
-	} else {
-		response, callback = s.handle(ctx, codec, req)
-	}
+	response, callback := s.handle(ctx, codec, req)
 
 	if err := codec.Write(response); err != nil {
 		log.Error(fmt.Sprintf("%v\n", err))
@@ -350,13 +404,9 @@ func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*s
 	responses := make([]interface{}, len(requests))
 	var callbacks []func()
 	for i, req := range requests {
-		if req.err != nil {
-			responses[i] = codec.CreateErrorResponse(&req.id, req.err)
-		} else {
-			var callback func()
-			if responses[i], callback = s.handle(ctx, codec, req); callback != nil {
-				callbacks = append(callbacks, callback)
-			}
+		var callback func()
+		if responses[i], callback = s.handle(ctx, codec, req); callback != nil {
+			callbacks = append(callbacks, callback)
 		}
 	}
 
@@ -371,6 +421,19 @@ func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*s
 	}
 }
 
+// writeErrors responds to all the given requests with the same error.
+func writeErrors(codec ServerCodec, reqs []*serverRequest, batch bool, err Error) {
+	if !batch {
+		codec.Write(codec.CreateErrorResponse(&reqs[0].id, err))
+		return
+	}
+	resps := make([]interface{}, len(reqs))
+	for i, r := range reqs {
+		resps[i] = codec.CreateErrorResponse(&r.id, err)
+	}
+	codec.Write(resps)
+}
+
 // readRequest requests the next (batch) request from the codec. It will return the collection
 // of requests, an indication if the request was a batch, the invalid request identifier and an
 // error when the request could not be read/parsed.
@@ -410,7 +473,7 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 
 		if r.isPubSub { // eth_subscribe, r.method contains the subscription method name
 			if callb, ok := svc.subscriptions[r.method]; ok {
-				requests[i] = &serverRequest{id: r.id, svcname: svc.name, callb: callb}
+				requests[i] = &serverRequest{id: r.id, svcname: svc.name, method: r.service + subscribeMethodSuffix, callb: callb}
 				if r.params != nil && len(callb.argTypes) > 0 {
 					argTypes := []reflect.Type{reflect.TypeOf("")}
 					argTypes = append(argTypes, callb.argTypes...)
@@ -427,7 +490,7 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 		}
 
 		if callb, ok := svc.callbacks[r.method]; ok { // lookup RPC method
-			requests[i] = &serverRequest{id: r.id, svcname: svc.name, callb: callb}
+			requests[i] = &serverRequest{id: r.id, svcname: svc.name, method: r.service + serviceMethodSeparator + r.method, callb: callb}
 			if r.params != nil && len(callb.argTypes) > 0 {
 				if args, err := codec.ParseRequestArguments(callb.argTypes, r.params); err == nil {
 					requests[i].args = args
@@ -37,7 +37,8 @@ type ID string
 type Subscription struct {
 	ID        ID
 	namespace string
-	err       chan error // closed on unsubscribe
+	err       chan error    // closed on unsubscribe
+	activated chan struct{} // closed on activation
 }
 
 // Err returns a channel that is closed when the client send an unsubscribe request.
@@ -45,6 +46,13 @@ func (s *Subscription) Err() <-chan error {
 	return s.err
 }
 
+// Activated returns a channel that is closed once the subscription ID was sent to
+// the client. Notifications sent before are dropped, callbacks which mustn't lose
+// any can wait for it.
+func (s *Subscription) Activated() <-chan struct{} {
+	return s.activated
+}
+
 // notifierKey is used to store a notifier within the connection context.
 type notifierKey struct{}
 
@@ -78,7 +86,7 @@ func NotifierFromContext(ctx context.Context) (*Notifier, bool) {
 // are dropped until the subscription is marked as active. This is done
 // by the RPC server after the subscription ID is send to the client.
 func (n *Notifier) CreateSubscription() *Subscription {
-	s := &Subscription{ID: NewID(), err: make(chan error)}
+	s := &Subscription{ID: NewID(), err: make(chan error), activated: make(chan struct{})}
 	n.subMu.Lock()
 	n.inactive[s.ID] = s
 	n.subMu.Unlock()
@@ -102,6 +110,28 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 	return nil
 }
 
+// Fail terminates a subscription with the given error, which is sent to the
+// client as the last notification of the subscription. The Err channel of the
+// subscription is closed as on an unsubscribe request.
+func (n *Notifier) Fail(id ID, err error) error {
+	n.subMu.Lock()
+	defer n.subMu.Unlock()
+
+	sub, active := n.active[id]
+	if !active {
+		return ErrSubscriptionNotFound
+	}
+	close(sub.err)
+	delete(n.active, id)
+
+	notification := n.codec.CreateErrorNotification(string(id), sub.namespace, &callbackError{err.Error()})
+	if err := n.codec.Write(notification); err != nil {
+		n.codec.Close()
+		return err
+	}
+	return nil
+}
+
 // Closed returns a channel that is closed when the RPC connection is closed.
 func (n *Notifier) Closed() <-chan interface{} {
 	return n.codec.Closed()
@@ -131,5 +161,6 @@ func (n *Notifier) activate(id ID, namespace string) {
 		sub.namespace = namespace
 		n.active[id] = sub
 		delete(n.inactive, id)
+		close(sub.activated)
 	}
 }
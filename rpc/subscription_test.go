@@ -19,6 +19,7 @@ package rpc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -50,6 +51,21 @@ func (s *NotificationTestService) Unsubscribe(subid string) {
 	s.mu.Unlock()
 }
 
+// FailingSubscription fails the subscription with the given message once the
+// client received its ID.
+func (s *NotificationTestService) FailingSubscription(ctx context.Context, msg string) (*Subscription, error) {
+	notifier, supported := NotifierFromContext(ctx)
+	if !supported {
+		return nil, ErrNotificationsUnsupported
+	}
+	subscription := notifier.CreateSubscription()
+	go func() {
+		<-subscription.Activated()
+		notifier.Fail(subscription.ID, errors.New(msg))
+	}()
+	return subscription, nil
+}
+
 func (s *NotificationTestService) SomeSubscription(ctx context.Context, n, val int) (*Subscription, error) {
 	notifier, supported := NotifierFromContext(ctx)
 	if !supported {
@@ -214,7 +230,7 @@ func waitForMessages(t *testing.T, in *json.Decoder, successes chan<- jsonSucces
 				notifications <- jsonNotification{
 					Version: msg["jsonrpc"].(string),
 					Method:  msg["method"].(string),
-					Params:  jsonSubscription{params["subscription"].(string), params["result"]},
+					Params:  jsonSubscription{Subscription: params["subscription"].(string), Result: params["result"]},
 				}
 				continue
 			}
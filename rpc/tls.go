@@ -0,0 +1,101 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+// TLSConfig configures the TLS termination of the HTTP and websocket endpoints.
+type TLSConfig struct {
+	CertFile string // PEM encoded certificate chain of the server
+	KeyFile  string // PEM encoded private key of the server
+
+	// ClientCAFile is a PEM encoded bundle of the certificate authorities client
+	// certificates are verified against. If set, clients must present a valid
+	// certificate (mutual TLS).
+	ClientCAFile string `toml:",omitempty"`
+}
+
+// TLSTerminator terminates TLS on the listeners of the HTTP and websocket
+// endpoints, with certificates which can be reloaded without restarting them.
+type TLSTerminator struct {
+	config TLSConfig
+
+	current *tls.Config // Configuration served to new connections
+	lock    sync.RWMutex
+}
+
+// NewTLSTerminator loads the certificates of the given configuration.
+func NewTLSTerminator(config *TLSConfig) (*TLSTerminator, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, errors.New("TLS requires both a certificate and a key file")
+	}
+	t := &TLSTerminator{config: *config}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload loads the certificates from their files again, used by the connections
+// established afterwards. On failure, the previous certificates remain in use.
+func (t *TLSTerminator) Reload() error {
+	cert, err := tls.LoadX509KeyPair(t.config.CertFile, t.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS key pair: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if t.config.ClientCAFile != "" {
+		blob, err := ioutil.ReadFile(t.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CAs: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(blob) {
+			return fmt.Errorf("no certificates found in %s", t.config.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	t.lock.Lock()
+	t.current = config
+	t.lock.Unlock()
+
+	return nil
+}
+
+// Listener wraps a listener to terminate TLS on its connections.
+func (t *TLSTerminator) Listener(listener net.Listener) net.Listener {
+	return tls.NewListener(listener, &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			t.lock.RLock()
+			defer t.lock.RUnlock()
+
+			return t.current, nil
+		},
+	})
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// testCert is a generated certificate along with its key.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pair tls.Certificate
+}
+
+// newTestCert generates a certificate for 127.0.0.1, signed by the given parent
+// or self-signed if it is nil.
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pair: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+	}
+}
+
+// write stores the certificate and key as PEM files in dir.
+func (c *testCert) write(t *testing.T, dir string, name string) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// Tests that HTTP and websocket RPC are served on the same TLS port, that client
+// certificates are verified and that certificates are reloaded.
+func TestTLSEndpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpc-tls-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		ca     = newTestCert(t, "ca", nil)
+		server = newTestCert(t, "server", ca)
+		client = newTestCert(t, "client", ca)
+		rogue  = newTestCert(t, "rogue", nil)
+	)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := server.write(t, dir, "server")
+
+	terminator, err := NewTLSTerminator(&TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	if err != nil {
+		t.Fatalf("failed to create TLS terminator: %v", err)
+	}
+	apis := []API{{Namespace: "test", Version: "1.0", Service: new(Service), Public: true}}
+	wsHandler, ws, err := NewWSHandler(apis, nil, []string{"*"}, false, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create websocket handler: %v", err)
+	}
+	defer wsHandler.Stop()
+
+	listener, httpHandler, err := StartHTTPEndpoint("127.0.0.1:0", apis, nil, nil, []string{"*"}, nil, nil, nil, ws, terminator)
+	if err != nil {
+		t.Fatalf("failed to start endpoint: %v", err)
+	}
+	defer httpHandler.Stop()
+	defer listener.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := func(cert *testCert) *tls.Config {
+		config := &tls.Config{RootCAs: roots}
+		if cert != nil {
+			config.Certificates = []tls.Certificate{cert.pair}
+		}
+		return config
+	}
+	dialHTTP := func(cert *testCert) (*Client, error) {
+		return DialHTTPWithClient("https://"+listener.Addr().String(), &http.Client{
+			Transport: &http.Transport{TLSClientConfig: config(cert)},
+		})
+	}
+	dialWS := func(cert *testCert) (*Client, error) {
+		wsConfig, err := websocket.NewConfig("wss://"+listener.Addr().String(), "https://localhost")
+		if err != nil {
+			return nil, err
+		}
+		wsConfig.TlsConfig = config(cert)
+		return newClient(context.Background(), func(ctx context.Context) (net.Conn, error) {
+			return wsDialContext(ctx, wsConfig)
+		})
+	}
+	echo := func(c *Client) error {
+		var result Result
+		return c.Call(&result, "test_echo", "hello", 10, &Args{"world"})
+	}
+	// Both HTTP and websocket clients with a valid certificate must be served
+	httpClient, err := dialHTTP(client)
+	if err != nil {
+		t.Fatalf("failed to dial HTTP: %v", err)
+	}
+	defer httpClient.Close()
+	if err := echo(httpClient); err != nil {
+		t.Errorf("HTTP call failed: %v", err)
+	}
+	wsClient, err := dialWS(client)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	defer wsClient.Close()
+	if err := echo(wsClient); err != nil {
+		t.Errorf("websocket call failed: %v", err)
+	}
+	// Clients without a certificate or with an unknown one must be rejected
+	for _, cert := range []*testCert{nil, rogue} {
+		if c, err := dialHTTP(cert); err == nil {
+			if err := echo(c); err == nil {
+				t.Errorf("HTTP call without valid client certificate succeeded")
+			}
+			c.Close()
+		}
+		if c, err := dialWS(cert); err == nil {
+			t.Errorf("websocket dial without valid client certificate succeeded")
+			c.Close()
+		}
+	}
+	// Replace the server certificate, new connections must use it once reloaded
+	renewed := newTestCert(t, "renewed", ca)
+	renewed.write(t, dir, "server")
+
+	served := func() string {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), config(client))
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	if name := served(); name != "server" {
+		t.Errorf("certificate mismatch before reload: have %s, want server", name)
+	}
+	if err := terminator.Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if name := served(); name != "renewed" {
+		t.Errorf("certificate mismatch after reload: have %s, want renewed", name)
+	}
+	if err := echo(wsClient); err != nil {
+		t.Errorf("websocket call failed after reload: %v", err)
+	}
+}
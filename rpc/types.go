@@ -57,6 +57,7 @@ type service struct {
 type serverRequest struct {
 	id            interface{}
 	svcname       string
+	method        string // Full name of the called method, used for authorization
 	callb         *callback
 	args          []reflect.Value
 	isUnsubscribe bool
@@ -70,6 +71,9 @@ type subscriptions map[string]*callback  // collection of subscription callbacks
 // Server represents a RPC server
 type Server struct {
 	services serviceRegistry
+	auth     *Authenticator // Authorizes the called methods, nil if disabled
+	limits   *Limits        // Resource limits of the clients, nil if disabled
+	limiter  *rateLimiter   // Request rate limiter of the clients, nil if disabled
 
 	run      int32
 	codecsMu sync.Mutex
@@ -92,6 +96,13 @@ type Error interface {
 	ErrorCode() int // returns the code
 }
 
+// DataError is an error returned by a method which carries additional data for
+// the caller, delivered in the data field of the JSON-RPC error.
+type DataError interface {
+	Error() string          // returns the message
+	ErrorData() interface{} // returns the error data
+}
+
 // ServerCodec implements reading, parsing and writing RPC messages for the server side of
 // a RPC session. Implementations must be go-routine safe since the codec can be called in
 // multiple go-routines concurrently.
@@ -108,6 +119,8 @@ type ServerCodec interface {
 	CreateErrorResponseWithInfo(id interface{}, err Error, info interface{}) interface{}
 	// Create notification response
 	CreateNotification(id, namespace string, event interface{}) interface{}
+	// Create notification terminating a subscription with an error
+	CreateErrorNotification(id, namespace string, err Error) interface{}
 	// Write msg to client.
 	Write(msg interface{}) error
 	// Close underlying data stream
@@ -0,0 +1,72 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package sink
+
+import (
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+)
+
+// DefaultConfig contains the default settings of the event sink, which is
+// disabled until a webhook or a file is configured.
+var DefaultConfig = Config{
+	Retries:       5,
+	RetryInterval: time.Second,
+	Timeout:       10 * time.Second,
+	QueueSize:     1024,
+}
+
+// Config are the settings of the event sink.
+type Config struct {
+	// Events to publish
+	Logs       []LogFilter `toml:",omitempty"` // Filters of the logs to publish, any matching one suffices
+	Heads      bool        // Whether to publish the new chain heads
+	PendingTxs bool        // Whether to publish the hashes of the new pending transactions
+
+	// Destinations of the events
+	Webhooks []Webhook `toml:",omitempty"` // HTTP endpoints the events are POSTed to
+	File     string    `toml:",omitempty"` // Append-only file of the events, or of the undeliverable ones with webhooks
+
+	// Delivery settings of the webhooks
+	Retries       int           // Number of retries of a failed delivery before dead-lettering it
+	RetryInterval time.Duration // Delay before the first retry, doubled for each subsequent one
+	Timeout       time.Duration // Timeout of a single delivery
+	QueueSize     int           // Number of events queued per webhook before dead-lettering new ones
+}
+
+// Enabled returns whether the configuration has any destination to publish
+// events to.
+func (c *Config) Enabled() bool {
+	return len(c.Webhooks) > 0 || c.File != ""
+}
+
+// LogFilter selects the logs to publish, with the semantics of the address and
+// topics fields of the eth_getLogs filter criteria.
+type LogFilter struct {
+	Addresses []common.Address `toml:",omitempty"`
+	Topics    [][]common.Hash  `toml:",omitempty"`
+}
+
+// Webhook is an HTTP endpoint events are POSTed to as JSON.
+type Webhook struct {
+	URL string
+
+	// Secret is the key the bodies are signed with using HMAC-SHA256, sent in the
+	// X-Themis-Signature header. Requests are not signed if empty.
+	Secret string `toml:",omitempty"`
+}
@@ -0,0 +1,269 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package sink implements a node service publishing chain events to HTTP
+// webhooks and to an append-only file.
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/themis-network/go-themis"
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/eth/filters"
+	"github.com/themis-network/go-themis/log"
+	"github.com/themis-network/go-themis/p2p"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// Types of the published events.
+const (
+	LogEvent       = "log"
+	HeadEvent      = "head"
+	PendingTxEvent = "pendingTransaction"
+)
+
+// recentLogs is the number of recently published logs remembered to publish the
+// logs matching several of the configured filters only once.
+const recentLogs = 4096
+
+// logKey identifies a published log. Logs removed by a reorg are published
+// separately from their addition.
+type logKey struct {
+	block   common.Hash
+	index   uint
+	removed bool
+}
+
+// Event is a published chain event, serialized as the JSON body of the webhook
+// requests and as a line of the file sink.
+type Event struct {
+	Type   string        `json:"type"`
+	Log    *types.Log    `json:"log,omitempty"`
+	Header *types.Header `json:"head,omitempty"`
+	TxHash *common.Hash  `json:"transactionHash,omitempty"`
+}
+
+// deadLetter is an event that could not be delivered to a webhook, written to
+// the file sink instead.
+type deadLetter struct {
+	Webhook string `json:"webhook"`
+	Error   string `json:"error"`
+	Event   *Event `json:"event"`
+}
+
+// Service is a node service publishing the chain events matching its
+// configuration to webhooks and to an append-only file.
+type Service struct {
+	config   *Config
+	backend  filters.Backend
+	light    bool
+	events   *filters.EventSystem
+	webhooks []*webhook
+	file     *fileSink
+
+	subs []*filters.Subscription
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates an event sink publishing the events of the given backend, which
+// is running in light mode if light is set.
+func New(config *Config, backend filters.Backend, light bool) (*Service, error) {
+	if !config.Enabled() {
+		return nil, errors.New("no webhook or file to publish events to")
+	}
+	for _, hook := range config.Webhooks {
+		if hook.URL == "" {
+			return nil, errors.New("webhook without URL")
+		}
+	}
+	return &Service{
+		config:  config,
+		backend: backend,
+		light:   light,
+	}, nil
+}
+
+// Protocols implements node.Service, returning the P2P network protocols used
+// by the event sink (nil as it doesn't use the devp2p overlay network).
+func (s *Service) Protocols() []p2p.Protocol { return nil }
+
+// APIs implements node.Service, returning the RPC API endpoints provided by the
+// event sink (nil as it doesn't provide any user callable APIs).
+func (s *Service) APIs() []rpc.API { return nil }
+
+// Start implements node.Service, subscribing to the configured events and
+// starting the delivery to the webhooks.
+func (s *Service) Start(server *p2p.Server) error {
+	if s.config.File != "" {
+		file, err := newFileSink(s.config.File)
+		if err != nil {
+			return err
+		}
+		s.file = file
+	}
+	s.quit = make(chan struct{})
+	for _, hook := range s.config.Webhooks {
+		w := newWebhook(hook, s.config, s.file)
+		s.webhooks = append(s.webhooks, w)
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			w.loop(s.quit)
+		}()
+	}
+	s.events = filters.NewEventSystem(s.backend.EventMux(), s.backend, s.light)
+
+	var (
+		logs    = make(chan []*types.Log)
+		heads   = make(chan *types.Header)
+		pending = make(chan []*types.Transaction)
+	)
+	for _, filter := range s.config.Logs {
+		sub, err := s.events.SubscribeLogs(ethereum.FilterQuery{Addresses: filter.Addresses, Topics: filter.Topics}, logs)
+		if err != nil {
+			s.Stop()
+			return err
+		}
+		s.subs = append(s.subs, sub)
+	}
+	if s.config.Heads {
+		s.subs = append(s.subs, s.events.SubscribeNewHeads(heads))
+	}
+	if s.config.PendingTxs {
+		s.subs = append(s.subs, s.events.SubscribePendingTxs(pending))
+	}
+	s.wg.Add(1)
+	go s.loop(logs, heads, pending)
+
+	log.Info("Started event sink", "webhooks", len(s.webhooks), "file", s.config.File)
+	return nil
+}
+
+// Stop implements node.Service, unsubscribing from the events and writing the
+// ones still queued for delivery to the file sink.
+func (s *Service) Stop() error {
+	for _, sub := range s.subs {
+		sub.Unsubscribe()
+	}
+	s.subs = nil
+
+	close(s.quit)
+	s.wg.Wait()
+
+	if s.file != nil {
+		s.file.close()
+	}
+	log.Info("Stopped event sink")
+	return nil
+}
+
+// loop publishes the events of the subscriptions until the service is stopped.
+func (s *Service) loop(logs chan []*types.Log, heads chan *types.Header, pending chan []*types.Transaction) {
+	defer s.wg.Done()
+
+	// Every log filter delivers its matches separately, drop the duplicates
+	published, _ := lru.New(recentLogs)
+	for {
+		select {
+		case batch := <-logs:
+			for _, log := range batch {
+				key := logKey{log.BlockHash, log.Index, log.Removed}
+				if published.Contains(key) {
+					continue
+				}
+				published.Add(key, struct{}{})
+				s.publish(&Event{Type: LogEvent, Log: log})
+			}
+		case head := <-heads:
+			s.publish(&Event{Type: HeadEvent, Header: head})
+
+		case txs := <-pending:
+			for _, tx := range txs {
+				hash := tx.Hash()
+				s.publish(&Event{Type: PendingTxEvent, TxHash: &hash})
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// publish queues an event for delivery to every webhook, or writes it to the
+// file sink if there are none.
+func (s *Service) publish(event *Event) {
+	if len(s.webhooks) == 0 {
+		s.file.write(event)
+		return
+	}
+	for _, w := range s.webhooks {
+		w.enqueue(event)
+	}
+}
+
+// fileSink is an append-only file of JSON encoded records, one per line.
+type fileSink struct {
+	path string
+	file *os.File
+	lock sync.Mutex
+}
+
+// newFileSink opens the file at the given path for appending, creating it if
+// it doesn't exist.
+func newFileSink(path string) (*fileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{path: path, file: file}, nil
+}
+
+// write appends a record to the file. Without a file sink, the record is only
+// logged.
+func (f *fileSink) write(record interface{}) {
+	if f == nil {
+		log.Warn("Dropped undeliverable event", "event", record)
+		return
+	}
+	blob, err := json.Marshal(record)
+	if err != nil {
+		log.Error("Failed to encode event", "err", err)
+		return
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, err := f.file.Write(append(blob, '\n')); err != nil {
+		log.Error("Failed to write event", "path", f.path, "err", err)
+	}
+}
+
+// close closes the file.
+func (f *fileSink) close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.file.Close(); err != nil {
+		log.Error("Failed to close event file", "path", f.path, "err", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/themis-network/go-themis/common"
+	"github.com/themis-network/go-themis/core"
+	"github.com/themis-network/go-themis/core/bloombits"
+	"github.com/themis-network/go-themis/core/types"
+	"github.com/themis-network/go-themis/ethdb"
+	"github.com/themis-network/go-themis/event"
+	"github.com/themis-network/go-themis/rpc"
+)
+
+// testBackend is a filters.Backend only feeding the events of the test.
+type testBackend struct {
+	mux       *event.TypeMux
+	txFeed    event.Feed
+	logsFeed  event.Feed
+	rmLogs    event.Feed
+	chainFeed event.Feed
+}
+
+func (b *testBackend) ChainDb() ethdb.Database  { return nil }
+func (b *testBackend) EventMux() *event.TypeMux { return b.mux }
+func (b *testBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
+	return nil, nil
+}
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return nil, nil
+}
+func (b *testBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
+	return nil, nil
+}
+func (b *testBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
+	return b.txFeed.Subscribe(ch)
+}
+func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
+	return b.chainFeed.Subscribe(ch)
+}
+func (b *testBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
+	return b.rmLogs.Subscribe(ch)
+}
+func (b *testBackend) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription {
+	return b.logsFeed.Subscribe(ch)
+}
+func (b *testBackend) BloomStatus() (uint64, uint64)                                        { return 0, 0 }
+func (b *testBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {}
+
+// readRecords waits until the file contains the given number of JSON records
+// and decodes them.
+func readRecords(t *testing.T, path string, count int) []map[string]interface{} {
+	for i := 0; i < 100; i++ {
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read file sink: %v", err)
+		}
+		var records []map[string]interface{}
+		scanner := bufio.NewScanner(bytes.NewReader(blob))
+		for scanner.Scan() {
+			var record map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+			}
+			records = append(records, record)
+		}
+		if len(records) >= count {
+			if len(records) > count {
+				t.Fatalf("record count mismatch: have %d, want %d", len(records), count)
+			}
+			return records
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d records", count)
+	return nil
+}
+
+// Tests that matching logs are POSTed signed to the webhooks, and that the ones
+// failing all retries are dead-lettered to the file sink.
+func TestWebhookDelivery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		secret    = []byte("secret")
+		addr      = common.HexToAddress("0x01")
+		delivered = make(chan *Event, 16)
+		attempts  = make(chan struct{}, 16)
+	)
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if sig := r.Header.Get(SignatureHeader); sig != "sha256="+Sign(secret, body) {
+			t.Errorf("signature mismatch: have %q", sig)
+		}
+		event := new(Event)
+		if err := json.Unmarshal(body, event); err != nil {
+			t.Errorf("invalid event %q: %v", body, err)
+		}
+		delivered <- event
+	}))
+	defer good.Close()
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts <- struct{}{}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+
+	config := DefaultConfig
+	config.Logs = []LogFilter{{Addresses: []common.Address{addr}}}
+	config.Webhooks = []Webhook{{URL: good.URL, Secret: string(secret)}, {URL: bad.URL}}
+	config.File = filepath.Join(dir, "events.jsonl")
+	config.Retries = 2
+	config.RetryInterval = time.Millisecond
+
+	backend := &testBackend{mux: new(event.TypeMux)}
+	sink, err := New(&config, backend, false)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	if err := sink.Start(nil); err != nil {
+		t.Fatalf("failed to start sink: %v", err)
+	}
+	defer sink.Stop()
+
+	backend.logsFeed.Send([]*types.Log{
+		{Address: common.HexToAddress("0x02"), Topics: []common.Hash{}, BlockNumber: 1},
+		{Address: addr, Topics: []common.Hash{}, BlockNumber: 1, Index: 1},
+	})
+	select {
+	case event := <-delivered:
+		if event.Type != LogEvent || event.Log == nil || event.Log.Index != 1 {
+			t.Errorf("delivered event mismatch: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for delivery")
+	}
+	records := readRecords(t, config.File, 1)
+	if records[0]["webhook"] != bad.URL {
+		t.Errorf("dead letter webhook mismatch: have %v, want %v", records[0]["webhook"], bad.URL)
+	}
+	if len(attempts) != config.Retries+1 {
+		t.Errorf("delivery attempts mismatch: have %d, want %d", len(attempts), config.Retries+1)
+	}
+	select {
+	case event := <-delivered:
+		t.Errorf("unexpected event delivered: %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Tests that without webhooks, the events are appended to the file sink.
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig
+	config.Heads = true
+	config.File = filepath.Join(dir, "events.jsonl")
+
+	backend := &testBackend{mux: new(event.TypeMux)}
+	sink, err := New(&config, backend, false)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	if err := sink.Start(nil); err != nil {
+		t.Fatalf("failed to start sink: %v", err)
+	}
+	defer sink.Stop()
+
+	for i := 0; i < 2; i++ {
+		block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i))})
+		backend.chainFeed.Send(core.ChainEvent{Block: block, Hash: block.Hash()})
+	}
+	records := readRecords(t, config.File, 2)
+	for i, record := range records {
+		if record["type"] != HeadEvent {
+			t.Errorf("record %d: type mismatch: have %v, want %v", i, record["type"], HeadEvent)
+		}
+	}
+}
+
+// Tests that logs matching several filters are published once.
+func TestOverlappingFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		addr  = common.HexToAddress("0x01")
+		topic = common.HexToHash("0x02")
+		block = common.HexToHash("0x03")
+	)
+	config := DefaultConfig
+	config.Logs = []LogFilter{{Addresses: []common.Address{addr}}, {Topics: [][]common.Hash{{topic}}}}
+	config.File = filepath.Join(dir, "events.jsonl")
+
+	backend := &testBackend{mux: new(event.TypeMux)}
+	sink, err := New(&config, backend, false)
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+	if err := sink.Start(nil); err != nil {
+		t.Fatalf("failed to start sink: %v", err)
+	}
+	defer sink.Stop()
+
+	backend.logsFeed.Send([]*types.Log{
+		{Address: addr, Topics: []common.Hash{topic}, BlockHash: block, Index: 0},
+		{Address: addr, Topics: []common.Hash{}, BlockHash: block, Index: 1},
+	})
+	backend.logsFeed.Send([]*types.Log{{Address: addr, Topics: []common.Hash{topic}, BlockHash: block, Index: 0, Removed: true}})
+
+	readRecords(t, config.File, 3)
+	time.Sleep(50 * time.Millisecond)
+	have := make(map[string]bool)
+	for _, record := range readRecords(t, config.File, 3) {
+		log := record["log"].(map[string]interface{})
+		have[fmt.Sprintf("%v/%v", log["logIndex"], log["removed"])] = true
+	}
+	for _, want := range []string{"0x0/false", "0x1/false", "0x0/true"} {
+		if !have[want] {
+			t.Errorf("log %s not published, have %v", want, have)
+		}
+	}
+}
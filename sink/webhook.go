@@ -0,0 +1,166 @@
+// Copyright 2018 The go-themis Authors
+// This file is part of the go-themis library.
+//
+// The go-themis library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-themis library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-themis library. If not, see <http://www.gnu.org/licenses/>.
+
+package sink
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/themis-network/go-themis/log"
+)
+
+// SignatureHeader is the header of the webhook requests carrying the hex encoded
+// HMAC-SHA256 of the body, prefixed with "sha256=".
+const SignatureHeader = "X-Themis-Signature"
+
+var (
+	errQueueFull = errors.New("delivery queue full")
+	errStopped   = errors.New("event sink stopped")
+)
+
+// webhook delivers the queued events to an HTTP endpoint, retrying the failed
+// deliveries and dead-lettering the ones failing all retries.
+type webhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+
+	retries  int
+	interval time.Duration
+
+	queue chan *Event
+	dead  *fileSink
+}
+
+// newWebhook creates a webhook dead-lettering to the given file sink, if any.
+func newWebhook(hook Webhook, config *Config, dead *fileSink) *webhook {
+	w := &webhook{
+		url:      hook.URL,
+		client:   &http.Client{Timeout: config.Timeout},
+		retries:  config.Retries,
+		interval: config.RetryInterval,
+		queue:    make(chan *Event, config.QueueSize),
+		dead:     dead,
+	}
+	if hook.Secret != "" {
+		w.secret = []byte(hook.Secret)
+	}
+	return w
+}
+
+// enqueue queues an event for delivery, dead-lettering it if the queue is full
+// so a slow endpoint doesn't hold up the event system.
+func (w *webhook) enqueue(event *Event) {
+	select {
+	case w.queue <- event:
+	default:
+		w.deadLetter(event, errQueueFull)
+	}
+}
+
+// loop delivers the queued events until quit is closed, dead-lettering the
+// remaining ones afterwards.
+func (w *webhook) loop(quit chan struct{}) {
+	for {
+		select {
+		case event := <-w.queue:
+			if err := w.deliver(event, quit); err != nil {
+				w.deadLetter(event, err)
+			}
+		case <-quit:
+			for {
+				select {
+				case event := <-w.queue:
+					w.deadLetter(event, errStopped)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver POSTs an event to the endpoint, retrying with an exponential backoff
+// until it succeeds, the retries are exhausted or quit is closed.
+func (w *webhook) deliver(event *Event, quit chan struct{}) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	delay := w.interval
+	for attempt := 0; ; attempt++ {
+		if err = w.post(body); err == nil {
+			return nil
+		}
+		if attempt >= w.retries {
+			return err
+		}
+		log.Debug("Failed to deliver event, retrying", "url", w.url, "attempt", attempt+1, "err", err)
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-quit:
+			return errStopped
+		}
+	}
+}
+
+// post sends a single request to the endpoint, failing on non-2xx responses.
+func (w *webhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != nil {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.secret, body))
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// deadLetter writes an undeliverable event to the file sink.
+func (w *webhook) deadLetter(event *Event, err error) {
+	log.Warn("Dead-lettering undeliverable event", "url", w.url, "type", event.Type, "err", err)
+	w.dead.write(&deadLetter{Webhook: w.url, Error: err.Error(), Event: event})
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of a webhook request body, allowing
+// receivers to authenticate the requests.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -128,6 +128,174 @@ func VerifyProof(rootHash common.Hash, key []byte, proofDb DatabaseReader) (valu
 	}
 }
 
+// VerifyEmptyRange checks merkle proofs of the first and last key of a range of
+// equally long keys. The given proof must contain the nodes on the paths to both
+// keys in a trie with the given root hash, showing that the trie contains no key
+// within the range. VerifyEmptyRange returns an error if the proof is incomplete,
+// contains invalid trie nodes or the range isn't empty.
+func VerifyEmptyRange(rootHash common.Hash, first, last []byte, proofDb DatabaseReader) error {
+	if len(first) != len(last) || bytes.Compare(first, last) > 0 {
+		return fmt.Errorf("invalid range %x-%x", first, last)
+	}
+	firstHex, lastHex := keybytesToHex(first), keybytesToHex(last)
+	return verifyEmptyRange(hashNode(rootHash[:]), nil, firstHex[:len(firstHex)-1], lastHex[:len(lastHex)-1], proofDb)
+}
+
+// verifyEmptyRange checks that the subtrie at the given path holds no key within
+// the range, resolving from the proof the nodes it can't decide on otherwise.
+func verifyEmptyRange(tn node, path, first, last []byte, proofDb DatabaseReader) error {
+	if _, ok := tn.(valueNode); ok {
+		if bytes.Compare(path, first) >= 0 && bytes.Compare(path, last) <= 0 {
+			return fmt.Errorf("key %x within range", hexToKeybytes(path))
+		}
+		return nil
+	}
+	// Skip the subtries outside of the range and reject the ones within it
+	lo, hi := comparePrefix(path, first), comparePrefix(path, last)
+	if tn == nil || lo < 0 || hi > 0 {
+		return nil
+	}
+	if lo > 0 && hi < 0 {
+		return fmt.Errorf("keys with prefix %x within range", path)
+	}
+	// The subtrie is on the path of a boundary, descend into it
+	switch n := tn.(type) {
+	case hashNode:
+		buf, _ := proofDb.Get(n)
+		if buf == nil {
+			return fmt.Errorf("proof node (hash %064x) missing", []byte(n))
+		}
+		dec, err := decodeNode(n, buf, 0)
+		if err != nil {
+			return fmt.Errorf("bad proof node: %v", err)
+		}
+		return verifyEmptyRange(dec, path, first, last, proofDb)
+	case *shortNode:
+		key := n.Key
+		if hasTerm(key) {
+			key = key[:len(key)-1]
+		}
+		return verifyEmptyRange(n.Val, append(append([]byte{}, path...), key...), first, last, proofDb)
+	case *fullNode:
+		for i, child := range n.Children[:16] {
+			if err := verifyEmptyRange(child, append(append([]byte{}, path...), byte(i)), first, last, proofDb); err != nil {
+				return err
+			}
+		}
+		return verifyEmptyRange(n.Children[16], path, first, last, proofDb)
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
+	}
+}
+
+// VerifyRangeProof checks that the given sorted keys and values are all entries
+// of a trie with the given root hash from first up to the last key, using the
+// merkle proofs of first and the last key in proofDb. The keys must be as long
+// as first. VerifyRangeProof returns an error if the proof is incomplete,
+// contains invalid trie nodes, or the trie holds other entries within the range.
+func VerifyRangeProof(rootHash common.Hash, first []byte, keys, values [][]byte, proofDb DatabaseReader) error {
+	if len(keys) == 0 || len(keys) != len(values) {
+		return fmt.Errorf("invalid range of %d keys and %d values", len(keys), len(values))
+	}
+	for i, key := range keys {
+		if len(key) != len(first) || bytes.Compare(key, first) < 0 {
+			return fmt.Errorf("key %x out of range", key)
+		}
+		if i > 0 && bytes.Compare(key, keys[i-1]) <= 0 {
+			return fmt.Errorf("key %x out of order", key)
+		}
+		if len(values[i]) == 0 {
+			return fmt.Errorf("empty value of key %x", key)
+		}
+	}
+	// Rebuild the trie without the entries of the range, then insert the given
+	// ones. The root hash only matches if they are all entries of the range.
+	last := keys[len(keys)-1]
+	firstHex, lastHex := keybytesToHex(first), keybytesToHex(last)
+	root, err := unsetRange(hashNode(rootHash[:]), nil, firstHex[:len(firstHex)-1], lastHex[:len(lastHex)-1], proofDb)
+	if err != nil {
+		return err
+	}
+	tr := &Trie{root: root, db: NewDatabase(ethdb.NewMemDatabase())}
+	for i, key := range keys {
+		if err := tr.TryUpdate(key, values[i]); err != nil {
+			return fmt.Errorf("key %x outside of proof: %v", key, err)
+		}
+	}
+	if hash := tr.Hash(); hash != rootHash {
+		return fmt.Errorf("range root mismatch: have %x, want %x", hash, rootHash)
+	}
+	return nil
+}
+
+// unsetRange returns the subtrie at the given path without the keys within the
+// range, resolving from the proof the nodes on the paths of the boundaries.
+func unsetRange(tn node, path, first, last []byte, proofDb DatabaseReader) (node, error) {
+	if _, ok := tn.(valueNode); ok {
+		if bytes.Compare(path, first) >= 0 && bytes.Compare(path, last) <= 0 {
+			return nil, nil
+		}
+		return tn, nil
+	}
+	// Keep the subtries outside of the range and drop the ones within it
+	lo, hi := comparePrefix(path, first), comparePrefix(path, last)
+	if tn == nil || lo < 0 || hi > 0 {
+		return tn, nil
+	}
+	if lo > 0 && hi < 0 {
+		return nil, nil
+	}
+	// The subtrie is on the path of a boundary, descend into it
+	switch n := tn.(type) {
+	case hashNode:
+		buf, _ := proofDb.Get(n)
+		if buf == nil {
+			return nil, fmt.Errorf("proof node (hash %064x) missing", []byte(n))
+		}
+		dec, err := decodeNode(n, buf, 0)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node: %v", err)
+		}
+		return unsetRange(dec, path, first, last, proofDb)
+	case *shortNode:
+		key := n.Key
+		if hasTerm(key) {
+			key = key[:len(key)-1]
+		}
+		child, err := unsetRange(n.Val, append(append([]byte{}, path...), key...), first, last, proofDb)
+		if err != nil || child == nil {
+			return nil, err
+		}
+		return &shortNode{Key: n.Key, Val: child, flags: nodeFlag{dirty: true}}, nil
+	case *fullNode:
+		cpy := n.copy()
+		cpy.flags = nodeFlag{dirty: true}
+		for i, child := range n.Children[:16] {
+			child, err := unsetRange(child, append(append([]byte{}, path...), byte(i)), first, last, proofDb)
+			if err != nil {
+				return nil, err
+			}
+			cpy.Children[i] = child
+		}
+		child, err := unsetRange(n.Children[16], path, first, last, proofDb)
+		if err != nil {
+			return nil, err
+		}
+		cpy.Children[16] = child
+		return cpy, nil
+	default:
+		panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
+	}
+}
+
+// comparePrefix compares a path with the same length prefix of a key.
+func comparePrefix(path, key []byte) int {
+	if len(key) > len(path) {
+		key = key[:len(path)]
+	}
+	return bytes.Compare(path, key)
+}
+
 func get(tn node, key []byte) ([]byte, node) {
 	for {
 		switch n := tn.(type) {
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	mrand "math/rand"
+	"sort"
 	"testing"
 	"time"
 
@@ -216,3 +217,122 @@ func randBytes(n int) []byte {
 	crand.Read(r)
 	return r
 }
+
+func TestEmptyRangeProof(t *testing.T) {
+	trie, vals := randomTrie(500)
+	root := trie.Hash()
+
+	keys := make([][]byte, 0, len(vals))
+	for _, kv := range vals {
+		keys = append(keys, kv.k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	prove := func(first, last []byte) *ethdb.MemDatabase {
+		proof := ethdb.NewMemDatabase()
+		trie.Prove(first, 0, proof)
+		trie.Prove(last, 0, proof)
+		return proof
+	}
+	for i := 1; i < len(keys); i++ {
+		// The gap between two neighbouring keys must be proven empty
+		first, last := increaseKey(common.CopyBytes(keys[i-1])), decreaseKey(common.CopyBytes(keys[i]))
+		if bytes.Compare(first, last) > 0 {
+			continue
+		}
+		if err := VerifyEmptyRange(root, first, last, prove(first, last)); err != nil {
+			t.Fatalf("gap %x-%x: failed to verify empty range: %v", first, last, err)
+		}
+		// Ranges containing a key must be rejected
+		if err := VerifyEmptyRange(root, first, keys[i], prove(first, keys[i])); err == nil {
+			t.Fatalf("range %x-%x containing %x proven empty", first, keys[i], keys[i])
+		}
+		if err := VerifyEmptyRange(root, keys[i-1], last, prove(keys[i-1], last)); err == nil {
+			t.Fatalf("range %x-%x containing %x proven empty", keys[i-1], last, keys[i-1])
+		}
+	}
+	// A range spanning many keys must be rejected, even if only its origin is proven
+	first, last := increaseKey(common.CopyBytes(keys[0])), keys[len(keys)-1]
+	proof := ethdb.NewMemDatabase()
+	trie.Prove(first, 0, proof)
+	if err := VerifyEmptyRange(root, first, last, proof); err == nil {
+		t.Fatal("range over all keys proven empty by the origin proof")
+	}
+}
+
+func TestRangeProof(t *testing.T) {
+	trie, vals := randomTrie(500)
+	root := trie.Hash()
+
+	keys := make([][]byte, 0, len(vals))
+	for _, kv := range vals {
+		keys = append(keys, kv.k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = vals[string(key)].v
+	}
+	prove := func(first, last []byte) *ethdb.MemDatabase {
+		proof := ethdb.NewMemDatabase()
+		trie.Prove(first, 0, proof)
+		trie.Prove(last, 0, proof)
+		return proof
+	}
+	for i := 0; i < 100; i++ {
+		start := mrand.Intn(len(keys))
+		end := start + 1 + mrand.Intn(len(keys)-start)
+
+		// The range must be proven from its first key and from an origin before it
+		first := keys[start]
+		if err := VerifyRangeProof(root, first, keys[start:end], values[start:end], prove(first, keys[end-1])); err != nil {
+			t.Fatalf("range %d-%d: failed to verify: %v", start, end, err)
+		}
+		if start > 0 {
+			first = increaseKey(common.CopyBytes(keys[start-1]))
+			if err := VerifyRangeProof(root, first, keys[start:end], values[start:end], prove(first, keys[end-1])); err != nil {
+				t.Fatalf("range %d-%d from origin %x: failed to verify: %v", start, end, first, err)
+			}
+			// Omitting the first key behind the origin must be detected
+			if err := VerifyRangeProof(root, keys[start-1], keys[start:end], values[start:end], prove(keys[start-1], keys[end-1])); err == nil {
+				t.Fatalf("range %d-%d without its first key accepted", start-1, end)
+			}
+		}
+		// Omitting or modifying an entry within the range must be detected
+		if end-start > 2 {
+			omit := start + 1 + mrand.Intn(end-start-2)
+			k := append(append([][]byte{}, keys[start:omit]...), keys[omit+1:end]...)
+			v := append(append([][]byte{}, values[start:omit]...), values[omit+1:end]...)
+			if err := VerifyRangeProof(root, keys[start], k, v, prove(keys[start], keys[end-1])); err == nil {
+				t.Fatalf("range %d-%d without key %d accepted", start, end, omit)
+			}
+			v = append([][]byte{}, values[start:end]...)
+			v[omit-start] = []byte("modified")
+			if err := VerifyRangeProof(root, keys[start], keys[start:end], v, prove(keys[start], keys[end-1])); err == nil {
+				t.Fatalf("range %d-%d with modified key %d accepted", start, end, omit)
+			}
+		}
+	}
+}
+
+// increaseKey returns the key following the given one, modifying it in place.
+func increaseKey(key []byte) []byte {
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]++
+		if key[i] != 0x0 {
+			break
+		}
+	}
+	return key
+}
+
+// decreaseKey returns the key preceding the given one, modifying it in place.
+func decreaseKey(key []byte) []byte {
+	for i := len(key) - 1; i >= 0; i-- {
+		key[i]--
+		if key[i] != 0xff {
+			break
+		}
+	}
+	return key
+}